@@ -3,13 +3,14 @@ package main
 import (
 	"fmt"
 	"gohole/config"
+	"gohole/internal/blocklist"
 	"gohole/internal/controller/dns"
 	"gohole/internal/controller/http"
 	"gohole/internal/database"
 	"gohole/internal/filter"
 	"gohole/internal/query"
-
-	dns2 "codeberg.org/miekg/dns"
+	"gohole/internal/source"
+	"log/slog"
 )
 
 type Daemon interface {
@@ -26,22 +27,29 @@ type DaemonRegistry struct {
 }
 
 func NewDaemonRegistry(
-	blockedDomains []string,
-	allowedDomains []string,
-	filterStrategy filter.Strategy,
+	loader *blocklist.Loader,
+	lists blocklist.Lists,
 	db database.Manager,
 	cfg *config.Config,
 ) (*DaemonRegistry, error) {
-	blockFilter := filter.NewFilter(filterStrategy, blockedDomains)
-	allowFilter := filter.NewFilter(filterStrategy, allowedDomains)
+	filterStrategy := cfg.Blocking.FilterStrategy
+	blockFilter, allowFilter := blocklist.BuildFilters(filterStrategy, lists.Block, lists.Allow)
 
 	repo := db.Repository()
 
 	queryService := query.NewService(blockFilter, allowFilter, repo)
 
-	dnsCache := dns.NewCache()
+	cacheOpts, err := cfg.DNS.CacheOptions()
+	if err != nil {
+		return nil, err
+	}
+	dnsCache := dns.NewCache(cacheOpts)
 
-	dnsClient := dns2.NewClient()
+	// The client is shared, so are the connections to the encrypted upstreams
+	dnsClient, err := dns.NewClient(&cfg.DNS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DNS client: %w", err)
+	}
 
 	tcpHandler, err := dns.NewHandler(queryService, dns.TCP, dnsCache, &cfg.DNS, dnsClient)
 	if err != nil {
@@ -53,12 +61,70 @@ func NewDaemonRegistry(
 		return nil, fmt.Errorf("failed to create UDP DNS handler: %w", err)
 	}
 
+	refreshInterval, err := cfg.Blocking.Refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	// The refresher always runs, as changing the sources triggers a refresh
+	refresher := blocklist.NewRefresher(
+		loader,
+		refreshInterval,
+		filterStrategy,
+		func(blockFilter, allowFilter filter.Filter) {
+			queryService.SetFilters(blockFilter, allowFilter)
+			// The cached answers were filtered by the former lists
+			flushed := dnsCache.FlushFiltered()
+			slog.Debug("Flushed the cache after the filters changed", "entries", flushed)
+		},
+	)
+
+	sourceService := source.NewService(db.SourceRepository(), loader, refresher.Trigger)
+
 	queryRouter := http.NewQueryRouter(queryService)
+	sourceRouter := http.NewSourceRouter(sourceService)
+	// Both handlers share their configuration and cache, either can explain queries
+	explainRouter := http.NewExplainRouter(udpHandler)
+	cacheRouter := http.NewCacheRouter(dnsCache)
+	// DNS-over-HTTPS queries may be large, they are forwarded like TCP ones
+	dohRouter := http.NewDoHRouter(tcpHandler.Chain(dns.DoH))
 
 	daemons := []Daemon{
-		http.NewServer(&cfg.HTTP, queryRouter),
+		http.NewServer(
+			&cfg.HTTP,
+			queryRouter,
+			sourceRouter,
+			explainRouter,
+			cacheRouter,
+			dohRouter,
+		),
 		dns.NewServer(&cfg.DNS, tcpHandler),
 		dns.NewServer(&cfg.DNS, udpHandler),
+		dns.NewCacheSweeper(dnsCache),
+		refresher,
+	}
+
+	for _, job := range db.Jobs() {
+		daemons = append(daemons, job)
+	}
+
+	if cfg.DNS.CacheEnabled.Or(false) {
+		persister, err := dns.NewCachePersister(&cfg.DNS, dnsCache, udpHandler)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create DNS cache persister: %w", err)
+		}
+		if persister != nil {
+			daemons = append(daemons, persister)
+		}
+	}
+
+	if cfg.DNS.TLSAddress.Ok {
+		// Like the DNS-over-HTTPS ones, DNS-over-TLS queries are forwarded over TCP
+		tlsServer, err := dns.NewTLSServer(&cfg.DNS, tcpHandler)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create DNS-over-TLS server: %w", err)
+		}
+		daemons = append(daemons, tlsServer)
 	}
 
 	return &DaemonRegistry{
@@ -8,6 +8,7 @@ import (
 	"gohole/internal/database"
 	"gohole/internal/database/clickhouse"
 	"gohole/internal/database/pg"
+	"gohole/internal/source"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -30,7 +31,9 @@ func initLogger(cfg *config.Config) {
 	slog.SetDefault(slog.New(handler))
 }
 
-func initDatabase(ctx context.Context, cfg *config.Config) (database.Manager, error) {
+// connectDatabase connects to the database configured in cfg, without
+// initializing it.
+func connectDatabase(ctx context.Context, cfg *config.Config) (database.Manager, error) {
 	var dbManager database.Manager
 
 	switch cfg.DB.Type {
@@ -39,7 +42,6 @@ func initDatabase(ctx context.Context, cfg *config.Config) (database.Manager, er
 	case database.TypePostgres:
 		dbManager = pg.NewManager(&cfg.DB)
 	case database.TypeNone:
-		slog.Info("Database storage is disabled (type: none)")
 		return database.NewNoOpManager(), nil
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", cfg.DB.Type)
@@ -51,6 +53,21 @@ func initDatabase(ctx context.Context, cfg *config.Config) (database.Manager, er
 
 	slog.Info("Connected to DB")
 
+	return dbManager, nil
+}
+
+func initDatabase(ctx context.Context, cfg *config.Config) (database.Manager, error) {
+	if cfg.DB.Type == database.TypeNone {
+		slog.Info("Database storage is disabled (type: none)")
+		return database.NewNoOpManager(), nil
+	}
+
+	dbManager, err := connectDatabase(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initializing the database applies the pending migrations
 	if err := dbManager.Init(ctx); err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
@@ -61,6 +78,14 @@ func initDatabase(ctx context.Context, cfg *config.Config) (database.Manager, er
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	fmt.Println("=========")
 	fmt.Println(" GOHOLE! ")
 	fmt.Println("=========")
@@ -90,28 +115,18 @@ func main() {
 		logPanic(err)
 	}
 
-	domains, err := blocklist.LoadRemote(cfg.Blocking.BlocklistFile)
+	loader, err := blocklist.NewLoader(&cfg.Blocking)
 	if err != nil {
 		logPanic(err)
 	}
+	loader.SetSourceProvider(source.EnabledURLs(db.SourceRepository()))
 
-	if cfg.Blocking.LocalBlockList.Ok {
-		localDomains, err := blocklist.LoadLocalFile(cfg.Blocking.LocalBlockList.Value)
-		if err != nil {
-			logPanic(err)
-		}
-		domains = append(domains, localDomains...)
-	}
-
-	var allowDomains []string
-	if cfg.Blocking.LocalAllowList.Ok {
-		allowDomains, err = blocklist.LoadLocalFile(cfg.Blocking.LocalAllowList.Value)
-		if err != nil {
-			logPanic(err)
-		}
+	lists, _, err := loader.Load()
+	if err != nil {
+		logPanic(err)
 	}
 
-	reg, err := NewDaemonRegistry(domains, allowDomains, cfg.Blocking.FilterStrategy, db, cfg)
+	reg, err := NewDaemonRegistry(loader, lists, db, cfg)
 	if err != nil {
 		logPanic(err)
 	}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gohole/config"
+	"gohole/internal/database"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = "usage: gohole migrate status [config path]"
+
+// migrate runs the migrate command. Its only subcommand, status, lists the
+// schema migrations and tells which ones are pending. They are applied when
+// gohole starts.
+func migrate(args []string) error {
+	if len(args) == 0 || args[0] != "status" || len(args) > 2 {
+		return errors.New(migrateUsage)
+	}
+
+	configPath := defaultConfigPath
+	if len(args) > 1 {
+		configPath = args[1]
+	}
+
+	cfg, err := config.New(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if cfg.DB.Type == database.TypeNone {
+		fmt.Println("Database storage is disabled (type: none), there is no migration")
+		return nil
+	}
+
+	ctx := context.Background()
+
+	db, err := connectDatabase(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	statuses, err := db.MigrationStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch the migrations: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+
+	pending := 0
+	for _, s := range statuses {
+		appliedAt := "pending"
+		if s.Pending() {
+			pending++
+		} else {
+			appliedAt = s.AppliedAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d of %d migrations pending\n", pending, len(statuses))
+
+	return nil
+}
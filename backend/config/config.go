@@ -2,10 +2,10 @@ package config
 
 import (
 	"fmt"
+	"gohole/internal/blocklist"
 	"gohole/internal/controller/dns"
 	"gohole/internal/controller/http"
 	"gohole/internal/database"
-	"gohole/internal/filter"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/specialfish9/confuso/v2"
@@ -17,16 +17,7 @@ type Config struct {
 		LogLevel LogLevel `confuso:"log_level" validate:"required"`
 	} `confuso:"app"`
 
-	Blocking struct {
-		// FilterStrategy is the strategy used to filter domains (e.g., "basic", "trie2").
-		FilterStrategy filter.Strategy `confuso:"filter_strategy" validate:"required,oneof=basic trie trie2"`
-		// BlocklistFile is the path to the file containing the list of blocklists URLs.
-		BlocklistFile string `confuso:"blocklist_file" validate:"required"`
-		// LocalBlockList is the path to a local file containing a list of domains to block.
-		LocalBlockList confuso.Optional[string] `confuso:"local_blocklist"`
-		// LocalAllowList is the path to a local file containing a list of domains to allow.
-		LocalAllowList confuso.Optional[string] `confuso:"local_allowlist"`
-	} `confuso:"blocking"`
+	Blocking blocklist.Config `confuso:"blocking"`
 
 	HTTP http.Config `confuso:"http"`
 
@@ -47,5 +38,9 @@ func New(fileName string) (*Config, error) {
 		return nil, fmt.Errorf("config: validating config: %w", err)
 	}
 
+	if err := config.Blocking.Validate(); err != nil {
+		return nil, fmt.Errorf("config: validating config: %w", err)
+	}
+
 	return &config, nil
 }
@@ -0,0 +1,195 @@
+package blocklist
+
+import (
+	"errors"
+	"fmt"
+	"gohole/internal/filter"
+	"strings"
+
+	"codeberg.org/miekg/dns"
+)
+
+// This file implements the DNS subset of the adblock syntax, as used by lists
+// such as the AdGuard DNS filter or OISD:
+//
+//	||example.com^                       blocks example.com and its subdomains
+//	|example.com^                        blocks example.com only
+//	@@||example.com^                     exception, allows example.com and its subdomains
+//	@@||example.com^$important           exception overriding the important rules too
+//	/^ads?[0-9]*\./$important            regex rule with modifiers
+//	||example.com^$client=192.168.1.0/24 rule restricted to some clients
+//	||example.com^$dnstype=AAAA|~A       rule restricted to some question types
+//
+// Rules with other modifiers are rejected, since ignoring them would change
+// their meaning.
+
+// isAdblockComment returns true if the line is an adblock comment (e.g. "! Title")
+// or a list header (e.g. "[Adblock Plus 2.0]").
+func isAdblockComment(line string) bool {
+	return strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[")
+}
+
+// isAdblockRule returns true if the line uses the adblock syntax.
+func isAdblockRule(line string) bool {
+	if strings.HasPrefix(line, "@@") || strings.HasPrefix(line, "|") {
+		return true
+	}
+
+	if strings.HasPrefix(line, "/") {
+		// Regex rules only use the adblock syntax when they have modifiers
+		return strings.Contains(line, "/$")
+	}
+
+	return strings.Contains(line, "^")
+}
+
+// addAdblockRule parses an adblock rule and adds it to the list, or to its
+// exceptions for "@@" rules.
+func (l *List) addAdblockRule(line string) error {
+	pattern, exception := strings.CutPrefix(line, "@@")
+
+	pattern, mods, err := splitModifiers(pattern)
+	if err != nil {
+		return err
+	}
+
+	modifiers, err := parseModifiers(mods)
+	if err != nil {
+		return err
+	}
+
+	target := l
+	if exception {
+		target = l.exceptions()
+	}
+
+	if isRegexRule(pattern) {
+		rule, err := filter.NewRegexRule(line, pattern[1:len(pattern)-1])
+		if err != nil {
+			return err
+		}
+		rule.Modifiers = modifiers
+		target.Rules = append(target.Rules, rule)
+		return nil
+	}
+
+	// "|example.com^" matches the domain only, while "||example.com^" (and the
+	// bare "example.com^") match its subdomains as well.
+	exact := !strings.HasPrefix(pattern, "||") && strings.HasPrefix(pattern, "|")
+	domain := strings.TrimLeft(pattern, "|")
+	domain = strings.TrimRight(domain, "^|")
+
+	if domain == "" || strings.ContainsAny(domain, "/^|$ ") {
+		return fmt.Errorf("unsupported pattern '%s'", pattern)
+	}
+
+	if !strings.Contains(domain, "*") {
+		domain, err = normalizeDomain(domain)
+		if err != nil {
+			return err
+		}
+	}
+
+	var rule filter.Rule
+	switch {
+	case strings.Contains(domain, "*"):
+		domain = strings.ToLower(domain)
+		expr := wildcardToRegex(domain)
+		if !exact {
+			// Match the subdomains as well
+			expr = `^(.*\.)?` + strings.TrimPrefix(expr, "^")
+		}
+		rule, err = filter.NewRegexRule(line, expr)
+		if err != nil {
+			return err
+		}
+	case !hasModifiers(modifiers) && !exact:
+		// Plain domain rules take the fast path
+		target.Suffixes = append(target.Suffixes, domain)
+		return nil
+	default:
+		rule = filter.NewDomainRule(line, domain, !exact)
+	}
+
+	rule.Modifiers = modifiers
+	target.Rules = append(target.Rules, rule)
+
+	return nil
+}
+
+// splitModifiers splits a rule into its pattern and its modifiers, i.e. what
+// follows the "$" sign.
+func splitModifiers(rule string) (string, string, error) {
+	if strings.HasPrefix(rule, "/") {
+		// The regex itself may contain a "$", so only look after its closing slash
+		end := strings.LastIndex(rule, "/")
+		if end == 0 {
+			return "", "", errors.New("unterminated regex")
+		}
+
+		mods := rule[end+1:]
+		if mods != "" && !strings.HasPrefix(mods, "$") {
+			return "", "", fmt.Errorf("unexpected '%s' after regex", mods)
+		}
+
+		return rule[:end+1], strings.TrimPrefix(mods, "$"), nil
+	}
+
+	pattern, mods, _ := strings.Cut(rule, "$")
+	return pattern, mods, nil
+}
+
+// hasModifiers returns true if any modifier is set.
+func hasModifiers(m filter.Modifiers) bool {
+	return m.Important ||
+		len(m.Clients) > 0 || len(m.ExcludedClients) > 0 ||
+		len(m.DNSTypes) > 0 || len(m.ExcludedDNSTypes) > 0
+}
+
+// parseModifiers parses a comma separated list of modifiers, e.g.
+// "important,client=192.168.1.5|~192.168.1.6,dnstype=AAAA".
+func parseModifiers(s string) (filter.Modifiers, error) {
+	var m filter.Modifiers
+	if s == "" {
+		return m, nil
+	}
+
+	for mod := range strings.SplitSeq(s, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(mod), "=")
+
+		switch name {
+		case "important":
+			m.Important = true
+		case "client":
+			for v := range strings.SplitSeq(value, "|") {
+				v, excluded := strings.CutPrefix(strings.TrimSpace(v), "~")
+				v = strings.Trim(v, `'"`)
+				if v == "" {
+					return m, errors.New("empty client modifier")
+				}
+				if excluded {
+					m.ExcludedClients = append(m.ExcludedClients, v)
+				} else {
+					m.Clients = append(m.Clients, v)
+				}
+			}
+		case "dnstype":
+			for v := range strings.SplitSeq(value, "|") {
+				v, excluded := strings.CutPrefix(strings.TrimSpace(v), "~")
+				t, ok := dns.StringToType[strings.ToUpper(v)]
+				if !ok {
+					return m, fmt.Errorf("unknown DNS type '%s'", v)
+				}
+				if excluded {
+					m.ExcludedDNSTypes = append(m.ExcludedDNSTypes, t)
+				} else {
+					m.DNSTypes = append(m.DNSTypes, t)
+				}
+			}
+		default:
+			return m, fmt.Errorf("unsupported modifier '%s'", name)
+		}
+	}
+
+	return m, nil
+}
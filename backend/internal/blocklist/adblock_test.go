@@ -0,0 +1,150 @@
+package blocklist
+
+import (
+	"gohole/internal/filter"
+	"testing"
+
+	"codeberg.org/miekg/dns"
+)
+
+func TestParseBlockList_AdblockSyntax(t *testing.T) {
+	input := `[Adblock Plus 2.0]
+! Title: test list
+||ads.example.com^
+@@||good.ads.example.com^
+|exact.example.com^
+||tracker.net^$important
+||*.metrics.org^
+||unsupported.com^$denyallow=foo.com
+`
+	list := parseBlockList(input)
+
+	if len(list.Domains) != 0 {
+		t.Errorf("expected 0 domains, got %d: %v", len(list.Domains), list.Domains)
+	}
+	if len(list.Suffixes) != 1 || list.Suffixes[0] != "ads.example.com" {
+		t.Errorf("expected suffixes [ads.example.com], got %v", list.Suffixes)
+	}
+	if list.Exceptions == nil || len(list.Exceptions.Suffixes) != 1 ||
+		list.Exceptions.Suffixes[0] != "good.ads.example.com" {
+		t.Fatalf("expected exceptions [good.ads.example.com], got %+v", list.Exceptions)
+	}
+	if len(list.Rules) != 3 {
+		t.Fatalf("expected 3 rules (unsupported modifier skipped), got %d", len(list.Rules))
+	}
+	if !list.Rules[1].Modifiers.Important {
+		t.Error("expected $important modifier to be parsed")
+	}
+
+	cases := []struct {
+		rule int
+		name string
+		want bool
+	}{
+		{0, "exact.example.com", true},
+		{0, "sub.exact.example.com", false},
+		{1, "a.tracker.net", true},
+		{2, "x.metrics.org", true},
+		{2, "a.x.metrics.org", true},
+		{2, "metrics.org", false},
+	}
+	for _, tc := range cases {
+		if got := list.Rules[tc.rule].Match(filter.Request{Name: tc.name}); got != tc.want {
+			t.Errorf("rule %q on %q: expected %v, got %v", list.Rules[tc.rule].Text, tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestParseBlockList_AdblockModifiers(t *testing.T) {
+	input := `||kids.example.com^$client=192.168.1.0/24|~192.168.1.1
+||ipv6.example.com^$dnstype=AAAA
+/^ads?[0-9]*\./$client=laptop
+`
+	list := parseBlockList(input)
+	if len(list.Rules) != 3 {
+		t.Fatalf("expected 3 rules, got %d", len(list.Rules))
+	}
+
+	cases := []struct {
+		rule int
+		req  filter.Request
+		want bool
+	}{
+		{0, filter.Request{Name: "kids.example.com", Client: "192.168.1.20"}, true},
+		{0, filter.Request{Name: "kids.example.com", Client: "192.168.1.1"}, false},
+		{0, filter.Request{Name: "kids.example.com", Client: "10.0.0.1"}, false},
+		{1, filter.Request{Name: "ipv6.example.com", Type: dns.TypeAAAA}, true},
+		{1, filter.Request{Name: "ipv6.example.com", Type: dns.TypeA}, false},
+		{2, filter.Request{Name: "ads1.example.com", Client: "10.0.0.2", ClientID: "laptop"}, true},
+		{2, filter.Request{Name: "ads1.example.com", Client: "10.0.0.2", ClientID: "Laptop"}, true},
+		{2, filter.Request{Name: "ads1.example.com", Client: "10.0.0.2", ClientID: "phone"}, false},
+		// Client names are not matched against the address
+		{2, filter.Request{Name: "ads1.example.com", Client: "laptop"}, false},
+	}
+	for _, tc := range cases {
+		if got := list.Rules[tc.rule].Match(tc.req); got != tc.want {
+			t.Errorf("rule %q on %+v: expected %v, got %v", list.Rules[tc.rule].Text, tc.req, tc.want, got)
+		}
+	}
+
+	if !list.Rules[0].ClientScoped() || list.Rules[1].ClientScoped() {
+		t.Error("expected only $client rules to be client scoped")
+	}
+}
+
+func TestParseBlockList_AdblockInvalid(t *testing.T) {
+	input := `||bad.com^$dnstype=NOPE
+||^
+@@||ok.com^$badmodifier
+`
+	list := parseBlockList(input)
+	if len(list.Rules) != 0 || len(list.Suffixes) != 0 || len(list.Domains) != 0 {
+		t.Errorf("expected every rule to be rejected, got %+v", list)
+	}
+}
+
+func TestBuildFilters(t *testing.T) {
+	block := parseBlockList(`||ads.example.com^
+@@||good.ads.example.com^
+||tracker.net^$important
+||metrics.net^$important
+@@||metrics.net^$important
+`)
+	allow := parseBlockList("tracker.net\nfriendly.org\n")
+
+	blockFilter, allowFilter := BuildFilters(filter.BasicStrategy, block, allow)
+
+	cases := []struct {
+		name      string
+		wantBlock bool
+		wantAllow bool
+	}{
+		{"x.ads.example.com", true, false},
+		{"good.ads.example.com", true, true},
+		// $important rules win over the allow list
+		{"tracker.net", true, false},
+		// except over the $important exceptions
+		{"metrics.net", true, true},
+		{"friendly.org", false, true},
+	}
+	for _, tc := range cases {
+		req := filter.Request{Name: tc.name}
+
+		blockMatch, err := blockFilter.Filter(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		allowMatch, err := allowFilter.Filter(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		blocked, allowed := blockMatch != nil, allowMatch != nil
+		if blocked != tc.wantBlock || allowed != tc.wantAllow {
+			t.Errorf(
+				"%s: expected block=%v allow=%v, got block=%v allow=%v",
+				tc.name, tc.wantBlock, tc.wantAllow, blocked, allowed,
+			)
+		}
+	}
+}
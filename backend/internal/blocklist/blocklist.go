@@ -5,17 +5,25 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"net/http"
 	"os"
 	"regexp"
 	"strings"
 )
 
-var ipAddrRegex = regexp.MustCompile(`[0-9]+\.[0-9]+\.[0-9]+\.[0-9]+`)
-
 // LoadRemote reads a file containing URLs of blocklists, downloads them, and
-// returns a list of domains.
-func LoadRemote(fileName string) ([]string, error) {
+// returns the list of their entries, along with the result of each download.
+func LoadRemote(fileName string) (*List, []Result, error) {
+	loader, err := NewLoader(&Config{BlocklistFile: fileName})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	list, results, _, err := loader.loadRemote()
+	return list, results, err
+}
+
+// readURLs reads a file containing URLs of blocklists, one per line.
+func readURLs(fileName string) ([]string, error) {
 	file, err := os.Open(fileName)
 	if err != nil {
 		return nil, fmt.Errorf("blocklist: opening blocklist file: %w", err)
@@ -26,56 +34,26 @@ func LoadRemote(fileName string) ([]string, error) {
 		}
 	}()
 
-	var lines []string
+	var urls []string
 
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		line := scanner.Text()
-		lines = append(lines, line)
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("blocklist: reading blocklist file: %w", err)
-	}
-
-	var domains []string
-	dones := 0
-
-	// TODO parallelize
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
+		line := strings.TrimSpace(scanner.Text())
 		// Skip comments and empty lines
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-
-		slog.Info("Loading blocklist entry", "entry", line)
-
-		blockList, err := download(line)
-		if err != nil {
-			slog.Error("Downloading blocklist", "blocklist", line, "error", err)
-		} else {
-			dones++
-		}
-
-		urls := parseBlockList(blockList)
-
-		domains = append(domains, urls...)
+		urls = append(urls, line)
 	}
 
-	slog.Info(
-		fmt.Sprintf(
-			"Loaded %d out of %d blocklists (%d domains)\n",
-			dones,
-			len(lines),
-			len(domains),
-		),
-	)
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("blocklist: reading blocklist file: %w", err)
+	}
 
-	return domains, nil
+	return urls, nil
 }
 
-func LoadLocalFile(fileName string) ([]string, error) {
+func LoadLocalFile(fileName string) (*List, error) {
 	f, err := os.Open(fileName)
 	if err != nil {
 		return nil, fmt.Errorf("blocklist: opening local blocklist file: %w", err)
@@ -92,56 +70,27 @@ func LoadLocalFile(fileName string) ([]string, error) {
 		return nil, fmt.Errorf("blocklist: reading local blocklist file: %w", err)
 	}
 
-	domains := parseBlockList(string(content))
-	return domains, nil
-}
-
-func download(url string) (string, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", fmt.Errorf("blocklist: downloading blocklist: %w", err)
+	list := parseBlockList(string(content))
+	list.SetSource(fileName)
+	if list.Rejected > 0 {
+		slog.Warn("blocklist: rejected lines in local blocklist", "file", fileName, "rejected", list.Rejected)
 	}
 
-	defer func() {
-		if err = resp.Body.Close(); err != nil {
-			slog.Error("blocklist: closing body", "url", url, "err", err)
-		}
-	}()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("blocklist: downloading blocklist: status code %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("blocklist: reading blocklist: %w", err)
-	}
-
-	return string(body), nil
+	return list, nil
 }
 
-func parseBlockList(data string) []string {
-	lines := strings.Split(data, "\n")
-	var domains []string
-
-	for _, line := range lines {
-		line = strings.Trim(line, " \t\r\n")
-
-		// Skip comments and empty lines
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		parts := strings.SplitSeq(line, " ")
-		for part := range parts {
-			// Match ip addreses with regex
-			if ipAddrRegex.MatchString(part) {
-				continue
-			}
+// isRegexRule returns true if the line is a regex rule, e.g. "/^ads?[0-9]*\./".
+func isRegexRule(line string) bool {
+	return len(line) > 2 && strings.HasPrefix(line, "/") && strings.HasSuffix(line, "/")
+}
 
-			domains = append(domains, part)
-		}
+// wildcardToRegex converts a wildcard rule (e.g. "*.tracking.*") into an anchored
+// regular expression, where each "*" matches any sequence of characters.
+func wildcardToRegex(rule string) string {
+	parts := strings.Split(rule, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
 	}
 
-	return domains
+	return "^" + strings.Join(parts, ".*") + "$"
 }
@@ -2,6 +2,7 @@ package blocklist
 
 import (
 	"fmt"
+	"gohole/internal/filter"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -12,7 +13,7 @@ import (
 // ---- parseBlockList (unexported, tested via package-level access) ----
 
 func TestParseBlockList_EmptyInput(t *testing.T) {
-	domains := parseBlockList("")
+	domains := parseBlockList("").Domains
 	if len(domains) != 0 {
 		t.Errorf("expected 0 domains, got %d", len(domains))
 	}
@@ -20,7 +21,7 @@ func TestParseBlockList_EmptyInput(t *testing.T) {
 
 func TestParseBlockList_SkipsComments(t *testing.T) {
 	input := "# this is a comment\n# another comment\n"
-	domains := parseBlockList(input)
+	domains := parseBlockList(input).Domains
 	if len(domains) != 0 {
 		t.Errorf("expected 0 domains, got %d: %v", len(domains), domains)
 	}
@@ -28,7 +29,7 @@ func TestParseBlockList_SkipsComments(t *testing.T) {
 
 func TestParseBlockList_SkipsEmptyLines(t *testing.T) {
 	input := "\n\n   \n\t\n"
-	domains := parseBlockList(input)
+	domains := parseBlockList(input).Domains
 	if len(domains) != 0 {
 		t.Errorf("expected 0 domains, got %d", len(domains))
 	}
@@ -36,7 +37,7 @@ func TestParseBlockList_SkipsEmptyLines(t *testing.T) {
 
 func TestParseBlockList_PlainDomains(t *testing.T) {
 	input := "example.com\nbad.com\n"
-	domains := parseBlockList(input)
+	domains := parseBlockList(input).Domains
 	if len(domains) != 2 {
 		t.Fatalf("expected 2 domains, got %d: %v", len(domains), domains)
 	}
@@ -51,7 +52,7 @@ func TestParseBlockList_PlainDomains(t *testing.T) {
 func TestParseBlockList_HostsFormat(t *testing.T) {
 	// Standard /etc/hosts-style blocklist: "0.0.0.0 domain.com"
 	input := "0.0.0.0 ads.example.com\n127.0.0.1 tracker.example.com\n"
-	domains := parseBlockList(input)
+	domains := parseBlockList(input).Domains
 	if len(domains) != 2 {
 		t.Fatalf("expected 2 domains, got %d: %v", len(domains), domains)
 	}
@@ -65,7 +66,7 @@ func TestParseBlockList_HostsFormat(t *testing.T) {
 
 func TestParseBlockList_StripsWhitespace(t *testing.T) {
 	input := "  example.com  \n\t  bad.com\t\n"
-	domains := parseBlockList(input)
+	domains := parseBlockList(input).Domains
 	if len(domains) != 2 {
 		t.Fatalf("expected 2 domains, got %d: %v", len(domains), domains)
 	}
@@ -79,12 +80,56 @@ func TestParseBlockList_MixedContent(t *testing.T) {
 127.0.0.1 tracker.com
 plain.com
 `
-	domains := parseBlockList(input)
+	domains := parseBlockList(input).Domains
 	if len(domains) != 3 {
 		t.Fatalf("expected 3 domains, got %d: %v", len(domains), domains)
 	}
 }
 
+func TestParseBlockList_RegexRules(t *testing.T) {
+	input := "/^ads?[0-9]*\\./\nexample.com\n/[invalid/\n"
+	list := parseBlockList(input)
+	if len(list.Domains) != 1 {
+		t.Fatalf("expected 1 domain, got %d: %v", len(list.Domains), list.Domains)
+	}
+	if len(list.Rules) != 1 {
+		t.Fatalf("expected 1 rule (invalid one skipped), got %d", len(list.Rules))
+	}
+	if !list.Rules[0].Match(filter.Request{Name: "ads1.example.com"}) {
+		t.Error("expected regex rule to match ads1.example.com")
+	}
+	if list.Rules[0].Match(filter.Request{Name: "example.com"}) {
+		t.Error("expected regex rule not to match example.com")
+	}
+}
+
+func TestParseBlockList_WildcardRules(t *testing.T) {
+	list := parseBlockList("*.tracking.*\n0.0.0.0 ads.*.net\n")
+	if len(list.Domains) != 0 {
+		t.Fatalf("expected 0 domains, got %d: %v", len(list.Domains), list.Domains)
+	}
+	if len(list.Rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(list.Rules))
+	}
+
+	cases := []struct {
+		name string
+		want bool
+	}{
+		{"a.tracking.com", true},
+		{"tracking.com", false},
+		{"a.trackingxcom", false},
+	}
+	for _, tc := range cases {
+		if got := list.Rules[0].Match(filter.Request{Name: tc.name}); got != tc.want {
+			t.Errorf("rule %q on %q: expected %v, got %v", list.Rules[0].Text, tc.name, tc.want, got)
+		}
+	}
+	if !list.Rules[1].Match(filter.Request{Name: "ads.foo.net"}) {
+		t.Error("expected wildcard rule to match ads.foo.net")
+	}
+}
+
 // ---- LoadLocalFile ----
 
 func TestLoadLocalFile_NotFound(t *testing.T) {
@@ -98,30 +143,30 @@ func TestLoadLocalFile_ValidFile(t *testing.T) {
 	content := "example.com\nbad.com\n# comment\n\n"
 	f := writeTempFile(t, content)
 
-	domains, err := LoadLocalFile(f)
+	list, err := LoadLocalFile(f)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(domains) != 2 {
-		t.Errorf("expected 2 domains, got %d: %v", len(domains), domains)
+	if len(list.Domains) != 2 {
+		t.Errorf("expected 2 domains, got %d: %v", len(list.Domains), list.Domains)
 	}
 }
 
 func TestLoadLocalFile_EmptyFile(t *testing.T) {
 	f := writeTempFile(t, "")
-	domains, err := LoadLocalFile(f)
+	list, err := LoadLocalFile(f)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(domains) != 0 {
-		t.Errorf("expected 0 domains, got %d", len(domains))
+	if len(list.Domains) != 0 {
+		t.Errorf("expected 0 domains, got %d", len(list.Domains))
 	}
 }
 
 // ---- LoadRemote ----
 
 func TestLoadRemote_FileNotFound(t *testing.T) {
-	_, err := LoadRemote("/nonexistent/path/to/file.txt")
+	_, _, err := LoadRemote("/nonexistent/path/to/file.txt")
 	if err == nil {
 		t.Error("expected error for nonexistent file, got nil")
 	}
@@ -129,23 +174,23 @@ func TestLoadRemote_FileNotFound(t *testing.T) {
 
 func TestLoadRemote_EmptyFile(t *testing.T) {
 	f := writeTempFile(t, "")
-	domains, err := LoadRemote(f)
+	list, _, err := LoadRemote(f)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(domains) != 0 {
-		t.Errorf("expected 0 domains, got %d", len(domains))
+	if len(list.Domains) != 0 {
+		t.Errorf("expected 0 domains, got %d", len(list.Domains))
 	}
 }
 
 func TestLoadRemote_SkipsCommentsAndBlankLines(t *testing.T) {
 	f := writeTempFile(t, "# comment\n\n   \n")
-	domains, err := LoadRemote(f)
+	list, _, err := LoadRemote(f)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(domains) != 0 {
-		t.Errorf("expected 0 domains, got %d", len(domains))
+	if len(list.Domains) != 0 {
+		t.Errorf("expected 0 domains, got %d", len(list.Domains))
 	}
 }
 
@@ -159,12 +204,12 @@ func TestLoadRemote_DownloadsAndParses(t *testing.T) {
 
 	f := writeTempFile(t, srv.URL+"\n")
 
-	domains, err := LoadRemote(f)
+	list, _, err := LoadRemote(f)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(domains) != 2 {
-		t.Errorf("expected 2 domains, got %d: %v", len(domains), domains)
+	if len(list.Domains) != 2 {
+		t.Errorf("expected 2 domains, got %d: %v", len(list.Domains), list.Domains)
 	}
 }
 
@@ -177,12 +222,12 @@ func TestLoadRemote_PartialFailure(t *testing.T) {
 
 	f := writeTempFile(t, "http://127.0.0.1:0/nonexistent\n"+srv.URL+"\n")
 
-	domains, err := LoadRemote(f)
+	list, _, err := LoadRemote(f)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(domains) != 1 || domains[0] != "good.com" {
-		t.Errorf("expected [good.com], got %v", domains)
+	if len(list.Domains) != 1 || list.Domains[0] != "good.com" {
+		t.Errorf("expected [good.com], got %v", list.Domains)
 	}
 }
 
@@ -195,12 +240,12 @@ func TestLoadRemote_NonOKStatus(t *testing.T) {
 	f := writeTempFile(t, srv.URL+"\n")
 
 	// Should not return an error (download failure is logged, not propagated)
-	domains, err := LoadRemote(f)
+	list, _, err := LoadRemote(f)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(domains) != 0 {
-		t.Errorf("expected 0 domains on 404, got %d: %v", len(domains), domains)
+	if len(list.Domains) != 0 {
+		t.Errorf("expected 0 domains on 404, got %d: %v", len(list.Domains), list.Domains)
 	}
 }
 
@@ -0,0 +1,149 @@
+package blocklist
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// diskCache stores the downloaded lists in a directory, so that they can be used
+// when a download fails, e.g. when gohole starts while the network is down.
+// A nil *diskCache is a disabled cache.
+type diskCache struct {
+	dir string
+}
+
+// cacheMeta describes a cached list.
+type cacheMeta struct {
+	URL          string    `json:"url"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+}
+
+func newDiskCache(dir string) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("blocklist: creating cache directory: %w", err)
+	}
+
+	return &diskCache{dir: dir}, nil
+}
+
+// paths returns the paths of the files holding the list downloaded from url and
+// its metadata.
+func (c *diskCache) paths(url string) (string, string) {
+	sum := sha256.Sum256([]byte(url))
+	base := filepath.Join(c.dir, hex.EncodeToString(sum[:16]))
+	return base + ".txt", base + ".json"
+}
+
+// store saves a downloaded list. Files are replaced atomically, so that a crash
+// never leaves a truncated list behind.
+func (c *diskCache) store(body []byte, meta cacheMeta) error {
+	if c == nil {
+		return nil
+	}
+
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("blocklist: encoding cache metadata: %w", err)
+	}
+
+	dataPath, metaPath := c.paths(meta.URL)
+	if err := writeFileAtomic(dataPath, body); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(metaPath, metaJSON)
+}
+
+// meta returns the metadata of the cached copy of the list downloaded from url.
+func (c *diskCache) meta(url string) (cacheMeta, error) {
+	var meta cacheMeta
+	if c == nil {
+		return meta, os.ErrNotExist
+	}
+
+	_, metaPath := c.paths(url)
+	b, err := os.ReadFile(metaPath)
+	if err != nil {
+		return meta, fmt.Errorf("blocklist: reading cache metadata: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return meta, fmt.Errorf("blocklist: decoding cache metadata: %w", err)
+	}
+
+	if meta.URL != url {
+		return meta, fmt.Errorf("blocklist: cache entry belongs to '%s'", meta.URL)
+	}
+
+	return meta, nil
+}
+
+// validators returns the validators of the cached copy of the list downloaded
+// from url, as a remoteList without entries. It returns nil if there is no such
+// copy.
+func (c *diskCache) validators(url string) *remoteList {
+	meta, err := c.meta(url)
+	if err != nil || (meta.ETag == "" && meta.LastModified == "") {
+		return nil
+	}
+
+	return &remoteList{
+		etag:         meta.ETag,
+		lastModified: meta.LastModified,
+		fetchedAt:    meta.FetchedAt,
+	}
+}
+
+// load reads and parses the cached copy of the list downloaded from url.
+func (c *diskCache) load(url string) (*remoteList, error) {
+	meta, err := c.meta(url)
+	if err != nil {
+		return nil, err
+	}
+
+	dataPath, _ := c.paths(url)
+	body, err := os.ReadFile(dataPath)
+	if err != nil {
+		return nil, fmt.Errorf("blocklist: reading cached blocklist: %w", err)
+	}
+
+	data := string(body)
+	list := parse(data, DetectFormat(data))
+	list.SetSource(url)
+
+	return &remoteList{
+		etag:         meta.ETag,
+		lastModified: meta.LastModified,
+		fetchedAt:    meta.FetchedAt,
+		list:         list,
+	}, nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("blocklist: writing cache: %w", err)
+	}
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("blocklist: writing cache: %w", err)
+	}
+
+	return nil
+}
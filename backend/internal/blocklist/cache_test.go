@@ -0,0 +1,120 @@
+package blocklist
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/specialfish9/confuso/v2"
+)
+
+// ---- diskCache ----
+
+func TestLoader_CacheFallback(t *testing.T) {
+	var down atomic.Bool
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprintln(w, "ads.com")
+	}))
+	defer srv.Close()
+
+	cfg := &Config{
+		BlocklistFile: writeTempFile(t, srv.URL+"\n"),
+		CacheDir:      confuso.Optional[string]{Value: t.TempDir(), Ok: true},
+	}
+
+	before := time.Now().UTC()
+	if _, _, err := newLoader(t, cfg).Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries, err := os.ReadDir(cfg.CacheDir.Value)
+	if err != nil {
+		t.Fatalf("reading cache directory: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected the list and its metadata to be cached, got %d files", len(entries))
+	}
+
+	// A new loader simulates a restart while the network is down
+	down.Store(true)
+	lists, changed, err := newLoader(t, cfg).Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed || !slices.Equal(lists.Block.Domains, []string{"ads.com"}) {
+		t.Fatalf("expected the cached list to be used, got %v %v", changed, lists.Block.Domains)
+	}
+
+	res := lists.Results[0]
+	if res.Err == nil || !res.Stale {
+		t.Errorf("expected a stale result with an error, got %+v", res)
+	}
+	if res.FetchedAt.Before(before.Truncate(time.Second)) || res.FetchedAt.After(time.Now()) {
+		t.Errorf("unexpected fetch time %s", res.FetchedAt)
+	}
+}
+
+func TestLoader_CacheRevalidation(t *testing.T) {
+	var bodies atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		bodies.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprintln(w, "ads.com")
+	}))
+	defer srv.Close()
+
+	cfg := &Config{
+		BlocklistFile: writeTempFile(t, srv.URL+"\n"),
+		CacheDir:      confuso.Optional[string]{Value: t.TempDir(), Ok: true},
+	}
+
+	if _, _, err := newLoader(t, cfg).Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lists, _, err := newLoader(t, cfg).Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res := lists.Results[0]
+	if res.Err != nil || !res.NotModified || res.Stale || res.Bytes != 0 {
+		t.Errorf("expected the cached copy to be revalidated, got %+v", res)
+	}
+	if !slices.Equal(lists.Block.Domains, []string{"ads.com"}) {
+		t.Errorf("expected the cached list to be used, got %v", lists.Block.Domains)
+	}
+	if bodies.Load() != 1 {
+		t.Errorf("expected the list to be downloaded once, got %d", bodies.Load())
+	}
+}
+
+func TestLoader_NoCacheNoFallback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	lists, _, err := newLoader(t, &Config{BlocklistFile: writeTempFile(t, srv.URL+"\n")}).Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lists.Results[0].Stale || len(lists.Block.Domains) != 0 {
+		t.Errorf("expected no fallback without a cache, got %+v", lists.Results[0])
+	}
+}
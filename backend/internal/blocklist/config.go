@@ -0,0 +1,135 @@
+package blocklist
+
+import (
+	"fmt"
+	"gohole/internal/filter"
+	"time"
+
+	"github.com/specialfish9/confuso/v2"
+)
+
+const (
+	defaultDownloadConcurrency = 4
+	defaultDownloadTimeout     = 30 * time.Second
+	defaultDownloadRetries     = 3
+	defaultDownloadDeadline    = 2 * time.Minute
+)
+
+// retryBackoff is the delay before the first download retry, doubled at each
+// following attempt.
+var retryBackoff = time.Second
+
+type Config struct {
+	// FilterStrategy is the strategy used to filter domains (e.g., "basic", "trie2", "suffix").
+	FilterStrategy filter.Strategy `confuso:"filter_strategy" validate:"required,oneof=basic trie trie2 suffix"`
+	// BlocklistFile is the path to the file containing the list of blocklists URLs.
+	BlocklistFile string `confuso:"blocklist_file" validate:"required"`
+	// LocalBlockList is the path to a local file containing a list of domains to block.
+	LocalBlockList confuso.Optional[string] `confuso:"local_blocklist"`
+	// LocalAllowList is the path to a local file containing a list of domains to allow.
+	LocalAllowList confuso.Optional[string] `confuso:"local_allowlist"`
+	// RefreshInterval is how often the lists are reloaded (e.g., "12h"). The lists
+	// are loaded only at startup if unset.
+	RefreshInterval confuso.Optional[string] `confuso:"refresh_interval"`
+	// CacheDir is a directory where the downloaded lists are stored, so that they
+	// can be used when a download fails. Lists are not cached if unset.
+	CacheDir confuso.Optional[string] `confuso:"cache_dir"`
+	// DownloadConcurrency is the number of lists downloaded at once. Default is 4.
+	DownloadConcurrency confuso.Optional[int] `confuso:"download_concurrency"`
+	// DownloadTimeout is the timeout of a single download attempt. Default is "30s".
+	DownloadTimeout confuso.Optional[string] `confuso:"download_timeout"`
+	// DownloadRetries is the number of times a failed download is retried. Default is 3.
+	DownloadRetries confuso.Optional[int] `confuso:"download_retries"`
+	// DownloadDeadline bounds the time spent downloading all of the lists. Default is "2m".
+	DownloadDeadline confuso.Optional[string] `confuso:"download_deadline"`
+}
+
+// downloadOptions holds the download settings, with the defaults applied.
+type downloadOptions struct {
+	concurrency int
+	timeout     time.Duration
+	retries     int
+	deadline    time.Duration
+	backoff     time.Duration
+}
+
+// Validate checks the settings that cannot be validated through struct tags.
+func (c *Config) Validate() error {
+	if _, err := c.Refresh(); err != nil {
+		return err
+	}
+
+	_, err := c.downloadOptions()
+	return err
+}
+
+// Refresh returns the refresh interval, or zero if the lists should not be refreshed.
+func (c *Config) Refresh() (time.Duration, error) {
+	if !c.RefreshInterval.Ok {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(c.RefreshInterval.Value)
+	if err != nil {
+		return 0, fmt.Errorf("blocklist: invalid refresh interval: %w", err)
+	}
+
+	if d < time.Minute {
+		return 0, fmt.Errorf("blocklist: refresh interval must be at least 1m, got %s", d)
+	}
+
+	return d, nil
+}
+
+func (c *Config) downloadOptions() (downloadOptions, error) {
+	opts := downloadOptions{
+		concurrency: c.DownloadConcurrency.Or(defaultDownloadConcurrency),
+		retries:     c.DownloadRetries.Or(defaultDownloadRetries),
+		backoff:     retryBackoff,
+	}
+
+	if opts.concurrency < 1 {
+		return opts, fmt.Errorf(
+			"blocklist: download concurrency must be at least 1, got %d",
+			opts.concurrency,
+		)
+	}
+
+	if opts.retries < 0 {
+		return opts, fmt.Errorf(
+			"blocklist: download retries cannot be negative, got %d",
+			opts.retries,
+		)
+	}
+
+	var err error
+	opts.timeout, err = parsePositiveDuration(c.DownloadTimeout, defaultDownloadTimeout)
+	if err != nil {
+		return opts, fmt.Errorf("blocklist: invalid download timeout: %w", err)
+	}
+
+	opts.deadline, err = parsePositiveDuration(c.DownloadDeadline, defaultDownloadDeadline)
+	if err != nil {
+		return opts, fmt.Errorf("blocklist: invalid download deadline: %w", err)
+	}
+
+	return opts, nil
+}
+
+// parsePositiveDuration parses an optional duration, returning def if it is unset.
+func parsePositiveDuration(opt confuso.Optional[string], def time.Duration) (time.Duration, error) {
+	if !opt.Ok {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(opt.Value)
+	if err != nil {
+		return 0, err
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive, got %s", d)
+	}
+
+	return d, nil
+}
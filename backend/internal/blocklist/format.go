@@ -0,0 +1,92 @@
+package blocklist
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// Format is the syntax of a block or allow list.
+type Format string
+
+const (
+	// FormatHosts is the /etc/hosts syntax, e.g. "0.0.0.0 ads.example.com".
+	FormatHosts Format = "hosts"
+	// FormatPlain is a list of domains, one per line. Plain lists may also contain
+	// regex, wildcard and adblock-style rules.
+	FormatPlain Format = "plain"
+	// FormatDnsmasq is the dnsmasq syntax, e.g. "address=/ads.example.com/".
+	FormatDnsmasq Format = "dnsmasq"
+	// FormatUnbound is the unbound syntax, e.g.
+	// `local-zone: "ads.example.com" always_nxdomain`.
+	FormatUnbound Format = "unbound"
+	// FormatRPZ is a response policy zone file, e.g. "ads.example.com CNAME .".
+	FormatRPZ Format = "rpz"
+)
+
+// detectLines is the number of meaningful lines DetectFormat looks at.
+const detectLines = 200
+
+// DetectFormat guesses the format of a list from its first lines. Lists whose
+// format cannot be told apart are considered plain.
+func DetectFormat(data string) Format {
+	scores := make(map[Format]int)
+
+	seen := 0
+	for line := range strings.SplitSeq(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") ||
+			isAdblockComment(line) {
+			continue
+		}
+
+		scores[lineFormat(line)]++
+
+		seen++
+		if seen == detectLines {
+			break
+		}
+	}
+
+	best := FormatPlain
+	for _, f := range []Format{FormatHosts, FormatDnsmasq, FormatUnbound, FormatRPZ} {
+		if scores[f] > scores[best] {
+			best = f
+		}
+	}
+
+	return best
+}
+
+// lineFormat returns the format a single line most likely belongs to.
+func lineFormat(line string) Format {
+	switch {
+	case strings.HasPrefix(line, "address=/") || strings.HasPrefix(line, "server=/") ||
+		strings.HasPrefix(line, "local=/"):
+		return FormatDnsmasq
+	case strings.HasPrefix(line, "local-zone:") || strings.HasPrefix(line, "local-data:") ||
+		line == "server:":
+		return FormatUnbound
+	case strings.HasPrefix(line, "$TTL") || strings.HasPrefix(line, "$ORIGIN"):
+		return FormatRPZ
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) > 1 && isAddr(fields[0]) {
+		return FormatHosts
+	}
+
+	for _, f := range fields[1:] {
+		switch strings.ToUpper(f) {
+		case "SOA", "NS", "CNAME":
+			return FormatRPZ
+		}
+	}
+
+	return FormatPlain
+}
+
+// isAddr returns true if s is an IPv4 or IPv6 address.
+func isAddr(s string) bool {
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
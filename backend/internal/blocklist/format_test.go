@@ -0,0 +1,185 @@
+package blocklist
+
+import (
+	"gohole/internal/filter"
+	"slices"
+	"testing"
+)
+
+// ---- DetectFormat ----
+
+func TestDetectFormat(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  Format
+	}{
+		{"empty", "", FormatPlain},
+		{"plain", "# list\nads.com\ntracker.com\n", FormatPlain},
+		{"adblock", "! title\n||ads.com^\n||tracker.com^\n", FormatPlain},
+		{"hosts", "127.0.0.1 localhost\n::1 localhost\n0.0.0.0 ads.com\n", FormatHosts},
+		{"dnsmasq", "address=/ads.com/\nserver=/tracker.com/\n", FormatDnsmasq},
+		{"unbound", "server:\nlocal-zone: \"ads.com\" always_nxdomain\n", FormatUnbound},
+		{
+			"rpz",
+			"$TTL 300\n@ SOA localhost. root.localhost. 1 3600 600 86400 300\n" +
+				"ads.com CNAME .\n*.ads.com CNAME .\n",
+			FormatRPZ,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := DetectFormat(tc.input); got != tc.want {
+				t.Errorf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+// ---- parsers ----
+
+func TestParse_Hosts(t *testing.T) {
+	input := `127.0.0.1 localhost localhost.localdomain
+::1 localhost ip6-localhost ip6-loopback
+255.255.255.255 broadcasthost
+0.0.0.0 Ads.Example.com. tracker.example.com # inline comment
+:: ipv6.example.com
+0.0.0.0 bad..domain
+0.0.0.0
+`
+	list := parse(input, FormatHosts)
+
+	want := []string{"ads.example.com", "tracker.example.com", "ipv6.example.com"}
+	if !slices.Equal(list.Domains, want) {
+		t.Errorf("expected %v, got %v", want, list.Domains)
+	}
+	if list.Rejected != 2 {
+		t.Errorf("expected 2 rejected lines, got %d", list.Rejected)
+	}
+}
+
+func TestParse_Plain(t *testing.T) {
+	input := `ads.example.com
+bücher.example
+-invalid.com
+two fields.com
+192.168.1.1
+`
+	list := parse(input, FormatPlain)
+
+	want := []string{"ads.example.com", "xn--bcher-kva.example"}
+	if !slices.Equal(list.Domains, want) {
+		t.Errorf("expected %v, got %v", want, list.Domains)
+	}
+	if list.Rejected != 3 {
+		t.Errorf("expected 3 rejected lines, got %d", list.Rejected)
+	}
+}
+
+func TestParse_Dnsmasq(t *testing.T) {
+	input := `address=/ads.example.com/0.0.0.0
+address=/a.com/b.com/
+server=/tracker.example.com/
+server=/corp.lan/10.0.0.1
+cache-size=1000
+`
+	list := parse(input, FormatDnsmasq)
+
+	want := []string{"ads.example.com", "a.com", "b.com", "tracker.example.com"}
+	if !slices.Equal(list.Suffixes, want) {
+		t.Errorf("expected %v, got %v", want, list.Suffixes)
+	}
+	if list.Rejected != 2 {
+		t.Errorf("expected 2 rejected lines, got %d", list.Rejected)
+	}
+}
+
+func TestParse_Unbound(t *testing.T) {
+	input := `server:
+local-zone: "ads.example.com." always_nxdomain
+local-zone: "tracker.example.com" redirect
+local-data: "tracker.example.com A 0.0.0.0"
+local-zone: "corp.lan" transparent
+`
+	list := parse(input, FormatUnbound)
+
+	wantSuffixes := []string{"ads.example.com", "tracker.example.com"}
+	if !slices.Equal(list.Suffixes, wantSuffixes) {
+		t.Errorf("expected suffixes %v, got %v", wantSuffixes, list.Suffixes)
+	}
+	if !slices.Equal(list.Domains, []string{"tracker.example.com"}) {
+		t.Errorf("expected domains [tracker.example.com], got %v", list.Domains)
+	}
+	if list.Rejected != 1 {
+		t.Errorf("expected 1 rejected line, got %d", list.Rejected)
+	}
+}
+
+func TestParse_RPZ(t *testing.T) {
+	input := `$TTL 300
+$ORIGIN rpz.example.
+@ IN SOA localhost. root.localhost. (
+        1       ; serial
+        3600    ; refresh
+        600 86400 300 )
+  IN NS localhost.
+
+ads.com        CNAME .
+*.ads.com      CNAME .
+*.tracker.net  CNAME *.
+exact.org.rpz.example. 300 IN A 0.0.0.0
+good.ads.com   CNAME rpz-passthru.
+32.1.0.0.10.rpz-ip CNAME .
+`
+	list := parse(input, FormatRPZ)
+
+	if !slices.Equal(list.Suffixes, []string{"ads.com"}) {
+		t.Errorf("expected suffixes [ads.com], got %v", list.Suffixes)
+	}
+	if !slices.Equal(list.Domains, []string{"exact.org"}) {
+		t.Errorf("expected domains [exact.org], got %v", list.Domains)
+	}
+	if len(list.Rules) != 1 {
+		t.Fatalf("expected 1 rule, got %d", len(list.Rules))
+	}
+	if !list.Rules[0].Match(filter.Request{Name: "a.tracker.net"}) ||
+		list.Rules[0].Match(filter.Request{Name: "tracker.net"}) {
+		t.Error("expected wildcard rule to match the subdomains only")
+	}
+	if list.Exceptions == nil || !slices.Equal(list.Exceptions.Domains, []string{"good.ads.com"}) {
+		t.Errorf("expected exceptions [good.ads.com], got %+v", list.Exceptions)
+	}
+	if list.Rejected != 1 {
+		t.Errorf("expected 1 rejected line, got %d", list.Rejected)
+	}
+}
+
+// ---- normalizeDomain ----
+
+func TestNormalizeDomain(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+		ok    bool
+	}{
+		{"Example.COM.", "example.com", true},
+		{"_dmarc.example.com", "_dmarc.example.com", true},
+		{"münchen.de", "xn--mnchen-3ya.de", true},
+		{"", "", false},
+		{"1.2.3.4", "", false},
+		{"a..b", "", false},
+		{"ex ample.com", "", false},
+		{"-bad.com", "", false},
+	}
+
+	for _, tc := range cases {
+		got, err := normalizeDomain(tc.input)
+		if tc.ok && (err != nil || got != tc.want) {
+			t.Errorf("%q: expected %q, got %q (err %v)", tc.input, tc.want, got, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("%q: expected an error, got %q", tc.input, got)
+		}
+	}
+}
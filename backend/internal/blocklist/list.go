@@ -0,0 +1,118 @@
+package blocklist
+
+import "gohole/internal/filter"
+
+// List holds the entries parsed from one or more block or allow lists.
+type List struct {
+	// Domains are the literal entries, matched through the configured filter strategy.
+	Domains []string
+	// Suffixes are the literal entries whose subdomains are listed too
+	// (e.g. "||example.com^").
+	Suffixes []string
+	// Rules are the entries that need more than a literal lookup, such as regex
+	// (e.g. "/^ads?[0-9]*\./") and wildcard (e.g. "*.tracking.*") entries, or
+	// adblock rules with modifiers.
+	Rules []filter.Rule
+	// Exceptions holds the adblock exception ("@@") entries, which feed the allow
+	// side. It is nil if the list has no exceptions.
+	Exceptions *List
+	// Rejected is the number of lines that could not be parsed.
+	Rejected int
+	// DomainSources and SuffixSources tell which list each domain and suffix
+	// comes from. Rules carry their list themselves.
+	DomainSources filter.Sources
+	SuffixSources filter.Sources
+}
+
+// SetSource attributes all of the entries of the list, exceptions included, to
+// the list with the given ID (e.g. its URL or its path).
+func (l *List) SetSource(id string) {
+	l.DomainSources = filter.Sources{}
+	l.DomainSources.Add(id, len(l.Domains))
+	l.SuffixSources = filter.Sources{}
+	l.SuffixSources.Add(id, len(l.Suffixes))
+
+	for i := range l.Rules {
+		l.Rules[i].List = id
+	}
+
+	if l.Exceptions != nil {
+		l.Exceptions.SetSource(id)
+	}
+}
+
+// Append adds the entries of other to the list.
+func (l *List) Append(other *List) {
+	// Sources must be appended first, as they count the entries already there.
+	// Entries added without a source are attributed to no list.
+	l.DomainSources.Add("", len(l.Domains)-l.DomainSources.Len())
+	l.SuffixSources.Add("", len(l.Suffixes)-l.SuffixSources.Len())
+	l.DomainSources.Append(&other.DomainSources, len(other.Domains))
+	l.SuffixSources.Append(&other.SuffixSources, len(other.Suffixes))
+
+	l.Domains = append(l.Domains, other.Domains...)
+	l.Suffixes = append(l.Suffixes, other.Suffixes...)
+	l.Rules = append(l.Rules, other.Rules...)
+	l.Rejected += other.Rejected
+
+	if other.Exceptions != nil {
+		l.exceptions().Append(other.Exceptions)
+	}
+}
+
+func (l *List) exceptions() *List {
+	if l.Exceptions == nil {
+		l.Exceptions = &List{}
+	}
+
+	return l.Exceptions
+}
+
+// importantRules returns the rules flagged as $important.
+func (l *List) importantRules() []filter.Rule {
+	var rules []filter.Rule
+	for _, r := range l.Rules {
+		if r.Modifiers.Important {
+			rules = append(rules, r)
+		}
+	}
+
+	return rules
+}
+
+// buildFilter creates a filter for the list. Literal domains are looked up using
+// the given strategy, while rules are evaluated only if no lookup matches.
+func (l *List) buildFilter(strategy filter.Strategy, overrides []filter.Rule) filter.Filter {
+	literals := []filter.Filter{
+		filter.WithSources(filter.NewFilter(strategy, l.Domains), &l.DomainSources),
+	}
+	if len(l.Suffixes) > 0 {
+		literals = append(
+			literals,
+			filter.WithSources(filter.NewSuffix(l.Suffixes), &l.SuffixSources),
+		)
+	}
+
+	return filter.NewComposite(literals, l.Rules, overrides)
+}
+
+// BuildFilters creates the block and allow filters out of the given lists. The
+// exceptions of both lists feed the allow filter, while the important rules of
+// the block list take precedence over any allow entry but the important ones.
+func BuildFilters(strategy filter.Strategy, block *List, allow *List) (filter.Filter, filter.Filter) {
+	allowAll := &List{}
+	allowAll.Append(allow)
+	if block.Exceptions != nil {
+		allowAll.Append(block.Exceptions)
+	}
+	if exceptions := allowAll.Exceptions; exceptions != nil {
+		// Exceptions in an allow list are allow entries as well
+		allowAll.Exceptions = nil
+		allowAll.Append(exceptions)
+	}
+
+	blockFilter := block.buildFilter(strategy, nil)
+	allowFilter := allowAll.buildFilter(strategy, block.importantRules())
+
+	return blockFilter, allowFilter
+}
@@ -0,0 +1,522 @@
+package blocklist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Lists holds the loaded block and allow lists.
+type Lists struct {
+	Block *List
+	Allow *List
+	// Results reports how each remote list was loaded.
+	Results []Result
+}
+
+// Result reports how a remote list was loaded.
+type Result struct {
+	URL string
+	// Bytes is the size of the downloaded list. It is zero if the list was not
+	// downloaded, e.g. because it did not change.
+	Bytes int
+	// Domains and Rules are the number of entries of the list.
+	Domains int
+	Rules   int
+	// Duration is the time spent loading the list, retries included.
+	Duration time.Duration
+	// Attempts is the number of download attempts.
+	Attempts int
+	// NotModified is true if the server reported that the list did not change.
+	NotModified bool
+	// FetchedAt is the time the copy of the list in use was downloaded.
+	FetchedAt time.Time
+	// Stale is true if the download failed and a previous copy of the list, kept
+	// in memory or in the cache directory, is used instead.
+	Stale bool
+	// Err is the error of the last attempt, nil if the list was loaded.
+	Err error
+}
+
+// statusError is returned when a server replies with an unexpected status code.
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("status code %d", int(e))
+}
+
+// retryable returns true if a download failing with err may succeed later.
+func retryable(err error) bool {
+	var status statusError
+	if errors.As(err, &status) {
+		return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+	}
+
+	return true
+}
+
+// SourceProvider returns the URLs of the lists to load on top of the ones in
+// the blocklist file.
+type SourceProvider func(ctx context.Context) ([]string, error)
+
+// Loader loads the block and allow lists. It remembers what it loaded, so that
+// lists that did not change are neither downloaded nor parsed again.
+type Loader struct {
+	cfg    *Config
+	opts   downloadOptions
+	client *http.Client
+	// cache is nil if no cache directory is configured.
+	cache *diskCache
+
+	mu sync.Mutex
+	// loaded is true once the lists have been loaded at least once.
+	loaded  bool
+	remotes map[string]*remoteList
+	locals  map[string]*localList
+	// sources is nil if no lists are loaded on top of the blocklist file.
+	sources SourceProvider
+	// provided is the last list of URLs returned by sources.
+	provided []string
+
+	// resultsMu guards results alone, so that they can be read while loading.
+	resultsMu sync.Mutex
+	results   map[string]Result
+}
+
+// remoteList is a downloaded list, along with the validators sent back to the
+// server when refreshing it.
+type remoteList struct {
+	etag         string
+	lastModified string
+	fetchedAt    time.Time
+	list         *List
+}
+
+// localList is a local list, along with the file attributes used to tell
+// whether it changed.
+type localList struct {
+	modTime time.Time
+	size    int64
+	list    *List
+}
+
+func NewLoader(cfg *Config) (*Loader, error) {
+	opts, err := cfg.downloadOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	var cache *diskCache
+	if cfg.CacheDir.Ok {
+		cache, err = newDiskCache(cfg.CacheDir.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Loader{
+		cfg:     cfg,
+		opts:    opts,
+		client:  &http.Client{},
+		cache:   cache,
+		remotes: make(map[string]*remoteList),
+		locals:  make(map[string]*localList),
+		results: make(map[string]Result),
+	}, nil
+}
+
+// SetSourceProvider sets the provider of the lists loaded on top of the ones in
+// the blocklist file. It must be called before the first Load.
+func (l *Loader) SetSourceProvider(sources SourceProvider) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sources = sources
+}
+
+// FileURLs returns the URLs listed in the blocklist file.
+func (l *Loader) FileURLs() ([]string, error) {
+	return readURLs(l.cfg.BlocklistFile)
+}
+
+// Result returns how the list downloaded from url was last loaded, and false if
+// it was never loaded.
+func (l *Loader) Result(url string) (Result, bool) {
+	l.resultsMu.Lock()
+	defer l.resultsMu.Unlock()
+
+	res, ok := l.results[url]
+	return res, ok
+}
+
+// Load loads the remote and local lists. The returned bool is false if none of
+// them changed since the previous call, in which case the filters built out of
+// them do not need to be rebuilt.
+func (l *Loader) Load() (Lists, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	block, results, changed, err := l.loadRemote()
+	if err != nil {
+		return Lists{}, false, err
+	}
+
+	if l.cfg.LocalBlockList.Ok {
+		local, localChanged, err := l.loadLocal(l.cfg.LocalBlockList.Value)
+		if err != nil {
+			return Lists{}, false, err
+		}
+		block.Append(local)
+		changed = changed || localChanged
+	}
+
+	allow := &List{}
+	if l.cfg.LocalAllowList.Ok {
+		local, localChanged, err := l.loadLocal(l.cfg.LocalAllowList.Value)
+		if err != nil {
+			return Lists{}, false, err
+		}
+		allow.Append(local)
+		changed = changed || localChanged
+	}
+
+	changed = changed || !l.loaded
+	l.loaded = true
+
+	return Lists{Block: block, Allow: allow, Results: results}, changed, nil
+}
+
+// loadRemote downloads the lists whose URLs are in the blocklist file or come
+// from the source provider, a few at a time. A list that cannot be downloaded
+// is replaced by its previous version, if any, either from memory or from the
+// cache directory.
+func (l *Loader) loadRemote() (*List, []Result, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.deadline)
+	defer cancel()
+
+	urls, err := l.urls(ctx)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	fetched := make([]*remoteList, len(urls))
+	results := make([]Result, len(urls))
+	sem := make(chan struct{}, l.opts.concurrency)
+
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		prev := l.remotes[url]
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			fetched[i], results[i] = l.fetchWithRetry(ctx, url, prev)
+		})
+	}
+	wg.Wait()
+
+	list := &List{}
+	changed := false
+	dones := 0
+	remotes := make(map[string]*remoteList, len(urls))
+
+	for i, url := range urls {
+		remote := fetched[i]
+		if results[i].Err != nil {
+			slog.Error("Downloading blocklist", "blocklist", url, "error", results[i].Err)
+		} else {
+			dones++
+		}
+		changed = changed || remote != l.remotes[url]
+
+		if remote == nil {
+			continue
+		}
+
+		remotes[url] = remote
+		list.Append(remote.list)
+	}
+
+	// Removing a URL from the file changes the list as well
+	for url := range l.remotes {
+		if _, ok := remotes[url]; !ok {
+			changed = true
+		}
+	}
+	l.remotes = remotes
+
+	l.resultsMu.Lock()
+	l.results = make(map[string]Result, len(results))
+	for _, res := range results {
+		l.results[res.URL] = res
+	}
+	l.resultsMu.Unlock()
+
+	slog.Info(
+		fmt.Sprintf(
+			"Loaded %d out of %d blocklists (%d domains, %d rules, %d rejected lines)\n",
+			dones,
+			len(urls),
+			len(list.Domains)+len(list.Suffixes),
+			len(list.Rules),
+			list.Rejected,
+		),
+	)
+
+	return list, results, changed, nil
+}
+
+// urls returns the URLs of the lists to download, without duplicates. If the
+// source provider fails, the URLs it returned last time are used.
+func (l *Loader) urls(ctx context.Context) ([]string, error) {
+	urls, err := readURLs(l.cfg.BlocklistFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.sources != nil {
+		provided, err := l.sources(ctx)
+		if err != nil {
+			slog.Error("Fetching blocklist sources", "error", err)
+		} else {
+			l.provided = provided
+		}
+	}
+
+	for _, url := range l.provided {
+		if !slices.Contains(urls, url) {
+			urls = append(urls, url)
+		}
+	}
+
+	return urls, nil
+}
+
+// fetchWithRetry downloads a remote list, retrying with an exponential backoff
+// until it succeeds, the retries are exhausted or ctx is done. If the download
+// fails, the previous copy of the list is returned, if any.
+func (l *Loader) fetchWithRetry(
+	ctx context.Context,
+	url string,
+	prev *remoteList,
+) (*remoteList, Result) {
+	res := Result{URL: url}
+	start := time.Now()
+	backoff := l.opts.backoff
+
+	validators := prev
+	if validators == nil {
+		// Revalidate the cached copy rather than downloading it again
+		validators = l.cache.validators(url)
+	}
+
+	var remote *remoteList
+	for {
+		res.Attempts++
+
+		remote, res.Bytes, res.Err = l.fetch(ctx, url, validators)
+		res.NotModified = res.Err == nil && remote == validators
+		if res.Err == nil && remote.list == nil {
+			// The cached copy is up to date
+			remote, res.Err = l.cache.load(url)
+			if res.Err != nil {
+				validators = nil
+				continue
+			}
+		}
+
+		if res.Err == nil || res.Attempts > l.opts.retries || !retryable(res.Err) {
+			break
+		}
+
+		slog.Warn(
+			"Retrying blocklist download",
+			"blocklist", url,
+			"attempt", res.Attempts,
+			"backoff", backoff,
+			"error", res.Err,
+		)
+
+		if err := sleep(ctx, backoff); err != nil {
+			res.Err = fmt.Errorf("blocklist: downloading blocklist: %w", err)
+			break
+		}
+		backoff *= 2
+	}
+
+	res.Duration = time.Since(start)
+	if res.Err != nil {
+		remote = l.fallback(url, prev)
+		if remote != nil {
+			res.Stale = true
+			res.FetchedAt = remote.fetchedAt
+		}
+		return remote, res
+	}
+
+	res.FetchedAt = remote.fetchedAt
+	res.Domains = len(remote.list.Domains) + len(remote.list.Suffixes)
+	res.Rules = len(remote.list.Rules)
+
+	slog.Info(
+		"Loaded blocklist",
+		"blocklist", url,
+		"bytes", res.Bytes,
+		"domains", res.Domains,
+		"duration", res.Duration,
+		"not_modified", res.NotModified,
+	)
+
+	return remote, res
+}
+
+// fallback returns the copy of a list to use when it cannot be downloaded: the
+// one in memory if any, the one in the cache directory otherwise.
+func (l *Loader) fallback(url string, prev *remoteList) *remoteList {
+	remote := prev
+	if remote == nil {
+		var err error
+		remote, err = l.cache.load(url)
+		if err != nil {
+			return nil
+		}
+	}
+
+	slog.Warn(
+		"Using stale copy of blocklist",
+		"blocklist", url,
+		"fetched_at", remote.fetchedAt,
+		"age", time.Since(remote.fetchedAt).Round(time.Second),
+	)
+
+	return remote
+}
+
+// sleep waits for d, or returns the context error if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// fetch downloads a remote list, unless the server reports that prev is still
+// up to date, in which case prev is returned. It also returns the size of the
+// downloaded list, which is stored in the cache directory if any.
+func (l *Loader) fetch(
+	ctx context.Context,
+	url string,
+	prev *remoteList,
+) (*remoteList, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.opts.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("blocklist: downloading blocklist: %w", err)
+	}
+
+	if prev != nil {
+		if prev.etag != "" {
+			req.Header.Set("If-None-Match", prev.etag)
+		}
+		if prev.lastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.lastModified)
+		}
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("blocklist: downloading blocklist: %w", err)
+	}
+
+	defer func() {
+		if err = resp.Body.Close(); err != nil {
+			slog.Error("blocklist: closing body", "url", url, "err", err)
+		}
+	}()
+
+	if resp.StatusCode == http.StatusNotModified && prev != nil {
+		return prev, 0, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf(
+			"blocklist: downloading blocklist: %w",
+			statusError(resp.StatusCode),
+		)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("blocklist: reading blocklist: %w", err)
+	}
+
+	data := string(body)
+	format := DetectFormat(data)
+	list := parse(data, format)
+	list.SetSource(url)
+	slog.Debug(
+		"Parsed blocklist",
+		"blocklist", url,
+		"format", format,
+		"rejected", list.Rejected,
+	)
+
+	remote := &remoteList{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		fetchedAt:    time.Now().UTC(),
+		list:         list,
+	}
+
+	meta := cacheMeta{
+		URL:          url,
+		FetchedAt:    remote.fetchedAt,
+		ETag:         remote.etag,
+		LastModified: remote.lastModified,
+	}
+	if err := l.cache.store(body, meta); err != nil {
+		slog.Error("Caching blocklist", "blocklist", url, "error", err)
+	}
+
+	return remote, len(body), nil
+}
+
+// loadLocal loads a local list, unless it did not change since the previous call.
+func (l *Loader) loadLocal(fileName string) (*List, bool, error) {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return nil, false, fmt.Errorf("blocklist: opening local blocklist file: %w", err)
+	}
+
+	prev, ok := l.locals[fileName]
+	if ok && prev.modTime.Equal(info.ModTime()) && prev.size == info.Size() {
+		return prev.list, false, nil
+	}
+
+	list, err := LoadLocalFile(fileName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	l.locals[fileName] = &localList{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		list:    list,
+	}
+
+	return list, true, nil
+}
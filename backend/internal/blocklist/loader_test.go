@@ -0,0 +1,483 @@
+package blocklist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gohole/internal/filter"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/specialfish9/confuso/v2"
+)
+
+func TestMain(m *testing.M) {
+	// Keep the retries of failing downloads fast
+	retryBackoff = time.Millisecond
+	os.Exit(m.Run())
+}
+
+// ---- Loader ----
+
+func TestLoader_ETag(t *testing.T) {
+	var version, requests, notModified atomic.Int32
+	version.Store(1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		etag := fmt.Sprintf(`"v%d"`, version.Load())
+		if r.Header.Get("If-None-Match") == etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprintf(w, "ads-v%d.com\n", version.Load())
+	}))
+	defer srv.Close()
+
+	loader := newLoader(t, &Config{BlocklistFile: writeTempFile(t, srv.URL+"\n")})
+
+	lists, changed, err := loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed || !slices.Equal(lists.Block.Domains, []string{"ads-v1.com"}) {
+		t.Fatalf("expected changed [ads-v1.com], got %v %v", changed, lists.Block.Domains)
+	}
+
+	lists, changed, err = loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if changed {
+		t.Error("expected no change when the server replies 304")
+	}
+	if notModified.Load() != 1 {
+		t.Errorf("expected 1 conditional hit, got %d", notModified.Load())
+	}
+	if !slices.Equal(lists.Block.Domains, []string{"ads-v1.com"}) {
+		t.Errorf("expected the previous list to be kept, got %v", lists.Block.Domains)
+	}
+
+	version.Store(2)
+	lists, changed, err = loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed || !slices.Equal(lists.Block.Domains, []string{"ads-v2.com"}) {
+		t.Errorf("expected changed [ads-v2.com], got %v %v", changed, lists.Block.Domains)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("expected 3 requests, got %d", requests.Load())
+	}
+}
+
+func TestLoader_LastModified(t *testing.T) {
+	const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		fmt.Fprintln(w, "ads.com")
+	}))
+	defer srv.Close()
+
+	loader := newLoader(t, &Config{BlocklistFile: writeTempFile(t, srv.URL+"\n")})
+
+	if _, changed, err := loader.Load(); err != nil || !changed {
+		t.Fatalf("expected first load to change, got %v (err %v)", changed, err)
+	}
+	if _, changed, err := loader.Load(); err != nil || changed {
+		t.Errorf("expected second load not to change, got %v (err %v)", changed, err)
+	}
+}
+
+func TestLoader_KeepsPreviousListOnFailure(t *testing.T) {
+	var fail atomic.Bool
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintln(w, "ads.com")
+	}))
+	defer srv.Close()
+
+	loader := newLoader(t, &Config{BlocklistFile: writeTempFile(t, srv.URL+"\n")})
+	if _, _, err := loader.Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fail.Store(true)
+	lists, changed, err := loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if changed {
+		t.Error("expected no change when the download fails")
+	}
+	if !slices.Equal(lists.Block.Domains, []string{"ads.com"}) {
+		t.Errorf("expected the previous list to be kept, got %v", lists.Block.Domains)
+	}
+}
+
+func TestLoader_LocalFiles(t *testing.T) {
+	allowFile := writeTempFile(t, "good.com\n")
+	loader := newLoader(t, &Config{
+		BlocklistFile:  writeTempFile(t, ""),
+		LocalBlockList: confuso.Optional[string]{Value: writeTempFile(t, "bad.com\n"), Ok: true},
+		LocalAllowList: confuso.Optional[string]{Value: allowFile, Ok: true},
+	})
+
+	lists, _, err := loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(lists.Block.Domains, []string{"bad.com"}) ||
+		!slices.Equal(lists.Allow.Domains, []string{"good.com"}) {
+		t.Fatalf("unexpected lists: block %v, allow %v", lists.Block.Domains, lists.Allow.Domains)
+	}
+
+	if _, changed, _ := loader.Load(); changed {
+		t.Error("expected no change when the files are untouched")
+	}
+
+	if err := os.WriteFile(allowFile, []byte("good.com\nbetter.com\n"), 0o644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+
+	lists, changed, err := loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed || len(lists.Allow.Domains) != 2 {
+		t.Errorf("expected the allow list to be reloaded, got %v %v", changed, lists.Allow.Domains)
+	}
+}
+
+// ---- Refresher ----
+
+func TestRefresher_Refresh(t *testing.T) {
+	blockFile := writeTempFile(t, "bad.com\n")
+	loader := newLoader(t, &Config{
+		BlocklistFile:  writeTempFile(t, ""),
+		LocalBlockList: confuso.Optional[string]{Value: blockFile, Ok: true},
+	})
+
+	var updates int
+	var blockFilter filter.Filter
+	refresher := NewRefresher(loader, 0, filter.BasicStrategy, func(b filter.Filter, _ filter.Filter) {
+		updates++
+		blockFilter = b
+	})
+
+	refresher.Refresh()
+	refresher.Refresh()
+	if updates != 1 {
+		t.Fatalf("expected 1 update, got %d", updates)
+	}
+
+	if err := os.WriteFile(blockFile, []byte("bad.com\nworse.com\n"), 0o644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	refresher.Refresh()
+
+	if updates != 2 {
+		t.Fatalf("expected 2 updates, got %d", updates)
+	}
+	if m, _ := blockFilter.Filter(filter.Request{Name: "worse.com"}); m == nil {
+		t.Error("expected the new filter to block worse.com")
+	}
+}
+
+func TestRefresher_Trigger(t *testing.T) {
+	loader := newLoader(t, &Config{BlocklistFile: writeTempFile(t, "")})
+
+	updated := make(chan struct{}, 1)
+	refresher := NewRefresher(loader, 0, filter.BasicStrategy, func(filter.Filter, filter.Filter) {
+		updated <- struct{}{}
+	})
+
+	go func() { _ = refresher.Start() }()
+	defer func() { _ = refresher.Stop() }()
+
+	refresher.Trigger()
+
+	select {
+	case <-updated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a triggered refresh to update the filters")
+	}
+}
+
+func TestLoader_Retries(t *testing.T) {
+	var requests atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ads.com")
+		fmt.Fprintln(w, "||tracker.com^")
+	}))
+	defer srv.Close()
+
+	lists, _, err := newLoader(t, &Config{BlocklistFile: writeTempFile(t, srv.URL+"\n")}).Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(lists.Results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(lists.Results))
+	}
+
+	res := lists.Results[0]
+	if res.Err != nil || res.Attempts != 3 {
+		t.Errorf("expected success after 3 attempts, got %d attempts (err %v)", res.Attempts, res.Err)
+	}
+	if res.URL != srv.URL || res.Domains != 2 || res.Bytes != len("ads.com\n||tracker.com^\n") {
+		t.Errorf("unexpected result: %+v", res)
+	}
+}
+
+func TestLoader_NoRetryOnClientError(t *testing.T) {
+	var requests atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	lists, _, err := newLoader(t, &Config{BlocklistFile: writeTempFile(t, srv.URL+"\n")}).Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lists.Results[0].Err == nil || requests.Load() != 1 {
+		t.Errorf("expected a single failed attempt, got %d (err %v)", requests.Load(), lists.Results[0].Err)
+	}
+}
+
+func TestLoader_Timeouts(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	cases := []struct {
+		name string
+		cfg  Config
+	}{
+		{"request timeout", Config{
+			DownloadTimeout: confuso.Optional[string]{Value: "50ms", Ok: true},
+			DownloadRetries: confuso.Optional[int]{Value: 1, Ok: true},
+		}},
+		{"total deadline", Config{
+			DownloadDeadline: confuso.Optional[string]{Value: "50ms", Ok: true},
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.BlocklistFile = writeTempFile(t, srv.URL+"\n")
+
+			start := time.Now()
+			lists, _, err := newLoader(t, &tc.cfg).Load()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if lists.Results[0].Err == nil {
+				t.Error("expected the download to time out")
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("expected the download to give up quickly, took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestLoader_BoundedConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprintf(w, "%s.com\n", r.URL.Path[1:])
+	}))
+	defer srv.Close()
+
+	urls := ""
+	for i := range 6 {
+		urls += fmt.Sprintf("%s/list%d\n", srv.URL, i)
+	}
+
+	lists, _, err := newLoader(t, &Config{
+		BlocklistFile:       writeTempFile(t, urls),
+		DownloadConcurrency: confuso.Optional[int]{Value: 2, Ok: true},
+	}).Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if peak.Load() != 2 {
+		t.Errorf("expected 2 concurrent downloads at most, got %d", peak.Load())
+	}
+	// The lists keep the order of the file
+	for i, res := range lists.Results {
+		if res.Err != nil || res.URL != fmt.Sprintf("%s/list%d", srv.URL, i) {
+			t.Errorf("unexpected result %d: %+v", i, res)
+		}
+	}
+	if len(lists.Block.Domains) != 6 || lists.Block.Domains[0] != "list0.com" {
+		t.Errorf("unexpected domains: %v", lists.Block.Domains)
+	}
+}
+
+func TestNewLoader_InvalidConfig(t *testing.T) {
+	cases := []Config{
+		{DownloadConcurrency: confuso.Optional[int]{Value: 0, Ok: true}},
+		{DownloadRetries: confuso.Optional[int]{Value: -1, Ok: true}},
+		{DownloadTimeout: confuso.Optional[string]{Value: "soon", Ok: true}},
+		{DownloadDeadline: confuso.Optional[string]{Value: "-1s", Ok: true}},
+	}
+
+	for _, cfg := range cases {
+		if _, err := NewLoader(&cfg); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected a validation error for %+v", cfg)
+		}
+	}
+}
+
+func TestLoader_MatchProvenance(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ads.com")
+		fmt.Fprintln(w, "||tracker.net^")
+		fmt.Fprintln(w, "/^ads?[0-9]+\\./")
+		fmt.Fprintln(w, "@@||ok.ads.com^")
+	}))
+	defer srv.Close()
+
+	localFile := writeTempFile(t, "local.com\n")
+	lists, _, err := newLoader(t, &Config{
+		BlocklistFile:  writeTempFile(t, srv.URL+"\n"),
+		LocalBlockList: confuso.Optional[string]{Value: localFile, Ok: true},
+	}).Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	blockFilter, allowFilter := BuildFilters(filter.BasicStrategy, lists.Block, lists.Allow)
+
+	cases := []struct {
+		f    filter.Filter
+		name string
+		want filter.Match
+	}{
+		{blockFilter, "ads.com", filter.Match{List: srv.URL, Rule: "ads.com", Kind: filter.MatchExact}},
+		{blockFilter, "x.tracker.net", filter.Match{List: srv.URL, Rule: "tracker.net", Kind: filter.MatchSuffix}},
+		{blockFilter, "ads1.foo.com", filter.Match{List: srv.URL, Rule: "/^ads?[0-9]+\\./", Kind: filter.MatchRegex}},
+		{blockFilter, "local.com", filter.Match{List: localFile, Rule: "local.com", Kind: filter.MatchExact}},
+		{allowFilter, "ok.ads.com", filter.Match{List: srv.URL, Rule: "ok.ads.com", Kind: filter.MatchExact}},
+	}
+
+	for _, c := range cases {
+		m, err := c.f.Filter(filter.Request{Name: c.name})
+		if err != nil || m == nil {
+			t.Fatalf("%s: expected a match, got %v %v", c.name, m, err)
+		}
+		if got := (filter.Match{List: m.List, Rule: m.Rule, Kind: m.Kind}); got != c.want {
+			t.Errorf("%s: expected %+v, got %+v", c.name, c.want, got)
+		}
+	}
+}
+
+// ---- SourceProvider ----
+
+func TestLoader_SourceProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, strings.TrimPrefix(r.URL.Path, "/")+".com")
+	}))
+	defer srv.Close()
+
+	provided := []string{srv.URL + "/api", srv.URL + "/file"}
+	var providerErr error
+
+	loader := newLoader(t, &Config{BlocklistFile: writeTempFile(t, srv.URL+"/file\n")})
+	loader.SetSourceProvider(func(ctx context.Context) ([]string, error) {
+		return provided, providerErr
+	})
+
+	lists, _, err := loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The URL in both the file and the provider is downloaded once
+	if !slices.Equal(lists.Block.Domains, []string{"file.com", "api.com"}) {
+		t.Errorf("unexpected domains: %v", lists.Block.Domains)
+	}
+
+	res, ok := loader.Result(srv.URL + "/api")
+	if !ok || res.Domains != 1 || res.Err != nil {
+		t.Errorf("unexpected result: %+v %v", res, ok)
+	}
+
+	// A failing provider keeps the previous URLs
+	providerErr = errors.New("db down")
+	provided = nil
+	lists, _, err = loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(lists.Block.Domains) != 2 {
+		t.Errorf("expected the sources to be kept, got %v", lists.Block.Domains)
+	}
+
+	providerErr = nil
+	lists, changed, err := loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed || !slices.Equal(lists.Block.Domains, []string{"file.com"}) {
+		t.Errorf("expected the removed source to be dropped, got %v %v", changed, lists.Block.Domains)
+	}
+	if _, ok := loader.Result(srv.URL + "/api"); ok {
+		t.Error("expected no result for the removed source")
+	}
+}
+
+// ---- helpers ----
+
+func newLoader(t *testing.T, cfg *Config) *Loader {
+	t.Helper()
+	loader, err := NewLoader(cfg)
+	if err != nil {
+		t.Fatalf("creating loader: %v", err)
+	}
+	return loader
+}
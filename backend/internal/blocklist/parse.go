@@ -0,0 +1,521 @@
+package blocklist
+
+import (
+	"errors"
+	"fmt"
+	"gohole/internal/filter"
+	"log/slog"
+	"net/netip"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile converts internationalized names to punycode. Underscores are
+// allowed, since they are common in blocklists.
+var idnaProfile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false))
+
+// hostsBoilerplate holds the names found in most hosts files that must not be
+// blocked, e.g. "127.0.0.1 localhost".
+var hostsBoilerplate = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+	"0.0.0.0":               true,
+}
+
+// lineParsers holds the line parsers of the line-oriented formats. RPZ files
+// are parsed by parseRPZ instead, since records may span several lines.
+var lineParsers = map[Format]func(l *List, line string) error{
+	FormatHosts:   parseHostsLine,
+	FormatPlain:   parsePlainLine,
+	FormatDnsmasq: parseDnsmasqLine,
+	FormatUnbound: parseUnboundLine,
+}
+
+// parseBlockList detects the format of a list and parses it.
+func parseBlockList(data string) *List {
+	return parse(data, DetectFormat(data))
+}
+
+// parse parses a list written in the given format. Lines that cannot be parsed
+// are skipped and counted in List.Rejected.
+func parse(data string, format Format) *List {
+	list := &List{}
+
+	if format == FormatRPZ {
+		parseRPZ(list, data)
+		return list
+	}
+
+	parseLine := lineParsers[format]
+	for line := range strings.SplitSeq(data, "\n") {
+		line = stripComment(line, "#")
+
+		// Skip comments and empty lines
+		if line == "" || strings.HasPrefix(line, "#") || isAdblockComment(line) {
+			continue
+		}
+
+		if err := parseLine(list, line); err != nil {
+			list.reject(line, err)
+		}
+	}
+
+	return list
+}
+
+// stripComment removes the trailing whitespace and the comment starting with
+// the given marker, if it follows some whitespace (e.g. "ads.com # tracker").
+func stripComment(line string, marker string) string {
+	line = strings.TrimSpace(line)
+
+	for i := strings.Index(line, marker); i > 0; {
+		if line[i-1] == ' ' || line[i-1] == '\t' {
+			return strings.TrimSpace(line[:i])
+		}
+
+		next := strings.Index(line[i+1:], marker)
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+
+	return line
+}
+
+func (l *List) reject(line string, err error) {
+	l.Rejected++
+	slog.Debug("blocklist: rejecting line", "line", line, "error", err)
+}
+
+// parsePlainLine parses a domain, or a regex, wildcard or adblock-style rule.
+// Lines starting with an address are parsed as hosts lines.
+func parsePlainLine(l *List, line string) error {
+	if isAdblockRule(line) {
+		return l.addAdblockRule(line)
+	}
+
+	// Regex rules take the whole line, as the expression may contain spaces
+	if isRegexRule(line) {
+		rule, err := filter.NewRegexRule(line, line[1:len(line)-1])
+		if err != nil {
+			return err
+		}
+		l.Rules = append(l.Rules, rule)
+		return nil
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 1 {
+		return l.addDomain(fields[0])
+	}
+
+	if isAddr(fields[0]) {
+		return parseHostsLine(l, line)
+	}
+
+	return errors.New("unexpected fields")
+}
+
+// parseHostsLine parses an address followed by one or more host names. Lines
+// without an address are parsed as plain lines, since some lists mix both.
+func parseHostsLine(l *List, line string) error {
+	fields := strings.Fields(line)
+	if !isAddr(fields[0]) {
+		return parsePlainLine(l, line)
+	}
+
+	if len(fields) == 1 {
+		return errors.New("missing host name")
+	}
+
+	var errs []error
+	for _, name := range fields[1:] {
+		if hostsBoilerplate[strings.ToLower(name)] {
+			continue
+		}
+
+		if err := l.addDomain(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// parseDnsmasqLine parses a dnsmasq entry answering locally for a domain and
+// its subdomains, e.g. "address=/ads.example.com/0.0.0.0" or "server=/ads.com/".
+func parseDnsmasqLine(l *List, line string) error {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return errors.New("missing '='")
+	}
+
+	switch key {
+	case "address", "local", "server":
+	default:
+		return fmt.Errorf("unsupported option '%s'", key)
+	}
+
+	parts := strings.Split(value, "/")
+	if len(parts) < 3 || parts[0] != "" {
+		return fmt.Errorf("malformed %s entry", key)
+	}
+
+	if key == "server" && parts[len(parts)-1] != "" {
+		// The domains are forwarded to another server rather than blocked
+		return errors.New("forwarding entry")
+	}
+
+	var errs []error
+	for _, d := range parts[1 : len(parts)-1] {
+		domain, err := normalizeDomain(d)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		l.Suffixes = append(l.Suffixes, domain)
+	}
+
+	return errors.Join(errs...)
+}
+
+// unboundBlockingZones holds the unbound local-zone types that prevent a zone
+// from being resolved.
+var unboundBlockingZones = map[string]bool{
+	"deny":            true,
+	"refuse":          true,
+	"static":          true,
+	"redirect":        true,
+	"inform_deny":     true,
+	"always_refuse":   true,
+	"always_nxdomain": true,
+	"always_null":     true,
+}
+
+// parseUnboundLine parses an unbound local-zone or local-data entry, e.g.
+// `local-zone: "ads.example.com" always_nxdomain` or
+// `local-data: "ads.example.com A 0.0.0.0"`.
+func parseUnboundLine(l *List, line string) error {
+	key, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return errors.New("missing ':'")
+	}
+
+	fields := strings.Fields(strings.ReplaceAll(value, `"`, " "))
+
+	switch key {
+	case "server":
+		// Clause header
+		return nil
+	case "local-zone":
+		if len(fields) != 2 {
+			return errors.New("malformed local-zone entry")
+		}
+		if !unboundBlockingZones[fields[1]] {
+			return fmt.Errorf("non blocking zone type '%s'", fields[1])
+		}
+
+		domain, err := normalizeDomain(fields[0])
+		if err != nil {
+			return err
+		}
+		l.Suffixes = append(l.Suffixes, domain)
+	case "local-data":
+		if len(fields) < 3 {
+			return errors.New("malformed local-data entry")
+		}
+
+		domain, err := normalizeDomain(fields[0])
+		if err != nil {
+			return err
+		}
+		l.Domains = append(l.Domains, domain)
+	default:
+		return fmt.Errorf("unsupported option '%s'", key)
+	}
+
+	return nil
+}
+
+// rpzEntries collects the owner names of an RPZ policy. Wildcard owners (e.g.
+// "*.ads.com") are kept apart, so that they can be merged with their parent.
+type rpzEntries struct {
+	exact     []string
+	wildcards []string
+}
+
+func (e *rpzEntries) add(owner string) error {
+	owner, wildcard := strings.CutPrefix(owner, "*.")
+
+	domain, err := normalizeDomain(owner)
+	if err != nil {
+		return err
+	}
+
+	if wildcard {
+		e.wildcards = append(e.wildcards, domain)
+	} else {
+		e.exact = append(e.exact, domain)
+	}
+
+	return nil
+}
+
+// addTo adds the entries to the list. A domain listed along with its wildcard
+// (the usual way to block a whole zone) becomes a suffix entry, while lone
+// wildcards become rules matching the subdomains only.
+func (e *rpzEntries) addTo(l *List) {
+	exact := make(map[string]bool, len(e.exact))
+	for _, d := range e.exact {
+		exact[d] = true
+	}
+
+	suffixes := make(map[string]bool)
+	for _, w := range e.wildcards {
+		if suffixes[w] {
+			continue
+		}
+
+		if exact[w] {
+			suffixes[w] = true
+			l.Suffixes = append(l.Suffixes, w)
+			continue
+		}
+
+		wildcard := "*." + w
+		rule, err := filter.NewRegexRule(wildcard, wildcardToRegex(wildcard))
+		if err != nil {
+			l.reject(wildcard, err)
+			continue
+		}
+		l.Rules = append(l.Rules, rule)
+	}
+
+	for _, d := range e.exact {
+		if !suffixes[d] {
+			l.Domains = append(l.Domains, d)
+		}
+	}
+}
+
+// parseRPZ parses a response policy zone file. Records rewriting a name to
+// NXDOMAIN, NODATA or local data are block entries, while "rpz-passthru."
+// records are exceptions.
+func parseRPZ(l *List, data string) {
+	var (
+		block, passthru rpzEntries
+		origin, owner   string
+		// depth is the number of parentheses left open by a multi-line record.
+		depth int
+	)
+
+	for raw := range strings.SplitSeq(data, "\n") {
+		line := stripComment(raw, ";")
+		if strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if depth > 0 {
+			depth += strings.Count(line, "(") - strings.Count(line, ")")
+			continue
+		}
+
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		if strings.HasPrefix(fields[0], "$") {
+			switch fields[0] {
+			case "$ORIGIN":
+				if len(fields) > 1 {
+					origin = strings.ToLower(strings.TrimSuffix(fields[1], "."))
+				}
+			case "$TTL":
+			default:
+				l.reject(line, fmt.Errorf("unsupported directive '%s'", fields[0]))
+			}
+			continue
+		}
+
+		// Records starting with a blank reuse the previous owner
+		if raw[0] != ' ' && raw[0] != '\t' {
+			owner = fields[0]
+			fields = fields[1:]
+		}
+
+		depth = strings.Count(line, "(") - strings.Count(line, ")")
+
+		rrType, rdata := rpzRecord(fields)
+		switch rrType {
+		case "":
+			l.reject(line, errors.New("missing record type"))
+			continue
+		case "SOA", "NS":
+			continue
+		}
+
+		name, ok := rpzOwner(owner, origin)
+		if !ok {
+			// Zone apex
+			continue
+		}
+
+		if strings.Contains(name, "rpz-") {
+			l.reject(line, errors.New("unsupported trigger"))
+			continue
+		}
+
+		target := &block
+		if rrType == "CNAME" {
+			switch strings.ToLower(rdata) {
+			case "rpz-passthru.":
+				target = &passthru
+			case "rpz-tcp-only.":
+				l.reject(line, errors.New("unsupported action"))
+				continue
+			}
+		}
+
+		if err := target.add(name); err != nil {
+			l.reject(line, err)
+		}
+	}
+
+	block.addTo(l)
+	if len(passthru.exact) > 0 || len(passthru.wildcards) > 0 {
+		passthru.addTo(l.exceptions())
+	}
+}
+
+// rpzRecord returns the type and the first rdata field of a record, skipping the
+// optional TTL and class.
+func rpzRecord(fields []string) (string, string) {
+	for i, f := range fields {
+		upper := strings.ToUpper(f)
+		if upper == "IN" || strings.Trim(f, "0123456789") == "" {
+			continue
+		}
+
+		if i+1 < len(fields) {
+			return upper, fields[i+1]
+		}
+		return upper, ""
+	}
+
+	return "", ""
+}
+
+// rpzOwner returns the policy name of a record owner, relative to the zone
+// origin. It returns false for the zone apex.
+func rpzOwner(owner string, origin string) (string, bool) {
+	if owner == "@" {
+		return "", false
+	}
+
+	name, absolute := strings.CutSuffix(strings.ToLower(owner), ".")
+	if !absolute || origin == "" {
+		return name, true
+	}
+
+	if name == origin {
+		return "", false
+	}
+
+	return strings.TrimSuffix(name, "."+origin), true
+}
+
+// addDomain adds a domain, or a wildcard rule if it contains a "*".
+func (l *List) addDomain(s string) error {
+	if strings.Contains(s, "*") {
+		s = strings.ToLower(s)
+		rule, err := filter.NewRegexRule(s, wildcardToRegex(s))
+		if err != nil {
+			return err
+		}
+		l.Rules = append(l.Rules, rule)
+		return nil
+	}
+
+	domain, err := normalizeDomain(s)
+	if err != nil {
+		return err
+	}
+	l.Domains = append(l.Domains, domain)
+
+	return nil
+}
+
+// normalizeDomain lowercases a domain, converts it to punycode and removes its
+// trailing dot. It returns an error if the result is not a valid host name.
+func normalizeDomain(s string) (string, error) {
+	domain := strings.TrimSuffix(s, ".")
+
+	if !isASCII(domain) {
+		ascii, err := idnaProfile.ToASCII(domain)
+		if err != nil {
+			return "", fmt.Errorf("invalid domain '%s': %w", s, err)
+		}
+		domain = ascii
+	}
+
+	domain = strings.ToLower(domain)
+	if !isHostname(domain) {
+		return "", fmt.Errorf("invalid domain '%s'", s)
+	}
+
+	return domain, nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isHostname returns true if s is a valid lowercase host name. Underscores are
+// allowed, since they are common in blocklists.
+func isHostname(s string) bool {
+	if s == "" || len(s) > 253 {
+		return false
+	}
+
+	// Addresses are not host names
+	if _, err := netip.ParseAddr(s); err == nil {
+		return false
+	}
+
+	for label := range strings.SplitSeq(s, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+				return false
+			}
+		}
+	}
+
+	return true
+}
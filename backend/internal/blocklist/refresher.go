@@ -0,0 +1,109 @@
+package blocklist
+
+import (
+	"gohole/internal/filter"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// UpdateFunc is called with the filters built out of freshly loaded lists.
+type UpdateFunc func(blockFilter filter.Filter, allowFilter filter.Filter)
+
+// Refresher reloads the lists periodically and on demand and, when any of them
+// changed, rebuilds the filters and hands them to an UpdateFunc.
+type Refresher struct {
+	loader *Loader
+	// interval is zero if the lists are reloaded on demand only.
+	interval time.Duration
+	strategy filter.Strategy
+	update   UpdateFunc
+	trigger  chan struct{}
+	done     chan struct{}
+	l        *slog.Logger
+
+	// mu ensures that filters are updated in the order the lists are loaded.
+	mu sync.Mutex
+}
+
+func NewRefresher(
+	loader *Loader,
+	interval time.Duration,
+	strategy filter.Strategy,
+	update UpdateFunc,
+) *Refresher {
+	return &Refresher{
+		loader:   loader,
+		interval: interval,
+		strategy: strategy,
+		update:   update,
+		trigger:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		l:        slog.With("component", "blocklist-refresher"),
+	}
+}
+
+func (r *Refresher) ID() string {
+	return "Blocklist-refresher"
+}
+
+func (r *Refresher) Start() error {
+	r.l.Info("Started blocklist refresher", "interval", r.interval)
+
+	// A nil channel never fires, hence without interval only triggers refresh
+	var tick <-chan time.Time
+	if r.interval > 0 {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-r.done:
+			return nil
+		case <-tick:
+			r.Refresh()
+		case <-r.trigger:
+			r.Refresh()
+		}
+	}
+}
+
+// Trigger requests a refresh without waiting for it. Requests made while a
+// refresh is pending are merged into it.
+func (r *Refresher) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Refresher) Stop() error {
+	r.l.Info("Stopping blocklist refresher")
+	close(r.done)
+	return nil
+}
+
+// Refresh reloads the lists and updates the filters if any of them changed. On
+// error, the current filters are kept.
+func (r *Refresher) Refresh() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lists, changed, err := r.loader.Load()
+	if err != nil {
+		r.l.Error("Refreshing blocklists", "error", err)
+		return
+	}
+
+	if !changed {
+		r.l.Info("Blocklists are up to date")
+		return
+	}
+
+	blockFilter, allowFilter := BuildFilters(r.strategy, lists.Block, lists.Allow)
+	r.update(blockFilter, allowFilter)
+
+	r.l.Info("Refreshed blocklists", "entries", blockFilter.Size())
+}
@@ -1,16 +1,56 @@
 package dns
 
 import (
+	"container/list"
+	"gohole/internal/filter"
+	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
 	"codeberg.org/miekg/dns"
 )
 
+const (
+	// defaultCacheMaxEntries is the number of entries the cache holds by default.
+	defaultCacheMaxEntries = 10_000
+	// defaultCacheMaxMemory is the approximate memory, in MiB, the cache uses at
+	// most by default.
+	defaultCacheMaxMemory = 32
+
+	// blockedTTL is how long blocked entries are cached, as they have no TTL of
+	// their own. It also bounds how long a change of the lists takes to apply to
+	// the cached names.
+	blockedTTL = time.Hour
+	// cacheSweepInterval is how often the expired entries are removed.
+	cacheSweepInterval = time.Minute
+	// maxNegativeTTL caps how long negative answers are cached (RFC 2308, section 5).
+	maxNegativeTTL = 3 * 60 * 60
+	// staleTTL is the TTL of the stale answers (RFC 8767, section 4).
+	staleTTL = 30
+
+	// prefetchMinHits is how many times an entry must have been read to be
+	// prefetched, so that only the popular names are.
+	prefetchMinHits = 3
+	// prefetchMinTTL is the TTL below which entries are not prefetched, as they
+	// would be refreshed all the time.
+	prefetchMinTTL = 10 * time.Second
+	// prefetchWindow is the fraction of their TTL entries have left when they
+	// are prefetched.
+	prefetchWindow = 0.1
+
+	// entryOverhead and rrOverhead approximate the memory used by an entry and
+	// by each of its records, besides the names and the wire size of the records.
+	entryOverhead = 200
+	rrOverhead    = 64
+)
+
 type CacheKey struct {
 	Name  string
 	Type  uint16
 	Class uint16
+	// Route is the conditional forwarding route of the name, if any.
+	Route string
 }
 
 func NewCacheKey(question dns.RR) CacheKey {
@@ -22,77 +62,528 @@ func NewCacheKey(question dns.RR) CacheKey {
 }
 
 type CacheEntry struct {
+	// Rcode, Answer, Ns and Extra are the cached response. On a cache hit, the
+	// TTLs of the records are the time they have left.
+	Rcode      uint16
 	Answer     []dns.RR
+	Ns         []dns.RR
+	Extra      []dns.RR
 	Expiration time.Time
-	allowed    bool
+	// Stored is when the entry was cached.
+	Stored  time.Time
+	Allowed bool
+	// Match is the list entry a blocked entry was blocked by.
+	Match *filter.Match
+	// Prefetch is set on the cache hit that should refresh the entry, as it is
+	// popular and about to expire.
+	Prefetch bool
+}
+
+// CacheStats are the counters of the cache since it was created, and its
+// current size.
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	// StaleHits counts the expired entries served because the upstreams failed.
+	StaleHits  uint64 `json:"staleHits"`
+	Prefetches uint64 `json:"prefetches"`
+	Evictions  uint64 `json:"evictions"`
+	// Expirations counts the entries removed because their TTL elapsed.
+	Expirations uint64 `json:"expirations"`
+	Entries     int    `json:"entries"`
+	// Bytes is the approximate memory used by the entries.
+	Bytes      int64 `json:"bytes"`
+	MaxEntries int   `json:"maxEntries"`
+	MaxBytes   int64 `json:"maxBytes"`
 }
 
 //go:generate go tool go.uber.org/mock/mockgen -destination=../../mock/dns/cache.go -typed -source=cache.go
 type Cache interface {
-	// Get retrieves a cached DNS response for the given key.
-	// It returns a boolean indicating whether the entry
-	// should be allowed, the cached message, and a boolean
+	// Get retrieves the cached entry for the given key, and a boolean
 	// indicating if the entry was found.
-	Get(key CacheKey) (bool, []dns.RR, bool)
-	SetBlocked(key CacheKey)
-	Set(key CacheKey, answer []dns.RR, ttl uint32)
+	Get(key CacheKey) (CacheEntry, bool)
+	// Peek is like Get, without side effects: the entry is not marked as
+	// used, neither for the eviction nor for the prefetching, and the stats
+	// are left as is.
+	Peek(key CacheKey) (CacheEntry, bool)
+	// GetStale retrieves an entry even if it expired, as long as it is within
+	// the stale window, to answer when it cannot be refreshed (RFC 8767).
+	GetStale(key CacheKey) (CacheEntry, bool)
+	SetBlocked(key CacheKey, match *filter.Match)
+	// Set caches resp for ttl seconds, see responseTTL.
+	Set(key CacheKey, resp *dns.Msg, ttl uint32)
+	// Sweep removes the expired entries past the stale window, and returns how
+	// many there were.
+	Sweep() int
+	// FlushFiltered removes the entries depending on the filters, i.e. the ones
+	// of the names without a forwarding route, and returns how many there were.
+	// It is called when the filters change, as their verdicts may differ.
+	FlushFiltered() int
+	Stats() CacheStats
+	// Items returns the entries of the cache that can still be served, the
+	// most recently used first. Blocked entries are left out.
+	Items() []CacheItem
+	// Restore adds entries returned by Items, unless they can no longer be
+	// served or are already cached, and returns how many were added.
+	Restore(items []CacheItem) int
 }
 
+// CacheItem is an entry of the cache along with its key.
+type CacheItem struct {
+	Key   CacheKey
+	Entry CacheEntry
+}
+
+// CacheOptions configures the cache. The least recently used entries are
+// evicted to stay within both size limits.
+type CacheOptions struct {
+	MaxEntries int
+	// MaxBytes is the approximate memory the entries may use.
+	MaxBytes int64
+	// StaleWindow is how long the entries are kept after they expire, to be
+	// served stale. Entries are not served stale if zero.
+	StaleWindow time.Duration
+	// Prefetch flags the popular entries to be refreshed shortly before they
+	// expire.
+	Prefetch bool
+}
+
+// lruItem is an entry of the cache, as stored in its LRU list.
+type lruItem struct {
+	key   CacheKey
+	entry CacheEntry
+	size  int64
+	// hits counts the reads of the entry, and prefetching is set once it has
+	// been flagged to be prefetched.
+	hits        int
+	prefetching bool
+}
+
+// cacheImpl is an LRU cache: the most recently used entries are at the front
+// of the list, and the entries are evicted from its back.
 type cacheImpl struct {
-	mu    sync.RWMutex
-	items map[CacheKey]*CacheEntry
+	opts CacheOptions
+
+	mu    sync.Mutex
+	items map[CacheKey]*list.Element
+	lru   *list.List
+	bytes int64
+	stats CacheStats
 }
 
-func NewCache() Cache {
+// NewCache returns a cache configured by opts. Zero size limits get the defaults.
+func NewCache(opts CacheOptions) Cache {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultCacheMaxEntries
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultCacheMaxMemory << 20
+	}
+
 	return &cacheImpl{
-		items: make(map[CacheKey]*CacheEntry),
+		opts:  opts,
+		items: make(map[CacheKey]*list.Element),
+		lru:   list.New(),
+	}
+}
+
+func (c *cacheImpl) Get(key CacheKey) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		return CacheEntry{}, false
+	}
+
+	item := elem.Value.(*lruItem)
+	now := time.Now()
+	if now.After(item.entry.Expiration) {
+		// Expired entries are kept to be served stale, until the window is over
+		if c.pastStaleWindow(item, now) {
+			c.remove(elem)
+			c.stats.Expirations++
+		}
+		c.stats.Misses++
+		return CacheEntry{}, false
+	}
+
+	c.lru.MoveToFront(elem)
+	c.stats.Hits++
+	item.hits++
+
+	entry := item.entry.elapsed(now)
+	if c.shouldPrefetch(item, now) {
+		item.prefetching = true
+		entry.Prefetch = true
+		c.stats.Prefetches++
+	}
+
+	return entry, true
+}
+
+func (c *cacheImpl) Peek(key CacheKey) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return CacheEntry{}, false
 	}
+
+	item := elem.Value.(*lruItem)
+	now := time.Now()
+	if now.After(item.entry.Expiration) {
+		return CacheEntry{}, false
+	}
+
+	return item.entry.elapsed(now), true
 }
 
-func (c *cacheImpl) Get(key CacheKey) (bool, []dns.RR, bool) {
-	c.mu.RLock()
-	entry, ok := c.items[key]
-	c.mu.RUnlock()
+func (c *cacheImpl) GetStale(key CacheKey) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	// If the entry is not found return false
+	elem, ok := c.items[key]
 	if !ok {
-		return false, nil, false
+		return CacheEntry{}, false
+	}
+
+	item := elem.Value.(*lruItem)
+	now := time.Now()
+	if !item.entry.Allowed || c.pastStaleWindow(item, now) {
+		return CacheEntry{}, false
+	}
+
+	c.lru.MoveToFront(elem)
+
+	if !now.After(item.entry.Expiration) {
+		c.stats.Hits++
+		return item.entry.elapsed(now), true
 	}
 
-	// Blocked entries do not expire
-	if entry.allowed && time.Now().After(entry.Expiration) {
-		c.mu.Lock()
-		defer c.mu.Unlock()
+	c.stats.StaleHits++
+	return item.entry.stale(), true
+}
+
+// pastStaleWindow reports whether an entry can no longer be served, even stale.
+func (c *cacheImpl) pastStaleWindow(item *lruItem, now time.Time) bool {
+	return now.After(item.entry.Expiration.Add(c.opts.StaleWindow))
+}
+
+// shouldPrefetch reports whether an entry is to be refreshed in the background:
+// it is popular, has a long enough TTL, and most of it has elapsed.
+func (c *cacheImpl) shouldPrefetch(item *lruItem, now time.Time) bool {
+	if !c.opts.Prefetch || !item.entry.Allowed || item.prefetching || item.hits < prefetchMinHits {
+		return false
+	}
+
+	ttl := item.entry.Expiration.Sub(item.entry.Stored)
+	if ttl < prefetchMinTTL {
+		return false
+	}
+
+	return item.entry.Expiration.Sub(now) <= time.Duration(float64(ttl)*prefetchWindow)
+}
+
+// elapsed returns a copy of the entry whose records have the TTLs left at now.
+func (e CacheEntry) elapsed(now time.Time) CacheEntry {
+	age := uint32(now.Sub(e.Stored) / time.Second)
+
+	return e.withTTLs(func(ttl uint32) uint32 {
+		if ttl > age {
+			return ttl - age
+		}
+		return 0
+	})
+}
+
+// stale returns a copy of an expired entry whose records have the TTL of the
+// stale answers.
+func (e CacheEntry) stale() CacheEntry {
+	return e.withTTLs(func(uint32) uint32 { return staleTTL })
+}
+
+// withTTLs returns a copy of the entry with the TTLs of its records mapped by
+// f. The cached records are not modified, as they are shared by the cache hits.
+func (e CacheEntry) withTTLs(f func(ttl uint32) uint32) CacheEntry {
+	mapTTLs := func(rrs []dns.RR) []dns.RR {
+		if rrs == nil {
+			return nil
+		}
 
-		// Re-check after acquiring write lock
-		entry, ok := c.items[key]
-		if !ok || time.Now().After(entry.Expiration) {
-			// Entry is expired, remove it from cache and return false
-			delete(c.items, key)
-			return false, nil, false
+		out := make([]dns.RR, len(rrs))
+		for i, rr := range rrs {
+			out[i] = rr.Clone()
+			out[i].Header().TTL = f(rr.Header().TTL)
 		}
+		return out
 	}
 
-	// Entry is valid, return the cached message
-	return entry.allowed, entry.Answer, true
+	e.Answer = mapTTLs(e.Answer)
+	e.Ns = mapTTLs(e.Ns)
+	e.Extra = mapTTLs(e.Extra)
+
+	return e
 }
 
-func (c *cacheImpl) SetBlocked(key CacheKey) {
+func (c *cacheImpl) SetBlocked(key CacheKey, match *filter.Match) {
+	now := time.Now()
+	c.set(key, CacheEntry{
+		Expiration: now.Add(blockedTTL),
+		Stored:     now,
+		Allowed:    false,
+		Match:      match,
+	})
+}
+
+func (c *cacheImpl) Set(key CacheKey, resp *dns.Msg, ttl uint32) {
+	now := time.Now()
+	c.set(key, CacheEntry{
+		Rcode:      resp.Rcode,
+		Answer:     resp.Answer,
+		Ns:         resp.Ns,
+		Extra:      resp.Extra,
+		Expiration: now.Add(time.Duration(ttl) * time.Second),
+		Stored:     now,
+		Allowed:    true,
+	})
+}
+
+// responseTTL returns how long resp can be cached, in seconds. The boolean is
+// false if it must not be cached.
+//
+// Positive answers are cached for the lowest TTL of their records. Negative
+// answers, NXDOMAIN or NODATA (NOERROR without answer), are cached for the TTL
+// of the SOA record of their authority section, bounded by its minimum field,
+// as in RFC 2308. They are not cached without SOA record.
+func responseTTL(resp *dns.Msg) (uint32, bool) {
+	if resp.Truncated {
+		return 0, false
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return 0, false
+	}
+
+	var ttl uint32
+	found := false
+	lower := func(t uint32) {
+		if !found || t < ttl {
+			ttl = t
+			found = true
+		}
+	}
+
+	if resp.Rcode == dns.RcodeNameError || len(resp.Answer) == 0 {
+		var soa *dns.SOA
+		for _, rr := range resp.Ns {
+			if s, ok := rr.(*dns.SOA); ok {
+				soa = s
+				break
+			}
+		}
+		if soa == nil {
+			return 0, false
+		}
+
+		lower(maxNegativeTTL)
+		lower(soa.Hdr.TTL)
+		lower(soa.SOA.Minttl)
+	}
+
+	for _, section := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range section {
+			lower(rr.Header().TTL)
+		}
+	}
+
+	return ttl, found && ttl > 0
+}
+
+func (c *cacheImpl) set(key CacheKey, entry CacheEntry) {
+	item := &lruItem{key: key, entry: entry, size: entrySize(key, entry)}
+	// An entry larger than the cache would evict everything, and then itself
+	if item.size > c.opts.MaxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+
+	c.push(item)
+}
+
+func (c *cacheImpl) Items() []CacheItem {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.items[key] = &CacheEntry{
-		allowed: false,
+	now := time.Now()
+	items := make([]CacheItem, 0, len(c.items))
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		item := elem.Value.(*lruItem)
+		if item.entry.Allowed && !c.pastStaleWindow(item, now) {
+			items = append(items, CacheItem{Key: item.key, Entry: item.entry})
+		}
 	}
+
+	return items
 }
 
-func (c *cacheImpl) Set(key CacheKey, answer []dns.RR, ttl uint32) {
+func (c *cacheImpl) Restore(items []CacheItem) int {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.items[key] = &CacheEntry{
-		Answer:     answer,
-		Expiration: time.Now().Add(time.Duration(ttl) * time.Second),
-		allowed:    true,
+	now := time.Now()
+	restored := 0
+	// The least recently used entries are pushed first, to keep their order
+	for _, it := range slices.Backward(items) {
+		if _, ok := c.items[it.Key]; ok || !it.Entry.Allowed {
+			continue
+		}
+
+		it.Entry.Prefetch = false
+		item := &lruItem{key: it.Key, entry: it.Entry, size: entrySize(it.Key, it.Entry)}
+		if item.size > c.opts.MaxBytes || c.pastStaleWindow(item, now) {
+			continue
+		}
+
+		c.push(item)
+		restored++
 	}
+
+	return restored
+}
+
+// push adds an item at the front of the LRU list, and evicts the least
+// recently used ones to stay within the limits. The caller must hold the lock.
+func (c *cacheImpl) push(item *lruItem) {
+	c.items[item.key] = c.lru.PushFront(item)
+	c.bytes += item.size
+
+	for len(c.items) > c.opts.MaxEntries || c.bytes > c.opts.MaxBytes {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *cacheImpl) Sweep() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for elem := c.lru.Back(); elem != nil; {
+		prev := elem.Prev()
+		if c.pastStaleWindow(elem.Value.(*lruItem), now) {
+			c.remove(elem)
+			removed++
+		}
+		elem = prev
+	}
+	c.stats.Expirations += uint64(removed)
+
+	return removed
+}
+
+func (c *cacheImpl) FlushFiltered() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for elem := c.lru.Back(); elem != nil; {
+		prev := elem.Prev()
+		if elem.Value.(*lruItem).key.Route == "" {
+			c.remove(elem)
+			removed++
+		}
+		elem = prev
+	}
+
+	return removed
+}
+
+func (c *cacheImpl) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = len(c.items)
+	stats.Bytes = c.bytes
+	stats.MaxEntries = c.opts.MaxEntries
+	stats.MaxBytes = c.opts.MaxBytes
+
+	return stats
+}
+
+// remove deletes an entry. The caller must hold the lock.
+func (c *cacheImpl) remove(elem *list.Element) {
+	item := c.lru.Remove(elem).(*lruItem)
+	delete(c.items, item.key)
+	c.bytes -= item.size
+}
+
+// entrySize approximates the memory used by an entry.
+func entrySize(key CacheKey, entry CacheEntry) int64 {
+	size := entryOverhead + len(key.Name) + len(key.Route)
+	for _, section := range [][]dns.RR{entry.Answer, entry.Ns, entry.Extra} {
+		for _, rr := range section {
+			size += rrOverhead + rr.Len()
+		}
+	}
+	if entry.Match != nil {
+		size += len(entry.Match.List) + len(entry.Match.Rule)
+	}
+
+	return int64(size)
+}
+
+// CacheSweeper periodically removes the expired entries of a cache, which
+// would otherwise stay until they are read again or evicted.
+type CacheSweeper struct {
+	cache    Cache
+	interval time.Duration
+	done     chan struct{}
+	l        *slog.Logger
+}
+
+func NewCacheSweeper(cache Cache) *CacheSweeper {
+	return &CacheSweeper{
+		cache:    cache,
+		interval: cacheSweepInterval,
+		done:     make(chan struct{}),
+		l:        slog.With("component", "cache-sweeper"),
+	}
+}
+
+func (s *CacheSweeper) ID() string {
+	return "DNS-cache-sweeper"
+}
+
+func (s *CacheSweeper) Start() error {
+	s.l.Info("Started DNS cache sweeper", "interval", s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case <-ticker.C:
+			if removed := s.cache.Sweep(); removed > 0 {
+				s.l.Debug("Removed expired cache entries", "count", removed)
+			}
+		}
+	}
+}
+
+func (s *CacheSweeper) Stop() error {
+	s.l.Info("Stopping DNS cache sweeper")
+	close(s.done)
+	return nil
 }
@@ -0,0 +1,155 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"codeberg.org/miekg/dns"
+	"codeberg.org/miekg/dns/rdata"
+)
+
+func newTTLRecord(rr dns.RR, ttl uint32) dns.RR {
+	rr.Header().TTL = ttl
+	return rr
+}
+
+func aRecord(ttl uint32) dns.RR {
+	return newTTLRecord(&dns.A{
+		Hdr: dns.Header{Name: "example.com.", Class: dns.ClassINET},
+		A:   rdata.A{Addr: netip.MustParseAddr("192.0.2.1")},
+	}, ttl)
+}
+
+func soaRecord(ttl, minttl uint32) dns.RR {
+	return newTTLRecord(&dns.SOA{
+		Hdr: dns.Header{Name: "example.com.", Class: dns.ClassINET},
+		SOA: rdata.SOA{Ns: "ns.example.com.", Mbox: "admin.example.com.", Minttl: minttl},
+	}, ttl)
+}
+
+func TestResponseTTL(t *testing.T) {
+	tests := map[string]struct {
+		rcode     uint16
+		answer    []dns.RR
+		ns        []dns.RR
+		truncated bool
+		want      uint32
+		wantOk    bool
+	}{
+		"positive":                {answer: []dns.RR{aRecord(300), aRecord(60)}, want: 60, wantOk: true},
+		"positive with authority": {answer: []dns.RR{aRecord(300)}, ns: []dns.RR{soaRecord(30, 900)}, want: 30, wantOk: true},
+		"nxdomain":                {rcode: dns.RcodeNameError, ns: []dns.RR{soaRecord(3600, 900)}, want: 900, wantOk: true},
+		"nxdomain with lower TTL": {rcode: dns.RcodeNameError, ns: []dns.RR{soaRecord(60, 900)}, want: 60, wantOk: true},
+		"nodata":                  {ns: []dns.RR{soaRecord(3600, 300)}, want: 300, wantOk: true},
+		"negative capped":         {ns: []dns.RR{soaRecord(86400, 86400)}, want: maxNegativeTTL, wantOk: true},
+		"nxdomain after a CNAME":  {rcode: dns.RcodeNameError, answer: []dns.RR{aRecord(10)}, ns: []dns.RR{soaRecord(3600, 900)}, want: 10, wantOk: true},
+		"negative without SOA":    {rcode: dns.RcodeNameError},
+		"nodata without SOA":      {},
+		"servfail":                {rcode: dns.RcodeServerFailure, ns: []dns.RR{soaRecord(3600, 900)}},
+		"truncated":               {answer: []dns.RR{aRecord(300)}, truncated: true},
+		"zero TTL":                {answer: []dns.RR{aRecord(0)}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp := new(dns.Msg)
+			resp.Rcode = tt.rcode
+			resp.Answer = tt.answer
+			resp.Ns = tt.ns
+			resp.Truncated = tt.truncated
+
+			got, ok := responseTTL(resp)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("responseTTL() = %d, %v, want %d, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestCacheEntry_Elapsed(t *testing.T) {
+	stored := time.Now()
+	entry := CacheEntry{
+		Rcode:  dns.RcodeSuccess,
+		Answer: []dns.RR{aRecord(300), aRecord(20)},
+		Ns:     []dns.RR{soaRecord(3600, 900)},
+		Stored: stored,
+	}
+
+	got := entry.elapsed(stored.Add(30 * time.Second))
+
+	for i, want := range []uint32{270, 0} {
+		if ttl := got.Answer[i].Header().TTL; ttl != want {
+			t.Errorf("expected answer %d to have TTL %d, got %d", i, want, ttl)
+		}
+	}
+	if ttl := got.Ns[0].Header().TTL; ttl != 3570 {
+		t.Errorf("expected the authority TTL 3570, got %d", ttl)
+	}
+	if got.Extra != nil {
+		t.Errorf("expected no additional records, got %v", got.Extra)
+	}
+
+	// The cached records are left untouched
+	if ttl := entry.Answer[0].Header().TTL; ttl != 300 {
+		t.Errorf("expected the cached record to keep TTL 300, got %d", ttl)
+	}
+}
+
+func TestCache_Prefetch(t *testing.T) {
+	c := NewCache(CacheOptions{Prefetch: true}).(*cacheImpl)
+	key := CacheKey{Name: "example.com.", Type: dns.TypeA, Class: dns.ClassINET}
+	resp := new(dns.Msg)
+	resp.Answer = []dns.RR{aRecord(100)}
+	c.Set(key, resp, 100)
+
+	// age moves the entry back in time, as if it was stored d ago
+	age := func(d time.Duration) {
+		item := c.items[key].Value.(*lruItem)
+		item.entry.Stored = item.entry.Stored.Add(-d)
+		item.entry.Expiration = item.entry.Expiration.Add(-d)
+	}
+
+	// Popular, but far from expiring
+	for range prefetchMinHits {
+		if entry, _ := c.Get(key); entry.Prefetch {
+			t.Fatal("expected no prefetch of a fresh entry")
+		}
+	}
+
+	age(95 * time.Second)
+	entry, ok := c.Get(key)
+	if !ok || !entry.Prefetch {
+		t.Fatal("expected the entry to be prefetched")
+	}
+
+	// Only one of the hits triggers the prefetch
+	if entry, _ := c.Get(key); entry.Prefetch {
+		t.Error("expected a single prefetch")
+	}
+	if stats := c.Stats(); stats.Prefetches != 1 {
+		t.Errorf("expected 1 prefetch, got %d", stats.Prefetches)
+	}
+
+	// Refreshing the entry allows it to be prefetched again later
+	c.Set(key, resp, 100)
+	if entry, _ := c.Get(key); entry.Prefetch {
+		t.Error("expected no prefetch of a refreshed entry")
+	}
+}
+
+func TestCache_PrefetchUnpopular(t *testing.T) {
+	c := NewCache(CacheOptions{Prefetch: true}).(*cacheImpl)
+	key := CacheKey{Name: "example.com.", Type: dns.TypeA, Class: dns.ClassINET}
+	resp := new(dns.Msg)
+	resp.Answer = []dns.RR{aRecord(100)}
+	c.Set(key, resp, 100)
+
+	item := c.items[key].Value.(*lruItem)
+	item.entry.Stored = item.entry.Stored.Add(-95 * time.Second)
+	item.entry.Expiration = item.entry.Expiration.Add(-95 * time.Second)
+
+	if entry, _ := c.Get(key); entry.Prefetch {
+		t.Error("expected no prefetch of an entry read once")
+	}
+}
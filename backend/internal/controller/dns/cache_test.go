@@ -1,14 +1,17 @@
 package dns_test
 
 import (
+	"fmt"
 	"net/netip"
 	"testing"
 	"time"
 
 	gdns "codeberg.org/miekg/dns"
 	"codeberg.org/miekg/dns/rdata"
+	"github.com/specialfish9/confuso/v2"
 
 	"gohole/internal/controller/dns"
+	"gohole/internal/filter"
 )
 
 func newARecord(name string, addr string) gdns.RR {
@@ -21,6 +24,12 @@ func newARecord(name string, addr string) gdns.RR {
 	}
 }
 
+func newResponse(answer ...gdns.RR) *gdns.Msg {
+	resp := new(gdns.Msg)
+	resp.Answer = answer
+	return resp
+}
+
 func TestNewCacheKey(t *testing.T) {
 	rr := newARecord("example.com.", "1.2.3.4")
 	key := dns.NewCacheKey(rr)
@@ -37,92 +46,342 @@ func TestNewCacheKey(t *testing.T) {
 }
 
 func TestCache_GetMiss(t *testing.T) {
-	c := dns.NewCache()
+	c := dns.NewCache(dns.CacheOptions{})
 	key := dns.CacheKey{Name: "example.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
 
-	allowed, rr, found := c.Get(key)
+	entry, found := c.Get(key)
 	if found {
 		t.Error("expected cache miss, got hit")
 	}
-	if allowed {
+	if entry.Allowed {
 		t.Error("expected allowed=false on miss")
 	}
-	if rr != nil {
+	if entry.Answer != nil {
 		t.Error("expected nil RR on miss")
 	}
 }
 
 func TestCache_SetAndGet(t *testing.T) {
-	c := dns.NewCache()
+	c := dns.NewCache(dns.CacheOptions{})
 	rr := newARecord("example.com.", "1.2.3.4")
 	key := dns.CacheKey{Name: "example.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
 
-	c.Set(key, []gdns.RR{rr}, 60)
+	c.Set(key, newResponse(rr), 60)
 
-	allowed, got, found := c.Get(key)
+	entry, found := c.Get(key)
+	got := entry.Answer
 	if !found {
 		t.Fatal("expected cache hit, got miss")
 	}
-	if !allowed {
+	if !entry.Allowed {
 		t.Error("expected allowed=true for Set entry")
 	}
 	if len(got) != 1 {
 		t.Fatalf("expected 1 RR in answer, got %d", len(got))
 	}
-	if got[0] != rr {
-		t.Error("expected the same RR back from cache")
+	if got[0].String() != rr.String() {
+		t.Errorf("expected %s back from cache, got %s", rr, got[0])
 	}
 }
 
 func TestCache_SetBlocked(t *testing.T) {
-	c := dns.NewCache()
+	c := dns.NewCache(dns.CacheOptions{})
 	key := dns.CacheKey{Name: "blocked.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
 
-	c.SetBlocked(key)
+	match := &filter.Match{List: "https://example.com/list", Rule: "blocked.com"}
+	c.SetBlocked(key, match)
 
-	allowed, rr, found := c.Get(key)
+	entry, found := c.Get(key)
 	if !found {
 		t.Fatal("expected cache hit for blocked entry")
 	}
-	if allowed {
+	if entry.Allowed {
 		t.Error("expected allowed=false for blocked entry")
 	}
-	if rr != nil {
+	if entry.Answer != nil {
 		t.Error("expected nil RR for blocked entry")
 	}
+	if entry.Match != match {
+		t.Error("expected the match to be kept with the blocked entry")
+	}
 }
 
 func TestCache_Expiration(t *testing.T) {
-	c := dns.NewCache()
+	c := dns.NewCache(dns.CacheOptions{})
 	rr := newARecord("ttl.com.", "5.6.7.8")
 	key := dns.CacheKey{Name: "ttl.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
 
 	// Set with TTL of 0 seconds — expires immediately
-	c.Set(key, []gdns.RR{rr}, 0)
+	c.Set(key, newResponse(rr), 0)
 
 	// Wait briefly to ensure expiration
 	time.Sleep(10 * time.Millisecond)
 
-	_, _, found := c.Get(key)
+	_, found := c.Get(key)
 	if found {
 		t.Error("expected expired entry to be a cache miss")
 	}
 }
 
 func TestCache_BlockedEntryDoesNotExpire(t *testing.T) {
-	c := dns.NewCache()
+	c := dns.NewCache(dns.CacheOptions{})
 	key := dns.CacheKey{Name: "neverexpire.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
 
-	c.SetBlocked(key)
+	c.SetBlocked(key, nil)
 
-	// Even after some time, blocked entries should remain
+	// Blocked entries have no TTL, they are kept for a long while
 	time.Sleep(10 * time.Millisecond)
 
-	allowed, _, found := c.Get(key)
+	entry, found := c.Get(key)
 	if !found {
 		t.Error("expected blocked entry to persist (not expire)")
 	}
-	if allowed {
+	if entry.Allowed {
 		t.Error("expected allowed=false for blocked entry")
 	}
 }
+
+func TestCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := dns.NewCache(dns.CacheOptions{MaxEntries: 2})
+	keyA := dns.CacheKey{Name: "a.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
+	keyB := dns.CacheKey{Name: "b.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
+	keyC := dns.CacheKey{Name: "c.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
+
+	c.Set(keyA, newResponse(newARecord("a.com.", "1.1.1.1")), 60)
+	c.Set(keyB, newResponse(newARecord("b.com.", "2.2.2.2")), 60)
+
+	// Reading a.com makes b.com the least recently used entry
+	if _, found := c.Get(keyA); !found {
+		t.Fatal("expected cache hit for a.com")
+	}
+	c.Set(keyC, newResponse(newARecord("c.com.", "3.3.3.3")), 60)
+
+	if _, found := c.Get(keyB); found {
+		t.Error("expected b.com to be evicted")
+	}
+	for _, key := range []dns.CacheKey{keyA, keyC} {
+		if _, found := c.Get(key); !found {
+			t.Errorf("expected cache hit for %s", key.Name)
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Entries != 2 || stats.Evictions != 1 {
+		t.Errorf("expected 2 entries and 1 eviction, got %+v", stats)
+	}
+}
+
+func TestCache_MemoryLimit(t *testing.T) {
+	c := dns.NewCache(dns.CacheOptions{MaxEntries: 1000, MaxBytes: 2048})
+
+	for i := range 100 {
+		key := dns.CacheKey{Name: fmt.Sprintf("host%d.com.", i), Type: gdns.TypeA, Class: gdns.ClassINET}
+		c.Set(key, newResponse(newARecord(key.Name, "1.2.3.4")), 60)
+	}
+
+	stats := c.Stats()
+	if stats.Bytes > 2048 {
+		t.Errorf("expected at most 2048 bytes, got %d", stats.Bytes)
+	}
+	if stats.Entries == 0 || stats.Entries == 100 {
+		t.Errorf("expected some of the entries to be evicted, got %d", stats.Entries)
+	}
+	if stats.Evictions != uint64(100-stats.Entries) {
+		t.Errorf("expected %d evictions, got %d", 100-stats.Entries, stats.Evictions)
+	}
+
+	// The most recent entry is kept
+	last := dns.CacheKey{Name: "host99.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
+	if _, found := c.Get(last); !found {
+		t.Error("expected the last entry to be cached")
+	}
+}
+
+func TestCache_Sweep(t *testing.T) {
+	c := dns.NewCache(dns.CacheOptions{})
+	expired := dns.CacheKey{Name: "expired.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
+	valid := dns.CacheKey{Name: "valid.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
+	blocked := dns.CacheKey{Name: "blocked.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
+
+	c.Set(expired, newResponse(newARecord("expired.com.", "1.1.1.1")), 0)
+	c.Set(valid, newResponse(newARecord("valid.com.", "2.2.2.2")), 60)
+	c.SetBlocked(blocked, nil)
+
+	time.Sleep(10 * time.Millisecond)
+
+	if removed := c.Sweep(); removed != 1 {
+		t.Errorf("expected 1 expired entry, got %d", removed)
+	}
+
+	stats := c.Stats()
+	if stats.Entries != 2 || stats.Expirations != 1 {
+		t.Errorf("expected 2 entries and 1 expiration, got %+v", stats)
+	}
+}
+
+func TestCache_FlushFiltered(t *testing.T) {
+	c := dns.NewCache(dns.CacheOptions{})
+	allowed := dns.CacheKey{Name: "example.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
+	blocked := dns.CacheKey{Name: "ads.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
+	routed := dns.CacheKey{Name: "nas.lan.", Type: gdns.TypeA, Class: gdns.ClassINET, Route: "lan."}
+
+	c.Set(allowed, newResponse(newARecord("example.com.", "1.2.3.4")), 300)
+	c.SetBlocked(blocked, nil)
+	c.Set(routed, newResponse(newARecord("nas.lan.", "192.168.1.10")), 300)
+
+	if removed := c.FlushFiltered(); removed != 2 {
+		t.Errorf("expected 2 entries removed, got %d", removed)
+	}
+	for _, key := range []dns.CacheKey{allowed, blocked} {
+		if _, found := c.Get(key); found {
+			t.Errorf("expected %s to be flushed", key.Name)
+		}
+	}
+	// The names with a forwarding route are not filtered
+	if _, found := c.Get(routed); !found {
+		t.Error("expected the entry of the forwarded name to be kept")
+	}
+}
+
+func TestCache_Peek(t *testing.T) {
+	c := dns.NewCache(dns.CacheOptions{MaxEntries: 2})
+	a := dns.CacheKey{Name: "a.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
+	b := dns.CacheKey{Name: "b.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
+
+	c.Set(a, newResponse(newARecord("a.com.", "1.2.3.4")), 60)
+	c.Set(b, newResponse(newARecord("b.com.", "5.6.7.8")), 60)
+
+	if _, found := c.Peek(a); !found {
+		t.Fatal("expected a.com. to be found")
+	}
+	if stats := c.Stats(); stats.Hits != 0 || stats.Misses != 0 {
+		t.Errorf("expected the stats to be left as is, got %+v", stats)
+	}
+
+	// a.com. is still the least recently used entry
+	c.Set(dns.CacheKey{Name: "c.com.", Type: gdns.TypeA, Class: gdns.ClassINET}, newResponse(newARecord("c.com.", "9.9.9.9")), 60)
+	if _, found := c.Peek(a); found {
+		t.Error("expected a.com. to be evicted")
+	}
+}
+
+func TestCache_Stats(t *testing.T) {
+	c := dns.NewCache(dns.CacheOptions{MaxEntries: 10, MaxBytes: 1 << 20})
+	key := dns.CacheKey{Name: "example.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
+
+	c.Get(key)
+	c.Set(key, newResponse(newARecord("example.com.", "1.2.3.4")), 60)
+	c.Get(key)
+	c.Get(key)
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("expected 2 hits and 1 miss, got %+v", stats)
+	}
+	if stats.Entries != 1 || stats.Bytes <= 0 {
+		t.Errorf("expected 1 entry with a positive size, got %+v", stats)
+	}
+	if stats.MaxEntries != 10 || stats.MaxBytes != 1<<20 {
+		t.Errorf("expected the limits in the stats, got %+v", stats)
+	}
+
+	// Replacing an entry does not change the count
+	c.Set(key, newResponse(newARecord("example.com.", "5.6.7.8")), 60)
+	if got := c.Stats(); got.Entries != 1 || got.Bytes != stats.Bytes {
+		t.Errorf("expected the entry to be replaced, got %+v", got)
+	}
+}
+
+func TestConfig_CacheOptions(t *testing.T) {
+	opts, err := (&dns.Config{}).CacheOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.MaxEntries != 10_000 || opts.MaxBytes != 32<<20 {
+		t.Errorf("expected the default limits, got %+v", opts)
+	}
+
+	opts, err = (&dns.Config{
+		CacheMaxEntries: confuso.Optional[int]{Value: 500, Ok: true},
+		CacheMaxMemory:  confuso.Optional[int]{Value: 4, Ok: true},
+	}).CacheOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.MaxEntries != 500 || opts.MaxBytes != 4<<20 {
+		t.Errorf("expected the configured limits, got %+v", opts)
+	}
+
+	opts, err = (&dns.Config{
+		CacheServeStale: confuso.Optional[string]{Value: "1h", Ok: true},
+		CachePrefetch:   confuso.Optional[bool]{Value: true, Ok: true},
+	}).CacheOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.StaleWindow != time.Hour || !opts.Prefetch {
+		t.Errorf("expected serve-stale and prefetch, got %+v", opts)
+	}
+	if _, err := (&dns.Config{CacheServeStale: confuso.Optional[string]{Value: "soon", Ok: true}}).CacheOptions(); err == nil {
+		t.Error("expected an error for an invalid stale window")
+	}
+
+	if _, err := (&dns.Config{CacheMaxEntries: confuso.Optional[int]{Value: 0, Ok: true}}).CacheOptions(); err == nil {
+		t.Error("expected an error for a zero entry limit")
+	}
+	if _, err := (&dns.Config{CacheMaxMemory: confuso.Optional[int]{Value: -1, Ok: true}}).CacheOptions(); err == nil {
+		t.Error("expected an error for a negative memory limit")
+	}
+}
+
+func TestCache_ServeStale(t *testing.T) {
+	c := dns.NewCache(dns.CacheOptions{StaleWindow: time.Hour})
+	key := dns.CacheKey{Name: "stale.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
+	rr := newARecord("stale.com.", "1.2.3.4")
+	rr.Header().TTL = 300
+	c.Set(key, newResponse(rr), 0)
+
+	time.Sleep(10 * time.Millisecond)
+
+	if _, found := c.Get(key); found {
+		t.Fatal("expected expired entry to be a cache miss")
+	}
+
+	entry, found := c.GetStale(key)
+	if !found {
+		t.Fatal("expected the expired entry to be served stale")
+	}
+	if ttl := entry.Answer[0].Header().TTL; ttl != 30 {
+		t.Errorf("expected the stale TTL 30, got %d", ttl)
+	}
+
+	// Entries within the stale window are kept by the sweeper
+	if removed := c.Sweep(); removed != 0 {
+		t.Errorf("expected no entry to be swept, got %d", removed)
+	}
+	if stats := c.Stats(); stats.StaleHits != 1 || stats.Entries != 1 {
+		t.Errorf("expected 1 stale hit and 1 entry, got %+v", stats)
+	}
+}
+
+func TestCache_ServeStaleDisabled(t *testing.T) {
+	c := dns.NewCache(dns.CacheOptions{})
+	key := dns.CacheKey{Name: "stale.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
+	c.Set(key, newResponse(newARecord("stale.com.", "1.2.3.4")), 0)
+
+	time.Sleep(10 * time.Millisecond)
+
+	if _, found := c.GetStale(key); found {
+		t.Error("expected no stale entry without stale window")
+	}
+}
+
+func TestCache_BlockedEntryNotServedStale(t *testing.T) {
+	c := dns.NewCache(dns.CacheOptions{StaleWindow: time.Hour})
+	key := dns.CacheKey{Name: "blocked.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
+	c.SetBlocked(key, nil)
+
+	if _, found := c.GetStale(key); found {
+		t.Error("expected blocked entries not to be served stale")
+	}
+}
@@ -0,0 +1,262 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"codeberg.org/miekg/dns"
+)
+
+const (
+	// cacheSnapshotVersion is the version of the format of the snapshots. Files
+	// of another version are ignored.
+	cacheSnapshotVersion = 1
+	// defaultCacheSnapshotInterval is how often the snapshot is written by default.
+	defaultCacheSnapshotInterval = 5 * time.Minute
+)
+
+// cacheSnapshot is the content of a snapshot file.
+type cacheSnapshot struct {
+	Version int                  `json:"version"`
+	Entries []cacheSnapshotEntry `json:"entries"`
+}
+
+// cacheSnapshotEntry is a cache entry in a snapshot. The response is kept in
+// wire format, along with the absolute times the entry was stored and expires.
+type cacheSnapshotEntry struct {
+	Name       string    `json:"name"`
+	Type       uint16    `json:"type"`
+	Class      uint16    `json:"class"`
+	Route      string    `json:"route,omitempty"`
+	Stored     time.Time `json:"stored"`
+	Expiration time.Time `json:"expiration"`
+	Response   []byte    `json:"response"`
+}
+
+// writeCacheSnapshot saves items to path. The file is replaced atomically, so
+// that a crash never leaves a truncated snapshot behind.
+func writeCacheSnapshot(path string, items []CacheItem) error {
+	snapshot := cacheSnapshot{
+		Version: cacheSnapshotVersion,
+		Entries: make([]cacheSnapshotEntry, 0, len(items)),
+	}
+
+	for _, it := range items {
+		m := &dns.Msg{Answer: it.Entry.Answer, Ns: it.Entry.Ns, Extra: it.Entry.Extra}
+		m.Rcode = it.Entry.Rcode
+		m.Response = true
+		if err := m.Pack(); err != nil {
+			slog.Warn("Skipping cache entry in snapshot", "key", it.Key, "error", err)
+			continue
+		}
+
+		snapshot.Entries = append(snapshot.Entries, cacheSnapshotEntry{
+			Name:       it.Key.Name,
+			Type:       it.Key.Type,
+			Class:      it.Key.Class,
+			Route:      it.Key.Route,
+			Stored:     it.Entry.Stored,
+			Expiration: it.Entry.Expiration,
+			Response:   m.Data,
+		})
+	}
+
+	b, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("encoding cache snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("writing cache snapshot: %w", err)
+	}
+
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("writing cache snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// readCacheSnapshot loads the items saved to path. A missing file holds no items.
+func readCacheSnapshot(path string) ([]CacheItem, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading cache snapshot: %w", err)
+	}
+
+	var snapshot cacheSnapshot
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return nil, fmt.Errorf("decoding cache snapshot: %w", err)
+	}
+	if snapshot.Version != cacheSnapshotVersion {
+		return nil, fmt.Errorf("unsupported cache snapshot version %d", snapshot.Version)
+	}
+
+	items := make([]CacheItem, 0, len(snapshot.Entries))
+	for _, e := range snapshot.Entries {
+		m := &dns.Msg{Data: e.Response}
+		if err := m.Unpack(); err != nil {
+			slog.Warn("Skipping invalid cache entry in snapshot", "name", e.Name, "error", err)
+			continue
+		}
+
+		items = append(items, CacheItem{
+			Key: CacheKey{Name: e.Name, Type: e.Type, Class: e.Class, Route: e.Route},
+			Entry: CacheEntry{
+				Rcode:      m.Rcode,
+				Answer:     m.Answer,
+				Ns:         m.Ns,
+				Extra:      m.Extra,
+				Expiration: e.Expiration,
+				Stored:     e.Stored,
+				Allowed:    true,
+			},
+		})
+	}
+
+	return items, nil
+}
+
+// CachePersister keeps the cache across restarts: it restores the snapshot
+// of the cache on startup, then saves it periodically and on shutdown. It can
+// also warm the cache up with the most queried domains, so that a fresh
+// install starts with a populated cache.
+type CachePersister struct {
+	cache    Cache
+	handler  *Handler
+	path     string
+	interval time.Duration
+	warmUp   int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	l      *slog.Logger
+}
+
+// NewCachePersister returns the persister of the cache configured in cfg. The
+// cache is warmed up through handler. It returns nil if neither the snapshot
+// nor the warm-up are enabled.
+func NewCachePersister(cfg *Config, cache Cache, handler *Handler) (*CachePersister, error) {
+	path := cfg.CacheSnapshot.Or("")
+	warmUp := cfg.CacheWarmUp.Or(0)
+	if warmUp < 0 {
+		return nil, fmt.Errorf("dns: cache_warmup must not be negative, got %d", warmUp)
+	}
+	if path == "" && warmUp == 0 {
+		return nil, nil
+	}
+
+	interval := defaultCacheSnapshotInterval
+	if cfg.CacheSnapshotInterval.Ok {
+		var err error
+		interval, err = time.ParseDuration(cfg.CacheSnapshotInterval.Value)
+		if err != nil {
+			return nil, fmt.Errorf("dns: invalid cache_snapshot_interval: %w", err)
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("dns: cache_snapshot_interval must be at least 1s, got %s", interval)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &CachePersister{
+		cache:    cache,
+		handler:  handler,
+		path:     path,
+		interval: interval,
+		warmUp:   warmUp,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		l:        slog.With("component", "cache-persister"),
+	}, nil
+}
+
+func (p *CachePersister) ID() string {
+	return "DNS-cache-persister"
+}
+
+func (p *CachePersister) Start() error {
+	defer close(p.done)
+
+	p.l.Info("Started DNS cache persister", "snapshot", p.path, "interval", p.interval, "warmup", p.warmUp)
+
+	if p.path != "" {
+		items, err := readCacheSnapshot(p.path)
+		if err != nil {
+			// A broken snapshot must not prevent gohole from starting
+			p.l.Warn("Restoring the cache snapshot", "path", p.path, "error", err)
+		} else {
+			p.l.Info("Restored the cache snapshot", "path", p.path, "entries", p.cache.Restore(items))
+		}
+	}
+
+	if p.warmUp > 0 {
+		cached, err := p.handler.WarmUp(p.ctx, p.warmUp)
+		if err != nil {
+			p.l.Warn("Warming up the cache", "error", err)
+		} else {
+			p.l.Info("Warmed up the cache", "entries", cached)
+		}
+	}
+
+	if p.path == "" {
+		return nil
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return nil
+		case <-ticker.C:
+			p.save()
+		}
+	}
+}
+
+func (p *CachePersister) Stop() error {
+	p.l.Info("Stopping DNS cache persister")
+	p.cancel()
+	<-p.done
+
+	if p.path != "" {
+		p.save()
+	}
+
+	return nil
+}
+
+func (p *CachePersister) save() {
+	items := p.cache.Items()
+	if err := writeCacheSnapshot(p.path, items); err != nil {
+		p.l.Error("Saving the cache snapshot", "path", p.path, "error", err)
+		return
+	}
+
+	p.l.Debug("Saved the cache snapshot", "path", p.path, "entries", len(items))
+}
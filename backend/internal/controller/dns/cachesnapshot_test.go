@@ -0,0 +1,171 @@
+package dns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"codeberg.org/miekg/dns"
+	"github.com/specialfish9/confuso/v2"
+)
+
+func TestCacheSnapshot_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	c := NewCache(CacheOptions{})
+	positive := CacheKey{Name: "example.com.", Type: dns.TypeA, Class: dns.ClassINET}
+	negative := CacheKey{Name: "missing.example.com.", Type: dns.TypeA, Class: dns.ClassINET, Route: "example.com"}
+	blocked := CacheKey{Name: "ads.com.", Type: dns.TypeA, Class: dns.ClassINET}
+
+	resp := new(dns.Msg)
+	resp.Answer = []dns.RR{aRecord(300)}
+	c.Set(positive, resp, 300)
+
+	nxdomain := new(dns.Msg)
+	nxdomain.Rcode = dns.RcodeNameError
+	nxdomain.Ns = []dns.RR{soaRecord(3600, 900)}
+	c.Set(negative, nxdomain, 900)
+
+	c.SetBlocked(blocked, nil)
+
+	if err := writeCacheSnapshot(path, c.Items()); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := readCacheSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 entries in the snapshot, got %d", len(items))
+	}
+
+	restored := NewCache(CacheOptions{})
+	if n := restored.Restore(items); n != 2 {
+		t.Fatalf("expected 2 restored entries, got %d", n)
+	}
+
+	entry, ok := restored.Get(positive)
+	if !ok || len(entry.Answer) != 1 || entry.Answer[0].Header().TTL > 300 {
+		t.Errorf("expected the positive answer to be restored, got %+v", entry)
+	}
+
+	original, _ := c.Get(negative)
+	entry, ok = restored.Get(negative)
+	if !ok || entry.Rcode != dns.RcodeNameError || len(entry.Ns) != 1 {
+		t.Errorf("expected the negative answer to be restored, got %+v", entry)
+	}
+	if !entry.Expiration.Equal(original.Expiration) {
+		t.Errorf("expected the expiration %s to be kept, got %s", original.Expiration, entry.Expiration)
+	}
+
+	if _, ok := restored.Get(blocked); ok {
+		t.Error("expected blocked entries not to be saved")
+	}
+}
+
+func TestCacheSnapshot_SkipsExpired(t *testing.T) {
+	now := time.Now()
+	resp := new(dns.Msg)
+	resp.Answer = []dns.RR{aRecord(60)}
+
+	items := []CacheItem{
+		{
+			Key:   CacheKey{Name: "old.com.", Type: dns.TypeA, Class: dns.ClassINET},
+			Entry: CacheEntry{Answer: resp.Answer, Stored: now.Add(-2 * time.Hour), Expiration: now.Add(-time.Hour), Allowed: true},
+		},
+		{
+			Key:   CacheKey{Name: "new.com.", Type: dns.TypeA, Class: dns.ClassINET},
+			Entry: CacheEntry{Answer: resp.Answer, Stored: now, Expiration: now.Add(time.Minute), Allowed: true},
+		},
+	}
+
+	if n := NewCache(CacheOptions{}).Restore(items); n != 1 {
+		t.Errorf("expected the expired entry to be skipped, got %d restored", n)
+	}
+
+	// Within the stale window, expired entries are kept to be served stale
+	if n := NewCache(CacheOptions{StaleWindow: 2 * time.Hour}).Restore(items); n != 2 {
+		t.Errorf("expected the stale entry to be restored, got %d restored", n)
+	}
+}
+
+func TestReadCacheSnapshot_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	items, err := readCacheSnapshot(filepath.Join(dir, "missing.json"))
+	if err != nil || items != nil {
+		t.Errorf("expected no entries for a missing snapshot, got %v, %v", items, err)
+	}
+
+	path := filepath.Join(dir, "cache.json")
+	if err := os.WriteFile(path, []byte(`{"version": 99, "entries": []}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readCacheSnapshot(path); err == nil {
+		t.Error("expected an error for an unknown version")
+	}
+}
+
+func TestCachePersister(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	cfg := &Config{CacheSnapshot: confuso.Optional[string]{Value: path, Ok: true}}
+	key := CacheKey{Name: "example.com.", Type: dns.TypeA, Class: dns.ClassINET}
+
+	// The snapshot is saved on shutdown
+	c := NewCache(CacheOptions{})
+	p, err := NewCachePersister(cfg, c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.Start()
+
+	resp := new(dns.Msg)
+	resp.Answer = []dns.RR{aRecord(300)}
+	c.Set(key, resp, 300)
+
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// And restored on startup
+	restored := NewCache(CacheOptions{})
+	p, err = NewCachePersister(cfg, restored, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.Start()
+	defer p.Stop()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := restored.Get(key); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the snapshot to be restored")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewCachePersister(t *testing.T) {
+	p, err := NewCachePersister(&Config{}, NewCache(CacheOptions{}), nil)
+	if err != nil || p != nil {
+		t.Errorf("expected no persister without snapshot nor warm-up, got %v, %v", p, err)
+	}
+
+	invalid := []*Config{
+		{CacheWarmUp: confuso.Optional[int]{Value: -1, Ok: true}},
+		{
+			CacheSnapshot:         confuso.Optional[string]{Value: "cache.json", Ok: true},
+			CacheSnapshotInterval: confuso.Optional[string]{Value: "often", Ok: true},
+		},
+	}
+	for _, cfg := range invalid {
+		if _, err := NewCachePersister(cfg, NewCache(CacheOptions{}), nil); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"codeberg.org/miekg/dns"
+)
+
+const (
+	// exchangeTimeout bounds the queries sent over the encrypted transports.
+	exchangeTimeout = 5 * time.Second
+	dialTimeout     = 5 * time.Second
+)
+
+// transportClient sends the queries over the transport named by the network:
+// plain DNS for udp and tcp, DNS over TLS or DNS over HTTPS otherwise.
+type transportClient struct {
+	plain Client
+	dot   *DoTClient
+	doh   *DoHClient
+}
+
+// NewClient returns the client used to reach the upstreams, whatever their
+// transport. The connections to the encrypted upstreams are shared by all of
+// the queries.
+func NewClient(cfg *Config) (Client, error) {
+	var bootstrap []string
+	if cfg.Bootstrap.Ok {
+		addresses, err := parseAddresses(cfg.Bootstrap.Value)
+		if err != nil {
+			return nil, fmt.Errorf("dns client: invalid bootstrap servers: %w", err)
+		}
+
+		for _, addr := range addresses {
+			addr, err := addDefaultPort(addr)
+			if err != nil {
+				return nil, fmt.Errorf("dns client: invalid bootstrap server: %w", err)
+			}
+			bootstrap = append(bootstrap, addr)
+		}
+	}
+
+	doh, err := NewDoHClient(newBootstrapDialer(bootstrap), nil, cfg.DoHMethod.Or("post"))
+	if err != nil {
+		return nil, fmt.Errorf("dns client: %w", err)
+	}
+
+	return &transportClient{
+		plain: dns.NewClient(),
+		dot:   NewDoTClient(newBootstrapDialer(bootstrap), nil),
+		doh:   doh,
+	}, nil
+}
+
+func (c *transportClient) Exchange(
+	ctx context.Context,
+	m *dns.Msg,
+	network, address string,
+) (*dns.Msg, time.Duration, error) {
+	switch network {
+	case DoT:
+		return c.dot.Exchange(ctx, m, network, address)
+	case DoH:
+		return c.doh.Exchange(ctx, m, network, address)
+	default:
+		return c.plain.Exchange(ctx, m, network, address)
+	}
+}
+
+// newBootstrapDialer returns a dialer resolving hostnames with the given DNS
+// servers, or with the system resolver if there are none.
+func newBootstrapDialer(servers []string) *net.Dialer {
+	d := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+	if len(servers) == 0 {
+		return d
+	}
+
+	// The resolver must not use d, which would resolve through itself
+	plain := &net.Dialer{Timeout: dialTimeout}
+	d.Resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var errs []error
+			for _, server := range servers {
+				conn, err := plain.DialContext(ctx, network, server)
+				if err == nil {
+					return conn, nil
+				}
+				errs = append(errs, err)
+			}
+			return nil, errors.Join(errs...)
+		},
+	}
+
+	return d
+}
+
+// parseUpstream returns the transport and the address of an upstream, as given
+// to Client.Exchange. An empty network means the protocol of the handler.
+func parseUpstream(upstream string) (Protocol, string, error) {
+	var network Protocol
+	var addr string
+	var err error
+
+	switch {
+	case strings.HasPrefix(upstream, "tls://"):
+		network = DoT
+		addr, err = parseDoTAddress(upstream)
+	case strings.HasPrefix(upstream, "https://"):
+		network = DoH
+		addr, err = parseDoHURL(upstream)
+	default:
+		addr, err = addDefaultPort(upstream)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	return network, addr, nil
+}
+
+// tlsConfigFor returns the TLS configuration to connect to the upstream at
+// address, verifying its certificate against its host.
+func tlsConfigFor(base *tls.Config, address string) *tls.Config {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		cfg = base.Clone()
+	}
+
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		cfg.ServerName = host
+	}
+
+	return cfg
+}
@@ -0,0 +1,360 @@
+package dns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"codeberg.org/miekg/dns"
+	"codeberg.org/miekg/dns/dnshttp"
+	"codeberg.org/miekg/dns/dnsutil"
+	"codeberg.org/miekg/dns/rdata"
+)
+
+// answer replies to q with an A record for 192.0.2.1.
+func answer(q *dns.Msg) *dns.Msg {
+	resp := new(dns.Msg)
+	dnsutil.SetReply(resp, q)
+	resp.Answer = []dns.RR{&dns.A{
+		Hdr: dns.Header{Name: q.Question[0].Header().Name, Class: dns.ClassINET, TTL: 60},
+		A:   rdata.A{Addr: netip.MustParseAddr("192.0.2.1")},
+	}}
+	return resp
+}
+
+func selfSigned(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// ---- parseUpstream ----
+
+func TestParseUpstream(t *testing.T) {
+	tests := []struct {
+		upstream string
+		network  Protocol
+		address  string
+		err      bool
+	}{
+		{upstream: "1.1.1.1", address: "1.1.1.1:53"},
+		{upstream: "tls://dns.quad9.net", network: DoT, address: "dns.quad9.net:853"},
+		{upstream: "tls://1.1.1.1:8853", network: DoT, address: "1.1.1.1:8853"},
+		{upstream: "https://dns.google", network: DoH, address: "https://dns.google/dns-query"},
+		{upstream: "https://doh.example:8443/resolve", network: DoH, address: "https://doh.example:8443/resolve"},
+		{upstream: "tls://", err: true},
+		{upstream: "tls://host/path", err: true},
+		{upstream: "https:///dns-query", err: true},
+		{upstream: "dns.google", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.upstream, func(t *testing.T) {
+			network, address, err := parseUpstream(test.upstream)
+			if (err != nil) != test.err {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if network != test.network || address != test.address {
+				t.Errorf("expected %s %s, got %s %s", test.network, test.address, network, address)
+			}
+		})
+	}
+}
+
+// ---- Bootstrap ----
+
+func TestBootstrapDialer(t *testing.T) {
+	// The bootstrap server resolves every name to the loopback address
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	var asked atomic.Int32
+	go func() {
+		buf := make([]byte, dns.MaxMsgSize)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			q := &dns.Msg{Data: append([]byte(nil), buf[:n]...)}
+			if err := q.Unpack(); err != nil {
+				continue
+			}
+			asked.Add(1)
+
+			resp := answer(q)
+			if dns.RRToType(q.Question[0]) == dns.TypeA {
+				resp.Answer[0].(*dns.A).A = rdata.A{Addr: netip.MustParseAddr("127.0.0.1")}
+			} else {
+				resp.Answer = nil
+			}
+			if err := resp.Pack(); err != nil {
+				continue
+			}
+			pc.WriteTo(resp.Data, addr)
+		}
+	}()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	d := newBootstrapDialer([]string{pc.LocalAddr().String()})
+	conn, err := d.DialContext(context.Background(), "tcp", net.JoinHostPort("upstream.test", port))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conn.Close()
+
+	if asked.Load() == 0 {
+		t.Error("expected the name to be resolved by the bootstrap server")
+	}
+}
+
+// ---- DoTClient ----
+
+func TestDoTClient_Pipelining(t *testing.T) {
+	cert, pool := selfSigned(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var conns atomic.Int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+
+			// Both queries are read before answering, in reverse order
+			go func() {
+				defer conn.Close()
+				var queries []*dns.Msg
+				for range 2 {
+					var size [2]byte
+					if _, err := io.ReadFull(conn, size[:]); err != nil {
+						return
+					}
+					buf := make([]byte, binary.BigEndian.Uint16(size[:]))
+					if _, err := io.ReadFull(conn, buf); err != nil {
+						return
+					}
+					q := &dns.Msg{Data: buf}
+					if err := q.Unpack(); err != nil {
+						return
+					}
+					queries = append(queries, q)
+				}
+				for i := len(queries) - 1; i >= 0; i-- {
+					resp := answer(queries[i])
+					if err := resp.Pack(); err != nil {
+						return
+					}
+					out := binary.BigEndian.AppendUint16(nil, uint16(len(resp.Data)))
+					if _, err := conn.Write(append(out, resp.Data...)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	c := NewDoTClient(newBootstrapDialer(nil), &tls.Config{RootCAs: pool})
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"a.example.", "b.example."} {
+		wg.Go(func() {
+			q := dns.NewMsg(name, dns.TypeA)
+			resp, _, err := c.Exchange(context.Background(), q, DoT, l.Addr().String())
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if resp.ID != q.ID || resp.Answer[0].Header().Name != name {
+				t.Errorf("unexpected answer for %s: %v", name, resp)
+			}
+		})
+	}
+	wg.Wait()
+
+	if conns.Load() != 1 {
+		t.Errorf("expected the queries to share a connection, got %d", conns.Load())
+	}
+}
+
+func TestDoTClient_SlowUpstreamDoesNotBlockOthers(t *testing.T) {
+	cert, pool := selfSigned(t)
+	fast, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Close()
+	go func() {
+		for {
+			conn, err := fast.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var size [2]byte
+				if _, err := io.ReadFull(conn, size[:]); err != nil {
+					return
+				}
+				buf := make([]byte, binary.BigEndian.Uint16(size[:]))
+				if _, err := io.ReadFull(conn, buf); err != nil {
+					return
+				}
+				q := &dns.Msg{Data: buf}
+				if err := q.Unpack(); err != nil {
+					return
+				}
+				resp := answer(q)
+				if err := resp.Pack(); err != nil {
+					return
+				}
+				out := binary.BigEndian.AppendUint16(nil, uint16(len(resp.Data)))
+				_, _ = conn.Write(append(out, resp.Data...))
+			}()
+		}
+	}()
+
+	// The slow upstream accepts the connections but never completes the handshake
+	slow, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+
+	c := NewDoTClient(newBootstrapDialer(nil), &tls.Config{RootCAs: pool})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		_, _, _ = c.Exchange(ctx, dns.NewMsg("slow.example.", dns.TypeA), DoT, slow.Addr().String())
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if _, _, err := c.Exchange(context.Background(), dns.NewMsg("fast.example.", dns.TypeA), DoT, fast.Addr().String()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the fast upstream not to wait for the slow one, took %s", elapsed)
+	}
+
+	cancel()
+	<-slowDone
+}
+
+// ---- DoHClient ----
+
+func TestDoHClient(t *testing.T) {
+	for _, method := range []string{"get", "post"} {
+		t.Run(method, func(t *testing.T) {
+			var proto atomic.Int32
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				proto.Store(int32(r.ProtoMajor))
+				if r.Method != map[string]string{"get": http.MethodGet, "post": http.MethodPost}[method] {
+					http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+					return
+				}
+				if r.Method == http.MethodGet {
+					// GET queries carry no body, hence no content type
+					r.Header.Set("Content-Type", dnshttp.MimeType)
+				}
+
+				q, err := dnshttp.Request(r)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				resp := answer(q)
+				if err := resp.Pack(); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", dnshttp.MimeType)
+				w.Write(resp.Data)
+			}))
+			srv.EnableHTTP2 = true
+			srv.StartTLS()
+			defer srv.Close()
+
+			pool := x509.NewCertPool()
+			pool.AddCert(srv.Certificate())
+
+			c, err := NewDoHClient(newBootstrapDialer(nil), &tls.Config{RootCAs: pool}, method)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			q := dns.NewMsg("example.com.", dns.TypeA)
+			resp, _, err := c.Exchange(context.Background(), q, DoH, srv.URL+"/dns-query")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.ID != q.ID || len(resp.Answer) != 1 {
+				t.Errorf("unexpected answer: %v", resp)
+			}
+			if proto.Load() != 2 {
+				t.Errorf("expected HTTP/2, got HTTP/%d", proto.Load())
+			}
+		})
+	}
+}
+
+func TestNewDoHClient_InvalidMethod(t *testing.T) {
+	if _, err := NewDoHClient(newBootstrapDialer(nil), nil, "put"); err == nil {
+		t.Error("expected an error for an unsupported method")
+	}
+}
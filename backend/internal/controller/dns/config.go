@@ -1,6 +1,11 @@
 package dns
 
-import "github.com/specialfish9/confuso/v2"
+import (
+	"fmt"
+	"time"
+
+	"github.com/specialfish9/confuso/v2"
+)
 
 type BlockingStrategy = string
 
@@ -11,14 +16,161 @@ const (
 	BlockingStrategyIP BlockingStrategy = "ip"
 )
 
+type UpstreamStrategy = string
+
+const (
+	// UpstreamStrategyFailover tries the upstreams in order, moving to the next one on failure.
+	UpstreamStrategyFailover UpstreamStrategy = "failover"
+	// UpstreamStrategyRoundRobin spreads the queries over the upstreams in turn.
+	UpstreamStrategyRoundRobin UpstreamStrategy = "round_robin"
+	// UpstreamStrategyFastest sends the queries to the upstream with the lowest
+	// average latency (EWMA).
+	UpstreamStrategyFastest UpstreamStrategy = "fastest"
+	// UpstreamStrategyRace sends the queries to all of the upstreams at once, and
+	// takes the first answer.
+	UpstreamStrategyRace UpstreamStrategy = "race"
+)
+
 type Config struct {
-	// Upstream is the address of the upstream DNS server to which queries will be forwarded.
-	Upstream string `confuso:"upstream"          validate:"required"`
+	// Upstream is the address of the upstream DNS server to which queries will be
+	// forwarded, or a list of such addresses. Addresses starting with tls:// are
+	// DNS-over-TLS servers, and https:// URLs are DNS-over-HTTPS servers.
+	Upstream any `confuso:"upstream"          validate:"required"`
+	// UpstreamStrategy defines how the upstream of a query is chosen when there
+	// are several of them. Default is "failover".
+	UpstreamStrategy confuso.Optional[UpstreamStrategy] `confuso:"upstream_strategy"`
 	// Address is the address on which the DNS server will listen for incoming queries.
 	Address string `confuso:"address"           validate:"required"`
 	// CacheEnabled toggles the cache. Disabled by default as it is an experimental feature.
-	CacheEnabled  confuso.Optional[bool]           `confuso:"cache"`
+	CacheEnabled confuso.Optional[bool] `confuso:"cache"`
+	// CacheMaxEntries is the number of entries the cache holds at most. Default is 10000.
+	CacheMaxEntries confuso.Optional[int] `confuso:"cache_max_entries"`
+	// CacheMaxMemory is the approximate memory, in MiB, the cache uses at most.
+	// Default is 32.
+	CacheMaxMemory confuso.Optional[int] `confuso:"cache_max_memory"`
+	// CacheServeStale is how long expired answers are kept (e.g. "1h"), to be
+	// served when the upstreams fail to refresh them. Disabled when unset.
+	CacheServeStale confuso.Optional[string] `confuso:"cache_serve_stale"`
+	// CachePrefetch refreshes the popular answers in the background shortly
+	// before they expire. Disabled by default.
+	CachePrefetch confuso.Optional[bool] `confuso:"cache_prefetch"`
+	// CacheSnapshot is the path of the file the cache is saved to, periodically
+	// and on shutdown, and restored from on startup. Disabled when unset.
+	CacheSnapshot confuso.Optional[string] `confuso:"cache_snapshot"`
+	// CacheSnapshotInterval is how often the snapshot is saved. Default is "5m".
+	CacheSnapshotInterval confuso.Optional[string] `confuso:"cache_snapshot_interval"`
+	// CacheWarmUp is the number of most queried domains of the last week that
+	// are resolved on startup, unless they are cached already. Disabled when unset.
+	CacheWarmUp confuso.Optional[int] `confuso:"cache_warmup"`
+	// CustomDomains maps names, or wildcard names like *.dev.lan, to the address
+	// or list of addresses they resolve to, or to their records by type (a, aaaa,
+	// cname, txt, mx, srv and ptr). The PTR records of the addresses are added
+	// automatically.
 	CustomDomains confuso.Optional[map[string]any] `confuso:"custom_domains"`
+	// HostsFiles is the path, or list of paths, of hosts files (like /etc/hosts)
+	// whose names are resolved locally, like custom domains.
+	HostsFiles confuso.Optional[any] `confuso:"hosts_files"`
+	// ZoneFiles is the path, or list of paths, of BIND zone files whose records
+	// are answered locally, like custom domains.
+	ZoneFiles confuso.Optional[any] `confuso:"zone_files"`
 	// BlockingStrategy defines how blocked queries are handled. Default is "nxdomain".
 	BlockingStrategy confuso.Optional[BlockingStrategy] `confuso:"blocking_strategy"`
+	// Forward maps domain suffixes and CIDRs (for their reverse zones) to the
+	// upstream, or list of upstreams, their queries are forwarded to instead of
+	// the default ones. These queries are not filtered.
+	Forward confuso.Optional[map[string]any] `confuso:"forward"`
+	// Bootstrap is the address, or list of addresses, of the plain DNS servers
+	// resolving the hostnames of the encrypted upstreams. The system resolver is
+	// used when unset, and it must then not be gohole itself.
+	Bootstrap confuso.Optional[any] `confuso:"bootstrap"`
+	// DoHMethod is the HTTP method of the DNS-over-HTTPS queries, "get" or "post".
+	// Default is "post".
+	DoHMethod confuso.Optional[string] `confuso:"doh_method"`
+	// TLSAddress is the address on which the DNS-over-TLS server listens, e.g.
+	// ":853". The server is disabled when unset.
+	TLSAddress confuso.Optional[string] `confuso:"tls_address"`
+	// TLSCert and TLSKey are the paths of the PEM certificate and key of the
+	// DNS-over-TLS server. They are reloaded when the files change.
+	TLSCert confuso.Optional[string] `confuso:"tls_cert"`
+	TLSKey  confuso.Optional[string] `confuso:"tls_key"`
+	// TLSSelfSigned generates a self-signed certificate, for LAN use, when the
+	// certificate files do not exist or are not set. Disabled by default.
+	TLSSelfSigned confuso.Optional[bool] `confuso:"tls_self_signed"`
+	// TLSServerName is the name of the DNS-over-TLS server. Clients connecting to
+	// one of its subdomains, e.g. phone.dns.example.com, are identified by it.
+	TLSServerName confuso.Optional[string] `confuso:"tls_server_name"`
+}
+
+// Upstreams returns the addresses of the upstreams, whether one or a list of
+// them is configured.
+func (c *Config) Upstreams() ([]string, error) {
+	return parseAddresses(c.Upstream)
+}
+
+// CacheOptions returns the options of the cache.
+func (c *Config) CacheOptions() (CacheOptions, error) {
+	maxEntries := c.CacheMaxEntries.Or(defaultCacheMaxEntries)
+	if maxEntries < 1 {
+		return CacheOptions{}, fmt.Errorf("dns: cache_max_entries must be positive, got %d", maxEntries)
+	}
+
+	maxMemory := c.CacheMaxMemory.Or(defaultCacheMaxMemory)
+	if maxMemory < 1 {
+		return CacheOptions{}, fmt.Errorf("dns: cache_max_memory must be positive, got %d", maxMemory)
+	}
+
+	var staleWindow time.Duration
+	if c.CacheServeStale.Ok {
+		var err error
+		staleWindow, err = time.ParseDuration(c.CacheServeStale.Value)
+		if err != nil {
+			return CacheOptions{}, fmt.Errorf("dns: invalid cache_serve_stale: %w", err)
+		}
+		if staleWindow < 0 {
+			return CacheOptions{}, fmt.Errorf("dns: cache_serve_stale must not be negative, got %s", staleWindow)
+		}
+	}
+
+	return CacheOptions{
+		MaxEntries:  maxEntries,
+		MaxBytes:    int64(maxMemory) << 20,
+		StaleWindow: staleWindow,
+		Prefetch:    c.CachePrefetch.Or(false),
+	}, nil
+}
+
+// parseAddresses parses a setting that is either an address or a list of addresses.
+func parseAddresses(v any) ([]string, error) {
+	addresses, err := parseStrings(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", fmt.Sprint(v), err)
+	}
+
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no address configured")
+	}
+
+	return addresses, nil
+}
+
+// parseStrings parses a setting that is either a string or a list of strings.
+func parseStrings(v any) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	case []any:
+		strs := make([]string, 0, len(v))
+		for _, u := range v {
+			s, ok := u.(string)
+			if !ok {
+				return nil, fmt.Errorf("'%v': expected a string, got %T", u, u)
+			}
+			strs = append(strs, s)
+		}
+		return strs, nil
+	default:
+		return nil, fmt.Errorf("'%v': expected a string or a list of strings, got %T", v, v)
+	}
 }
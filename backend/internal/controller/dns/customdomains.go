@@ -15,36 +15,56 @@ func normalizeName(name string) string {
 	return name
 }
 
-func parseCustomDomains(customDomains map[string]any) (map[string]netip.Addr, error) {
-	res := make(map[string]netip.Addr)
-	for name, addr := range customDomains {
-		addrStr, ok := addr.(string)
-		if !ok {
+// parseCustomDomains returns the records of the custom domains. Each name maps
+// to an address, a list of addresses, or a map of record types to the data of
+// the record, or list of records, of the type.
+func parseCustomDomains(customDomains map[string]any) ([]dns.RR, error) {
+	var rrs []dns.RR
+	for name, value := range customDomains {
+		if m, ok := value.(map[string]any); ok {
+			for typ, data := range m {
+				values, err := parseStrings(data)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s records for entry '%s': %w", typ, name, err)
+				}
+				for _, v := range values {
+					rr, err := recordFromData(name, typ, v)
+					if err != nil {
+						return nil, fmt.Errorf("invalid entry '%s': %w", name, err)
+					}
+					rrs = append(rrs, rr)
+				}
+			}
+			continue
+		}
+
+		addrs, err := parseStrings(value)
+		if err != nil {
 			return nil, fmt.Errorf(
-				"invalid IP address for entry '%s': expected a string, got '%v' of type %T",
+				"invalid IP address for entry '%s': expected a string, a list or a map, got '%v' of type %T",
 				name,
-				addr,
-				addr,
+				value,
+				value,
 			)
 		}
-
-		ip, err := netip.ParseAddr(addrStr)
-		if err != nil {
-			return nil, fmt.Errorf("invalid IP address '%s' in entry '%s': %s", addrStr, name, err)
+		for _, addrStr := range addrs {
+			ip, err := netip.ParseAddr(addrStr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP address '%s' in entry '%s': %s", addrStr, name, err)
+			}
+			rrs = append(rrs, addressRecord(name, ip))
 		}
-
-		name = normalizeName(name)
-
-		res[name] = ip
 	}
 
-	return res, nil
+	return rrs, nil
 }
 
-// checkCustomDomains checks whether the given question contains a name in the custom domains map.
-// It will then create a response RR.
-func (h *Handler) checkCustomDomains(rc *ReqCtx, question dns.RR) (dns.RR, error) {
-	addr, isCustom := h.customDomains[rc.Name]
+// checkCustomDomains answers the question from the local records, if there
+// are some for its name. An alias of a name without local records is resolved
+// through the upstreams.
+func (h *Handler) checkCustomDomains(rc *ReqCtx, question dns.RR) (*CacheEntry, error) {
+	qtype := dns.RRToType(question)
+	answer, target, isCustom := h.records.lookup(question.Header().Name, qtype)
 	if !isCustom {
 		rc.Logger.Debug("Name isn't a custom domain", "name", rc.Name)
 		return nil, nil
@@ -54,5 +74,40 @@ func (h *Handler) checkCustomDomains(rc *ReqCtx, question dns.RR) (dns.RR, error
 	rc.Custom = true
 	rc.Logger.Debug("Name is a custom domain", "name", rc.Name)
 
-	return answerFromQuestion(question, addr)
+	entry := &CacheEntry{Allowed: true, Answer: answer}
+	if target == "" {
+		return entry, nil
+	}
+
+	rc.Logger.Debug("Resolving the target of a custom domain", "name", rc.Name, "target", target)
+	resp, err := h.resolveTarget(rc, target, qtype)
+	if err != nil {
+		return nil, fmt.Errorf("resolving CNAME target %s: %w", target, err)
+	}
+	entry.Rcode = resp.Rcode
+	entry.Answer = append(entry.Answer, resp.Answer...)
+
+	return entry, nil
+}
+
+// resolveTarget queries the upstreams of target, or the default ones, for the
+// records of type qtype of target.
+func (h *Handler) resolveTarget(rc *ReqCtx, target string, qtype uint16) (*dns.Msg, error) {
+	m := dns.NewMsg(target, qtype)
+	if m == nil {
+		return nil, fmt.Errorf("unsupported query type %d", qtype)
+	}
+
+	upstreams := h.upstreams
+	if route := h.routes.lookup(normalizeName(target)); route != nil {
+		upstreams = route.upstreams
+	}
+
+	resp, upstream, err := upstreams.Exchange(rc.Context, m, h.protocol)
+	if err != nil {
+		return nil, err
+	}
+	rc.Upstream = upstream
+
+	return resp, nil
 }
@@ -1,21 +1,22 @@
 package dns
 
 import (
-	"net/netip"
 	"testing"
+
+	"codeberg.org/miekg/dns"
 )
 
 func TestParseCustomDomains(t *testing.T) {
 	testCases := []struct {
 		name     string
 		input    map[string]any
-		expected map[string]netip.Addr
+		expected []string
 		err      bool
 	}{
 		{
 			name:     "empty",
 			input:    map[string]any{},
-			expected: map[string]netip.Addr{},
+			expected: nil,
 			err:      false,
 		},
 		{
@@ -26,11 +27,40 @@ func TestParseCustomDomains(t *testing.T) {
 				"example6.com": "2345:0425:2CA1:0000:0000:0567:5673:23b5",
 				"domain6.com":  "::1",
 			},
-			expected: map[string]netip.Addr{
-				"example4.com": netip.MustParseAddr("192.168.1.1"),
-				"domain4.com":  netip.MustParseAddr("127.0.0.1"),
-				"example6.com": netip.MustParseAddr("2345:0425:2CA1:0000:0000:0567:5673:23b5"),
-				"domain6.com":  netip.MustParseAddr("::1"),
+			expected: []string{
+				"example4.com.\t60\tIN\tA\t192.168.1.1",
+				"domain4.com.\t60\tIN\tA\t127.0.0.1",
+				"example6.com.\t60\tIN\tAAAA\t2345:425:2ca1::567:5673:23b5",
+				"domain6.com.\t60\tIN\tAAAA\t::1",
+			},
+			err: false,
+		},
+		{
+			name: "list of addresses",
+			input: map[string]any{
+				"nas.lan": []any{"192.168.1.10", "fd00::10"},
+			},
+			expected: []string{
+				"nas.lan.\t60\tIN\tA\t192.168.1.10",
+				"nas.lan.\t60\tIN\tAAAA\tfd00::10",
+			},
+			err: false,
+		},
+		{
+			name: "records by type",
+			input: map[string]any{
+				"lan": map[string]any{
+					"mx":  "10 mail.lan",
+					"txt": []any{"v=spf1 -all"},
+				},
+				"www.lan":        map[string]any{"CNAME": "nas.lan"},
+				"_http._tcp.lan": map[string]any{"srv": "0 5 80 nas.lan"},
+			},
+			expected: []string{
+				"lan.\t60\tIN\tMX\t10 mail.lan.",
+				"lan.\t60\tIN\tTXT\t\"v=spf1 -all\"",
+				"www.lan.\t60\tIN\tCNAME\tnas.lan.",
+				"_http._tcp.lan.\t60\tIN\tSRV\t0 5 80 nas.lan.",
 			},
 			err: false,
 		},
@@ -50,6 +80,22 @@ func TestParseCustomDomains(t *testing.T) {
 			expected: nil,
 			err:      true,
 		},
+		{
+			name: "unsupported type",
+			input: map[string]any{
+				"example.com": map[string]any{"hinfo": "foo bar"},
+			},
+			expected: nil,
+			err:      true,
+		},
+		{
+			name: "invalid data",
+			input: map[string]any{
+				"example.com": map[string]any{"mx": "mail.lan"},
+			},
+			expected: nil,
+			err:      true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -63,14 +109,23 @@ func TestParseCustomDomains(t *testing.T) {
 			}
 
 			if len(result) != len(tc.expected) {
-				t.Fatalf("expected %d domains, got %d", len(tc.expected), len(result))
+				t.Fatalf("expected %d records, got %d", len(tc.expected), len(result))
 			}
-			for domain := range tc.expected {
-				if _, exists := result[normalizeName(domain)]; !exists {
-					t.Errorf("expected domain %q not found in result", domain)
+			for _, expected := range tc.expected {
+				if !containsRecord(result, expected) {
+					t.Errorf("expected record %q not found in result %v", expected, result)
 				}
 			}
 		})
 	}
 
 }
+
+func containsRecord(rrs []dns.RR, s string) bool {
+	for _, rr := range rrs {
+		if rr.String() == s {
+			return true
+		}
+	}
+	return false
+}
@@ -14,6 +14,12 @@ type Protocol = string
 const UDP Protocol = "udp"
 const TCP Protocol = "tcp"
 
+// DoT is DNS over TLS (RFC 7858).
+const DoT Protocol = "tls"
+
+// DoH is DNS over HTTPS (RFC 8484).
+const DoH Protocol = "https"
+
 type middleware func(next handlerFunc) handlerFunc
 type handlerFunc func(rc *ReqCtx, w dns.ResponseWriter, r *dns.Msg)
 
@@ -35,15 +41,7 @@ type Server struct {
 
 func NewServer(cfg *Config, handler *Handler) *Server {
 	mux := dns.NewServeMux()
-	mux.HandleFunc(
-		".", // "." = catch-all
-		applyMiddlewares(
-			handler.HandleRequest,
-			recoverMiddleware,
-			logMiddleware("proto", handler.protocol),
-			handler.persistenceMiddleware,
-			timeMiddleware,
-		))
+	mux.HandleFunc(".", handler.Chain(handler.protocol)) // "." = catch-all
 
 	return &Server{
 		srv: dns.Server{
@@ -57,6 +55,20 @@ func NewServer(cfg *Config, handler *Handler) *Server {
 	}
 }
 
+// Chain returns the handler wrapped in the middlewares of the DNS servers, for
+// the queries received over proto. It lets other servers, e.g. the DNS-over-HTTPS
+// endpoint, handle their queries like the DNS servers do.
+func (h *Handler) Chain(proto Protocol) dns.HandlerFunc {
+	return applyMiddlewares(
+		h.HandleRequest,
+		recoverMiddleware,
+		protocolMiddleware(proto),
+		logMiddleware("proto", proto),
+		h.persistenceMiddleware,
+		timeMiddleware,
+	)
+}
+
 func (s *Server) ID() string {
 	return fmt.Sprintf("DNS-server (%s)", s.protocol)
 }
@@ -64,7 +76,7 @@ func (s *Server) ID() string {
 func (s *Server) Start() error {
 	s.l.Info(
 		"Started DNS server",
-		"address", s.cfg.Address,
+		"address", s.srv.Addr,
 		"protocol", s.protocol,
 		"upstream", s.cfg.Upstream,
 		"cache", s.cfg.CacheEnabled.Or(false),
@@ -1,24 +1,36 @@
 package dns
 
 import (
+	"context"
 	"fmt"
 	"gohole/internal/database"
+	"gohole/internal/filter"
 	"gohole/internal/query"
 	"log/slog"
-	"net/netip"
+	"math"
+	"time"
 
 	"codeberg.org/miekg/dns"
 )
 
+const (
+	// maxPrefetches bounds the cache entries being refreshed at once, per handler.
+	maxPrefetches   = 8
+	prefetchTimeout = 10 * time.Second
+)
+
 type Handler struct {
-	upstream         string
+	upstreams        *Upstreams
+	routes           forwardRoutes
 	cacheEnabled     bool
 	queryService     query.Service
 	protocol         Protocol
-	customDomains    map[string]netip.Addr
+	records          localRecords
 	cache            Cache
 	client           Client
 	blockingStrategy BlockingStrategy
+	// prefetches holds a token for each cache entry being prefetched.
+	prefetches chan struct{}
 }
 
 func NewHandler(
@@ -28,44 +40,60 @@ func NewHandler(
 	cfg *Config,
 	client Client,
 ) (*Handler, error) {
-	upstream, err := addDefaultPort(cfg.Upstream)
+	addresses, err := cfg.Upstreams()
+	if err != nil {
+		return nil, fmt.Errorf("dns handler: %w", err)
+	}
+
+	strategy := cfg.UpstreamStrategy.Or(UpstreamStrategyFailover)
+	upstreams, err := NewUpstreams(addresses, strategy, client)
 	if err != nil {
-		return nil, fmt.Errorf("dns handler: invalid upstream address: %v", err)
+		return nil, fmt.Errorf("dns handler: invalid upstreams: %w", err)
 	}
 
-	customDomains := make(map[string]netip.Addr)
-	if cfg.CustomDomains.Ok {
-		slog.Debug("Parsing custom domains", "count", len(cfg.CustomDomains.Value))
-		var err error
-		customDomains, err = parseCustomDomains(cfg.CustomDomains.Value)
+	var routes forwardRoutes
+	if cfg.Forward.Ok {
+		slog.Debug("Parsing forwarding routes", "count", len(cfg.Forward.Value))
+		routes, err = parseForwardRoutes(cfg.Forward.Value, strategy, client)
 		if err != nil {
-			return nil, fmt.Errorf("dns handler: parsing custom domains: %w", err)
+			return nil, fmt.Errorf("dns handler: parsing forwarding routes: %w", err)
 		}
 	}
 
+	records, err := loadLocalRecords(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("dns handler: %w", err)
+	}
+
 	bs := cfg.BlockingStrategy.Or(BlockingStrategyNXDOMAIN)
 
 	slog.Debug(
 		"DNS handler configuration",
-		"upstream",
-		upstream,
+		"upstreams",
+		upstreams.Addresses(),
+		"upstream_strategy",
+		upstreams.strategy,
 		"cache_enabled",
 		cfg.CacheEnabled.Or(false),
 		"blocking_strategy",
 		bs,
-		"custom_domains_count",
-		len(customDomains),
+		"local_names_count",
+		len(records),
+		"forwarding_zones_count",
+		len(routes),
 	)
 
 	return &Handler{
-		upstream:         upstream,
+		upstreams:        upstreams,
+		routes:           routes,
 		cacheEnabled:     cfg.CacheEnabled.Or(false),
 		queryService:     queryService,
 		cache:            cache,
 		protocol:         protocol,
-		customDomains:    customDomains,
+		records:          records,
 		client:           client,
 		blockingStrategy: bs,
+		prefetches:       make(chan struct{}, maxPrefetches),
 	}, nil
 }
 
@@ -83,14 +111,15 @@ func (h *Handler) HandleRequest(rc *ReqCtx, w dns.ResponseWriter, r *dns.Msg) {
 
 	// Extract the requested name
 	rc.Name = normalizeName(question.Header().Name)
+	rc.Type = dns.RRToType(question)
 
 	allow, answer, err := h.tryAnswerQuestion(rc, question)
 	if err != nil {
-		// In case of error, return an error response
+		// The question could not be answered, which does not mean it is blocked
 		rc.Error = fmt.Errorf("dns handler: error trying answer question: %w", err)
-		response = blockedResponse(r, h.blockingStrategy)
+		response = serverFailureResponse(r)
 	} else if answer != nil {
-		response = responseFromAnswer(answer, r)
+		response = responseFromEntry(answer, r)
 	} else if !allow {
 		// Else, if the domain is blocked, then return a refused response
 		response = blockedResponse(r, h.blockingStrategy)
@@ -98,15 +127,24 @@ func (h *Handler) HandleRequest(rc *ReqCtx, w dns.ResponseWriter, r *dns.Msg) {
 		// Else, if the domain is allowed, forward the request to the upstream
 		response, err = h.forwardRequest(rc, r)
 		if err != nil {
-			// In case of error, return an error response
+			// All of the upstreams failed
 			rc.Error = fmt.Errorf("dns handler: error forwarding request to upstream: %w", err)
-			response = blockedResponse(r, h.blockingStrategy)
+			response = serverFailureResponse(r)
 		} else if response == nil {
-			// If the response is nil, it means that the upstream did not return an answer, so
-			// we return a refused response
-			response = blockedResponse(r, h.blockingStrategy)
+			// The upstream did not return an answer
+			response = serverFailureResponse(r)
+		}
+	}
+
+	rc.Rcode = response.Rcode
+	rc.AnswerCount = len(response.Answer)
+	if len(response.Data) == 0 {
+		if err := response.Pack(); err != nil {
+			rc.Error = fmt.Errorf("dns handler: error packing response: %w", err)
+			return
 		}
 	}
+	rc.ResponseSize = len(response.Data)
 
 	if _, err := response.WriteTo(w); err != nil {
 		rc.Error = fmt.Errorf("dns handler: error writing response to client: %w", err)
@@ -115,27 +153,37 @@ func (h *Handler) HandleRequest(rc *ReqCtx, w dns.ResponseWriter, r *dns.Msg) {
 	}
 }
 
-func (h *Handler) tryAnswerQuestion(rc *ReqCtx, q dns.RR) (bool, []dns.RR, error) {
+// tryAnswerQuestion tells whether the question is allowed and, if it can be
+// answered without the upstreams, the answer.
+func (h *Handler) tryAnswerQuestion(rc *ReqCtx, q dns.RR) (bool, *CacheEntry, error) {
 	rc.Logger.Debug("Answering question", "name", rc.Name)
 
 	// First, check custom domains
-	resp, err := h.checkCustomDomains(rc, q)
+	entry, err := h.checkCustomDomains(rc, q)
 	if err != nil {
 		return false, nil, err
 	}
-	if resp != nil {
+	if entry != nil {
 		// Custom domains are always allowed by definition
-		return true, []dns.RR{resp}, nil
+		return true, entry, nil
 	}
 
+	// Names with a forwarding route go to their own upstreams, unfiltered
+	rc.route = h.routes.lookup(rc.Name)
+
 	// Second, check cache
 	if h.cacheEnabled {
-		allowed, resp := h.checkCache(rc, q)
-		if resp != nil {
-			return allowed, resp, nil
+		if entry, ok := h.checkCache(rc, q); ok {
+			return true, &entry, nil
 		}
 	}
 
+	if rc.route != nil {
+		rc.Logger.Debug("Name has a forwarding route", "name", rc.Name, "route", rc.route.name)
+		rc.Allowed = true
+		return true, nil, nil
+	}
+
 	// Third, check filter
 	allowed, err := h.checkFilter(rc, q)
 	if err != nil {
@@ -145,78 +193,200 @@ func (h *Handler) tryAnswerQuestion(rc *ReqCtx, q dns.RR) (bool, []dns.RR, error
 	return allowed, nil, nil
 }
 
-func (h *Handler) checkCache(rc *ReqCtx, q dns.RR) (bool, []dns.RR) {
-	key := NewCacheKey(q)
+func (h *Handler) checkCache(rc *ReqCtx, q dns.RR) (CacheEntry, bool) {
+	key := rc.route.cacheKey(q)
 	rc.Logger.Debug("Performing cache lookup", "key", key)
-	allow, answer, cached := h.cache.Get(key)
+	entry, cached := h.cache.Get(key)
 	if !cached {
 		rc.Logger.Debug("Cache miss", "key", key)
-		return false, nil
+		return CacheEntry{}, false
 	}
 
 	rc.Logger.Debug("Cache hit", "key", key)
 
+	if entry.Prefetch {
+		rc.Logger.Debug("Prefetching cache entry", "key", key)
+		h.prefetch(rc.route, key)
+	}
+
+	if !entry.Allowed {
+		// Blocked entries are not served, the query is filtered again
+		rc.Logger.Debug("Cached entry is blocked, filtering again", "key", key)
+		return CacheEntry{}, false
+	}
+
 	rc.Cached = true
-	rc.Allowed = allow
+	rc.Allowed = true
+	rc.Match = entry.Match
 
-	return allow, answer
+	return entry, true
 }
 
 func (h *Handler) checkFilter(rc *ReqCtx, q dns.RR) (bool, error) {
 	rc.Logger.Debug("Checking filter", "name", rc.Name)
-	allow, err := h.queryService.ShouldAllow(rc.Name)
+	verdict, err := h.queryService.ShouldAllow(filter.Request{
+		Name:     rc.Name,
+		Client:   rc.Host,
+		ClientID: rc.ClientID,
+		Type:     dns.RRToType(q),
+	})
 	if err != nil {
 		return false, fmt.Errorf("filtering query: %w", err)
 	}
 
-	rc.Logger.Debug("Filter result", "name", rc.Name, "allow", allow)
+	rc.Logger.Debug(
+		"Filter result",
+		"name", rc.Name,
+		"allow", verdict.Allowed,
+		"clientScoped", verdict.ClientScoped,
+		"match", verdict.Match,
+	)
+
+	// Verdicts depending on the client must not be shared with other clients
+	// through the cache.
+	rc.ClientScoped = verdict.ClientScoped
+	rc.Match = verdict.Match
 
-	if !allow {
+	if !verdict.Allowed && !verdict.ClientScoped {
 		// Update the cache
 		rc.Logger.Debug("Updating cache with new blocked entry", "name", rc.Name)
 		cacheKey := NewCacheKey(q)
-		h.cache.SetBlocked(cacheKey)
+		h.cache.SetBlocked(cacheKey, verdict.Match)
 	}
 
-	rc.Allowed = allow
+	rc.Allowed = verdict.Allowed
 
-	return allow, nil
+	return verdict.Allowed, nil
 }
 
 // forwardRequest forwards the request to the upstream and updates the handler cache.
+// Names with a forwarding route are sent to the upstreams of the route.
 func (h *Handler) forwardRequest(rc *ReqCtx, r *dns.Msg) (*dns.Msg, error) {
-	rc.Logger.Debug("Forwarding request to upstream", "name", rc.Name, "upstream", h.upstream)
+	upstreams := h.upstreams
+	if rc.route != nil {
+		upstreams = rc.route.upstreams
+	}
 
-	response, _, err := h.client.Exchange(rc.Context, r.Copy(), h.protocol, h.upstream)
+	rc.Logger.Debug("Forwarding request to upstream", "name", rc.Name)
+
+	response, upstream, err := upstreams.Exchange(rc.Context, r, h.protocol)
 	if err != nil {
+		if stale := h.staleResponse(rc, r); stale != nil {
+			rc.Logger.Warn("Upstream failed, serving stale answer", "name", rc.Name, "error", err)
+			return stale, nil
+		}
 		return nil, fmt.Errorf("failed to exchange with upstream over %s: %w", h.protocol, err)
 	}
 
-	response.ID = r.ID
+	rc.Upstream = upstream
 
-	// Update the cache (only if there is something to cache)
-	if h.cacheEnabled {
-		if len(response.Answer) > 0 {
-			// We use the first answer to create the cache key, since all answers should have the same name
-			cacheKey := NewCacheKey(response.Answer[0])
-			// We take the smallest TTL from the answer
-			var ttl uint32
-			for _, ans := range response.Answer {
-				if ttl == 0 || ans.Header().TTL < ttl {
-					ttl = ans.Header().TTL
-				}
-			}
+	response.ID = r.ID
 
-			rc.Logger.Debug("Updating cache", "key", cacheKey, "TTL", ttl)
-			h.cache.Set(cacheKey, response.Answer, ttl)
+	// Update the cache, negative answers included
+	if h.cacheEnabled && !rc.ClientScoped {
+		cacheKey := rc.route.cacheKey(r.Question[0])
+		if ttl, ok := responseTTL(response); ok {
+			rc.Logger.Debug("Updating cache", "key", cacheKey, "TTL", ttl, "rcode", response.Rcode)
+			h.cache.Set(cacheKey, response, ttl)
 		} else {
-			rc.Logger.Debug("No answer to cache", "name", rc.Name)
+			rc.Logger.Debug("Response not cacheable", "name", rc.Name, "rcode", response.Rcode)
 		}
 	}
 
 	return response, nil
 }
 
+// staleResponse answers r with its cached entry, even if expired, when the
+// upstreams cannot be reached. It returns nil if there is none.
+func (h *Handler) staleResponse(rc *ReqCtx, r *dns.Msg) *dns.Msg {
+	if !h.cacheEnabled || rc.ClientScoped {
+		return nil
+	}
+
+	entry, ok := h.cache.GetStale(rc.route.cacheKey(r.Question[0]))
+	if !ok {
+		return nil
+	}
+
+	rc.Cached = true
+	return responseFromEntry(&entry, r)
+}
+
+// prefetch refreshes the cache entry of key in the background, from the
+// upstreams of route if any. It is skipped if too many prefetches are running.
+func (h *Handler) prefetch(route *forwardRoute, key CacheKey) {
+	select {
+	case h.prefetches <- struct{}{}:
+	default:
+		slog.Debug("Too many prefetches running, skipping", "key", key)
+		return
+	}
+
+	go func() {
+		defer func() { <-h.prefetches }()
+
+		// The filters may have changed since the entry was cached
+		verdict, err := h.refreshVerdict(key)
+		if err != nil {
+			slog.Warn("Filtering cache entry", "key", key, "error", err)
+			return
+		}
+		if !verdict.Allowed || verdict.ClientScoped {
+			if !verdict.ClientScoped {
+				h.cache.SetBlocked(key, verdict.Match)
+			}
+			slog.Debug("Cache entry no longer allowed, skipping prefetch", "key", key)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), prefetchTimeout)
+		defer cancel()
+
+		h.refresh(ctx, route, key)
+	}()
+}
+
+// refreshVerdict filters the name of key for any client, before its answer is
+// cached outside of a request. The names with a forwarding route are allowed.
+func (h *Handler) refreshVerdict(key CacheKey) (query.Verdict, error) {
+	if key.Route != "" {
+		return query.Verdict{Allowed: true}, nil
+	}
+
+	return h.queryService.ShouldAllow(filter.Request{Name: key.Name, Type: key.Type})
+}
+
+// refresh queries the upstreams of route, or the default ones, for key and
+// caches the answer. It returns false if nothing was cached.
+func (h *Handler) refresh(ctx context.Context, route *forwardRoute, key CacheKey) bool {
+	m := dns.NewMsg(key.Name, key.Type)
+	if m == nil {
+		return false
+	}
+	m.Question[0].Header().Class = key.Class
+
+	upstreams := h.upstreams
+	if route != nil {
+		upstreams = route.upstreams
+	}
+
+	resp, upstream, err := upstreams.Exchange(ctx, m, h.protocol)
+	if err != nil {
+		slog.Warn("Refreshing cache entry", "key", key, "error", err)
+		return false
+	}
+
+	ttl, ok := responseTTL(resp)
+	if !ok {
+		return false
+	}
+
+	h.cache.Set(key, resp, ttl)
+	slog.Debug("Refreshed cache entry", "key", key, "upstream", upstream, "TTL", ttl)
+
+	return true
+}
+
 // persistenceMiddleware stores the query in the database after the request has been handled.
 func (h *Handler) persistenceMiddleware(next handlerFunc) handlerFunc {
 	return func(rc *ReqCtx, w dns.ResponseWriter, r *dns.Msg) {
@@ -227,6 +397,20 @@ func (h *Handler) persistenceMiddleware(next handlerFunc) handlerFunc {
 			!rc.Allowed,
 			rc.End.Sub(rc.Start).Milliseconds(),
 		)
+		q.ClientID = rc.ClientID
+		q.Type = rc.Type
+		q.Rcode = rc.Rcode
+		q.AnswerCount = uint16(min(rc.AnswerCount, math.MaxUint16))
+		q.ResponseSize = uint32(rc.ResponseSize)
+		q.Upstream = rc.Upstream
+		q.Cached = rc.Cached
+		q.Custom = rc.Custom
+		q.Protocol = rc.Protocol
+		if rc.Match != nil {
+			q.MatchList = rc.Match.List
+			q.MatchRule = rc.Match.Rule
+			q.MatchKind = string(rc.Match.Kind)
+		}
 		err := h.queryService.Save(rc.Context, q)
 		if err != nil {
 			rc.Logger.Error("Failed to save query to database", "error", err.Error())
@@ -2,6 +2,7 @@ package dns_test
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net/netip"
 	"testing"
@@ -13,8 +14,11 @@ import (
 	"go.uber.org/mock/gomock"
 
 	"gohole/internal/controller/dns"
+	"gohole/internal/database"
+	"gohole/internal/filter"
 	mockdns "gohole/internal/mock/dns"
 	mockquery "gohole/internal/mock/query"
+	"gohole/internal/query"
 )
 
 type tctx struct {
@@ -53,6 +57,13 @@ func newReqCtx() *dns.ReqCtx {
 	}
 }
 
+func newSOARecord(zone string, ttl, minttl uint32) gdns.RR {
+	return &gdns.SOA{
+		Hdr: gdns.Header{Name: zone, Class: gdns.ClassINET, TTL: ttl},
+		SOA: rdata.SOA{Ns: "ns." + zone, Mbox: "admin." + zone, Minttl: minttl},
+	}
+}
+
 func TestHandleRequest(t *testing.T) {
 	const domain = "example.com."
 
@@ -61,8 +72,10 @@ func TestHandleRequest(t *testing.T) {
 		var testCfg = &dns.Config{Upstream: "8.8.8.8"}
 		tc := newCtx(t, testCfg)
 
-		tc.queryService.EXPECT().ShouldAllow(domain).Return(false, nil)
-		tc.cache.EXPECT().SetBlocked(gomock.Any())
+		tc.queryService.EXPECT().
+			ShouldAllow(filter.Request{Name: domain, Client: "", Type: gdns.TypeA}).
+			Return(query.Verdict{Allowed: false}, nil)
+		tc.cache.EXPECT().SetBlocked(gomock.Any(), gomock.Any())
 
 		rc := newReqCtx()
 		w := &fakeWriter{}
@@ -103,7 +116,9 @@ func TestHandleRequest(t *testing.T) {
 		upstreamResp := new(gdns.Msg)
 		upstreamResp.Answer = []gdns.RR{aRecord}
 
-		tc.queryService.EXPECT().ShouldAllow(domain).Return(true, nil)
+		tc.queryService.EXPECT().
+			ShouldAllow(filter.Request{Name: domain, Client: "", Type: gdns.TypeA}).
+			Return(query.Verdict{Allowed: true}, nil)
 		tc.client.EXPECT().
 			Exchange(gomock.Any(), gomock.Any(), dns.UDP, testCfg.Upstream).
 			Return(upstreamResp, time.Duration(0), nil)
@@ -126,6 +141,9 @@ func TestHandleRequest(t *testing.T) {
 		if len(got.Answer) == 0 {
 			t.Fatal("expected at least one answer for allowed domain")
 		}
+		if rc.Upstream != testCfg.Upstream {
+			t.Errorf("expected the request to be answered by %s, got %s", testCfg.Upstream, rc.Upstream)
+		}
 	})
 
 	t.Run("allow - cache miss", func(t *testing.T) {
@@ -147,13 +165,15 @@ func TestHandleRequest(t *testing.T) {
 		upstreamResp := new(gdns.Msg)
 		upstreamResp.Answer = []gdns.RR{aRecord}
 
-		tc.queryService.EXPECT().ShouldAllow(domain).Return(true, nil)
+		tc.queryService.EXPECT().
+			ShouldAllow(filter.Request{Name: domain, Client: "", Type: gdns.TypeA}).
+			Return(query.Verdict{Allowed: true}, nil)
 		tc.client.EXPECT().
 			Exchange(gomock.Any(), gomock.Any(), dns.UDP, testCfg.Upstream).
 			Return(upstreamResp, time.Duration(0), nil)
 		// Simulate cache miss
-		tc.cache.EXPECT().Get(gomock.Any()).Return(false, nil, false)
-		tc.cache.EXPECT().Set(gomock.Any(), []gdns.RR{aRecord}, uint32(300))
+		tc.cache.EXPECT().Get(gomock.Any()).Return(dns.CacheEntry{}, false)
+		tc.cache.EXPECT().Set(gomock.Any(), upstreamResp, uint32(300))
 
 		rc := newReqCtx()
 		w := &fakeWriter{}
@@ -251,6 +271,54 @@ func TestHandleRequest(t *testing.T) {
 		}
 	})
 
+	t.Run("custom domain - CNAME to an upstream name", func(t *testing.T) {
+		// Arrange: the target of the alias is resolved by the upstream, unfiltered.
+		var testCfg = &dns.Config{
+			Upstream: "8.8.8.8:53",
+			CustomDomains: confuso.Optional[map[string]any]{
+				Ok:    true,
+				Value: map[string]any{"www.local": map[string]any{"cname": "example.com"}},
+			},
+		}
+		tc := newCtx(t, testCfg)
+
+		upstreamResp := new(gdns.Msg)
+		upstreamResp.Answer = []gdns.RR{&gdns.A{
+			Hdr: gdns.Header{Name: "example.com.", Class: gdns.ClassINET, TTL: 300},
+			A:   rdata.A{Addr: netip.MustParseAddr("93.184.216.34")},
+		}}
+		tc.client.EXPECT().
+			Exchange(gomock.Any(), gomock.Any(), dns.UDP, testCfg.Upstream).
+			DoAndReturn(func(_ context.Context, m *gdns.Msg, _ dns.Protocol, _ string) (*gdns.Msg, time.Duration, error) {
+				if m.Question[0].Header().Name != "example.com." {
+					t.Errorf("expected the target to be resolved, got %s", m.Question[0].Header().Name)
+				}
+				return upstreamResp, 0, nil
+			})
+
+		rc := newReqCtx()
+		w := &fakeWriter{}
+		r := gdns.NewMsg("www.local", gdns.TypeA)
+
+		// Act
+		tc.h.HandleRequest(rc, w, r)
+
+		// Assert
+		got, err := w.ParseMsg()
+		if err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if len(got.Answer) != 2 {
+			t.Fatalf("expected the CNAME and the address, got %v", got.Answer)
+		}
+		if _, ok := got.Answer[0].(*gdns.CNAME); !ok {
+			t.Errorf("expected *dns.CNAME record first, got %T", got.Answer[0])
+		}
+		if !rc.Custom {
+			t.Error("expected the query to be marked as custom")
+		}
+	})
+
 	t.Run("allow - cache hit", func(t *testing.T) {
 		// Arrange
 		var testCfg = &dns.Config{
@@ -269,7 +337,9 @@ func TestHandleRequest(t *testing.T) {
 		}
 
 		// Simulate cache hit
-		tc.cache.EXPECT().Get(gomock.Any()).Return(true, []gdns.RR{aRecord}, true)
+		tc.cache.EXPECT().
+			Get(gomock.Any()).
+			Return(dns.CacheEntry{Allowed: true, Answer: []gdns.RR{aRecord}}, true)
 
 		rc := newReqCtx()
 		w := &fakeWriter{}
@@ -290,4 +360,518 @@ func TestHandleRequest(t *testing.T) {
 			t.Fatal("expected at least one answer for allowed domain")
 		}
 	})
+
+	t.Run("blocked cache hit - filtered again", func(t *testing.T) {
+		// Arrange
+		var testCfg = &dns.Config{
+			CacheEnabled: confuso.Optional[bool]{Value: true, Ok: true},
+			Upstream:     "8.8.8.8:53",
+		}
+		tc := newCtx(t, testCfg)
+
+		aRecord := &gdns.A{
+			Hdr: gdns.Header{Name: domain, Class: gdns.ClassINET, TTL: 300},
+			A:   rdata.A{Addr: netip.MustParseAddr("93.184.216.34")},
+		}
+		upstreamResp := new(gdns.Msg)
+		upstreamResp.Answer = []gdns.RR{aRecord}
+
+		tc.cache.EXPECT().
+			Get(gomock.Any()).
+			Return(dns.CacheEntry{Allowed: false, Match: &filter.Match{Rule: "example.com"}}, true)
+		tc.queryService.EXPECT().
+			ShouldAllow(filter.Request{Name: domain, Client: "", Type: gdns.TypeA}).
+			Return(query.Verdict{Allowed: true}, nil)
+		tc.client.EXPECT().
+			Exchange(gomock.Any(), gomock.Any(), dns.UDP, testCfg.Upstream).
+			Return(upstreamResp, time.Duration(0), nil)
+		tc.cache.EXPECT().Set(gomock.Any(), upstreamResp, uint32(300))
+
+		rc := newReqCtx()
+		w := &fakeWriter{}
+		r := gdns.NewMsg("example.com", gdns.TypeA)
+
+		// Act
+		tc.h.HandleRequest(rc, w, r)
+
+		// Assert
+		got, err := w.ParseMsg()
+		if err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if len(got.Answer) != 1 {
+			t.Fatalf("expected the upstream answer, got %v", got)
+		}
+		// The query was not answered from the cache
+		if rc.Cached || rc.Match != nil {
+			t.Errorf("expected the blocked entry to be left out of the request, got cached=%v match=%v", rc.Cached, rc.Match)
+		}
+	})
+
+	t.Run("forwarding route", func(t *testing.T) {
+		// Arrange: routed names bypass the filter and go to the upstream of the route
+		var testCfg = &dns.Config{
+			CacheEnabled: confuso.Optional[bool]{Value: true, Ok: true},
+			Upstream:     "8.8.8.8:53",
+			Forward: confuso.Optional[map[string]any]{
+				Ok: true,
+				Value: map[string]any{
+					"lan":            "192.168.1.1",
+					"192.168.0.0/16": "192.168.1.1",
+					"corp.example":   []any{"10.8.0.1", "10.8.0.2"},
+				},
+			},
+		}
+		tc := newCtx(t, testCfg)
+
+		upstreamResp := new(gdns.Msg)
+		tc.cache.EXPECT().
+			Get(dns.CacheKey{Name: "ads.corp.example.", Type: gdns.TypeA, Class: gdns.ClassINET, Route: "corp.example"}).
+			Return(dns.CacheEntry{}, false)
+		tc.client.EXPECT().
+			Exchange(gomock.Any(), gomock.Any(), dns.UDP, "10.8.0.1:53").
+			Return(upstreamResp, time.Duration(0), nil)
+
+		rc := newReqCtx()
+		w := &fakeWriter{}
+		r := gdns.NewMsg("ads.corp.example", gdns.TypeA)
+
+		// Act
+		tc.h.HandleRequest(rc, w, r)
+
+		// Assert
+		got, err := w.ParseMsg()
+		if err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if got.Rcode != gdns.RcodeSuccess {
+			t.Errorf("expected NOERROR (Rcode 0), got Rcode %d", got.Rcode)
+		}
+		if !rc.Allowed || rc.Upstream != "10.8.0.1:53" {
+			t.Errorf("expected the request to be answered by the route upstream, got %s", rc.Upstream)
+		}
+	})
+
+	t.Run("negative answer - cached for the SOA minimum", func(t *testing.T) {
+		// Arrange
+		var testCfg = &dns.Config{
+			CacheEnabled: confuso.Optional[bool]{Value: true, Ok: true},
+			Upstream:     "8.8.8.8:53",
+		}
+		tc := newCtx(t, testCfg)
+
+		upstreamResp := new(gdns.Msg)
+		upstreamResp.Rcode = gdns.RcodeNameError
+		upstreamResp.Ns = []gdns.RR{newSOARecord("com.", 3600, 900)}
+
+		tc.queryService.EXPECT().
+			ShouldAllow(filter.Request{Name: "missing.com.", Client: "", Type: gdns.TypeA}).
+			Return(query.Verdict{Allowed: true}, nil)
+		tc.client.EXPECT().
+			Exchange(gomock.Any(), gomock.Any(), dns.UDP, testCfg.Upstream).
+			Return(upstreamResp, time.Duration(0), nil)
+		key := dns.CacheKey{Name: "missing.com.", Type: gdns.TypeA, Class: gdns.ClassINET}
+		tc.cache.EXPECT().Get(key).Return(dns.CacheEntry{}, false)
+		tc.cache.EXPECT().Set(key, upstreamResp, uint32(900))
+
+		rc := newReqCtx()
+		w := &fakeWriter{}
+		r := gdns.NewMsg("missing.com", gdns.TypeA)
+
+		// Act
+		tc.h.HandleRequest(rc, w, r)
+
+		// Assert
+		got, err := w.ParseMsg()
+		if err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if got.Rcode != gdns.RcodeNameError {
+			t.Errorf("expected NXDOMAIN, got Rcode %d", got.Rcode)
+		}
+	})
+
+	t.Run("negative answer - cache hit", func(t *testing.T) {
+		// Arrange
+		var testCfg = &dns.Config{
+			CacheEnabled: confuso.Optional[bool]{Value: true, Ok: true},
+			Upstream:     "8.8.8.8:53",
+		}
+		tc := newCtx(t, testCfg)
+
+		// The upstream is not queried, nor is the filter
+		tc.cache.EXPECT().
+			Get(gomock.Any()).
+			Return(dns.CacheEntry{
+				Allowed: true,
+				Rcode:   gdns.RcodeNameError,
+				Ns:      []gdns.RR{newSOARecord("com.", 120, 900)},
+			}, true)
+
+		rc := newReqCtx()
+		w := &fakeWriter{}
+		r := gdns.NewMsg("missing.com", gdns.TypeA)
+
+		// Act
+		tc.h.HandleRequest(rc, w, r)
+
+		// Assert
+		got, err := w.ParseMsg()
+		if err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if got.Rcode != gdns.RcodeNameError {
+			t.Errorf("expected NXDOMAIN, got Rcode %d", got.Rcode)
+		}
+		if len(got.Answer) != 0 || len(got.Ns) != 1 {
+			t.Fatalf("expected the cached authority section only, got %v", got)
+		}
+		if got.Ns[0].Header().TTL != 120 {
+			t.Errorf("expected the cached TTL 120, got %d", got.Ns[0].Header().TTL)
+		}
+		if !rc.Cached {
+			t.Error("expected the request to be answered from the cache")
+		}
+	})
+
+	t.Run("upstream failure - stale answer", func(t *testing.T) {
+		// Arrange
+		var testCfg = &dns.Config{
+			CacheEnabled: confuso.Optional[bool]{Value: true, Ok: true},
+			Upstream:     "8.8.8.8:53",
+		}
+		tc := newCtx(t, testCfg)
+
+		aRecord := &gdns.A{
+			Hdr: gdns.Header{Name: domain, Class: gdns.ClassINET, TTL: 30},
+			A:   rdata.A{Addr: netip.MustParseAddr("93.184.216.34")},
+		}
+		key := dns.CacheKey{Name: domain, Type: gdns.TypeA, Class: gdns.ClassINET}
+
+		tc.cache.EXPECT().Get(key).Return(dns.CacheEntry{}, false)
+		tc.queryService.EXPECT().
+			ShouldAllow(filter.Request{Name: domain, Client: "", Type: gdns.TypeA}).
+			Return(query.Verdict{Allowed: true}, nil)
+		tc.client.EXPECT().
+			Exchange(gomock.Any(), gomock.Any(), dns.UDP, testCfg.Upstream).
+			Return(nil, time.Duration(0), errors.New("timeout"))
+		tc.cache.EXPECT().
+			GetStale(key).
+			Return(dns.CacheEntry{Allowed: true, Answer: []gdns.RR{aRecord}}, true)
+
+		rc := newReqCtx()
+		w := &fakeWriter{}
+		r := gdns.NewMsg("example.com", gdns.TypeA)
+
+		// Act
+		tc.h.HandleRequest(rc, w, r)
+
+		// Assert
+		got, err := w.ParseMsg()
+		if err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if got.Rcode != gdns.RcodeSuccess || len(got.Answer) != 1 {
+			t.Fatalf("expected the stale answer, got %v", got)
+		}
+		if rc.Error != nil || !rc.Cached {
+			t.Errorf("expected the request to be answered from the cache, got error %v", rc.Error)
+		}
+	})
+
+	t.Run("upstream failure - SERVFAIL", func(t *testing.T) {
+		// Arrange: with the ip strategy, a blocked answer would be 0.0.0.0
+		var testCfg = &dns.Config{
+			CacheEnabled:     confuso.Optional[bool]{Value: false, Ok: true},
+			Upstream:         "8.8.8.8:53",
+			BlockingStrategy: confuso.Optional[dns.BlockingStrategy]{Value: dns.BlockingStrategyIP, Ok: true},
+		}
+		tc := newCtx(t, testCfg)
+
+		tc.queryService.EXPECT().
+			ShouldAllow(filter.Request{Name: domain, Client: "", Type: gdns.TypeA}).
+			Return(query.Verdict{Allowed: true}, nil)
+		tc.client.EXPECT().
+			Exchange(gomock.Any(), gomock.Any(), dns.UDP, testCfg.Upstream).
+			Return(nil, time.Duration(0), errors.New("timeout"))
+
+		rc := newReqCtx()
+		w := &fakeWriter{}
+		r := gdns.NewMsg("example.com", gdns.TypeA)
+
+		// Act
+		tc.h.HandleRequest(rc, w, r)
+
+		// Assert
+		got, err := w.ParseMsg()
+		if err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if got.Rcode != gdns.RcodeServerFailure {
+			t.Errorf("expected SERVFAIL (Rcode %d), got Rcode %d", gdns.RcodeServerFailure, got.Rcode)
+		}
+		if len(got.Answer) != 0 {
+			t.Errorf("expected no answers, got %v", got.Answer)
+		}
+		if rc.Error == nil {
+			t.Error("expected the error to be recorded")
+		}
+	})
+
+	t.Run("custom domain - CNAME target failure - SERVFAIL", func(t *testing.T) {
+		// Arrange
+		var testCfg = &dns.Config{
+			Upstream: "8.8.8.8:53",
+			CustomDomains: confuso.Optional[map[string]any]{
+				Ok:    true,
+				Value: map[string]any{"www.local": map[string]any{"cname": "example.com"}},
+			},
+		}
+		tc := newCtx(t, testCfg)
+
+		tc.client.EXPECT().
+			Exchange(gomock.Any(), gomock.Any(), dns.UDP, testCfg.Upstream).
+			Return(nil, time.Duration(0), errors.New("timeout"))
+
+		rc := newReqCtx()
+		w := &fakeWriter{}
+		r := gdns.NewMsg("www.local", gdns.TypeA)
+
+		// Act
+		tc.h.HandleRequest(rc, w, r)
+
+		// Assert
+		got, err := w.ParseMsg()
+		if err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if got.Rcode != gdns.RcodeServerFailure {
+			t.Errorf("expected SERVFAIL (Rcode %d), got Rcode %d", gdns.RcodeServerFailure, got.Rcode)
+		}
+	})
+
+	t.Run("cache hit - prefetch", func(t *testing.T) {
+		// Arrange
+		var testCfg = &dns.Config{
+			CacheEnabled: confuso.Optional[bool]{Value: true, Ok: true},
+			Upstream:     "8.8.8.8:53",
+		}
+		tc := newCtx(t, testCfg)
+
+		aRecord := &gdns.A{
+			Hdr: gdns.Header{Name: domain, Class: gdns.ClassINET, TTL: 300},
+			A:   rdata.A{Addr: netip.MustParseAddr("93.184.216.34")},
+		}
+		upstreamResp := new(gdns.Msg)
+		upstreamResp.Answer = []gdns.RR{aRecord}
+		key := dns.CacheKey{Name: domain, Type: gdns.TypeA, Class: gdns.ClassINET}
+
+		tc.cache.EXPECT().
+			Get(key).
+			Return(dns.CacheEntry{Allowed: true, Answer: []gdns.RR{aRecord}, Prefetch: true}, true)
+		// The entry is refreshed in the background, once filtered again
+		tc.queryService.EXPECT().
+			ShouldAllow(filter.Request{Name: domain, Type: gdns.TypeA}).
+			Return(query.Verdict{Allowed: true}, nil)
+		tc.client.EXPECT().
+			Exchange(gomock.Any(), gomock.Any(), dns.UDP, testCfg.Upstream).
+			Return(upstreamResp, time.Duration(0), nil)
+		refreshed := make(chan struct{})
+		tc.cache.EXPECT().
+			Set(key, upstreamResp, uint32(300)).
+			Do(func(dns.CacheKey, *gdns.Msg, uint32) { close(refreshed) })
+
+		rc := newReqCtx()
+		w := &fakeWriter{}
+		r := gdns.NewMsg("example.com", gdns.TypeA)
+
+		// Act
+		tc.h.HandleRequest(rc, w, r)
+
+		// Assert
+		got, err := w.ParseMsg()
+		if err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if len(got.Answer) != 1 {
+			t.Fatalf("expected the cached answer, got %v", got)
+		}
+
+		select {
+		case <-refreshed:
+		case <-time.After(time.Second):
+			t.Fatal("expected the entry to be prefetched")
+		}
+	})
+
+	t.Run("cache hit - prefetch - no longer allowed", func(t *testing.T) {
+		// Arrange
+		var testCfg = &dns.Config{
+			CacheEnabled: confuso.Optional[bool]{Value: true, Ok: true},
+			Upstream:     "8.8.8.8:53",
+		}
+		tc := newCtx(t, testCfg)
+
+		aRecord := &gdns.A{
+			Hdr: gdns.Header{Name: domain, Class: gdns.ClassINET, TTL: 300},
+			A:   rdata.A{Addr: netip.MustParseAddr("93.184.216.34")},
+		}
+		key := dns.CacheKey{Name: domain, Type: gdns.TypeA, Class: gdns.ClassINET}
+		match := &filter.Match{Rule: "||example.com^"}
+
+		tc.cache.EXPECT().
+			Get(key).
+			Return(dns.CacheEntry{Allowed: true, Answer: []gdns.RR{aRecord}, Prefetch: true}, true)
+		tc.queryService.EXPECT().
+			ShouldAllow(filter.Request{Name: domain, Type: gdns.TypeA}).
+			Return(query.Verdict{Allowed: false, Match: match}, nil)
+		// The entry is blocked instead of being refreshed from the upstream
+		blocked := make(chan struct{})
+		tc.cache.EXPECT().
+			SetBlocked(key, match).
+			Do(func(dns.CacheKey, *filter.Match) { close(blocked) })
+
+		rc := newReqCtx()
+		w := &fakeWriter{}
+		r := gdns.NewMsg("example.com", gdns.TypeA)
+
+		// Act
+		tc.h.HandleRequest(rc, w, r)
+
+		// Assert
+		select {
+		case <-blocked:
+		case <-time.After(time.Second):
+			t.Fatal("expected the entry to be blocked")
+		}
+	})
+}
+
+// ---- WarmUp ----
+
+func TestWarmUp(t *testing.T) {
+	t.Run("caches the allowed top domains", func(t *testing.T) {
+		// Arrange
+		var testCfg = &dns.Config{
+			CacheEnabled: confuso.Optional[bool]{Value: true, Ok: true},
+			Upstream:     "8.8.8.8:53",
+			CustomDomains: confuso.Optional[map[string]any]{
+				Ok:    true,
+				Value: map[string]any{"custom.local": "1.2.3.4"},
+			},
+		}
+		tc := newCtx(t, testCfg)
+
+		upstreamResp := new(gdns.Msg)
+		upstreamResp.Answer = []gdns.RR{&gdns.A{
+			Hdr: gdns.Header{Name: "example.com.", Class: gdns.ClassINET, TTL: 300},
+			A:   rdata.A{Addr: netip.MustParseAddr("93.184.216.34")},
+		}}
+
+		tc.queryService.EXPECT().
+			GetTopAllowedDomains(gomock.Any(), query.Interval7D, 10).
+			Return([]string{"example.com", "custom.local", "ads.com", "cached.com"}, nil)
+		tc.queryService.EXPECT().
+			ShouldAllow(filter.Request{Name: "example.com.", Type: gdns.TypeA}).
+			Return(query.Verdict{Allowed: true}, nil)
+		tc.queryService.EXPECT().
+			ShouldAllow(filter.Request{Name: "example.com.", Type: gdns.TypeAAAA}).
+			Return(query.Verdict{Allowed: true}, nil)
+		tc.queryService.EXPECT().
+			ShouldAllow(gomock.Cond(func(r filter.Request) bool { return r.Name == "ads.com." })).
+			Return(query.Verdict{Allowed: false}, nil).
+			Times(2)
+		tc.queryService.EXPECT().
+			ShouldAllow(gomock.Cond(func(r filter.Request) bool { return r.Name == "cached.com." })).
+			Return(query.Verdict{Allowed: true}, nil).
+			Times(2)
+
+		tc.cache.EXPECT().
+			Get(gomock.Cond(func(k dns.CacheKey) bool { return k.Name == "cached.com." })).
+			Return(dns.CacheEntry{Allowed: true}, true).
+			Times(2)
+		tc.cache.EXPECT().
+			Get(gomock.Cond(func(k dns.CacheKey) bool { return k.Name == "example.com." })).
+			Return(dns.CacheEntry{}, false).
+			Times(2)
+		tc.client.EXPECT().
+			Exchange(gomock.Any(), gomock.Any(), dns.UDP, testCfg.Upstream).
+			Return(upstreamResp, time.Duration(0), nil).
+			Times(2)
+		tc.cache.EXPECT().
+			Set(dns.CacheKey{Name: "example.com.", Type: gdns.TypeA, Class: gdns.ClassINET}, upstreamResp, uint32(300))
+		tc.cache.EXPECT().
+			Set(dns.CacheKey{Name: "example.com.", Type: gdns.TypeAAAA, Class: gdns.ClassINET}, upstreamResp, uint32(300))
+
+		// Act
+		cached, err := tc.h.WarmUp(context.Background(), 10)
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cached != 2 {
+			t.Errorf("expected 2 cached answers, got %d", cached)
+		}
+	})
+
+	t.Run("query service error", func(t *testing.T) {
+		// Arrange
+		tc := newCtx(t, &dns.Config{Upstream: "8.8.8.8:53"})
+
+		tc.queryService.EXPECT().
+			GetTopAllowedDomains(gomock.Any(), query.Interval7D, 10).
+			Return(nil, errors.New("db down"))
+
+		// Act
+		_, err := tc.h.WarmUp(context.Background(), 10)
+
+		// Assert
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+// ---- Persistence ----
+
+func TestChain_PersistsResponseDetails(t *testing.T) {
+	// Arrange
+	var testCfg = &dns.Config{
+		Upstream: "8.8.8.8:53",
+		CustomDomains: confuso.Optional[map[string]any]{
+			Ok:    true,
+			Value: map[string]any{"nas.lan": []any{"192.168.1.10", "192.168.1.11"}},
+		},
+	}
+	tc := newCtx(t, testCfg)
+
+	var saved database.Query
+	tc.queryService.EXPECT().
+		Save(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, q database.Query) error {
+			saved = q
+			return nil
+		})
+
+	w := &fakeWriter{}
+	r := gdns.NewMsg("nas.lan", gdns.TypeA)
+
+	// Act
+	tc.h.Chain(dns.TCP)(context.Background(), w, r)
+
+	// Assert
+	if saved.Name != "nas.lan." || saved.Type != gdns.TypeA || saved.Host != "198.51.100.1" {
+		t.Errorf("unexpected query: %+v", saved)
+	}
+	if saved.Rcode != gdns.RcodeSuccess || saved.AnswerCount != 2 || !saved.Custom || saved.Cached {
+		t.Errorf("unexpected response details: %+v", saved)
+	}
+	if saved.Protocol != dns.TCP {
+		t.Errorf("expected protocol %s, got %s", dns.TCP, saved.Protocol)
+	}
+	// The written response is framed with its length
+	if int(saved.ResponseSize) != w.buf.Len()-2 {
+		t.Errorf("expected response size %d, got %d", w.buf.Len()-2, saved.ResponseSize)
+	}
 }
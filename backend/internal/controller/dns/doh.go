@@ -0,0 +1,143 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"codeberg.org/miekg/dns"
+	"codeberg.org/miekg/dns/dnshttp"
+)
+
+// DoHClient is a DNS-over-HTTPS client (RFC 8484). The queries share the HTTP/2
+// connections to the servers, falling back to HTTP/1.1 if unsupported.
+type DoHClient struct {
+	client *http.Client
+	method string
+}
+
+// NewDoHClient returns a DNS-over-HTTPS client sending the queries with the
+// given method, "get" or "post". A nil tlsConfig verifies the servers against
+// the system roots.
+func NewDoHClient(dialer *net.Dialer, tlsConfig *tls.Config, method string) (*DoHClient, error) {
+	method = strings.ToUpper(method)
+	if method != http.MethodGet && method != http.MethodPost {
+		return nil, fmt.Errorf("doh: unsupported method '%s'", method)
+	}
+
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	} else {
+		tlsConfig = tlsConfig.Clone()
+	}
+	tlsConfig.NextProtos = dnshttp.NextProtos
+
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     tlsConfig,
+		ForceAttemptHTTP2:   true,
+		TLSHandshakeTimeout: dialTimeout,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	return &DoHClient{
+		client: &http.Client{Transport: transport, Timeout: exchangeTimeout},
+		method: method,
+	}, nil
+}
+
+// Exchange sends m to the server at address, the URL of its endpoint. The
+// network is ignored.
+func (c *DoHClient) Exchange(
+	ctx context.Context,
+	m *dns.Msg,
+	_, address string,
+) (*dns.Msg, time.Duration, error) {
+	start := time.Now()
+
+	req, err := c.newRequest(ctx, m, address)
+	if err != nil {
+		return nil, 0, fmt.Errorf("doh: %w", err)
+	}
+
+	httpResp, err := c.client.Do(req)
+	if err != nil {
+		return nil, time.Since(start), fmt.Errorf("doh: %w", err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		if err := httpResp.Body.Close(); err != nil {
+			slog.Error("doh: closing body", "url", address, "err", err)
+		}
+		return nil, time.Since(start), fmt.Errorf("doh: unexpected status %s", httpResp.Status)
+	}
+
+	resp, err := dnshttp.Response(httpResp)
+	if err != nil {
+		return nil, time.Since(start), fmt.Errorf("doh: reading answer: %w", err)
+	}
+
+	// The query is sent with a zero ID, for the HTTP caches
+	resp.ID = m.ID
+	resp.Data = nil
+
+	return resp, time.Since(start), nil
+}
+
+func (c *DoHClient) newRequest(ctx context.Context, m *dns.Msg, address string) (*http.Request, error) {
+	q := m.Copy()
+	q.ID = 0
+	q.Data = nil
+	if err := q.Pack(); err != nil {
+		return nil, fmt.Errorf("packing query: %w", err)
+	}
+
+	var req *http.Request
+	var err error
+	if c.method == http.MethodGet {
+		u, perr := url.Parse(address)
+		if perr != nil {
+			return nil, perr
+		}
+		values := u.Query()
+		values.Set("dns", base64.RawURLEncoding.EncodeToString(q.Data))
+		u.RawQuery = values.Encode()
+
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, address, bytes.NewReader(q.Data))
+		if err == nil {
+			req.Header.Set("Content-Type", dnshttp.MimeType)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", dnshttp.MimeType)
+
+	return req, nil
+}
+
+// parseDoHURL validates an https:// upstream, and adds the standard path if missing.
+func parseDoHURL(upstream string) (string, error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return "", fmt.Errorf("invalid DNS-over-HTTPS upstream '%s': %w", upstream, err)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("invalid DNS-over-HTTPS upstream '%s': missing host", upstream)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = dnshttp.Path
+	}
+
+	return u.String(), nil
+}
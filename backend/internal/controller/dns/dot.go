@@ -0,0 +1,301 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"codeberg.org/miekg/dns"
+)
+
+// errConnClosed is returned for the queries pending on a connection when it is closed.
+var errConnClosed = errors.New("connection closed")
+
+// DoTClient is a DNS-over-TLS client (RFC 7858). It keeps a connection open to
+// each upstream, and pipelines the queries on it: they are sent without waiting
+// for the previous answers, which are matched to the queries by ID.
+type DoTClient struct {
+	dialer    *net.Dialer
+	tlsConfig *tls.Config
+
+	mu    sync.Mutex
+	conns map[string]*dotConn
+	// dials are the connections being opened, shared by the queries to the
+	// same upstream meanwhile
+	dials map[string]*dotDial
+}
+
+// dotDial is a connection being opened, ready once done is closed.
+type dotDial struct {
+	done chan struct{}
+	conn *dotConn
+	err  error
+}
+
+// NewDoTClient returns a DNS-over-TLS client. A nil tlsConfig verifies the
+// servers against the system roots.
+func NewDoTClient(dialer *net.Dialer, tlsConfig *tls.Config) *DoTClient {
+	return &DoTClient{
+		dialer:    dialer,
+		tlsConfig: tlsConfig,
+		conns:     make(map[string]*dotConn),
+		dials:     make(map[string]*dotDial),
+	}
+}
+
+// Exchange sends m to the server at address (host:port). The network is ignored.
+func (c *DoTClient) Exchange(
+	ctx context.Context,
+	m *dns.Msg,
+	_, address string,
+) (*dns.Msg, time.Duration, error) {
+	start := time.Now()
+
+	for attempt := 0; ; attempt++ {
+		conn, reused, err := c.conn(ctx, address)
+		if err != nil {
+			return nil, time.Since(start), fmt.Errorf("dot: %w", err)
+		}
+
+		resp, err := conn.exchange(ctx, m)
+		if err != nil && reused && attempt == 0 && errors.Is(err, errConnClosed) {
+			// The server may have closed the idle connection before getting the query
+			continue
+		}
+		if err != nil {
+			return nil, time.Since(start), fmt.Errorf("dot: %w", err)
+		}
+
+		return resp, time.Since(start), nil
+	}
+}
+
+// conn returns the open connection to address, or a new one. The boolean is
+// true if the connection was already open. The upstreams are dialed without
+// holding the lock, so that a slow one does not hold up the others.
+func (c *DoTClient) conn(ctx context.Context, address string) (*dotConn, bool, error) {
+	c.mu.Lock()
+	if conn, ok := c.conns[address]; ok && !conn.closed() {
+		c.mu.Unlock()
+		return conn, true, nil
+	}
+	d, dialing := c.dials[address]
+	if !dialing {
+		d = &dotDial{done: make(chan struct{})}
+		c.dials[address] = d
+	}
+	c.mu.Unlock()
+
+	if dialing {
+		select {
+		case <-d.done:
+			return d.conn, false, d.err
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+
+	dialer := tls.Dialer{NetDialer: c.dialer, Config: tlsConfigFor(c.tlsConfig, address)}
+	netConn, err := dialer.DialContext(ctx, "tcp", address)
+
+	c.mu.Lock()
+	delete(c.dials, address)
+	if err != nil {
+		d.err = err
+	} else {
+		d.conn = newDoTConn(netConn)
+		c.conns[address] = d.conn
+	}
+	c.mu.Unlock()
+	close(d.done)
+
+	return d.conn, false, d.err
+}
+
+// dotConn is a connection to a DNS-over-TLS server, shared by concurrent queries.
+type dotConn struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[uint16]chan *dns.Msg
+	err     error
+	done    chan struct{}
+}
+
+func newDoTConn(conn net.Conn) *dotConn {
+	c := &dotConn{
+		conn:    conn,
+		pending: make(map[uint16]chan *dns.Msg),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+
+	return c
+}
+
+func (c *dotConn) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	id, ch, err := c.register()
+	if err != nil {
+		return nil, err
+	}
+	defer c.unregister(id)
+
+	// The query gets an ID that is unique on the connection, the original one is
+	// restored in the answer
+	q := m.Copy()
+	q.ID = id
+	q.Data = nil
+	if err := q.Pack(); err != nil {
+		return nil, fmt.Errorf("packing query: %w", err)
+	}
+
+	buf := make([]byte, 2+len(q.Data))
+	binary.BigEndian.PutUint16(buf, uint16(len(q.Data)))
+	copy(buf[2:], q.Data)
+
+	if err := c.write(buf); err != nil {
+		c.close(err)
+		return nil, fmt.Errorf("%w: %w", errConnClosed, err)
+	}
+
+	timer := time.NewTimer(exchangeTimeout)
+	defer timer.Stop()
+
+	select {
+	case resp := <-ch:
+		resp.ID = m.ID
+		// The raw message carries the ID of the connection, it must be packed again
+		resp.Data = nil
+		return resp, nil
+	case <-c.done:
+		return nil, fmt.Errorf("%w: %w", errConnClosed, c.err)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		// The other queries on the connection go on, the answer to this one is
+		// dropped if it ever comes
+		return nil, errors.New("query timed out")
+	}
+}
+
+// write sends a framed query on the connection.
+func (c *dotConn) write(buf []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(exchangeTimeout)); err != nil {
+		return fmt.Errorf("setting write deadline: %w", err)
+	}
+	_, err := c.conn.Write(buf)
+
+	return err
+}
+
+func (c *dotConn) register() (uint16, chan *dns.Msg, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return 0, nil, fmt.Errorf("%w: %w", errConnClosed, c.err)
+	}
+	if len(c.pending) > 0xffff {
+		return 0, nil, errors.New("too many pending queries")
+	}
+
+	for {
+		id := uint16(rand.N(0x10000))
+		if _, ok := c.pending[id]; !ok {
+			ch := make(chan *dns.Msg, 1)
+			c.pending[id] = ch
+			return id, ch, nil
+		}
+	}
+}
+
+func (c *dotConn) unregister(id uint16) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+func (c *dotConn) readLoop() {
+	var size [2]byte
+	for {
+		if _, err := io.ReadFull(c.conn, size[:]); err != nil {
+			c.close(err)
+			return
+		}
+
+		buf := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(c.conn, buf); err != nil {
+			c.close(err)
+			return
+		}
+
+		resp := &dns.Msg{Data: buf}
+		if err := resp.Unpack(); err != nil {
+			c.close(fmt.Errorf("unpacking answer: %w", err))
+			return
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[resp.ID]
+		delete(c.pending, resp.ID)
+		c.mu.Unlock()
+
+		// Answers to queries given up on are dropped
+		if ok {
+			ch <- resp
+		}
+	}
+}
+
+func (c *dotConn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	c.err = err
+	close(c.done)
+	if err := c.conn.Close(); err != nil {
+		slog.Error("dot: closing connection", "address", c.conn.RemoteAddr(), "err", err)
+	}
+}
+
+func (c *dotConn) closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err != nil
+}
+
+// parseDoTAddress returns the host:port of a tls:// upstream, on port 853 by default.
+func parseDoTAddress(upstream string) (string, error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return "", fmt.Errorf("invalid DNS-over-TLS upstream '%s': %w", upstream, err)
+	}
+	if u.Hostname() == "" || (u.Path != "" && u.Path != "/") {
+		return "", fmt.Errorf("invalid DNS-over-TLS upstream '%s': expected tls://host[:port]", upstream)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "853"
+	}
+
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
@@ -0,0 +1,206 @@
+package dns
+
+import (
+	"fmt"
+	"gohole/internal/filter"
+	"strings"
+
+	"codeberg.org/miekg/dns"
+)
+
+// Stage is a step of the decision chain of the handler.
+type Stage string
+
+const (
+	StageCustom  Stage = "custom"
+	StageCache   Stage = "cache"
+	StageForward Stage = "forward"
+	StageAllow   Stage = "allow"
+	StageBlock   Stage = "block"
+)
+
+// Action is what the handler does with a query.
+type Action string
+
+const (
+	// ActionAnswer means the query is answered locally (custom domain or cache).
+	ActionAnswer Action = "answer"
+	// ActionBlock means the query is answered according to the blocking strategy.
+	ActionBlock Action = "block"
+	// ActionForward means the query is forwarded to the upstream.
+	ActionForward Action = "forward"
+)
+
+// ExplainStep is the outcome of a stage of the decision chain.
+type ExplainStep struct {
+	Stage Stage `json:"stage"`
+	// Enabled is false for the stages that are turned off, e.g. a disabled cache.
+	Enabled bool `json:"enabled"`
+	// Matched is true if the stage has an opinion on the query.
+	Matched bool `json:"matched"`
+	// Decisive is true for the first matching stage, the one the handler follows.
+	// The following stages are evaluated anyway, to tell what they would do.
+	Decisive bool   `json:"decisive"`
+	Action   Action `json:"action,omitempty"`
+	// Match is the list entry that matched, for the filter stages.
+	Match  *filter.Match `json:"match,omitempty"`
+	Detail string        `json:"detail,omitempty"`
+}
+
+// Explanation tells how the handler would deal with a query.
+type Explanation struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Client string `json:"client"`
+	Action Action `json:"action"`
+	// Match is the list entry the decision is based on, if any.
+	Match *filter.Match `json:"match,omitempty"`
+	// ClientScoped is true if the decision depends on the client.
+	ClientScoped     bool             `json:"clientScoped"`
+	BlockingStrategy BlockingStrategy `json:"blockingStrategy"`
+	// Rcode and Answer are the response that would be sent, unless the query is
+	// forwarded to the upstream.
+	Rcode  string        `json:"rcode,omitempty"`
+	Answer []string      `json:"answer,omitempty"`
+	Steps  []ExplainStep `json:"steps"`
+}
+
+// Explain runs the decision chain of HandleRequest for the given question
+// without side effects: the upstream is not contacted, nothing is stored in the
+// cache and the query is not logged.
+func (h *Handler) Explain(name string, qtype uint16, client string) (*Explanation, error) {
+	name = normalizeName(name)
+	req := dns.NewMsg(name, qtype)
+	if req == nil {
+		return nil, fmt.Errorf("dns handler: unsupported query type %d", qtype)
+	}
+	question := req.Question[0]
+
+	ex := &Explanation{
+		Name:             name,
+		Type:             dns.TypeToString[qtype],
+		Client:           client,
+		Action:           ActionForward,
+		BlockingStrategy: h.blockingStrategy,
+	}
+
+	var resp *dns.Msg
+	decide := func(step *ExplainStep, r *dns.Msg) {
+		if step.Matched && !ex.decided() {
+			step.Decisive = true
+			ex.Action = step.Action
+			ex.Match = step.Match
+			resp = r
+		}
+		ex.Steps = append(ex.Steps, *step)
+	}
+
+	// Custom domains
+	custom := ExplainStep{Stage: StageCustom, Enabled: len(h.records) > 0}
+	if answer, target, ok := h.records.lookup(name, qtype); ok {
+		custom.Matched = true
+		custom.Action = ActionAnswer
+		if target != "" {
+			// The upstream is not contacted, the answer stops at the alias
+			custom.Detail = fmt.Sprintf("%s is resolved through the upstream", target)
+		}
+		decide(&custom, responseFromAnswer(answer, req))
+	} else {
+		decide(&custom, nil)
+	}
+
+	route := h.routes.lookup(name)
+
+	// Cache
+	cache := ExplainStep{Stage: StageCache, Enabled: h.cacheEnabled}
+	if h.cacheEnabled {
+		if entry, ok := h.cache.Peek(route.cacheKey(question)); ok {
+			if entry.Allowed {
+				cache.Matched = true
+				cache.Action = ActionAnswer
+			} else {
+				// Like the handler, the filters are evaluated again for the
+				// blocked entries
+				cache.Match = entry.Match
+				cache.Detail = "blocked entry, the filters are evaluated again"
+			}
+			decide(&cache, responseFromEntry(&entry, req))
+		} else {
+			decide(&cache, nil)
+		}
+	} else {
+		decide(&cache, nil)
+	}
+
+	// Conditional forwarding
+	forward := ExplainStep{
+		Stage:   StageForward,
+		Enabled: len(h.routes) > 0,
+		Matched: route != nil,
+	}
+	if route != nil {
+		forward.Action = ActionForward
+		forward.Detail = fmt.Sprintf(
+			"route %s to %s, the filters are skipped",
+			route.name,
+			strings.Join(route.upstreams.Addresses(), ", "),
+		)
+	}
+	decide(&forward, nil)
+
+	// Filters
+	matches, err := h.queryService.Matches(filter.Request{
+		Name:   name,
+		Client: client,
+		Type:   qtype,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("dns handler: explaining query: %w", err)
+	}
+	ex.ClientScoped = matches.ClientScoped
+
+	allow := ExplainStep{
+		Stage:   StageAllow,
+		Enabled: true,
+		Matched: matches.Allow != nil,
+		Match:   matches.Allow,
+	}
+	if allow.Matched {
+		allow.Action = ActionForward
+	}
+	decide(&allow, nil)
+
+	block := ExplainStep{
+		Stage:   StageBlock,
+		Enabled: true,
+		Matched: matches.Block != nil,
+		Match:   matches.Block,
+	}
+	if block.Matched {
+		block.Action = ActionBlock
+		if allow.Matched {
+			block.Detail = "overridden by the allow list"
+		}
+	}
+	decide(&block, blockedResponse(req, h.blockingStrategy))
+
+	if resp != nil {
+		ex.Rcode = dns.RcodeToString[resp.Rcode]
+		for _, rr := range resp.Answer {
+			ex.Answer = append(ex.Answer, rr.String())
+		}
+	}
+
+	return ex, nil
+}
+
+// decided returns true if a stage already decided what to do with the query.
+func (ex *Explanation) decided() bool {
+	for _, s := range ex.Steps {
+		if s.Decisive {
+			return true
+		}
+	}
+
+	return false
+}
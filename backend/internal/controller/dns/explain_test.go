@@ -0,0 +1,149 @@
+package dns_test
+
+import (
+	"testing"
+
+	gdns "codeberg.org/miekg/dns"
+	"github.com/specialfish9/confuso/v2"
+	"go.uber.org/mock/gomock"
+
+	"gohole/internal/controller/dns"
+	"gohole/internal/filter"
+	"gohole/internal/query"
+)
+
+// ---- Explain ----
+
+func TestExplain(t *testing.T) {
+	blockMatch := &filter.Match{List: "https://example.com/ads.txt", Rule: "ads.com", Kind: filter.MatchExact}
+	allowMatch := &filter.Match{List: "allow.txt", Rule: "ads.com", Kind: filter.MatchExact}
+
+	t.Run("blocked", func(t *testing.T) {
+		tc := newCtx(t, &dns.Config{Upstream: "8.8.8.8"})
+		tc.queryService.EXPECT().
+			Matches(filter.Request{Name: "ads.com.", Client: "10.0.0.5", Type: gdns.TypeA}).
+			Return(query.Matches{Block: blockMatch}, nil)
+
+		ex, err := tc.h.Explain("ADS.com", gdns.TypeA, "10.0.0.5")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if ex.Action != dns.ActionBlock || ex.Match != blockMatch {
+			t.Errorf("expected the block entry to decide, got %+v", ex)
+		}
+		if ex.Rcode != "NXDOMAIN" || len(ex.Answer) != 0 {
+			t.Errorf("expected an NXDOMAIN response, got %s %v", ex.Rcode, ex.Answer)
+		}
+		if len(ex.Steps) != 5 || !ex.Steps[4].Decisive || ex.Steps[1].Enabled || ex.Steps[2].Enabled {
+			t.Errorf("unexpected steps: %+v", ex.Steps)
+		}
+	})
+
+	t.Run("ip strategy", func(t *testing.T) {
+		tc := newCtx(t, &dns.Config{
+			Upstream:         "8.8.8.8",
+			BlockingStrategy: confuso.Optional[dns.BlockingStrategy]{Value: dns.BlockingStrategyIP, Ok: true},
+		})
+		tc.queryService.EXPECT().
+			Matches(gomock.Any()).
+			Return(query.Matches{Block: blockMatch}, nil)
+
+		ex, err := tc.h.Explain("ads.com", gdns.TypeAAAA, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ex.Rcode != "NOERROR" || len(ex.Answer) != 1 {
+			t.Errorf("expected a null address answer, got %s %v", ex.Rcode, ex.Answer)
+		}
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		tc := newCtx(t, &dns.Config{Upstream: "8.8.8.8"})
+		tc.queryService.EXPECT().
+			Matches(gomock.Any()).
+			Return(query.Matches{Allow: allowMatch, Block: blockMatch}, nil)
+
+		ex, err := tc.h.Explain("ads.com", gdns.TypeA, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if ex.Action != dns.ActionForward || ex.Match != allowMatch || ex.Rcode != "" {
+			t.Errorf("expected the query to be forwarded, got %+v", ex)
+		}
+		if !ex.Steps[3].Decisive || ex.Steps[4].Decisive || ex.Steps[4].Detail == "" {
+			t.Errorf("expected the allow entry to override the block one: %+v", ex.Steps)
+		}
+	})
+
+	t.Run("custom domain and cache", func(t *testing.T) {
+		tc := newCtx(t, &dns.Config{
+			Upstream:      "8.8.8.8",
+			CacheEnabled:  confuso.Optional[bool]{Value: true, Ok: true},
+			CustomDomains: confuso.Optional[map[string]any]{Value: map[string]any{"nas.lan": "192.168.1.10"}, Ok: true},
+		})
+		tc.cache.EXPECT().
+			Peek(gomock.Any()).
+			Return(dns.CacheEntry{Allowed: true}, true)
+		tc.queryService.EXPECT().Matches(gomock.Any()).Return(query.Matches{}, nil)
+
+		ex, err := tc.h.Explain("nas.lan", gdns.TypeA, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if ex.Action != dns.ActionAnswer || len(ex.Answer) != 1 {
+			t.Errorf("expected the custom domain to be answered, got %+v", ex)
+		}
+		if !ex.Steps[0].Decisive || ex.Steps[1].Decisive || !ex.Steps[1].Matched {
+			t.Errorf("expected the cache to be evaluated but not followed: %+v", ex.Steps)
+		}
+	})
+
+	t.Run("cached blocked entry", func(t *testing.T) {
+		tc := newCtx(t, &dns.Config{
+			Upstream:     "8.8.8.8",
+			CacheEnabled: confuso.Optional[bool]{Value: true, Ok: true},
+		})
+		tc.cache.EXPECT().
+			Peek(gomock.Any()).
+			Return(dns.CacheEntry{Allowed: false, Match: blockMatch}, true)
+		tc.queryService.EXPECT().Matches(gomock.Any()).Return(query.Matches{}, nil)
+
+		ex, err := tc.h.Explain("ads.com", gdns.TypeA, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// The filters no longer block the name, it is forwarded
+		if ex.Action != dns.ActionForward {
+			t.Errorf("expected the query to be forwarded, got %s", ex.Action)
+		}
+		if ex.Steps[1].Matched || ex.Steps[1].Decisive || ex.Steps[1].Match != blockMatch {
+			t.Errorf("expected the blocked entry to be reported but not followed: %+v", ex.Steps[1])
+		}
+	})
+
+	t.Run("forwarding route", func(t *testing.T) {
+		tc := newCtx(t, &dns.Config{
+			Upstream: "8.8.8.8",
+			Forward:  confuso.Optional[map[string]any]{Value: map[string]any{"lan": "192.168.1.1"}, Ok: true},
+		})
+		tc.queryService.EXPECT().
+			Matches(gomock.Any()).
+			Return(query.Matches{Block: blockMatch}, nil)
+
+		ex, err := tc.h.Explain("ads.lan", gdns.TypeA, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if ex.Action != dns.ActionForward || ex.Match != nil {
+			t.Errorf("expected the query to be forwarded unfiltered, got %+v", ex)
+		}
+		if !ex.Steps[2].Decisive || ex.Steps[4].Decisive || !ex.Steps[4].Matched {
+			t.Errorf("expected the route to skip the filters: %+v", ex.Steps)
+		}
+	})
+}
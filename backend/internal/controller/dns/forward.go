@@ -0,0 +1,210 @@
+package dns
+
+import (
+	"cmp"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"codeberg.org/miekg/dns"
+)
+
+const (
+	reverseZoneV4 = "in-addr.arpa."
+	reverseZoneV6 = "ip6.arpa."
+)
+
+// forwardRoute sends the queries for the names under a zone to dedicated upstreams.
+type forwardRoute struct {
+	// name is the route as configured, a domain or a CIDR.
+	name string
+	// zone is the suffix of the names the route applies to.
+	zone string
+	// prefix is set for the routes of reverse zones: the name must also be the
+	// reverse name of an address of the prefix, as CIDRs do not always end on a
+	// label boundary.
+	prefix    netip.Prefix
+	upstreams *Upstreams
+}
+
+// forwardRoutes are the conditional forwarding routes, indexed by zone.
+type forwardRoutes map[string][]*forwardRoute
+
+func parseForwardRoutes(
+	routes map[string]any,
+	strategy UpstreamStrategy,
+	client Client,
+) (forwardRoutes, error) {
+	res := make(forwardRoutes)
+	for name, v := range routes {
+		addresses, err := parseAddresses(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstreams for route '%s': %w", name, err)
+		}
+
+		upstreams, err := NewUpstreams(addresses, strategy, client)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstreams for route '%s': %w", name, err)
+		}
+
+		route := &forwardRoute{name: name, upstreams: upstreams}
+		if prefix, err := netip.ParsePrefix(name); err == nil {
+			route.prefix = prefix.Masked()
+			route.zone = reverseZone(route.prefix)
+		} else {
+			zone := normalizeName(strings.TrimPrefix(name, "*."))
+			if zone == "." {
+				return nil, fmt.Errorf("invalid route '%s': expected a domain or a CIDR", name)
+			}
+			route.zone = zone
+		}
+
+		res[route.zone] = append(res[route.zone], route)
+	}
+
+	// The most specific prefix of a zone comes first, the domain (if any) last
+	for _, zoneRoutes := range res {
+		slices.SortFunc(zoneRoutes, func(a, b *forwardRoute) int {
+			return cmp.Compare(routeBits(b), routeBits(a))
+		})
+	}
+
+	return res, nil
+}
+
+func routeBits(r *forwardRoute) int {
+	if !r.prefix.IsValid() {
+		return -1
+	}
+	return r.prefix.Bits()
+}
+
+// lookup returns the route of the longest zone name belongs to, or nil if
+// there is none.
+func (f forwardRoutes) lookup(name string) *forwardRoute {
+	if len(f) == 0 {
+		return nil
+	}
+
+	for suffix := name; suffix != "" && suffix != "."; {
+		for _, route := range f[suffix] {
+			if route.contains(name) {
+				return route
+			}
+		}
+
+		i := strings.IndexByte(suffix, '.')
+		if i < 0 {
+			break
+		}
+		suffix = suffix[i+1:]
+	}
+
+	return nil
+}
+
+// contains returns true if the route applies to name, which is under its zone.
+func (r *forwardRoute) contains(name string) bool {
+	if !r.prefix.IsValid() {
+		return true
+	}
+
+	prefix, ok := parseReverseName(name)
+	return ok && prefix.Bits() >= r.prefix.Bits() && r.prefix.Contains(prefix.Addr())
+}
+
+// cacheKey returns the cache key of rr for the queries following the route, so
+// that the answers of different upstreams are kept apart. The route may be nil.
+func (r *forwardRoute) cacheKey(rr dns.RR) CacheKey {
+	key := NewCacheKey(rr)
+	if r != nil {
+		key.Route = r.name
+	}
+
+	return key
+}
+
+// reverseZone returns the reverse zone containing the addresses of prefix,
+// rounded down to the closest label boundary.
+func reverseZone(prefix netip.Prefix) string {
+	var labels []string
+
+	addr := prefix.Addr()
+	if addr.Is4() {
+		b := addr.As4()
+		for i := range prefix.Bits() / 8 {
+			labels = append(labels, strconv.Itoa(int(b[i])))
+		}
+		slices.Reverse(labels)
+		return strings.Join(append(labels, reverseZoneV4), ".")
+	}
+
+	b := addr.As16()
+	for i := range prefix.Bits() / 4 {
+		nibble := b[i/2] >> 4
+		if i%2 == 1 {
+			nibble = b[i/2] & 0x0f
+		}
+		labels = append(labels, strconv.FormatUint(uint64(nibble), 16))
+	}
+	slices.Reverse(labels)
+	return strings.Join(append(labels, reverseZoneV6), ".")
+}
+
+// parseReverseName parses a name under a reverse zone into the prefix of the
+// addresses it covers, e.g. "1.168.192.in-addr.arpa." is 192.168.1.0/24.
+func parseReverseName(name string) (netip.Prefix, bool) {
+	switch {
+	case strings.HasSuffix(name, "."+reverseZoneV4) || name == reverseZoneV4:
+		labels := reverseLabels(name, reverseZoneV4)
+		if len(labels) > 4 {
+			return netip.Prefix{}, false
+		}
+
+		var b [4]byte
+		for i, label := range labels {
+			n, err := strconv.ParseUint(label, 10, 8)
+			if err != nil {
+				return netip.Prefix{}, false
+			}
+			b[i] = byte(n)
+		}
+		return netip.PrefixFrom(netip.AddrFrom4(b), 8*len(labels)), true
+
+	case strings.HasSuffix(name, "."+reverseZoneV6) || name == reverseZoneV6:
+		labels := reverseLabels(name, reverseZoneV6)
+		if len(labels) > 32 {
+			return netip.Prefix{}, false
+		}
+
+		var b [16]byte
+		for i, label := range labels {
+			n, err := strconv.ParseUint(label, 16, 4)
+			if err != nil || len(label) != 1 {
+				return netip.Prefix{}, false
+			}
+			if i%2 == 0 {
+				b[i/2] |= byte(n) << 4
+			} else {
+				b[i/2] |= byte(n)
+			}
+		}
+		return netip.PrefixFrom(netip.AddrFrom16(b), 4*len(labels)), true
+	}
+
+	return netip.Prefix{}, false
+}
+
+// reverseLabels returns the labels of name before zone, most significant first.
+func reverseLabels(name, zone string) []string {
+	rest := strings.TrimSuffix(strings.TrimSuffix(name, zone), ".")
+	if rest == "" {
+		return nil
+	}
+
+	labels := strings.Split(rest, ".")
+	slices.Reverse(labels)
+	return labels
+}
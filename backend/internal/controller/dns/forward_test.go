@@ -0,0 +1,87 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestForwardRoutes_Lookup(t *testing.T) {
+	routes, err := parseForwardRoutes(map[string]any{
+		"lan":            "192.168.1.1",
+		"*.home.arpa":    "192.168.1.1",
+		"corp.example":   "10.8.0.1",
+		"vpn.lan":        "10.8.0.1",
+		"192.168.0.0/16": "192.168.1.1",
+		"172.16.0.0/12":  "172.16.0.1",
+		"10.1.2.0/24":    "10.1.2.1",
+		"10.1.0.0/16":    "10.1.0.1",
+		"fd00::/8":       "fd00::1",
+	}, UpstreamStrategyFailover, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		route string
+	}{
+		{name: "nas.lan.", route: "lan"},
+		{name: "lan.", route: "lan"},
+		{name: "host.vpn.lan.", route: "vpn.lan"},
+		{name: "router.home.arpa.", route: "*.home.arpa"},
+		{name: "git.corp.example.", route: "corp.example"},
+		{name: "example.", route: ""},
+		{name: "notlan.", route: ""},
+		{name: "10.1.168.192.in-addr.arpa.", route: "192.168.0.0/16"},
+		{name: "168.192.in-addr.arpa.", route: "192.168.0.0/16"},
+		{name: "192.in-addr.arpa.", route: ""},
+		{name: "1.0.20.172.in-addr.arpa.", route: "172.16.0.0/12"},
+		{name: "1.0.32.172.in-addr.arpa.", route: ""},
+		{name: "5.2.1.10.in-addr.arpa.", route: "10.1.2.0/24"},
+		{name: "5.3.1.10.in-addr.arpa.", route: "10.1.0.0/16"},
+		{name: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa.", route: "fd00::/8"},
+		{name: "8.8.8.8.in-addr.arpa.", route: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got string
+			if route := routes.lookup(test.name); route != nil {
+				got = route.name
+			}
+			if got != test.route {
+				t.Errorf("expected route '%s', got '%s'", test.route, got)
+			}
+		})
+	}
+}
+
+func TestParseForwardRoutes_Invalid(t *testing.T) {
+	for _, routes := range []map[string]any{
+		{"lan": 53},
+		{"lan": []any{}},
+		{"lan": "not an address"},
+		{".": "192.168.1.1"},
+	} {
+		if _, err := parseForwardRoutes(routes, UpstreamStrategyFailover, nil); err == nil {
+			t.Errorf("expected an error for %v", routes)
+		}
+	}
+}
+
+func TestReverseZone(t *testing.T) {
+	tests := map[string]string{
+		"192.168.0.0/16": "168.192.in-addr.arpa.",
+		"172.16.0.0/12":  "172.in-addr.arpa.",
+		"10.0.0.0/8":     "10.in-addr.arpa.",
+		"0.0.0.0/0":      "in-addr.arpa.",
+		"fd00::/8":       "d.f.ip6.arpa.",
+		"2001:db8::/34":  "8.b.d.0.1.0.0.2.ip6.arpa.",
+	}
+
+	for prefix, want := range tests {
+		if got := reverseZone(netip.MustParsePrefix(prefix)); got != want {
+			t.Errorf("%s: expected %s, got %s", prefix, want, got)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package dns
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+
+	"codeberg.org/miekg/dns"
+	"codeberg.org/miekg/dns/dnsutil"
+	"codeberg.org/miekg/dns/rdata"
+	"github.com/specialfish9/confuso/v2"
+)
+
+const (
+	// localTTL is the TTL of the local records which do not set their own.
+	localTTL = 60
+	// maxCNAMEChain bounds the aliases followed through the local records, which
+	// also stops CNAME loops.
+	maxCNAMEChain = 8
+	// maxTXTLength is the length of the character strings of TXT records.
+	maxTXTLength = 255
+)
+
+// localRecords holds the records answered without the upstreams, from the
+// custom domains and the hosts and zone files, by owner name. Wildcard names,
+// e.g. *.dev.lan., are kept as such and match the names without records below
+// them.
+type localRecords map[string][]dns.RR
+
+// loadLocalRecords returns the local records configured in cfg.
+func loadLocalRecords(cfg *Config) (localRecords, error) {
+	var rrs []dns.RR
+
+	if cfg.CustomDomains.Ok {
+		custom, err := parseCustomDomains(cfg.CustomDomains.Value)
+		if err != nil {
+			return nil, fmt.Errorf("parsing custom domains: %w", err)
+		}
+		rrs = append(rrs, custom...)
+	}
+
+	files := []struct {
+		setting string
+		paths   confuso.Optional[any]
+		parse   func(io.Reader, string) ([]dns.RR, error)
+	}{
+		{"hosts_files", cfg.HostsFiles, parseHostsFile},
+		{"zone_files", cfg.ZoneFiles, parseZoneFile},
+	}
+	for _, f := range files {
+		if !f.paths.Ok {
+			continue
+		}
+
+		paths, err := parseStrings(f.paths.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", f.setting, err)
+		}
+
+		for _, path := range paths {
+			loaded, err := loadRecordsFile(path, f.parse)
+			if err != nil {
+				return nil, err
+			}
+			rrs = append(rrs, loaded...)
+		}
+	}
+
+	return newLocalRecords(rrs)
+}
+
+func loadRecordsFile(path string, parse func(io.Reader, string) ([]dns.RR, error)) ([]dns.RR, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading records: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			slog.Error("dns: closing records file", "file", path, "err", err)
+		}
+	}()
+
+	rrs, err := parse(file, path)
+	if err != nil {
+		return nil, fmt.Errorf("loading records: %w", err)
+	}
+
+	return rrs, nil
+}
+
+// newLocalRecords groups rrs by owner name, and adds the PTR records of the
+// addresses whose reverse name has no record of its own.
+func newLocalRecords(rrs []dns.RR) (localRecords, error) {
+	l := make(localRecords)
+	for _, rr := range rrs {
+		name := normalizeName(rr.Header().Name)
+		if strings.Contains(strings.TrimPrefix(name, "*."), "*") {
+			return nil, fmt.Errorf("invalid name %s: wildcards are only allowed as first label", name)
+		}
+
+		rr.Header().Name = name
+		if !slices.ContainsFunc(l[name], func(o dns.RR) bool { return dns.Equal(o, rr) }) {
+			l[name] = append(l[name], rr)
+		}
+	}
+
+	for name, rrs := range l {
+		if len(rrs) > 1 && slices.ContainsFunc(rrs, isCNAME) {
+			return nil, fmt.Errorf("%s has a CNAME record along with other records", name)
+		}
+	}
+
+	ptrs := make(localRecords)
+	for name, rrs := range l {
+		if strings.HasPrefix(name, "*.") {
+			continue
+		}
+
+		for _, rr := range rrs {
+			var addr netip.Addr
+			switch rr := rr.(type) {
+			case *dns.A:
+				addr = rr.Addr
+			case *dns.AAAA:
+				addr = rr.Addr
+			default:
+				continue
+			}
+
+			reverse := dnsutil.ReverseAddr(addr)
+			if _, ok := l[reverse]; ok {
+				continue
+			}
+			ptrs[reverse] = append(ptrs[reverse], &dns.PTR{
+				Hdr: dns.Header{Name: reverse, Class: dns.ClassINET, TTL: rr.Header().TTL},
+				PTR: rdata.PTR{Ptr: name},
+			})
+		}
+	}
+	for reverse, rrs := range ptrs {
+		// Keep the answers stable, whatever the order of the names
+		slices.SortFunc(rrs, func(a, b dns.RR) int {
+			return strings.Compare(a.(*dns.PTR).Ptr, b.(*dns.PTR).Ptr)
+		})
+		l[reverse] = rrs
+	}
+
+	return l, nil
+}
+
+// find returns the records of name, or else the ones of the closest wildcard
+// name matching it.
+func (l localRecords) find(name string) ([]dns.RR, bool) {
+	if rrs, ok := l[name]; ok {
+		return rrs, true
+	}
+
+	for parent := name; ; {
+		var ok bool
+		if _, parent, ok = strings.Cut(parent, "."); !ok || parent == "" {
+			return nil, false
+		}
+		if rrs, ok := l["*."+parent]; ok {
+			return rrs, true
+		}
+	}
+}
+
+// has tells whether there are local records for name.
+func (l localRecords) has(name string) bool {
+	_, ok := l.find(name)
+	return ok
+}
+
+// lookup answers the question for name of type qtype from the local records.
+// The boolean is false if there is no record for name. Aliases are followed
+// through the local records; if the last one points to a name without local
+// records, target is that name, to be resolved by the upstreams. A name
+// without records of type qtype is answered with an empty answer.
+func (l localRecords) lookup(name string, qtype uint16) (answer []dns.RR, target string, ok bool) {
+	owner := dnsutil.Fqdn(name)
+
+	for range maxCNAMEChain {
+		rrs, found := l.find(strings.ToLower(owner))
+		if !found {
+			if len(answer) == 0 {
+				return nil, "", false
+			}
+			return answer, owner, true
+		}
+
+		if qtype != dns.TypeCNAME && isCNAME(rrs[0]) {
+			cname := withOwner(rrs[0], owner)
+			answer = append(answer, cname)
+			owner = cname.(*dns.CNAME).Target
+			continue
+		}
+
+		for _, rr := range rrs {
+			if qtype == dns.TypeANY || dns.RRToType(rr) == qtype {
+				answer = append(answer, withOwner(rr, owner))
+			}
+		}
+		return answer, "", true
+	}
+
+	return answer, "", true
+}
+
+// withOwner returns a copy of rr for the name owner, which differs from the
+// one of rr for wildcard records.
+func withOwner(rr dns.RR, owner string) dns.RR {
+	rr = rr.Clone()
+	rr.Header().Name = owner
+	return rr
+}
+
+func isCNAME(rr dns.RR) bool {
+	return dns.RRToType(rr) == dns.TypeCNAME
+}
+
+// addressRecord returns the A or AAAA record of addr for name.
+func addressRecord(name string, addr netip.Addr) dns.RR {
+	hdr := dns.Header{Name: dnsutil.Fqdn(name), Class: dns.ClassINET, TTL: localTTL}
+
+	addr = addr.Unmap().WithZone("")
+	if addr.Is4() {
+		return &dns.A{Hdr: hdr, A: rdata.A{Addr: addr}}
+	}
+	return &dns.AAAA{Hdr: hdr, AAAA: rdata.AAAA{Addr: addr}}
+}
+
+// recordFromData returns the record of name of the given type, from its data
+// in zone file format, e.g. "10 mail.example.com" for a MX record. The data of
+// TXT records is the text itself, without quotes.
+func recordFromData(name, typ, data string) (dns.RR, error) {
+	name = dnsutil.Fqdn(name)
+
+	switch typ = strings.ToUpper(typ); typ {
+	case "TXT":
+		var txt []string
+		for s := data; ; s = s[maxTXTLength:] {
+			if len(s) <= maxTXTLength {
+				txt = append(txt, s)
+				break
+			}
+			txt = append(txt, s[:maxTXTLength])
+		}
+		return &dns.TXT{
+			Hdr: dns.Header{Name: name, Class: dns.ClassINET, TTL: localTTL},
+			TXT: rdata.TXT{Txt: txt},
+		}, nil
+
+	case "A", "AAAA", "CNAME", "MX", "SRV", "PTR":
+		if strings.ContainsAny(data, ";\n") {
+			return nil, fmt.Errorf("invalid %s data '%s'", typ, data)
+		}
+		rr, err := dns.New(fmt.Sprintf("%s %d IN %s %s", name, localTTL, typ, data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s data '%s': %w", typ, data, err)
+		}
+		return rr, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported record type '%s'", typ)
+	}
+}
+
+// parseHostsFile parses a hosts file, like /etc/hosts: each line holds an
+// address followed by its names, and # starts a comment.
+func parseHostsFile(r io.Reader, file string) ([]dns.RR, error) {
+	var rrs []dns.RR
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) == 1 {
+			return nil, fmt.Errorf("%s:%d: missing names for address %s", file, line, fields[0])
+		}
+
+		addr, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid address: %w", file, line, err)
+		}
+
+		for _, name := range fields[1:] {
+			if !dnsutil.IsName(dnsutil.Fqdn(name)) {
+				return nil, fmt.Errorf("%s:%d: invalid name '%s'", file, line, name)
+			}
+			rrs = append(rrs, addressRecord(name, addr))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", file, err)
+	}
+
+	return rrs, nil
+}
+
+// parseZoneFile parses a BIND zone file. Relative names are relative to the
+// root, unless the file sets an $ORIGIN.
+func parseZoneFile(r io.Reader, file string) ([]dns.RR, error) {
+	var rrs []dns.RR
+
+	zp := dns.NewZoneParser(r, ".", file)
+	zp.SetDefaultTTL(localTTL)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, fmt.Errorf("parsing zone file: %w", err)
+	}
+
+	return rrs, nil
+}
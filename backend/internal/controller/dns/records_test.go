@@ -0,0 +1,302 @@
+package dns
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"codeberg.org/miekg/dns"
+	"github.com/specialfish9/confuso/v2"
+)
+
+func mustRecords(t *testing.T, zone string) localRecords {
+	t.Helper()
+
+	rrs, err := parseZoneFile(strings.NewReader(zone), "test.zone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := newLocalRecords(rrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func answerStrings(rrs []dns.RR) []string {
+	var res []string
+	for _, rr := range rrs {
+		res = append(res, rr.String())
+	}
+	return res
+}
+
+func TestLocalRecords_Lookup(t *testing.T) {
+	l := mustRecords(t, `$ORIGIN lan.
+nas         A      192.168.1.10
+nas         A      192.168.1.11
+nas         AAAA   fd00::10
+www         CNAME  nas
+alias       CNAME  www
+ext         CNAME  example.com.
+loop1       CNAME  loop2
+loop2       CNAME  loop1
+*.dev       A      192.168.1.20
+api.dev     A      192.168.1.21
+@           MX     10 mail
+@           TXT    "v=spf1 -all"
+_http._tcp  SRV    0 5 80 nas
+`)
+
+	testCases := []struct {
+		name     string
+		qname    string
+		qtype    uint16
+		expected []string
+		target   string
+		ok       bool
+	}{
+		{
+			name:  "multiple addresses",
+			qname: "NAS.lan",
+			qtype: dns.TypeA,
+			expected: []string{
+				"NAS.lan.\t60\tIN\tA\t192.168.1.10",
+				"NAS.lan.\t60\tIN\tA\t192.168.1.11",
+			},
+			ok: true,
+		},
+		{
+			name:     "alias without records of the type",
+			qname:    "www.lan.",
+			qtype:    dns.TypeTXT,
+			expected: []string{"www.lan.\t60\tIN\tCNAME\tnas.lan."},
+			ok:       true,
+		},
+		{
+			name:     "existing name without records of the type",
+			qname:    "lan.",
+			qtype:    dns.TypeA,
+			expected: nil,
+			ok:       true,
+		},
+		{
+			name:  "local CNAME chain",
+			qname: "alias.lan.",
+			qtype: dns.TypeAAAA,
+			expected: []string{
+				"alias.lan.\t60\tIN\tCNAME\twww.lan.",
+				"www.lan.\t60\tIN\tCNAME\tnas.lan.",
+				"nas.lan.\t60\tIN\tAAAA\tfd00::10",
+			},
+			ok: true,
+		},
+		{
+			name:     "CNAME question",
+			qname:    "www.lan.",
+			qtype:    dns.TypeCNAME,
+			expected: []string{"www.lan.\t60\tIN\tCNAME\tnas.lan."},
+			ok:       true,
+		},
+		{
+			name:     "CNAME to an upstream name",
+			qname:    "ext.lan.",
+			qtype:    dns.TypeA,
+			expected: []string{"ext.lan.\t60\tIN\tCNAME\texample.com."},
+			target:   "example.com.",
+			ok:       true,
+		},
+		{
+			name:   "CNAME loop",
+			qname:  "loop1.lan.",
+			qtype:  dns.TypeA,
+			target: "",
+			ok:     true,
+		},
+		{
+			name:     "wildcard",
+			qname:    "foo.bar.dev.lan.",
+			qtype:    dns.TypeA,
+			expected: []string{"foo.bar.dev.lan.\t60\tIN\tA\t192.168.1.20"},
+			ok:       true,
+		},
+		{
+			name:     "exact name over wildcard",
+			qname:    "api.dev.lan.",
+			qtype:    dns.TypeA,
+			expected: []string{"api.dev.lan.\t60\tIN\tA\t192.168.1.21"},
+			ok:       true,
+		},
+		{
+			name:     "MX",
+			qname:    "lan.",
+			qtype:    dns.TypeMX,
+			expected: []string{"lan.\t60\tIN\tMX\t10 mail.lan."},
+			ok:       true,
+		},
+		{
+			name:     "SRV",
+			qname:    "_http._tcp.lan.",
+			qtype:    dns.TypeSRV,
+			expected: []string{"_http._tcp.lan.\t60\tIN\tSRV\t0 5 80 nas.lan."},
+			ok:       true,
+		},
+		{
+			name:     "generated PTR",
+			qname:    "10.1.168.192.in-addr.arpa.",
+			qtype:    dns.TypePTR,
+			expected: []string{"10.1.168.192.in-addr.arpa.\t60\tIN\tPTR\tnas.lan."},
+			ok:       true,
+		},
+		{
+			name:  "wildcards have no PTR",
+			qname: "20.1.168.192.in-addr.arpa.",
+			qtype: dns.TypePTR,
+			ok:    false,
+		},
+		{
+			name:  "unknown name",
+			qname: "dev.lan.",
+			qtype: dns.TypeA,
+			ok:    false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			answer, target, ok := l.lookup(tc.qname, tc.qtype)
+			if ok != tc.ok {
+				t.Fatalf("expected ok %v, got %v", tc.ok, ok)
+			}
+			if target != tc.target {
+				t.Errorf("expected target %q, got %q", tc.target, target)
+			}
+			if tc.name == "CNAME loop" {
+				if len(answer) != maxCNAMEChain {
+					t.Errorf("expected the loop to stop after %d aliases, got %d", maxCNAMEChain, len(answer))
+				}
+				return
+			}
+			if got := answerStrings(answer); !slices.Equal(got, tc.expected) {
+				t.Errorf("expected answer %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewLocalRecords_PTR(t *testing.T) {
+	l := mustRecords(t, `
+b.lan.                        A    192.168.1.10
+a.lan.                        A    192.168.1.10
+c.lan.                        A    192.168.1.30
+30.1.168.192.in-addr.arpa.    PTR  printer.lan.
+`)
+
+	answer, _, _ := l.lookup("10.1.168.192.in-addr.arpa.", dns.TypePTR)
+	expected := []string{
+		"10.1.168.192.in-addr.arpa.\t60\tIN\tPTR\ta.lan.",
+		"10.1.168.192.in-addr.arpa.\t60\tIN\tPTR\tb.lan.",
+	}
+	if got := answerStrings(answer); !slices.Equal(got, expected) {
+		t.Errorf("expected a PTR record for each name, got %q", got)
+	}
+
+	answer, _, _ = l.lookup("30.1.168.192.in-addr.arpa.", dns.TypePTR)
+	expected = []string{"30.1.168.192.in-addr.arpa.\t60\tIN\tPTR\tprinter.lan."}
+	if got := answerStrings(answer); !slices.Equal(got, expected) {
+		t.Errorf("expected the explicit PTR record to win, got %q", got)
+	}
+}
+
+func TestNewLocalRecords_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		"CNAME with other records": "www.lan. CNAME nas.lan.\nwww.lan. A 192.168.1.10\n",
+		"wildcard not first label": "foo.*.lan. A 192.168.1.10\n",
+	}
+
+	for name, zone := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rrs, err := parseZoneFile(strings.NewReader(zone), "test.zone")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := newLocalRecords(rrs); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseHostsFile(t *testing.T) {
+	rrs, err := parseHostsFile(strings.NewReader(`
+# The local network
+192.168.1.10   nas nas.lan   # the NAS
+fe80::1%lo0    router.lan
+
+::ffff:10.0.0.1 mapped.lan
+`), "hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"nas.\t60\tIN\tA\t192.168.1.10",
+		"nas.lan.\t60\tIN\tA\t192.168.1.10",
+		"router.lan.\t60\tIN\tAAAA\tfe80::1",
+		"mapped.lan.\t60\tIN\tA\t10.0.0.1",
+	}
+	if got := answerStrings(rrs); !slices.Equal(got, expected) {
+		t.Errorf("expected records %q, got %q", expected, got)
+	}
+
+	invalid := []string{
+		"192.168.1.300 nas\n",
+		"192.168.1.10\n",
+		"192.168.1.10 bad..name\n",
+	}
+	for _, hosts := range invalid {
+		if _, err := parseHostsFile(strings.NewReader(hosts), "hosts"); err == nil {
+			t.Errorf("expected an error for %q", hosts)
+		}
+	}
+}
+
+func TestLoadLocalRecords(t *testing.T) {
+	dir := t.TempDir()
+	hosts := filepath.Join(dir, "hosts")
+	zone := filepath.Join(dir, "lan.zone")
+	if err := os.WriteFile(hosts, []byte("192.168.1.10 nas.lan\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(zone, []byte("$ORIGIN lan.\n$TTL 300\nwww CNAME nas\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := loadLocalRecords(&Config{
+		CustomDomains: confuso.Optional[map[string]any]{Value: map[string]any{"nas.lan": "fd00::10"}, Ok: true},
+		HostsFiles:    confuso.Optional[any]{Value: hosts, Ok: true},
+		ZoneFiles:     confuso.Optional[any]{Value: []any{zone}, Ok: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	answer, _, _ := l.lookup("www.lan.", dns.TypeA)
+	expected := []string{
+		"www.lan.\t300\tIN\tCNAME\tnas.lan.",
+		"nas.lan.\t60\tIN\tA\t192.168.1.10",
+	}
+	if got := answerStrings(answer); !slices.Equal(got, expected) {
+		t.Errorf("expected answer %q, got %q", expected, got)
+	}
+	if !l.has("nas.lan.") || len(l["nas.lan."]) != 2 {
+		t.Errorf("expected the records of the custom domains and files to be merged, got %v", l["nas.lan."])
+	}
+
+	_, err = loadLocalRecords(&Config{ZoneFiles: confuso.Optional[any]{Value: filepath.Join(dir, "missing"), Ok: true}})
+	if err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -2,8 +2,10 @@ package dns
 
 import (
 	"context"
+	"gohole/internal/filter"
 	"log/slog"
 	"net"
+	"regexp"
 	"runtime/debug"
 	"slices"
 	"sync"
@@ -19,11 +21,30 @@ type ReqCtx struct {
 	Start   time.Time
 	End     time.Time
 	Name    string
+	Type    uint16
 	Host    string
 	Allowed bool
 	Cached  bool
 	Custom  bool
-	Error   error
+	// ClientID is the ID the client identified itself with, if any.
+	ClientID string
+	// ClientScoped is true if the filter verdict depends on the client, hence it
+	// must not be cached.
+	ClientScoped bool
+	// Match is the list entry the request was blocked or allowed by, if any.
+	Match *filter.Match
+	// Upstream is the address of the upstream that answered, if the request was forwarded.
+	Upstream string
+	// Protocol is the protocol the request was received over.
+	Protocol Protocol
+	// Rcode, AnswerCount and ResponseSize describe the response sent to the client.
+	Rcode        uint16
+	AnswerCount  int
+	ResponseSize int
+	Error        error
+
+	// route is the conditional forwarding route of the name, if any.
+	route *forwardRoute
 }
 
 func (r *ReqCtx) Free() {
@@ -33,11 +54,37 @@ func (r *ReqCtx) Free() {
 	r.Start = time.Time{}
 	r.End = time.Time{}
 	r.Name = ""
+	r.Type = 0
 	r.Host = ""
+	r.ClientID = ""
 	r.Allowed = false
 	r.Cached = false
 	r.Custom = false
+	r.ClientScoped = false
+	r.Match = nil
+	r.Upstream = ""
+	r.Protocol = ""
+	r.Rcode = 0
+	r.AnswerCount = 0
+	r.ResponseSize = 0
 	r.Error = nil
+	r.route = nil
+}
+
+type clientIDKey struct{}
+
+// clientIDPattern is the format of the IDs clients can identify themselves with.
+var clientIDPattern = regexp.MustCompile(`^[a-zA-Z0-9-]{1,63}$`)
+
+// IsValidClientID reports whether id can identify a client.
+func IsValidClientID(id string) bool {
+	return clientIDPattern.MatchString(id)
+}
+
+// WithClientID returns a copy of ctx carrying the ID the client identified
+// itself with, for the queries served outside of the DNS servers.
+func WithClientID(ctx context.Context, clientID string) context.Context {
+	return context.WithValue(ctx, clientIDKey{}, clientID)
 }
 
 var ctxPool = sync.Pool{
@@ -67,6 +114,7 @@ func applyMiddlewares(handler handlerFunc, middlewares ...middleware) dns.Handle
 		rc := ctxPool.Get().(*ReqCtx)
 		rc.Context = ctx
 		rc.Host = host
+		rc.ClientID, _ = ctx.Value(clientIDKey{}).(string)
 		rc.Trace = trace
 		rc.Logger = l
 
@@ -115,20 +163,48 @@ func logMiddleware(kv ...any) middleware {
 					mex = "SMASH"
 				}
 
-				rc.Logger.Info(
-					mex,
+				attrs := []any{
 					"name", rc.Name,
 					"trace", rc.Trace,
 					"timeMicro", rc.End.Sub(rc.Start).Microseconds(),
 					"host", rc.Host,
 					"cache", rc.Cached,
 					"customDomain", rc.Custom,
-				)
+				}
+				if rc.ClientID != "" {
+					attrs = append(attrs, "clientID", rc.ClientID)
+				}
+				if rc.route != nil {
+					attrs = append(attrs, "route", rc.route.name)
+				}
+				if rc.Upstream != "" {
+					attrs = append(attrs, "upstream", rc.Upstream)
+				}
+				if rc.Match != nil {
+					attrs = append(
+						attrs,
+						"list", rc.Match.List,
+						"rule", rc.Match.Rule,
+						"matchKind", rc.Match.Kind,
+					)
+				}
+
+				rc.Logger.Info(mex, attrs...)
 			}
 		}
 	}
 }
 
+// protocolMiddleware records the protocol the request was received over.
+func protocolMiddleware(proto Protocol) middleware {
+	return func(next handlerFunc) handlerFunc {
+		return func(rc *ReqCtx, w dns.ResponseWriter, r *dns.Msg) {
+			rc.Protocol = proto
+			next(rc, w, r)
+		}
+	}
+}
+
 func timeMiddleware(next handlerFunc) handlerFunc {
 	return func(rc *ReqCtx, w dns.ResponseWriter, r *dns.Msg) {
 		rc.Start = time.Now()
@@ -39,6 +39,21 @@ func TestApplyMiddlewares(t *testing.T) {
 		}
 	})
 
+	t.Run("populates the client ID from the context", func(t *testing.T) {
+		var captured ReqCtx
+		handler := func(rc *ReqCtx, w gdns.ResponseWriter, r *gdns.Msg) {
+			captured = *rc
+		}
+
+		ctx := WithClientID(context.Background(), "phone")
+		fn := applyMiddlewares(handler)
+		fn(ctx, &dnstest.ResponseWriter{}, gdns.NewMsg("example.com", gdns.TypeA))
+
+		if captured.ClientID != "phone" {
+			t.Errorf("expected ClientID %q, got %q", "phone", captured.ClientID)
+		}
+	})
+
 	t.Run("applies middlewares outermost-first (m1 wraps m2 wraps handler)", func(t *testing.T) {
 		var callOrder []string
 
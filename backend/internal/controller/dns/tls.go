@@ -0,0 +1,275 @@
+package dns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"codeberg.org/miekg/dns"
+)
+
+const (
+	// certCheckInterval is how often the certificate files are checked for changes.
+	certCheckInterval = 10 * time.Second
+	// selfSignedValidity is how long the generated certificates are valid.
+	selfSignedValidity = 10 * 365 * 24 * time.Hour
+)
+
+// NewTLSServer returns the DNS-over-TLS server (RFC 7858), listening on the
+// TLS address of cfg. The queries go through handler and its middlewares like
+// the ones of the other DNS servers, handler should then forward over TCP.
+func NewTLSServer(cfg *Config, handler *Handler) (*Server, error) {
+	if !cfg.TLSAddress.Ok {
+		return nil, errors.New("dns: missing tls_address")
+	}
+
+	certs, err := newCertStore(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("dns: %w", err)
+	}
+
+	serverName := strings.TrimSuffix(strings.ToLower(cfg.TLSServerName.Or("")), ".")
+	chain := handler.Chain(DoT)
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", func(ctx context.Context, w dns.ResponseWriter, m *dns.Msg) {
+		if conn, ok := w.Conn().(*tls.Conn); ok {
+			sni := conn.ConnectionState().ServerName
+			if clientID, ok := clientIDFromSNI(sni, serverName); ok {
+				ctx = WithClientID(ctx, clientID)
+			}
+		}
+		chain(ctx, w, m)
+	})
+
+	return &Server{
+		srv: dns.Server{
+			Addr: cfg.TLSAddress.Value,
+			Net:  TCP,
+			TLSConfig: &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				NextProtos:     dns.NextProtos,
+				GetCertificate: certs.GetCertificate,
+			},
+			Handler: mux,
+		},
+		protocol: DoT,
+		l:        slog.With("component", fmt.Sprintf("%ssrv", DoT)),
+		cfg:      cfg,
+	}, nil
+}
+
+// clientIDFromSNI returns the client ID of a connection to a subdomain of the
+// server, e.g. "phone" for phone.dns.example.com. The boolean is false if the
+// client did not use one.
+func clientIDFromSNI(sni, serverName string) (string, bool) {
+	if serverName == "" {
+		return "", false
+	}
+
+	sni = strings.TrimSuffix(strings.ToLower(sni), ".")
+	clientID, ok := strings.CutSuffix(sni, "."+serverName)
+	if !ok || !IsValidClientID(clientID) {
+		return "", false
+	}
+
+	return clientID, true
+}
+
+// certStore holds the certificate of the DNS-over-TLS server. When it is read
+// from files, it is reloaded as soon as they change, without restarting.
+type certStore struct {
+	certFile, keyFile string
+	checkInterval     time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// newCertStore loads the certificate configured in cfg, generating a
+// self-signed one if allowed and there is none. A generated certificate is
+// written to the configured files, if any, so that it is kept across restarts.
+func newCertStore(cfg *Config) (*certStore, error) {
+	s := &certStore{
+		certFile:      cfg.TLSCert.Or(""),
+		keyFile:       cfg.TLSKey.Or(""),
+		checkInterval: certCheckInterval,
+	}
+	if (s.certFile == "") != (s.keyFile == "") {
+		return nil, errors.New("tls_cert and tls_key must be set together")
+	}
+
+	selfSigned := cfg.TLSSelfSigned.Or(false)
+	if s.certFile == "" {
+		if !selfSigned {
+			return nil, errors.New("missing tls_cert and tls_key, and tls_self_signed is disabled")
+		}
+
+		cert, _, _, err := generateSelfSigned(cfg.TLSServerName.Or(""))
+		if err != nil {
+			return nil, err
+		}
+		s.cert = &cert
+
+		return s, nil
+	}
+
+	if selfSigned && !fileExists(s.certFile) && !fileExists(s.keyFile) {
+		_, certPEM, keyPEM, err := generateSelfSigned(cfg.TLSServerName.Or(""))
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(s.certFile, certPEM, 0o644); err != nil {
+			return nil, fmt.Errorf("writing self-signed certificate: %w", err)
+		}
+		if err := os.WriteFile(s.keyFile, keyPEM, 0o600); err != nil {
+			return nil, fmt.Errorf("writing self-signed key: %w", err)
+		}
+		slog.Info("Generated a self-signed certificate", "cert", s.certFile, "key", s.keyFile)
+	}
+
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate. It checks the files
+// for changes at most every checkInterval, and keeps serving the previous
+// certificate if the new one is invalid, e.g. while it is being written.
+func (s *certStore) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.certFile != "" && time.Since(s.checkedAt) >= s.checkInterval {
+		if err := s.reloadLocked(); err != nil {
+			slog.Warn("Reloading the TLS certificate", "cert", s.certFile, "err", err)
+		}
+	}
+
+	return s.cert, nil
+}
+
+func (s *certStore) reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reloadLocked()
+}
+
+func (s *certStore) reloadLocked() error {
+	s.checkedAt = time.Now()
+
+	modTime, err := s.latestModTime()
+	if err != nil {
+		return err
+	}
+	if s.cert != nil && modTime.Equal(s.modTime) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+
+	if s.cert != nil {
+		slog.Info("Reloaded the TLS certificate", "cert", s.certFile)
+	}
+	s.cert = &cert
+	s.modTime = modTime
+
+	return nil
+}
+
+// latestModTime returns the modification time of the most recently changed
+// of the certificate and key files.
+func (s *certStore) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{s.certFile, s.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// generateSelfSigned returns a self-signed certificate for serverName and its
+// subdomains, along with the PEM encoding of the certificate and its key.
+func generateSelfSigned(serverName string) (tls.Certificate, []byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, nil, fmt.Errorf("generating key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, nil, nil, fmt.Errorf("generating serial number: %w", err)
+	}
+
+	commonName := "gohole"
+	var names []string
+	if serverName = strings.TrimSuffix(serverName, "."); serverName != "" {
+		commonName = serverName
+		names = []string{serverName, "*." + serverName}
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		DNSNames:              names,
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, nil, fmt.Errorf("generating certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, nil, nil, fmt.Errorf("encoding key: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, nil, nil, fmt.Errorf("loading generated certificate: %w", err)
+	}
+
+	return cert, certPEM, keyPEM, nil
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return !errors.Is(err, fs.ErrNotExist)
+}
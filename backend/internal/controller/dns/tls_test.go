@@ -0,0 +1,176 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/specialfish9/confuso/v2"
+)
+
+func TestClientIDFromSNI(t *testing.T) {
+	tests := []struct {
+		sni, serverName string
+		want            string
+		wantOk          bool
+	}{
+		{"phone.dns.example.com", "dns.example.com", "phone", true},
+		{"Phone.DNS.example.com.", "dns.example.com", "phone", true},
+		{"dns.example.com", "dns.example.com", "", false},
+		{"a.b.dns.example.com", "dns.example.com", "", false},
+		{"phone.other.com", "dns.example.com", "", false},
+		{"phone.dns.example.com", "", "", false},
+		{"", "dns.example.com", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := clientIDFromSNI(tt.sni, tt.serverName)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("clientIDFromSNI(%q, %q) = %q, %v, want %q, %v",
+				tt.sni, tt.serverName, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestNewCertStore_Invalid(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := map[string]*Config{
+		"no certificate": {},
+		"cert without key": {
+			TLSCert:       confuso.Optional[string]{Value: filepath.Join(dir, "tls.crt"), Ok: true},
+			TLSSelfSigned: confuso.Optional[bool]{Value: true, Ok: true},
+		},
+		"missing files": {
+			TLSCert: confuso.Optional[string]{Value: filepath.Join(dir, "tls.crt"), Ok: true},
+			TLSKey:  confuso.Optional[string]{Value: filepath.Join(dir, "tls.key"), Ok: true},
+		},
+	}
+
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newCertStore(cfg); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestNewCertStore_SelfSigned(t *testing.T) {
+	t.Run("in memory", func(t *testing.T) {
+		s, err := newCertStore(&Config{TLSSelfSigned: confuso.Optional[bool]{Value: true, Ok: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cert, err := s.GetCertificate(nil)
+		if err != nil || cert == nil {
+			t.Fatalf("GetCertificate() = %v, %v", cert, err)
+		}
+	})
+
+	t.Run("written to the files", func(t *testing.T) {
+		dir := t.TempDir()
+		cfg := &Config{
+			TLSCert:       confuso.Optional[string]{Value: filepath.Join(dir, "tls.crt"), Ok: true},
+			TLSKey:        confuso.Optional[string]{Value: filepath.Join(dir, "tls.key"), Ok: true},
+			TLSSelfSigned: confuso.Optional[bool]{Value: true, Ok: true},
+			TLSServerName: confuso.Optional[string]{Value: "dns.example.com", Ok: true},
+		}
+
+		s, err := newCertStore(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cert, _ := s.GetCertificate(nil)
+		leaf := parseLeaf(t, cert)
+		if !slices.Equal(leaf.DNSNames, []string{"dns.example.com", "*.dns.example.com"}) {
+			t.Errorf("DNSNames = %v", leaf.DNSNames)
+		}
+
+		// The certificate is kept across restarts
+		s2, err := newCertStore(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert2, _ := s2.GetCertificate(nil)
+		if !bytes.Equal(cert.Certificate[0], cert2.Certificate[0]) {
+			t.Error("expected the certificate written on the first start")
+		}
+	})
+}
+
+func TestCertStore_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	writeCert := func(serverName string, modTime time.Time) {
+		t.Helper()
+		_, certPEM, keyPEM, err := generateSelfSigned(serverName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, data := range map[string][]byte{certFile: certPEM, keyFile: keyPEM} {
+			if err := os.WriteFile(name, data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(name, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	now := time.Now()
+	writeCert("old.example.com", now.Add(-time.Minute))
+
+	s, err := newCertStore(&Config{
+		TLSCert: confuso.Optional[string]{Value: certFile, Ok: true},
+		TLSKey:  confuso.Optional[string]{Value: keyFile, Ok: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.checkInterval = 0
+
+	commonName := func() string {
+		cert, err := s.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parseLeaf(t, cert).Subject.CommonName
+	}
+
+	if got := commonName(); got != "old.example.com" {
+		t.Fatalf("CommonName = %s, want old.example.com", got)
+	}
+
+	writeCert("new.example.com", now)
+	if got := commonName(); got != "new.example.com" {
+		t.Fatalf("CommonName = %s, want new.example.com after the files changed", got)
+	}
+
+	// An invalid certificate keeps the previous one
+	if err := os.WriteFile(certFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(certFile, now.Add(time.Minute), now.Add(time.Minute))
+	if got := commonName(); got != "new.example.com" {
+		t.Fatalf("CommonName = %s, want new.example.com with an invalid file", got)
+	}
+}
+
+func parseLeaf(t *testing.T, cert *tls.Certificate) *x509.Certificate {
+	t.Helper()
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf
+}
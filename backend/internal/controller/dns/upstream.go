@@ -0,0 +1,274 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"codeberg.org/miekg/dns"
+)
+
+const (
+	// upstreamMaxFailures is the number of consecutive failures after which an
+	// upstream is considered down.
+	upstreamMaxFailures = 3
+	// upstreamDowntime is how long an upstream is considered down at first. It
+	// doubles each time the upstream fails again once back, up to upstreamMaxDowntime.
+	upstreamDowntime    = 30 * time.Second
+	upstreamMaxDowntime = 5 * time.Minute
+	// upstreamEWMAWeight is the weight of the latest response time in the
+	// average latency of an upstream.
+	upstreamEWMAWeight = 0.2
+)
+
+// upstream is an upstream server, along with its health.
+type upstream struct {
+	// network is the transport of the upstream, empty for plain DNS over the
+	// protocol of the query.
+	network Protocol
+	address string
+
+	mu sync.Mutex
+	// latency is the average response time, zero until the first response.
+	latency  time.Duration
+	failures int
+	// downtime is how long the upstream is considered down when it fails.
+	downtime  time.Duration
+	downUntil time.Time
+}
+
+func (u *upstream) success(rtt time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.latency == 0 {
+		u.latency = rtt
+	} else {
+		u.latency += time.Duration(upstreamEWMAWeight * float64(rtt-u.latency))
+	}
+
+	u.failures = 0
+	u.downtime = 0
+	u.downUntil = time.Time{}
+}
+
+func (u *upstream) failure() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.failures++
+	if u.failures < upstreamMaxFailures {
+		return
+	}
+
+	if u.downtime == 0 {
+		u.downtime = upstreamDowntime
+	} else {
+		u.downtime = min(2*u.downtime, upstreamMaxDowntime)
+	}
+	u.downUntil = time.Now().Add(u.downtime)
+}
+
+// state returns the average latency of the upstream and whether it is up.
+func (u *upstream) state(now time.Time) (time.Duration, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.latency, !now.Before(u.downUntil)
+}
+
+// Upstreams forwards queries to a set of upstream servers, chosen according to
+// a strategy. Upstreams failing repeatedly are considered down for a while, and
+// are only tried once the others failed.
+type Upstreams struct {
+	upstreams []*upstream
+	strategy  UpstreamStrategy
+	client    Client
+	// next is the index of the next upstream, for the round-robin strategy.
+	next atomic.Uint64
+}
+
+func NewUpstreams(addresses []string, strategy UpstreamStrategy, client Client) (*Upstreams, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("no upstream configured")
+	}
+
+	switch strategy {
+	case UpstreamStrategyFailover,
+		UpstreamStrategyRoundRobin,
+		UpstreamStrategyFastest,
+		UpstreamStrategyRace:
+	default:
+		return nil, fmt.Errorf("unknown upstream strategy '%s'", strategy)
+	}
+
+	u := &Upstreams{
+		strategy: strategy,
+		client:   client,
+	}
+
+	for _, addr := range addresses {
+		network, addr, err := parseUpstream(addr)
+		if err != nil {
+			return nil, err
+		}
+		u.upstreams = append(u.upstreams, &upstream{network: network, address: addr})
+	}
+
+	return u, nil
+}
+
+// Addresses returns the addresses of the upstreams.
+func (u *Upstreams) Addresses() []string {
+	addrs := make([]string, len(u.upstreams))
+	for i, up := range u.upstreams {
+		addrs[i] = up.address
+	}
+
+	return addrs
+}
+
+// Exchange forwards m to the upstreams and returns the first response, along
+// with the address of the upstream that sent it.
+func (u *Upstreams) Exchange(
+	ctx context.Context,
+	m *dns.Msg,
+	protocol Protocol,
+) (*dns.Msg, string, error) {
+	candidates := u.candidates()
+	if u.strategy == UpstreamStrategyRace {
+		return u.race(ctx, m, protocol, candidates)
+	}
+
+	var errs []error
+	for _, up := range candidates {
+		resp, err := u.exchange(ctx, up, m, protocol)
+		if err == nil {
+			return resp, up.address, nil
+		}
+
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, "", errors.Join(errs...)
+}
+
+// candidates returns the upstreams in the order they should be tried: the ones
+// that are up first, ordered according to the strategy, then the ones that are down.
+func (u *Upstreams) candidates() []*upstream {
+	now := time.Now()
+	n := len(u.upstreams)
+
+	ordered := make([]*upstream, n)
+	switch u.strategy {
+	case UpstreamStrategyRoundRobin:
+		start := int((u.next.Add(1) - 1) % uint64(n))
+		for i := range n {
+			ordered[i] = u.upstreams[(start+i)%n]
+		}
+	case UpstreamStrategyFastest:
+		copy(ordered, u.upstreams)
+		// Upstreams without a latency yet come first, so that they get measured
+		slices.SortStableFunc(ordered, func(a, b *upstream) int {
+			la, _ := a.state(now)
+			lb, _ := b.state(now)
+			return int(la - lb)
+		})
+	default:
+		copy(ordered, u.upstreams)
+	}
+
+	up := make([]*upstream, 0, n)
+	var down []*upstream
+	for _, c := range ordered {
+		if _, ok := c.state(now); ok {
+			up = append(up, c)
+		} else {
+			down = append(down, c)
+		}
+	}
+
+	return append(up, down...)
+}
+
+// race sends m to the upstreams that are up at once, or to all of them if they
+// are all down, and returns the first successful response.
+func (u *Upstreams) race(
+	ctx context.Context,
+	m *dns.Msg,
+	protocol Protocol,
+	candidates []*upstream,
+) (*dns.Msg, string, error) {
+	now := time.Now()
+	racers := slices.DeleteFunc(slices.Clone(candidates), func(up *upstream) bool {
+		_, ok := up.state(now)
+		return !ok
+	})
+	if len(racers) == 0 {
+		racers = candidates
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		resp    *dns.Msg
+		address string
+		err     error
+	}
+
+	results := make(chan result, len(racers))
+	for _, up := range racers {
+		go func() {
+			resp, err := u.exchange(ctx, up, m, protocol)
+			results <- result{resp: resp, address: up.address, err: err}
+		}()
+	}
+
+	var errs []error
+	for range racers {
+		res := <-results
+		if res.err == nil {
+			// The losers are canceled, and do not count as failures
+			return res.resp, res.address, nil
+		}
+		errs = append(errs, res.err)
+	}
+
+	return nil, "", errors.Join(errs...)
+}
+
+// exchange sends m to an upstream and updates its health.
+func (u *Upstreams) exchange(
+	ctx context.Context,
+	up *upstream,
+	m *dns.Msg,
+	protocol Protocol,
+) (*dns.Msg, error) {
+	network := protocol
+	if up.network != "" {
+		network = up.network
+	}
+
+	start := time.Now()
+
+	resp, _, err := u.client.Exchange(ctx, m.Copy(), network, up.address)
+	if err != nil {
+		// Queries canceled on our side say nothing about the upstream
+		if ctx.Err() == nil {
+			up.failure()
+		}
+		return nil, fmt.Errorf("upstream %s: %w", up.address, err)
+	}
+
+	up.success(time.Since(start))
+
+	return resp, nil
+}
@@ -0,0 +1,221 @@
+package dns_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	gdns "codeberg.org/miekg/dns"
+	"go.uber.org/mock/gomock"
+
+	"gohole/internal/controller/dns"
+	mockdns "gohole/internal/mock/dns"
+)
+
+var errUpstream = errors.New("upstream unreachable")
+
+func newUpstreams(
+	t *testing.T,
+	strategy dns.UpstreamStrategy,
+	addresses ...string,
+) (*dns.Upstreams, *mockdns.MockClient) {
+	client := mockdns.NewMockClient(gomock.NewController(t))
+
+	u, err := dns.NewUpstreams(addresses, strategy, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u, client
+}
+
+// ---- Config ----
+
+func TestConfig_Upstreams(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream any
+		want     []string
+		err      bool
+	}{
+		{name: "single", upstream: "1.1.1.1", want: []string{"1.1.1.1"}},
+		{name: "list", upstream: []any{"1.1.1.1", "9.9.9.9:53"}, want: []string{"1.1.1.1", "9.9.9.9:53"}},
+		{name: "empty list", upstream: []any{}, err: true},
+		{name: "not a string", upstream: []any{"1.1.1.1", 53}, err: true},
+		{name: "missing", upstream: nil, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := dns.Config{Upstream: test.upstream}
+
+			got, err := cfg.Upstreams()
+			if (err != nil) != test.err {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+// ---- Upstreams ----
+
+func TestNewUpstreams_Invalid(t *testing.T) {
+	if _, err := dns.NewUpstreams([]string{"1.1.1.1"}, "random", nil); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+	if _, err := dns.NewUpstreams(nil, dns.UpstreamStrategyFailover, nil); err == nil {
+		t.Error("expected an error without upstreams")
+	}
+	if _, err := dns.NewUpstreams([]string{"ciao!"}, dns.UpstreamStrategyFailover, nil); err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+}
+
+func TestUpstreams_Failover(t *testing.T) {
+	u, client := newUpstreams(t, dns.UpstreamStrategyFailover, "10.0.0.1", "10.0.0.2")
+	resp := new(gdns.Msg)
+
+	gomock.InOrder(
+		client.EXPECT().
+			Exchange(gomock.Any(), gomock.Any(), dns.UDP, "10.0.0.1:53").
+			Return(nil, time.Duration(0), errUpstream),
+		client.EXPECT().
+			Exchange(gomock.Any(), gomock.Any(), dns.UDP, "10.0.0.2:53").
+			Return(resp, time.Duration(0), nil),
+	)
+
+	got, addr, err := u.Exchange(context.Background(), new(gdns.Msg), dns.UDP)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != resp || addr != "10.0.0.2:53" {
+		t.Errorf("expected the answer of the second upstream, got %s", addr)
+	}
+}
+
+func TestUpstreams_AllFailing(t *testing.T) {
+	u, client := newUpstreams(t, dns.UpstreamStrategyFailover, "10.0.0.1", "10.0.0.2")
+
+	client.EXPECT().
+		Exchange(gomock.Any(), gomock.Any(), dns.UDP, gomock.Any()).
+		Return(nil, time.Duration(0), errUpstream).
+		Times(2)
+
+	_, addr, err := u.Exchange(context.Background(), new(gdns.Msg), dns.UDP)
+	if !errors.Is(err, errUpstream) {
+		t.Errorf("expected the upstream error, got %v", err)
+	}
+	if addr != "" {
+		t.Errorf("expected no upstream, got %s", addr)
+	}
+}
+
+func TestUpstreams_DownUpstreamIsTriedLast(t *testing.T) {
+	u, client := newUpstreams(t, dns.UpstreamStrategyFailover, "10.0.0.1", "10.0.0.2")
+	resp := new(gdns.Msg)
+
+	// The first upstream fails enough times to be considered down
+	client.EXPECT().
+		Exchange(gomock.Any(), gomock.Any(), dns.UDP, "10.0.0.1:53").
+		Return(nil, time.Duration(0), errUpstream).
+		Times(3)
+	client.EXPECT().
+		Exchange(gomock.Any(), gomock.Any(), dns.UDP, "10.0.0.2:53").
+		Return(resp, time.Duration(0), nil).
+		Times(4)
+
+	for range 4 {
+		_, addr, err := u.Exchange(context.Background(), new(gdns.Msg), dns.UDP)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if addr != "10.0.0.2:53" {
+			t.Errorf("expected the second upstream to answer, got %s", addr)
+		}
+	}
+}
+
+func TestUpstreams_RoundRobin(t *testing.T) {
+	u, client := newUpstreams(t, dns.UpstreamStrategyRoundRobin, "10.0.0.1", "10.0.0.2", "10.0.0.3")
+
+	client.EXPECT().
+		Exchange(gomock.Any(), gomock.Any(), dns.UDP, gomock.Any()).
+		Return(new(gdns.Msg), time.Duration(0), nil).
+		Times(6)
+
+	var got []string
+	for range 6 {
+		_, addr, err := u.Exchange(context.Background(), new(gdns.Msg), dns.UDP)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, addr)
+	}
+
+	want := []string{
+		"10.0.0.1:53", "10.0.0.2:53", "10.0.0.3:53",
+		"10.0.0.1:53", "10.0.0.2:53", "10.0.0.3:53",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestUpstreams_Fastest(t *testing.T) {
+	u, client := newUpstreams(t, dns.UpstreamStrategyFastest, "10.0.0.1", "10.0.0.2")
+
+	slow := func(context.Context, *gdns.Msg, dns.Protocol, string) (*gdns.Msg, time.Duration, error) {
+		time.Sleep(20 * time.Millisecond)
+		return new(gdns.Msg), 0, nil
+	}
+	fast := func(context.Context, *gdns.Msg, dns.Protocol, string) (*gdns.Msg, time.Duration, error) {
+		return new(gdns.Msg), 0, nil
+	}
+	client.EXPECT().Exchange(gomock.Any(), gomock.Any(), dns.UDP, "10.0.0.1:53").DoAndReturn(slow)
+	client.EXPECT().Exchange(gomock.Any(), gomock.Any(), dns.UDP, "10.0.0.2:53").DoAndReturn(fast).Times(3)
+
+	// The first two queries measure the upstreams, the next ones go to the fastest
+	var got []string
+	for range 4 {
+		_, addr, err := u.Exchange(context.Background(), new(gdns.Msg), dns.UDP)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, addr)
+	}
+
+	want := []string{"10.0.0.1:53", "10.0.0.2:53", "10.0.0.2:53", "10.0.0.2:53"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestUpstreams_Race(t *testing.T) {
+	u, client := newUpstreams(t, dns.UpstreamStrategyRace, "10.0.0.1", "10.0.0.2")
+
+	client.EXPECT().
+		Exchange(gomock.Any(), gomock.Any(), dns.UDP, "10.0.0.1:53").
+		DoAndReturn(func(ctx context.Context, _ *gdns.Msg, _ dns.Protocol, _ string) (*gdns.Msg, time.Duration, error) {
+			// The slow upstream gives up as soon as the race is won
+			<-ctx.Done()
+			return nil, 0, ctx.Err()
+		}).
+		// The race may be won before the query is even sent
+		MaxTimes(1)
+	client.EXPECT().
+		Exchange(gomock.Any(), gomock.Any(), dns.UDP, "10.0.0.2:53").
+		Return(new(gdns.Msg), time.Duration(0), nil)
+
+	_, addr, err := u.Exchange(context.Background(), new(gdns.Msg), dns.UDP)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if addr != "10.0.0.2:53" {
+		t.Errorf("expected the fastest upstream to win, got %s", addr)
+	}
+}
@@ -46,6 +46,15 @@ func responseFromAnswer(a []dns.RR, req *dns.Msg) *dns.Msg {
 	return resp
 }
 
+// responseFromEntry answers req with the response of a cache entry.
+func responseFromEntry(e *CacheEntry, req *dns.Msg) *dns.Msg {
+	resp := responseFromAnswer(e.Answer, req)
+	resp.Rcode = e.Rcode
+	resp.Ns = append(resp.Ns, e.Ns...)
+	resp.Extra = append(resp.Extra, e.Extra...)
+	return resp
+}
+
 // blockedResponse creates a DNS response for a blocked query based on the specified blocking strategy.
 func blockedResponse(req *dns.Msg, strategy BlockingStrategy) *dns.Msg {
 	if strategy == BlockingStrategyIP {
@@ -101,6 +110,15 @@ func blockedResponse(req *dns.Msg, strategy BlockingStrategy) *dns.Msg {
 	return blockedResponse(req, BlockingStrategyNXDOMAIN)
 }
 
+// serverFailureResponse answers req with a SERVFAIL, for the queries which
+// could not be resolved, e.g. because the upstreams failed.
+func serverFailureResponse(req *dns.Msg) *dns.Msg {
+	resp := new(dns.Msg)
+	dnsutil.SetReply(resp, req)
+	resp.Rcode = dns.RcodeServerFailure
+	return resp
+}
+
 func answerFromQuestion(question dns.RR, addr netip.Addr) (dns.RR, error) {
 	switch dns.RRToType(question) {
 	case dns.TypeA:
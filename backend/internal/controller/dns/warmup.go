@@ -0,0 +1,75 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"gohole/internal/query"
+	"sync"
+
+	"codeberg.org/miekg/dns"
+)
+
+// warmUpConcurrency is the number of queries sent at once while warming up.
+const warmUpConcurrency = 4
+
+// WarmUp caches the A and AAAA answers of the limit most queried domains of
+// the last week, unless they are cached already, and returns how many answers
+// were cached. The domains are filtered first, as cached answers are served
+// before filtering.
+func (h *Handler) WarmUp(ctx context.Context, limit int) (int, error) {
+	names, err := h.queryService.GetTopAllowedDomains(ctx, query.Interval7D, limit)
+	if err != nil {
+		return 0, fmt.Errorf("dns handler: warming up the cache: %w", err)
+	}
+
+	var keys []CacheKey
+	for _, name := range names {
+		name = normalizeName(name)
+		if h.records.has(name) {
+			continue
+		}
+
+		route := h.routes.lookup(name)
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			key := CacheKey{Name: name, Type: qtype, Class: dns.ClassINET}
+			if route != nil {
+				key.Route = route.name
+			}
+			verdict, err := h.refreshVerdict(key)
+			if err != nil || !verdict.Allowed || verdict.ClientScoped {
+				continue
+			}
+			if _, ok := h.cache.Get(key); !ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		cached int
+	)
+	sem := make(chan struct{}, warmUpConcurrency)
+	for _, key := range keys {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return cached, ctx.Err()
+		}
+
+		wg.Go(func() {
+			defer func() { <-sem }()
+
+			if h.refresh(ctx, h.routes.lookup(key.Name), key) {
+				mu.Lock()
+				cached++
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	return cached, nil
+}
@@ -0,0 +1,25 @@
+package http
+
+import (
+	"gohole/internal/controller/dns"
+	"net/http"
+)
+
+// CacheStatser reports the statistics of the DNS cache.
+type CacheStatser interface {
+	Stats() dns.CacheStats
+}
+
+type CacheRouter struct {
+	cache CacheStatser
+}
+
+func NewCacheRouter(cache CacheStatser) *CacheRouter {
+	return &CacheRouter{
+		cache: cache,
+	}
+}
+
+func (cr *CacheRouter) getStats(w http.ResponseWriter, _ *http.Request) error {
+	return writeJSON(w, http.StatusOK, cr.cache.Stats())
+}
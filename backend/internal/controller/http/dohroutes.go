@@ -0,0 +1,170 @@
+package http
+
+import (
+	"encoding/base64"
+	"errors"
+	"gohole/internal/controller/dns"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	dns2 "codeberg.org/miekg/dns"
+	"codeberg.org/miekg/dns/dnshttp"
+	"github.com/go-chi/chi/v5"
+)
+
+// DoHRouter serves DNS over HTTPS (RFC 8484). The queries go through the same
+// handler as the ones received by the DNS servers.
+type DoHRouter struct {
+	handler dns2.Handler
+}
+
+func NewDoHRouter(handler dns2.Handler) *DoHRouter {
+	return &DoHRouter{
+		handler: handler,
+	}
+}
+
+func (dr *DoHRouter) query(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	clientID := chi.URLParam(r, "clientID")
+	if clientID != "" {
+		if !dns.IsValidClientID(clientID) {
+			return newHTTPErr(http.StatusBadRequest, "invalid client ID '%s'", clientID)
+		}
+		ctx = dns.WithClientID(ctx, clientID)
+	}
+
+	m, err := parseDoHRequest(r)
+	if err != nil {
+		return err
+	}
+
+	rw := &dohResponseWriter{w: w, r: r}
+	dr.handler.ServeDNS(ctx, rw, m)
+	if !rw.written {
+		return errors.New("no DNS response written")
+	}
+
+	return nil
+}
+
+// parseDoHRequest reads the DNS query of a GET or POST request.
+func parseDoHRequest(r *http.Request) (*dns2.Msg, error) {
+	var buf []byte
+	switch r.Method {
+	case http.MethodGet:
+		param := r.URL.Query().Get("dns")
+		if param == "" {
+			return nil, newHTTPErr(http.StatusBadRequest, "missing dns parameter")
+		}
+
+		var err error
+		buf, err = base64.RawURLEncoding.DecodeString(param)
+		if err != nil {
+			return nil, newHTTPErr(http.StatusBadRequest, "invalid dns parameter: %s", err)
+		}
+	case http.MethodPost:
+		if ct := r.Header.Get("Content-Type"); ct != dnshttp.MimeType {
+			return nil, newHTTPErr(
+				http.StatusUnsupportedMediaType,
+				"unsupported content type '%s'",
+				ct,
+			)
+		}
+
+		var err error
+		buf, err = io.ReadAll(http.MaxBytesReader(nil, r.Body, dns2.MaxMsgSize))
+		if err != nil {
+			return nil, newHTTPErr(http.StatusRequestEntityTooLarge, "reading query: %s", err)
+		}
+	default:
+		return nil, newHTTPErr(http.StatusMethodNotAllowed, "unsupported method %s", r.Method)
+	}
+
+	if len(buf) > dns2.MaxMsgSize {
+		return nil, newHTTPErr(http.StatusRequestEntityTooLarge, "query too large")
+	}
+
+	m := &dns2.Msg{Data: buf}
+	if err := m.Unpack(); err != nil {
+		return nil, newHTTPErr(http.StatusBadRequest, "invalid DNS message: %s", err)
+	}
+	if m.Response || len(m.Question) != 1 {
+		return nil, newHTTPErr(http.StatusBadRequest, "expected a query with one question")
+	}
+
+	return m, nil
+}
+
+// dohResponseWriter writes the DNS response in the body of the HTTP response.
+type dohResponseWriter struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	written bool
+}
+
+var _ dns2.ResponseWriter = (*dohResponseWriter)(nil)
+
+func (rw *dohResponseWriter) Write(p []byte) (int, error) {
+	// Responses are written like on a TCP connection, behind their length
+	if len(p) < 2 {
+		return 0, io.ErrShortWrite
+	}
+	p = p[2:]
+
+	h := rw.w.Header()
+	h.Set("Content-Type", dnshttp.MimeType)
+	h.Set("Content-Length", strconv.Itoa(len(p)))
+	if ttl, ok := minTTL(p); ok {
+		h.Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(ttl), 10))
+	}
+	rw.w.WriteHeader(http.StatusOK)
+	rw.written = true
+
+	n, err := rw.w.Write(p)
+	return n + 2, err
+}
+
+// minTTL returns the lowest TTL of the records of a packed response, which is
+// how long it can be cached. The boolean is false if there are none.
+func minTTL(p []byte) (uint32, bool) {
+	m := &dns2.Msg{Data: p}
+	if err := m.Unpack(); err != nil {
+		return 0, false
+	}
+
+	var ttl uint32
+	found := false
+	for _, section := range [][]dns2.RR{m.Answer, m.Ns} {
+		for _, rr := range section {
+			if !found || rr.Header().TTL < ttl {
+				ttl = rr.Header().TTL
+				found = true
+			}
+		}
+	}
+
+	return ttl, found
+}
+
+func (rw *dohResponseWriter) LocalAddr() net.Addr {
+	addr, _ := rw.r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return addr
+}
+
+func (rw *dohResponseWriter) RemoteAddr() net.Addr {
+	addrPort, err := netip.ParseAddrPort(rw.r.RemoteAddr)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+	return net.TCPAddrFromAddrPort(addrPort)
+}
+
+func (rw *dohResponseWriter) Conn() net.Conn         { return nil }
+func (rw *dohResponseWriter) Session() *dns2.Session { return nil }
+func (rw *dohResponseWriter) Hijack()                {}
+func (rw *dohResponseWriter) Close() error           { return nil }
@@ -0,0 +1,57 @@
+package http
+
+import (
+	"gohole/internal/controller/dns"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	dns2 "codeberg.org/miekg/dns"
+	"github.com/go-chi/chi/v5"
+)
+
+// Explainer tells how a DNS query would be handled.
+type Explainer interface {
+	Explain(name string, qtype uint16, client string) (*dns.Explanation, error)
+}
+
+type ExplainRouter struct {
+	explainer Explainer
+}
+
+func NewExplainRouter(explainer Explainer) *ExplainRouter {
+	return &ExplainRouter{
+		explainer: explainer,
+	}
+}
+
+func (er *ExplainRouter) explain(w http.ResponseWriter, r *http.Request) error {
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		return newHTTPErr(http.StatusBadRequest, "missing name")
+	}
+
+	typeParam := r.URL.Query().Get("type")
+	if typeParam == "" {
+		typeParam = "A"
+	}
+
+	qtype, ok := dns2.StringToType[strings.ToUpper(typeParam)]
+	if !ok {
+		return newHTTPErr(http.StatusBadRequest, "invalid type parameter value '%s'", typeParam)
+	}
+
+	client := r.URL.Query().Get("client")
+	if client != "" {
+		if _, err := netip.ParseAddr(client); err != nil {
+			return newHTTPErr(http.StatusBadRequest, "invalid client parameter value '%s'", client)
+		}
+	}
+
+	ex, err := er.explainer.Explain(name, qtype, client)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, http.StatusOK, ex)
+}
@@ -16,7 +16,14 @@ type Server struct {
 	frontend bool
 }
 
-func NewServer(cfg *Config, qr *QueryRouter) *Server {
+func NewServer(
+	cfg *Config,
+	qr *QueryRouter,
+	sr *SourceRouter,
+	er *ExplainRouter,
+	cr *CacheRouter,
+	dr *DoHRouter,
+) *Server {
 	r := chi.NewRouter()
 
 	// Middlewares
@@ -37,12 +44,27 @@ func NewServer(cfg *Config, qr *QueryRouter) *Server {
 	r.Get("/api/queries", errorHandler(qr.getAll))
 	r.Get("/api/queries/stats", errorHandler(qr.getStats))
 	r.Get("/api/queries/stats/history", errorHandler(qr.getStatsHistory))
+	r.Get("/api/queries/stats/breakdown", errorHandler(qr.getBreakdownStats))
+	r.Get("/api/queries/storage", errorHandler(qr.getStorageStats))
 	r.Get("/api/hosts/stats", errorHandler(qr.getHostStats))
 	r.Get("/api/domains/stats", errorHandler(qr.getDomainStats))
 
 	r.Get("/api/domains/{name}", errorHandler(qr.getDomainDetails))
+	r.Get("/api/explain/{name}", errorHandler(er.explain))
+	r.Get("/api/cache/stats", errorHandler(cr.getStats))
 
 	r.Get("/api/blocklist/stats", errorHandler(qr.getBlockListStats))
+	r.Get("/api/blocklist/sources", errorHandler(sr.getAll))
+	r.Post("/api/blocklist/sources", errorHandler(sr.add))
+	r.Delete("/api/blocklist/sources/{id}", errorHandler(sr.remove))
+	r.Post("/api/blocklist/sources/{id}/enable", errorHandler(sr.enable))
+	r.Post("/api/blocklist/sources/{id}/disable", errorHandler(sr.disable))
+
+	// DNS over HTTPS, optionally with the ID of the client in the path
+	r.Get("/dns-query", errorHandler(dr.query))
+	r.Post("/dns-query", errorHandler(dr.query))
+	r.Get("/dns-query/{clientID}", errorHandler(dr.query))
+	r.Post("/dns-query/{clientID}", errorHandler(dr.query))
 
 	fe := cfg.ServeFrontend.Or(true)
 	if fe {
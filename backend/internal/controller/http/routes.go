@@ -1,8 +1,6 @@
 package http
 
 import (
-	"encoding/json"
-	"fmt"
 	"gohole/internal/query"
 	"net/http"
 
@@ -32,16 +30,7 @@ func (qr *QueryRouter) getAll(w http.ResponseWriter, r *http.Request) error {
 		jsonQueries[i] = query.QueryFromDB(q)
 	}
 
-	b, err := json.Marshal(&jsonQueries)
-	if err != nil {
-		return fmt.Errorf("failed to marshal queries: %w", err)
-	}
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(b); err != nil {
-		return fmt.Errorf("failed to write response: %w", err)
-	}
-
-	return nil
+	return writeJSON(w, http.StatusOK, &jsonQueries)
 }
 
 func (qr *QueryRouter) getStats(w http.ResponseWriter, r *http.Request) error {
@@ -55,16 +44,7 @@ func (qr *QueryRouter) getStats(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	b, err := json.Marshal(&stats)
-	if err != nil {
-		return fmt.Errorf("failed to marshal stats: %w", err)
-	}
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(b); err != nil {
-		return fmt.Errorf("failed to write response: %w", err)
-	}
-
-	return nil
+	return writeJSON(w, http.StatusOK, &stats)
 }
 
 func (qr *QueryRouter) getStatsHistory(w http.ResponseWriter, r *http.Request) error {
@@ -82,16 +62,7 @@ func (qr *QueryRouter) getStatsHistory(w http.ResponseWriter, r *http.Request) e
 		return err
 	}
 
-	b, err := json.Marshal(&history)
-	if err != nil {
-		return fmt.Errorf("failed to marshal history: %w", err)
-	}
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(b); err != nil {
-		return fmt.Errorf("failed to write response: %w", err)
-	}
-
-	return nil
+	return writeJSON(w, http.StatusOK, &history)
 }
 
 func (qr *QueryRouter) getBlockListStats(w http.ResponseWriter, _ *http.Request) error {
@@ -100,16 +71,7 @@ func (qr *QueryRouter) getBlockListStats(w http.ResponseWriter, _ *http.Request)
 		return err
 	}
 
-	b, err := json.Marshal(&stats)
-	if err != nil {
-		return fmt.Errorf("failed to marshal block list stats: %w", err)
-	}
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(b); err != nil {
-		return fmt.Errorf("failed to write response: %w", err)
-	}
-
-	return nil
+	return writeJSON(w, http.StatusOK, &stats)
 }
 
 func (qr *QueryRouter) getHostStats(w http.ResponseWriter, r *http.Request) error {
@@ -123,16 +85,7 @@ func (qr *QueryRouter) getHostStats(w http.ResponseWriter, r *http.Request) erro
 		return err
 	}
 
-	b, err := json.Marshal(&stats)
-	if err != nil {
-		return fmt.Errorf("failed to marshal host stats: %w", err)
-	}
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(b); err != nil {
-		return fmt.Errorf("failed to write response: %w", err)
-	}
-
-	return nil
+	return writeJSON(w, http.StatusOK, &stats)
 }
 
 func (qr *QueryRouter) getDomainStats(w http.ResponseWriter, r *http.Request) error {
@@ -146,16 +99,30 @@ func (qr *QueryRouter) getDomainStats(w http.ResponseWriter, r *http.Request) er
 		return err
 	}
 
-	b, err := json.Marshal(&stats)
+	return writeJSON(w, http.StatusOK, &stats)
+}
+
+func (qr *QueryRouter) getBreakdownStats(w http.ResponseWriter, r *http.Request) error {
+	interval := query.Interval(r.URL.Query().Get("interval"))
+	if !interval.IsValid() {
+		return newHTTPErr(http.StatusBadRequest, "invalid interval value \"%s\"", interval)
+	}
+
+	stats, err := qr.queryService.GetBreakdownStats(r.Context(), interval)
 	if err != nil {
-		return fmt.Errorf("failed to marshal domain stats: %w", err)
+		return err
 	}
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(b); err != nil {
-		return fmt.Errorf("failed to write response: %w", err)
+
+	return writeJSON(w, http.StatusOK, &stats)
+}
+
+func (qr *QueryRouter) getStorageStats(w http.ResponseWriter, r *http.Request) error {
+	stats, err := qr.queryService.GetStorageStats(r.Context())
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return writeJSON(w, http.StatusOK, &stats)
 }
 
 func (qr *QueryRouter) getDomainDetails(w http.ResponseWriter, r *http.Request) error {
@@ -187,14 +154,5 @@ func (qr *QueryRouter) getDomainDetails(w http.ResponseWriter, r *http.Request)
 		return err
 	}
 
-	b, err := json.Marshal(&details)
-	if err != nil {
-		return fmt.Errorf("failed to marshal domain details: %w", err)
-	}
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(b); err != nil {
-		return fmt.Errorf("failed to write response: %w", err)
-	}
-
-	return nil
+	return writeJSON(w, http.StatusOK, &details)
 }
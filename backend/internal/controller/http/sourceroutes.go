@@ -0,0 +1,88 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"gohole/internal/source"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type SourceRouter struct {
+	sourceService source.Service
+}
+
+func NewSourceRouter(sourceService source.Service) *SourceRouter {
+	return &SourceRouter{
+		sourceService: sourceService,
+	}
+}
+
+type addSourceRequest struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+func (sr *SourceRouter) getAll(w http.ResponseWriter, r *http.Request) error {
+	sources, err := sr.sourceService.GetAll(r.Context())
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, http.StatusOK, &sources)
+}
+
+func (sr *SourceRouter) add(w http.ResponseWriter, r *http.Request) error {
+	var req addSourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return newHTTPErr(http.StatusBadRequest, "invalid request body: %v", err)
+	}
+
+	s, err := sr.sourceService.Add(r.Context(), req.Name, req.URL)
+	if err != nil {
+		return sourceHTTPErr(err)
+	}
+
+	return writeJSON(w, http.StatusCreated, s)
+}
+
+func (sr *SourceRouter) remove(w http.ResponseWriter, r *http.Request) error {
+	if err := sr.sourceService.Remove(r.Context(), chi.URLParam(r, "id")); err != nil {
+		return sourceHTTPErr(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (sr *SourceRouter) enable(w http.ResponseWriter, r *http.Request) error {
+	return sr.setEnabled(w, r, true)
+}
+
+func (sr *SourceRouter) disable(w http.ResponseWriter, r *http.Request) error {
+	return sr.setEnabled(w, r, false)
+}
+
+func (sr *SourceRouter) setEnabled(w http.ResponseWriter, r *http.Request, enabled bool) error {
+	s, err := sr.sourceService.SetEnabled(r.Context(), chi.URLParam(r, "id"), enabled)
+	if err != nil {
+		return sourceHTTPErr(err)
+	}
+
+	return writeJSON(w, http.StatusOK, s)
+}
+
+// sourceHTTPErr maps the errors of the source service to HTTP errors.
+func sourceHTTPErr(err error) error {
+	switch {
+	case errors.Is(err, source.ErrInvalidURL):
+		return newHTTPErr(http.StatusBadRequest, "%v", err)
+	case errors.Is(err, source.ErrNotFound):
+		return newHTTPErr(http.StatusNotFound, "%v", err)
+	case errors.Is(err, source.ErrDuplicate):
+		return newHTTPErr(http.StatusConflict, "%v", err)
+	default:
+		return err
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"gohole/internal/database"
+	"strings"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
@@ -13,6 +14,8 @@ import (
 type Manager struct {
 	conn driver.Conn
 	cfg  *database.Config
+	// retention is how long the queries are kept, 0 if forever.
+	retention time.Duration
 }
 
 func NewManager(cfg *database.Config) *Manager {
@@ -25,6 +28,15 @@ func (m *Manager) Repository() database.Repository {
 	return NewRepository(m)
 }
 
+func (m *Manager) SourceRepository() database.SourceRepository {
+	return NewSourceRepository(m)
+}
+
+func (m *Manager) Jobs() []database.Job {
+	// The rollups are maintained by the materialized views
+	return nil
+}
+
 func (m *Manager) Connect(ctx context.Context) error {
 	conn, err := clickhouse.Open(&clickhouse.Options{
 		Addr: []string{m.cfg.Address},
@@ -55,29 +67,93 @@ func (m *Manager) Init(ctx context.Context) error {
 		return fmt.Errorf("clickhouse: connection is not initialized")
 	}
 
+	retention, err := m.cfg.RetentionPeriod()
+	if err != nil {
+		return err
+	}
+
 	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
 		"max_execution_time": 60,
 	}))
 
-	// Create the queries table if it doesn't exist
-	queries := []string{`
-		CREATE TABLE IF NOT EXISTS query (
-			name String,
-			type UInt16,
-			blocked UInt8,
-			host String,
-			timestamp DateTime,
-			millis Int64,
-		) ENGINE = MergeTree() 
-			ORDER BY (timestamp, type);
-		`,
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if err := database.Migrate(ctx, newMigrationStore(m.conn), migrations); err != nil {
+		return fmt.Errorf("clickhouse: %w", err)
+	}
+
+	// The partitioning of the tables created before the daily partitions
+	// cannot be changed, their rows are deleted by their TTL all the same
+	ttlColumns := map[string]string{"query": "timestamp"}
+	for _, rollup := range database.Rollups {
+		ttlColumns[rollup.Table] = "time"
 	}
 
-	for i, query := range queries {
-		if err := m.conn.Exec(ctx, query); err != nil {
-			return fmt.Errorf("clickhouse: cannot create initial table (%d): %w", i, err)
+	for table, column := range ttlColumns {
+		if err := m.setRetention(ctx, table, column, retention); err != nil {
+			return err
 		}
 	}
 
+	m.retention = retention
+
+	return nil
+}
+
+func (m *Manager) MigrationStatus(ctx context.Context) ([]database.MigrationStatus, error) {
+	if m.conn == nil {
+		return nil, fmt.Errorf("clickhouse: connection is not initialized")
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := database.MigrationStatuses(ctx, newMigrationStore(m.conn), migrations)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: %w", err)
+	}
+
+	return statuses, nil
+}
+
+// setRetention sets the TTL of table, deleting its rows once column is older
+// than retention. The TTL is removed if retention is 0.
+func (m *Manager) setRetention(
+	ctx context.Context,
+	table, column string,
+	retention time.Duration,
+) error {
+	var engine string
+	err := m.conn.QueryRow(ctx, `
+		SELECT engine_full
+		FROM system.tables
+		WHERE database = currentDatabase() AND name = ?
+	`, table).Scan(&engine)
+	if err != nil {
+		return fmt.Errorf("clickhouse: cannot fetch the engine of %s: %w", table, err)
+	}
+
+	seconds := int64(retention / time.Second)
+
+	var query string
+	switch {
+	case retention == 0 && strings.Contains(engine, " TTL "):
+		query = fmt.Sprintf("ALTER TABLE %s REMOVE TTL", table)
+	case retention > 0 && !strings.Contains(engine, fmt.Sprintf("toIntervalSecond(%d)", seconds)):
+		// Changing the TTL applies it to the existing rows, which is only done
+		// when it differs from the current one
+		query = fmt.Sprintf("ALTER TABLE %s MODIFY TTL %s + INTERVAL %d SECOND", table, column, seconds)
+	default:
+		return nil
+	}
+
+	if err := m.conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("clickhouse: cannot set the retention of %s: %w", table, err)
+	}
+
 	return nil
 }
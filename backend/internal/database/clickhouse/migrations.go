@@ -0,0 +1,209 @@
+package clickhouse
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"gohole/internal/database"
+	"log/slog"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+const (
+	// errCodeTableAlreadyExists is the code of the error ClickHouse returns when
+	// creating a table which already exists.
+	errCodeTableAlreadyExists = 57
+	// lockRetryDelay is how often the lock of the migrations is tried to be taken.
+	lockRetryDelay = time.Second
+	// lockTimeout is how long the lock of the migrations is waited for.
+	lockTimeout = 5 * time.Minute
+	// staleLockAge is the age after which the lock is considered left behind by
+	// an instance which died while migrating, and is taken over.
+	staleLockAge = 30 * time.Minute
+)
+
+// The statements of the migrations are not run in a transaction, so they must
+// be safe to run again if a migration fails midway.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+func loadMigrations() ([]database.Migration, error) {
+	return database.LoadMigrations(migrationFiles, "migrations")
+}
+
+// migrationStore keeps track of the migrations in the schema_migrations
+// table. As ClickHouse has no locks, the lock is a table: creating a table
+// which already exists fails, so only one instance can create it.
+type migrationStore struct {
+	conn driver.Conn
+}
+
+func newMigrationStore(conn driver.Conn) *migrationStore {
+	return &migrationStore{conn: conn}
+}
+
+func (s *migrationStore) CreateMigrationTable(ctx context.Context) error {
+	err := s.conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version UInt32,
+			name String,
+			applied_at DateTime
+		) ENGINE = MergeTree()
+			ORDER BY version;
+	`)
+	if err != nil {
+		return fmt.Errorf("cannot create the migrations table: %w", err)
+	}
+
+	return nil
+}
+
+func (s *migrationStore) Lock(ctx context.Context) (func(), error) {
+	owner := rand.Text()
+	deadline := time.Now().Add(lockTimeout)
+
+	for {
+		// The lock is created along with its row, so that it is never left empty
+		err := s.conn.Exec(ctx, `
+			CREATE TABLE schema_migrations_lock
+			ENGINE = Log
+			AS SELECT ? AS owner, now() AS locked_at;
+		`, owner)
+		if err == nil {
+			return s.unlock, nil
+		}
+		if !isTableExists(err) {
+			return nil, fmt.Errorf("cannot lock the migrations: %w", err)
+		}
+
+		if err := s.dropStaleLock(ctx); err != nil {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("cannot lock the migrations: %w", err)
+		}
+
+		slog.Info("Waiting for another instance to migrate the database")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryDelay):
+		}
+	}
+}
+
+// isTableExists reports whether err is ClickHouse refusing to create a table
+// which already exists.
+func isTableExists(err error) bool {
+	var exception *clickhouse.Exception
+	return errors.As(err, &exception) && exception.Code == errCodeTableAlreadyExists
+}
+
+// dropStaleLock drops the lock if it was taken more than staleLockAge ago. A
+// lock left empty by an instance which died while taking it is as old as its
+// table.
+func (s *migrationStore) dropStaleLock(ctx context.Context) error {
+	var exists uint8
+	if err := s.conn.QueryRow(ctx, "EXISTS TABLE schema_migrations_lock").Scan(&exists); err != nil {
+		return fmt.Errorf("cannot check the migrations lock: %w", err)
+	}
+	if exists == 0 {
+		return nil
+	}
+
+	var count uint64
+	var lockedAt time.Time
+	err := s.conn.QueryRow(ctx, "SELECT count(), max(locked_at) FROM schema_migrations_lock").
+		Scan(&count, &lockedAt)
+	if err != nil {
+		return fmt.Errorf("cannot check the migrations lock: %w", err)
+	}
+	if count == 0 {
+		err := s.conn.QueryRow(ctx, `
+			SELECT metadata_modification_time
+			FROM system.tables
+			WHERE database = currentDatabase() AND name = 'schema_migrations_lock'
+		`).Scan(&lockedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Unlocked meanwhile
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot check the migrations lock: %w", err)
+		}
+	}
+
+	if time.Since(lockedAt) < staleLockAge {
+		return nil
+	}
+
+	slog.Warn("Taking over a stale migrations lock", "locked_at", lockedAt)
+	if err := s.conn.Exec(ctx, "DROP TABLE IF EXISTS schema_migrations_lock"); err != nil {
+		return fmt.Errorf("cannot drop the stale migrations lock: %w", err)
+	}
+
+	return nil
+}
+
+func (s *migrationStore) unlock() {
+	if err := s.conn.Exec(context.Background(), "DROP TABLE IF EXISTS schema_migrations_lock"); err != nil {
+		slog.Error("Unlocking the migrations", "error", err)
+	}
+}
+
+func (s *migrationStore) AppliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	var exists uint8
+	if err := s.conn.QueryRow(ctx, "EXISTS TABLE schema_migrations").Scan(&exists); err != nil {
+		return nil, fmt.Errorf("cannot check the migrations table: %w", err)
+	}
+	if exists == 0 {
+		return map[int]time.Time{}, nil
+	}
+
+	rows, err := s.conn.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch the applied migrations: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("failed to close rows", "error", err)
+		}
+	}()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version uint32
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("cannot scan applied migration: %w", err)
+		}
+		applied[int(version)] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+func (s *migrationStore) ApplyMigration(ctx context.Context, m database.Migration) error {
+	for i, statement := range m.Statements {
+		if err := s.conn.Exec(ctx, statement); err != nil {
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+	}
+
+	err := s.conn.Exec(ctx,
+		"INSERT INTO schema_migrations VALUES (?, ?, ?)",
+		uint32(m.Version), m.Name, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("cannot record the migration: %w", err)
+	}
+
+	return nil
+}
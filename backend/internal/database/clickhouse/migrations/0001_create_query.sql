@@ -0,0 +1,36 @@
+-- The query log, in daily partitions.
+CREATE TABLE IF NOT EXISTS query (
+	name String,
+	type UInt16,
+	blocked UInt8,
+	host String,
+	timestamp DateTime,
+	millis Int64,
+	match_list LowCardinality(String) DEFAULT '',
+	match_rule String DEFAULT '',
+	match_kind LowCardinality(String) DEFAULT '',
+	client_id String DEFAULT '',
+	rcode UInt16 DEFAULT 0,
+	answer_count UInt16 DEFAULT 0,
+	response_size UInt32 DEFAULT 0,
+	upstream LowCardinality(String) DEFAULT '',
+	cached UInt8 DEFAULT 0,
+	custom UInt8 DEFAULT 0,
+	protocol LowCardinality(String) DEFAULT ''
+) ENGINE = MergeTree()
+	PARTITION BY toYYYYMMDD(timestamp)
+	ORDER BY (timestamp, type);
+
+-- Tables created before the migrations may lack the newer columns
+ALTER TABLE query
+	ADD COLUMN IF NOT EXISTS match_list LowCardinality(String) DEFAULT '',
+	ADD COLUMN IF NOT EXISTS match_rule String DEFAULT '',
+	ADD COLUMN IF NOT EXISTS match_kind LowCardinality(String) DEFAULT '',
+	ADD COLUMN IF NOT EXISTS client_id String DEFAULT '',
+	ADD COLUMN IF NOT EXISTS rcode UInt16 DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS answer_count UInt16 DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS response_size UInt32 DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS upstream LowCardinality(String) DEFAULT '',
+	ADD COLUMN IF NOT EXISTS cached UInt8 DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS custom UInt8 DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS protocol LowCardinality(String) DEFAULT '';
@@ -0,0 +1,11 @@
+-- Sources are updated and deleted by inserting a newer version of the row
+CREATE TABLE IF NOT EXISTS blocklist_source (
+	id String,
+	name String,
+	url String,
+	enabled UInt8,
+	created_at DateTime,
+	updated_at DateTime64(6),
+	deleted UInt8
+) ENGINE = ReplacingMergeTree(updated_at, deleted)
+	ORDER BY id;
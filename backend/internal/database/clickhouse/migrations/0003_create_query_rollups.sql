@@ -0,0 +1,93 @@
+-- The number of queries per minute and per hour, by client, domain and blocked
+-- flag. Rows of the same bucket are summed up as the parts are merged.
+CREATE TABLE IF NOT EXISTS query_rollup_1m (
+	time DateTime,
+	client String,
+	name String,
+	blocked UInt8,
+	queries UInt64
+) ENGINE = SummingMergeTree(queries)
+	ORDER BY (time, blocked, client, name);
+
+CREATE TABLE IF NOT EXISTS query_rollup_1h (
+	time DateTime,
+	client String,
+	name String,
+	blocked UInt8,
+	queries UInt64
+) ENGINE = SummingMergeTree(queries)
+	ORDER BY (time, blocked, client, name);
+
+-- The views only count the queries inserted after their creation, the older
+-- ones are added afterwards from the query table, up to a cutoff taken once
+-- before the views exist. Queries inserted while the views are created are
+-- thus counted by either. There is no cutoff if the views were created before
+-- the migrations, as the tables were filled along with them. Clients sharing
+-- an address are told apart by their ID.
+CREATE TABLE IF NOT EXISTS query_rollup_cutoff (
+	cutoff DateTime
+) ENGINE = Log;
+
+INSERT INTO query_rollup_cutoff
+SELECT now()
+WHERE (SELECT count() FROM query_rollup_cutoff) = 0
+	AND (
+		SELECT count()
+		FROM system.tables
+		WHERE database = currentDatabase() AND name = 'query_rollup_1m_mv'
+	) = 0;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS query_rollup_1m_mv TO query_rollup_1m AS
+SELECT
+	toStartOfMinute(timestamp) AS time,
+	if(client_id != '', client_id, host) AS client,
+	name,
+	blocked,
+	count() AS queries
+FROM query
+GROUP BY time, client, name, blocked;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS query_rollup_1h_mv TO query_rollup_1h AS
+SELECT
+	toStartOfHour(timestamp) AS time,
+	if(client_id != '', client_id, host) AS client,
+	name,
+	blocked,
+	count() AS queries
+FROM query
+GROUP BY time, client, name, blocked;
+
+-- The rollups already filled are skipped, if the migration is run again
+CREATE TABLE IF NOT EXISTS query_rollup_backfilled (
+	rollup String
+) ENGINE = Log;
+
+INSERT INTO query_rollup_1m
+SELECT
+	toStartOfMinute(timestamp) AS time,
+	if(client_id != '', client_id, host) AS client,
+	name,
+	blocked,
+	count() AS queries
+FROM query
+WHERE timestamp < (SELECT max(cutoff) FROM query_rollup_cutoff)
+	AND (SELECT count() FROM query_rollup_backfilled WHERE rollup = '1m') = 0
+GROUP BY time, client, name, blocked
+SETTINGS max_execution_time = 0;
+
+INSERT INTO query_rollup_backfilled VALUES ('1m');
+
+INSERT INTO query_rollup_1h
+SELECT
+	toStartOfHour(timestamp) AS time,
+	if(client_id != '', client_id, host) AS client,
+	name,
+	blocked,
+	count() AS queries
+FROM query
+WHERE timestamp < (SELECT max(cutoff) FROM query_rollup_cutoff)
+	AND (SELECT count() FROM query_rollup_backfilled WHERE rollup = '1h') = 0
+GROUP BY time, client, name, blocked
+SETTINGS max_execution_time = 0;
+
+INSERT INTO query_rollup_backfilled VALUES ('1h');
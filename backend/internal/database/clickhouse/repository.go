@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"gohole/internal/database"
 	"log/slog"
+	"strings"
 	"time"
 )
 
@@ -128,7 +129,10 @@ func (r *repositoryImpl) flushBatch(queries []database.Query) error {
 	ctx := context.Background()
 
 	b, err := r.mngr.conn.PrepareBatch(ctx, `
-		INSERT INTO query (name, type, blocked, host, timestamp, millis)
+		INSERT INTO query (
+			name, type, blocked, host, timestamp, millis, match_list, match_rule, match_kind,
+			client_id, rcode, answer_count, response_size, upstream, cached, custom, protocol
+		)
 	`)
 	if err != nil {
 		return fmt.Errorf("repository: prepare batch: %w", err)
@@ -137,11 +141,22 @@ func (r *repositoryImpl) flushBatch(queries []database.Query) error {
 	for _, q := range queries {
 		if err := b.Append(
 			q.Name,
-			uint16(0), // TODO
+			q.Type,
 			q.Blocked,
 			q.Host,
 			time.Unix(q.Timestamp, 0),
 			q.Millis,
+			q.MatchList,
+			q.MatchRule,
+			q.MatchKind,
+			q.ClientID,
+			q.Rcode,
+			q.AnswerCount,
+			q.ResponseSize,
+			q.Upstream,
+			q.Cached,
+			q.Custom,
+			q.Protocol,
 		); err != nil {
 			return fmt.Errorf("repository: append to batch: %w", err)
 		}
@@ -155,17 +170,15 @@ func (r *repositoryImpl) flushBatch(queries []database.Query) error {
 	return nil
 }
 
-func (r *repositoryImpl) FindAll(ctx context.Context) ([]database.Query, error) {
-	return r.FindAllLimit(ctx, -1, "")
-}
-
 func (r *repositoryImpl) FindAllLimit(
 	ctx context.Context,
 	limit int,
 	name string,
 ) ([]database.Query, error) {
 	baseQuery := `
-		SELECT name, type, host, blocked, timestamp, millis
+		SELECT
+			name, type, host, blocked, timestamp, millis, match_list, match_rule, match_kind,
+			client_id, rcode, answer_count, response_size, upstream, cached, custom, protocol
 		FROM query
   `
 
@@ -197,15 +210,35 @@ func (r *repositoryImpl) FindAllLimit(
 
 	for rows.Next() {
 		var q database.Query
-		var blockedUInt8 uint8
-
-		err := rows.Scan(&q.Name, &q.Type, &q.Host, &blockedUInt8, &q.Timestamp, &q.Millis)
+		var blockedUInt8, cachedUInt8, customUInt8 uint8
+
+		err := rows.Scan(
+			&q.Name,
+			&q.Type,
+			&q.Host,
+			&blockedUInt8,
+			&q.Timestamp,
+			&q.Millis,
+			&q.MatchList,
+			&q.MatchRule,
+			&q.MatchKind,
+			&q.ClientID,
+			&q.Rcode,
+			&q.AnswerCount,
+			&q.ResponseSize,
+			&q.Upstream,
+			&cachedUInt8,
+			&customUInt8,
+			&q.Protocol,
+		)
 		if err != nil {
 			slog.Error("scan failed", "error", err)
 			continue
 		}
 
 		q.Blocked = blockedUInt8 != 0
+		q.Cached = cachedUInt8 != 0
+		q.Custom = customUInt8 != 0
 		queries = append(queries, q)
 	}
 	defer func() {
@@ -217,59 +250,119 @@ func (r *repositoryImpl) FindAllLimit(
 	return queries, nil
 }
 
-func (r *repositoryImpl) FindAllByInterval(
+func (r *repositoryImpl) FindQueryCounts(
 	ctx context.Context,
 	since time.Time,
-) ([]database.Query, error) {
+) (database.QueryCounts, error) {
 	q := `
-    SELECT name, type, blocked, timestamp
-    FROM query
+		SELECT count() AS total, countIf(blocked = 1) AS blocked
+		FROM query
+	`
+	args := []any{}
+
+	if !since.IsZero() {
+		q += " WHERE timestamp >= ?"
+		args = append(args, since)
+	}
+
+	var counts database.QueryCounts
+	if err := r.mngr.conn.QueryRow(ctx, q, args...).Scan(&counts.Total, &counts.Blocked); err != nil {
+		return counts, fmt.Errorf("repository: cannot fetch query counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+func (r *repositoryImpl) FindHistoryPoints(
+	ctx context.Context,
+	since time.Time,
+	granularity time.Duration,
+) ([]database.HistoryPoint, error) {
+	seconds := int64(granularity / time.Second)
+	if seconds < 1 {
+		return nil, fmt.Errorf("repository: unsupported granularity: %v", granularity)
+	}
+
+	// Intervals in seconds are aligned on the Unix epoch, whatever the time zone
+	q := fmt.Sprintf(`
+		SELECT
+			toStartOfInterval(timestamp, INTERVAL %d SECOND) AS time,
+			countIf(blocked = 1) AS blocked,
+			countIf(blocked = 0) AS allowed
+		FROM query
 		WHERE timestamp >= ?
-	  ORDER BY timestamp DESC`
+		GROUP BY time
+		ORDER BY time
+	`, seconds)
 
 	rows, err := r.mngr.conn.Query(ctx, q, since)
-
 	if err != nil {
-		return nil, fmt.Errorf("repository: cannot fetch queries: %w", err)
+		return nil, fmt.Errorf("repository: cannot fetch history points: %w", err)
 	}
-
 	defer func() {
 		if err := rows.Close(); err != nil {
 			slog.Error("failed to close rows", "error", err)
 		}
 	}()
 
-	var queries []database.Query
+	var points []database.HistoryPoint
 
 	for rows.Next() {
-		var q database.Query
-		var blockedUInt8 uint8
-		if err := rows.Scan(&q.Name, &q.Type, &blockedUInt8, &q.Timestamp); err != nil {
+		var p database.HistoryPoint
+		if err := rows.Scan(&p.Time, &p.Blocked, &p.Allowed); err != nil {
 			slog.Error("scan failed", "error", err)
 			continue
 		}
-		q.Blocked = blockedUInt8 != 0
-		queries = append(queries, q)
+		points = append(points, p)
 	}
 
-	return queries, nil
+	return points, nil
+}
+
+// countsSince returns a subquery of the number of queries made after since,
+// by client, domain and blocked flag, along with its arguments. The counts
+// are read from the coarsest rollup suiting the period, if any, and from the
+// query table until its first whole bucket.
+func countsSince(since time.Time) (string, []any) {
+	rollup, ok := database.ChooseRollup(since, time.Now())
+	if !ok {
+		// Clients sharing an address are told apart by their ID
+		return `(
+			SELECT if(client_id != '', client_id, host) AS client, name, blocked, 1 AS queries
+			FROM query
+			WHERE timestamp >= ?
+		)`, []any{since}
+	}
+
+	edge := rollup.Ceil(since)
+
+	return fmt.Sprintf(`(
+		SELECT client, name, blocked, queries
+		FROM %s
+		WHERE time >= ?
+		UNION ALL
+		SELECT if(client_id != '', client_id, host) AS client, name, blocked, 1 AS queries
+		FROM query
+		WHERE timestamp >= ? AND timestamp < ?
+	)`, rollup.Table), []any{edge, since, edge}
 }
 
 func (r *repositoryImpl) FindHostStats(
 	ctx context.Context,
 	since time.Time,
 ) ([]database.HostStat, error) {
-	rows, err := r.mngr.conn.Query(ctx, `
+	counts, args := countsSince(since)
+
+	rows, err := r.mngr.conn.Query(ctx, fmt.Sprintf(`
 		SELECT
-			host,
-			COUNT(*) AS queryCount,
-			SUM(blocked) AS blockedCount,
-			ROUND(100.0 * SUM(blocked) / COUNT(*), 2) AS blockRate
-		FROM query
-		WHERE timestamp >= ?
-		GROUP BY host
+			client,
+			sum(queries) AS queryCount,
+			sumIf(queries, blocked = 1) AS blockedCount,
+			ROUND(100.0 * blockedCount / queryCount, 2) AS blockRate
+		FROM %s
+		GROUP BY client
 		ORDER BY queryCount DESC
-	`, since)
+	`, counts), args...)
 	if err != nil {
 		return nil, fmt.Errorf("repository: cannot fetch host stats: %w", err)
 	}
@@ -299,13 +392,14 @@ func (r *repositoryImpl) FindDomainStats(
 ) (database.DomainStats, error) {
 	var stats database.DomainStats
 
-	rows, err := r.mngr.conn.Query(ctx, `
+	counts, args := countsSince(since)
+
+	rows, err := r.mngr.conn.Query(ctx, fmt.Sprintf(`
 		SELECT
-    countDistinctIf(name, blocked = true)  AS blocked_count,
-    countDistinct(name) AS total
-		FROM query
-		WHERE timestamp >= ?
-	`, since)
+			countDistinctIf(name, blocked = 1) AS blocked_count,
+			countDistinct(name) AS total
+		FROM %s
+	`, counts), args...)
 	if err != nil {
 		return stats, fmt.Errorf("repository: cannot fetch domain stats: %w", err)
 	}
@@ -326,22 +420,75 @@ func (r *repositoryImpl) FindDomainStats(
 	return stats, nil
 }
 
+func (r *repositoryImpl) FindTypeCounts(
+	ctx context.Context,
+	since time.Time,
+) ([]database.KeyCount, error) {
+	return r.findCountsBy(ctx, "type", since)
+}
+
+func (r *repositoryImpl) FindRcodeCounts(
+	ctx context.Context,
+	since time.Time,
+) ([]database.KeyCount, error) {
+	return r.findCountsBy(ctx, "rcode", since)
+}
+
+// findCountsBy counts the queries made after since by value of column, which
+// must not come from user input.
+func (r *repositoryImpl) findCountsBy(
+	ctx context.Context,
+	column string,
+	since time.Time,
+) ([]database.KeyCount, error) {
+	rows, err := r.mngr.conn.Query(ctx, fmt.Sprintf(`
+		SELECT %s AS key, count() AS count
+		FROM query
+		WHERE timestamp >= ?
+		GROUP BY key
+		ORDER BY count DESC
+	`, column), since)
+	if err != nil {
+		return nil, fmt.Errorf("repository: cannot fetch counts by %s: %w", column, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("failed to close rows", "error", err)
+		}
+	}()
+
+	var counts []database.KeyCount
+
+	for rows.Next() {
+		var kc database.KeyCount
+		if err := rows.Scan(&kc.Key, &kc.Count); err != nil {
+			slog.Error("scan failed", "error", err)
+			continue
+		}
+		counts = append(counts, kc)
+	}
+
+	return counts, nil
+}
+
 func (r *repositoryImpl) FindTopDomains(
 	ctx context.Context,
 	blocked bool,
 	since time.Time,
 	limit int,
 ) ([]database.TopDomain, error) {
-	rows, err := r.mngr.conn.Query(ctx, `
+	counts, args := countsSince(since)
+
+	rows, err := r.mngr.conn.Query(ctx, fmt.Sprintf(`
 		SELECT
 			name AS domain,
-			COUNT(*) AS blockedCount
-		FROM query
-		WHERE blocked = ? AND timestamp >= ?
+			sum(queries) AS total
+		FROM %s
+		WHERE blocked = ?
 		GROUP BY name
-		ORDER BY blockedCount DESC
+		ORDER BY total DESC
 		LIMIT ?
-	`, blocked, since, limit)
+	`, counts), append(args, blocked, limit)...)
 	if err != nil {
 		return nil, fmt.Errorf("repository: cannot fetch top blocked domains: %w", err)
 	}
@@ -365,6 +512,37 @@ func (r *repositoryImpl) FindTopDomains(
 	return domains, nil
 }
 
+func (r *repositoryImpl) FindStorageStats(ctx context.Context) (database.StorageStats, error) {
+	stats := database.StorageStats{Retention: r.mngr.retention}
+
+	tables := []string{"'query'"}
+	for _, rollup := range database.Rollups {
+		tables = append(tables, "'"+rollup.Table+"'")
+	}
+
+	err := r.mngr.conn.QueryRow(ctx, fmt.Sprintf(`
+		SELECT sum(bytes_on_disk)
+		FROM system.parts
+		WHERE database = currentDatabase() AND active AND table IN (%s)
+	`, strings.Join(tables, ", "))).Scan(&stats.Bytes)
+	if err != nil {
+		return stats, fmt.Errorf("repository: cannot fetch data usage: %w", err)
+	}
+
+	var count uint64
+	var oldest time.Time
+	err = r.mngr.conn.QueryRow(ctx, "SELECT count(), min(timestamp) FROM query").Scan(&count, &oldest)
+	if err != nil {
+		return stats, fmt.Errorf("repository: cannot fetch oldest query: %w", err)
+	}
+	// The minimum of no rows is the Unix epoch
+	if count > 0 {
+		stats.Oldest = oldest
+	}
+
+	return stats, nil
+}
+
 func (r *repositoryImpl) FindDomainDetailsPoints(
 	ctx context.Context,
 	name string,
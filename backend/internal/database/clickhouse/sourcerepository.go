@@ -0,0 +1,90 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"gohole/internal/database"
+	"log/slog"
+	"time"
+)
+
+type sourceRepositoryImpl struct {
+	mngr *Manager
+}
+
+func NewSourceRepository(manager *Manager) database.SourceRepository {
+	return &sourceRepositoryImpl{
+		mngr: manager,
+	}
+}
+
+func (r *sourceRepositoryImpl) FindAllSources(ctx context.Context) ([]database.BlocklistSource, error) {
+	// FINAL merges the versions of each row, dropping the deleted ones
+	rows, err := r.mngr.conn.Query(ctx, `
+		SELECT id, name, url, enabled, created_at
+		FROM blocklist_source FINAL
+		WHERE deleted = 0
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("repository: cannot fetch sources: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("failed to close rows", "error", err)
+		}
+	}()
+
+	var sources []database.BlocklistSource
+	for rows.Next() {
+		var s database.BlocklistSource
+		var enabledUInt8 uint8
+
+		if err := rows.Scan(&s.ID, &s.Name, &s.URL, &enabledUInt8, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("repository: cannot scan source: %w", err)
+		}
+
+		s.Enabled = enabledUInt8 != 0
+		sources = append(sources, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository: cannot fetch sources: %w", err)
+	}
+
+	return sources, nil
+}
+
+func (r *sourceRepositoryImpl) SaveSource(ctx context.Context, s database.BlocklistSource) error {
+	return r.insert(ctx, s, false)
+}
+
+func (r *sourceRepositoryImpl) DeleteSource(ctx context.Context, id string) error {
+	return r.insert(ctx, database.BlocklistSource{ID: id}, true)
+}
+
+// insert writes a new version of a source, which replaces the previous ones.
+func (r *sourceRepositoryImpl) insert(
+	ctx context.Context,
+	s database.BlocklistSource,
+	deleted bool,
+) error {
+	err := r.mngr.conn.Exec(ctx, `
+		INSERT INTO blocklist_source (id, name, url, enabled, created_at, updated_at, deleted)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`,
+		s.ID,
+		s.Name,
+		s.URL,
+		s.Enabled,
+		s.CreatedAt,
+		time.Now().UTC(),
+		deleted,
+	)
+
+	if err != nil {
+		return fmt.Errorf("repository: save source failed: %w", err)
+	}
+
+	return nil
+}
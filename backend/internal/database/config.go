@@ -1,6 +1,13 @@
 package database
 
-import "github.com/specialfish9/confuso/v2"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/specialfish9/confuso/v2"
+)
 
 type Type = string
 
@@ -24,4 +31,37 @@ type Config struct {
 	// Debug indicates whether to enable debug mode for the database (e.g., logging queries).
 	// Default is false.
 	Debug confuso.Optional[bool] `confuso:"debug"`
+	// Retention is how long the queries are kept, e.g. "90d" or "36h". It must be
+	// at least a day, as the queries are stored in daily partitions. The queries
+	// are kept forever when unset.
+	Retention confuso.Optional[string] `confuso:"retention"`
+}
+
+// RetentionPeriod returns how long the queries are kept, or 0 if they are
+// kept forever.
+func (c *Config) RetentionPeriod() (time.Duration, error) {
+	if !c.Retention.Ok {
+		return 0, nil
+	}
+
+	var retention time.Duration
+	if days, ok := strings.CutSuffix(c.Retention.Value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("db: invalid retention: %w", err)
+		}
+		retention = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		retention, err = time.ParseDuration(c.Retention.Value)
+		if err != nil {
+			return 0, fmt.Errorf("db: invalid retention: %w", err)
+		}
+	}
+
+	if retention < 24*time.Hour {
+		return 0, fmt.Errorf("db: retention must be at least 1d, got %s", c.Retention.Value)
+	}
+
+	return retention, nil
 }
@@ -11,6 +11,20 @@ type Manager interface {
 	Connect(ctx context.Context) error
 	Init(ctx context.Context) error
 	Repository() Repository
+	SourceRepository() SourceRepository
+	// Jobs returns the tasks maintaining the database in the background.
+	Jobs() []Job
+	// MigrationStatus returns the status of each of the schema migrations,
+	// the pending ones included.
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+}
+
+// Job is a task a database runs in the background, e.g. to maintain its
+// tables. Jobs are started and stopped along with the other daemons.
+type Job interface {
+	ID() string
+	Start() error
+	Stop() error
 }
 
 func Connect(ctx context.Context, manager Manager, config *Config, attempts int) error {
@@ -4,12 +4,35 @@ import "time"
 
 type Query struct {
 	Name string `json:"name"`
-	// Type is yet to be used.
+	// Type is the type of the question, e.g. 1 for A.
 	Type      uint16 `json:"type"`
 	Blocked   bool   `json:"blocked"`
 	Host      string `json:"host"`
 	Timestamp int64  `json:"timestamp"`
 	Millis    int64  `json:"millis"`
+	// MatchList, MatchRule and MatchKind describe the list entry the query was
+	// blocked or allowed by. They are empty if no entry matched.
+	MatchList string `json:"matchList"`
+	MatchRule string `json:"matchRule"`
+	MatchKind string `json:"matchKind"`
+	// ClientID is the ID the client identified itself with, e.g. in the path of
+	// a DNS-over-HTTPS request. Empty if there is none.
+	ClientID string `json:"clientId"`
+	// Rcode is the response code of the response sent to the client.
+	Rcode uint16 `json:"rcode"`
+	// AnswerCount is the number of records in the answer section of the response.
+	AnswerCount uint16 `json:"answerCount"`
+	// ResponseSize is the size of the response in wire format, in bytes.
+	ResponseSize uint32 `json:"responseSize"`
+	// Upstream is the address of the upstream that answered, empty if the query
+	// was not forwarded.
+	Upstream string `json:"upstream"`
+	// Cached and Custom tell whether the query was answered from the cache or
+	// from the custom domains.
+	Cached bool `json:"cached"`
+	Custom bool `json:"custom"`
+	// Protocol is the protocol the query was received over, e.g. "udp" or "https".
+	Protocol string `json:"protocol"`
 }
 
 func NewQuery(name string, host string, blocked bool, millis int64) Query {
@@ -34,12 +57,53 @@ type DomainStats struct {
 	BlockedCount uint64 `json:"blocked"`
 }
 
+// KeyCount is the number of queries sharing the value of a column, e.g. the
+// queries of type A.
+type KeyCount struct {
+	Key   uint16 `json:"key"`
+	Count uint64 `json:"count"`
+}
+
 type TopDomain struct {
 	Domain string `json:"domain"`
 	Count  uint64 `json:"count"`
 }
 
+// QueryCounts is the number of queries over a period, and of the blocked ones.
+type QueryCounts struct {
+	Total   uint64 `json:"total"`
+	Blocked uint64 `json:"blocked"`
+}
+
+// HistoryPoint is the number of blocked and allowed queries made in the time
+// bucket starting at Time.
+type HistoryPoint struct {
+	Time    time.Time `json:"time"`
+	Blocked uint64    `json:"blocked"`
+	Allowed uint64    `json:"allowed"`
+}
+
+// StorageStats is the disk space used by the queries, and how long they are kept.
+type StorageStats struct {
+	// Bytes is the disk space used by the query table and its rollups.
+	Bytes uint64
+	// Oldest is the time of the oldest query kept, zero if there is none.
+	Oldest time.Time
+	// Retention is how long the queries are kept, 0 if they are kept forever.
+	Retention time.Duration
+}
+
 type Point struct {
 	Time  time.Time `json:"time"`
 	Count uint64    `json:"count"`
 }
+
+// BlocklistSource is a remote blocklist managed through the API, as opposed to
+// the ones listed in the blocklist file.
+type BlocklistSource struct {
+	ID        string
+	Name      string
+	URL       string
+	Enabled   bool
+	CreatedAt time.Time
+}
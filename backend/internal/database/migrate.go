@@ -0,0 +1,178 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration is a change of the schema of a database, applied once and in
+// order. Migrations are read from files named after their version and name,
+// e.g. 0001_create_query.sql.
+type Migration struct {
+	Version int
+	Name    string
+	// Statements are the SQL statements of the migration, run one by one.
+	Statements []string
+}
+
+// MigrationStatus tells when a migration was applied.
+type MigrationStatus struct {
+	Migration
+	// AppliedAt is zero if the migration is pending.
+	AppliedAt time.Time
+}
+
+// Pending tells whether the migration is yet to be applied.
+func (s MigrationStatus) Pending() bool {
+	return s.AppliedAt.IsZero()
+}
+
+// MigrationStore applies the migrations of a database, and keeps track of the
+// applied ones in the schema_migrations table.
+type MigrationStore interface {
+	// CreateMigrationTable creates the schema_migrations table, if needed.
+	CreateMigrationTable(ctx context.Context) error
+	// Lock prevents other instances from migrating the database until unlock
+	// is called.
+	Lock(ctx context.Context) (unlock func(), err error)
+	// AppliedMigrations returns the time the applied migrations were applied
+	// at, by version. There is none if the schema_migrations table does not exist.
+	AppliedMigrations(ctx context.Context) (map[int]time.Time, error)
+	// ApplyMigration runs the statements of m and records it as applied.
+	ApplyMigration(ctx context.Context, m Migration) error
+}
+
+// LoadMigrations reads the migrations from the .sql files of dir in fsys,
+// sorted by version.
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("db: cannot read migrations: %w", err)
+	}
+
+	var migrations []Migration
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+
+		base := strings.TrimSuffix(e.Name(), ".sql")
+		v, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(v)
+		if !ok || err != nil || version < 1 || name == "" {
+			return nil, fmt.Errorf("db: invalid migration file name %s", e.Name())
+		}
+
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("db: cannot read migration %s: %w", e.Name(), err)
+		}
+
+		migrations = append(migrations, Migration{
+			Version:    version,
+			Name:       name,
+			Statements: splitStatements(string(b)),
+		})
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("db: duplicate migration version %d", migrations[i].Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// splitStatements splits sql into statements, each ending with a semicolon
+// at the end of a line. Statements made of comments only are left out.
+func splitStatements(sql string) []string {
+	var statements []string
+	var current []string
+	hasCode := false
+
+	flush := func() {
+		if hasCode {
+			statements = append(statements, strings.TrimSpace(strings.Join(current, "\n")))
+		}
+		current, hasCode = nil, false
+	}
+
+	for line := range strings.Lines(sql) {
+		line = strings.TrimRight(line, " \t\r\n")
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+			hasCode = true
+		}
+
+		if s, ok := strings.CutSuffix(line, ";"); ok && hasCode {
+			current = append(current, s)
+			flush()
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+
+	return statements
+}
+
+// Migrate applies the pending migrations, in order, while holding the lock of
+// store.
+func Migrate(ctx context.Context, store MigrationStore, migrations []Migration) error {
+	if err := store.CreateMigrationTable(ctx); err != nil {
+		return err
+	}
+
+	unlock, err := store.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// The migrations applied by another instance are only known once locked
+	applied, err := store.AppliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		slog.Info("Applying migration", "version", m.Version, "name", m.Name)
+		if err := store.ApplyMigration(ctx, m); err != nil {
+			return fmt.Errorf("db: migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// MigrationStatuses returns the status of each of the migrations.
+func MigrationStatuses(
+	ctx context.Context,
+	store MigrationStore,
+	migrations []Migration,
+) ([]MigrationStatus, error) {
+	applied, err := store.AppliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = MigrationStatus{Migration: m, AppliedAt: applied[m.Version]}
+	}
+
+	return statuses, nil
+}
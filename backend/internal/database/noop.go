@@ -2,20 +2,37 @@ package database
 
 import (
 	"context"
+	"slices"
+	"sync"
 	"time"
 )
 
 type NoOpManager struct {
+	sources *MemorySourceRepository
 }
 
 func NewNoOpManager() *NoOpManager {
-	return &NoOpManager{}
+	return &NoOpManager{
+		sources: NewMemorySourceRepository(),
+	}
 }
 
 func (m *NoOpManager) Repository() Repository {
 	return NewNoOpRepostory()
 }
 
+func (m *NoOpManager) SourceRepository() SourceRepository {
+	return m.sources
+}
+
+func (m *NoOpManager) Jobs() []Job {
+	return nil
+}
+
+func (m *NoOpManager) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	return nil, nil
+}
+
 func (m *NoOpManager) Connect(ctx context.Context) error {
 	return nil
 }
@@ -39,10 +56,6 @@ func (r *NoOpRepository) SaveQuery(ctx context.Context, q Query) error {
 	return nil
 }
 
-func (r *NoOpRepository) FindAll(ctx context.Context) ([]Query, error) {
-	return []Query{}, nil
-}
-
 func (r *NoOpRepository) FindAllLimit(
 	ctx context.Context,
 	limit int,
@@ -51,8 +64,20 @@ func (r *NoOpRepository) FindAllLimit(
 	return []Query{}, nil
 }
 
-func (r *NoOpRepository) FindAllByInterval(ctx context.Context, since time.Time) ([]Query, error) {
-	return []Query{}, nil
+func (r *NoOpRepository) FindQueryCounts(ctx context.Context, since time.Time) (QueryCounts, error) {
+	return QueryCounts{}, nil
+}
+
+func (r *NoOpRepository) FindStorageStats(ctx context.Context) (StorageStats, error) {
+	return StorageStats{}, nil
+}
+
+func (r *NoOpRepository) FindHistoryPoints(
+	ctx context.Context,
+	since time.Time,
+	granularity time.Duration,
+) ([]HistoryPoint, error) {
+	return []HistoryPoint{}, nil
 }
 
 func (r *NoOpRepository) FindHostStats(ctx context.Context, since time.Time) ([]HostStat, error) {
@@ -66,6 +91,14 @@ func (r *NoOpRepository) FindDomainStats(
 	return DomainStats{}, nil
 }
 
+func (r *NoOpRepository) FindTypeCounts(ctx context.Context, since time.Time) ([]KeyCount, error) {
+	return []KeyCount{}, nil
+}
+
+func (r *NoOpRepository) FindRcodeCounts(ctx context.Context, since time.Time) ([]KeyCount, error) {
+	return []KeyCount{}, nil
+}
+
 func (r *NoOpRepository) FindTopDomains(
 	ctx context.Context,
 	blocked bool,
@@ -83,3 +116,44 @@ func (r *NoOpRepository) FindDomainDetailsPoints(
 ) ([]Point, error) {
 	return nil, nil
 }
+
+// MemorySourceRepository keeps the sources in memory, so that they can be
+// managed when database storage is disabled. They are lost on restart.
+type MemorySourceRepository struct {
+	mu      sync.Mutex
+	sources []BlocklistSource
+}
+
+func NewMemorySourceRepository() *MemorySourceRepository {
+	return &MemorySourceRepository{}
+}
+
+func (r *MemorySourceRepository) FindAllSources(ctx context.Context) ([]BlocklistSource, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.sources), nil
+}
+
+func (r *MemorySourceRepository) SaveSource(ctx context.Context, s BlocklistSource) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.IndexFunc(r.sources, func(o BlocklistSource) bool { return o.ID == s.ID })
+	if i >= 0 {
+		r.sources[i] = s
+	} else {
+		r.sources = append(r.sources, s)
+	}
+
+	return nil
+}
+
+func (r *MemorySourceRepository) DeleteSource(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sources = slices.DeleteFunc(r.sources, func(s BlocklistSource) bool { return s.ID == id })
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package pg
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"gohole/internal/database"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrationLockID is the advisory lock held while migrating the database, so
+// that two instances do not migrate it at once.
+const migrationLockID = 0x60401f
+
+// Each migration is run in a transaction, and is either applied as a whole or
+// not at all.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+func loadMigrations() ([]database.Migration, error) {
+	return database.LoadMigrations(migrationFiles, "migrations")
+}
+
+// migrationStore keeps track of the migrations in the schema_migrations table.
+type migrationStore struct {
+	pool *pgxpool.Pool
+}
+
+func newMigrationStore(pool *pgxpool.Pool) *migrationStore {
+	return &migrationStore{pool: pool}
+}
+
+func (s *migrationStore) CreateMigrationTable(ctx context.Context) error {
+	_, err := s.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("cannot create the migrations table: %w", err)
+	}
+
+	return nil
+}
+
+func (s *migrationStore) Lock(ctx context.Context) (func(), error) {
+	// Advisory locks belong to the session, which must be kept until unlocked
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot lock the migrations: %w", err)
+	}
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		conn.Release()
+		return nil, fmt.Errorf("cannot lock the migrations: %w", err)
+	}
+
+	return func() {
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID); err != nil {
+			slog.Error("Unlocking the migrations", "error", err)
+		}
+		conn.Release()
+	}, nil
+}
+
+func (s *migrationStore) AppliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	var exists bool
+	err := s.pool.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("cannot check the migrations table: %w", err)
+	}
+	if !exists {
+		return map[int]time.Time{}, nil
+	}
+
+	rows, err := s.pool.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch the applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("cannot scan applied migration: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+func (s *migrationStore) ApplyMigration(ctx context.Context, m database.Migration) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		for i, statement := range m.Statements {
+			if _, err := tx.Exec(ctx, statement); err != nil {
+				return fmt.Errorf("statement %d: %w", i+1, err)
+			}
+		}
+
+		_, err := tx.Exec(ctx,
+			"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+			m.Version, m.Name, time.Now(),
+		)
+		if err != nil {
+			return fmt.Errorf("cannot record the migration: %w", err)
+		}
+
+		return nil
+	})
+}
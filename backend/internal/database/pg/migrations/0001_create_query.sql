@@ -0,0 +1,37 @@
+-- The query log, partitioned by time range. The partitions are created and
+-- dropped by the partition job.
+CREATE TABLE IF NOT EXISTS "query" (
+	name TEXT,
+	type SMALLINT,
+	blocked BOOLEAN,
+	host TEXT,
+	timestamp TIMESTAMP,
+	millis BIGINT,
+	match_list TEXT NOT NULL DEFAULT '',
+	match_rule TEXT NOT NULL DEFAULT '',
+	match_kind TEXT NOT NULL DEFAULT '',
+	client_id TEXT NOT NULL DEFAULT '',
+	rcode SMALLINT NOT NULL DEFAULT 0,
+	answer_count SMALLINT NOT NULL DEFAULT 0,
+	response_size INTEGER NOT NULL DEFAULT 0,
+	upstream TEXT NOT NULL DEFAULT '',
+	cached BOOLEAN NOT NULL DEFAULT FALSE,
+	custom BOOLEAN NOT NULL DEFAULT FALSE,
+	protocol TEXT NOT NULL DEFAULT ''
+) PARTITION BY RANGE (timestamp);
+
+-- Tables created before the migrations may lack the newer columns
+ALTER TABLE "query"
+	ADD COLUMN IF NOT EXISTS match_list TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS match_rule TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS match_kind TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS client_id TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS rcode SMALLINT NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS answer_count SMALLINT NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS response_size INTEGER NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS upstream TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS cached BOOLEAN NOT NULL DEFAULT FALSE,
+	ADD COLUMN IF NOT EXISTS custom BOOLEAN NOT NULL DEFAULT FALSE,
+	ADD COLUMN IF NOT EXISTS protocol TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS query_timestamp_type_idx ON "query" (timestamp, type);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS blocklist_source (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	url TEXT NOT NULL UNIQUE,
+	enabled BOOLEAN NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
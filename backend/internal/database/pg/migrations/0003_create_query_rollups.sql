@@ -0,0 +1,26 @@
+-- The rollups are refreshed by the rollup job, up to the time kept in
+-- query_rollup_state.
+CREATE TABLE IF NOT EXISTS query_rollup_state (
+	rollup TEXT PRIMARY KEY,
+	refreshed_until TIMESTAMP NOT NULL
+);
+
+-- The number of queries per minute and per hour, by client, domain and
+-- blocked flag.
+CREATE TABLE IF NOT EXISTS query_rollup_1m (
+	time TIMESTAMP NOT NULL,
+	client TEXT NOT NULL,
+	name TEXT NOT NULL,
+	blocked BOOLEAN NOT NULL,
+	queries BIGINT NOT NULL,
+	PRIMARY KEY (time, client, name, blocked)
+);
+
+CREATE TABLE IF NOT EXISTS query_rollup_1h (
+	time TIMESTAMP NOT NULL,
+	client TEXT NOT NULL,
+	name TEXT NOT NULL,
+	blocked BOOLEAN NOT NULL,
+	queries BIGINT NOT NULL,
+	PRIMARY KEY (time, client, name, blocked)
+);
@@ -0,0 +1,259 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"gohole/internal/database"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// partitionInterval is how often the partitions are created and dropped.
+	partitionInterval = time.Hour
+	// partitionLookahead is the number of days the partitions are created in
+	// advance, so that the queries always have one to be saved to.
+	partitionLookahead = 7
+	// timestampLayout is the layout of the bounds of the partitions.
+	timestampLayout = "2006-01-02 15:04:05"
+)
+
+// partitionUpperBound matches the upper bound of a range partition, e.g.
+// FOR VALUES FROM ('2024-01-01 00:00:00') TO ('2024-01-02 00:00:00').
+var partitionUpperBound = regexp.MustCompile(`TO \('([^']+)'\)`)
+
+// partition is a partition of the query table, holding the queries made
+// before until.
+type partition struct {
+	name  string
+	until time.Time
+}
+
+// localTime returns the time of the wall clock of t in the local time zone.
+// The timestamps are stored without time zone, in local time, and read as UTC.
+func localTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+}
+
+// startOfDay returns the start of the day of t, in local time.
+func startOfDay(t time.Time) time.Time {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// partitionLegacyTable turns a query table created before the partitioning
+// into a partitioned one. The former table becomes the partition of the
+// queries made until the end of the day, so that no row is copied, and is
+// dropped as a whole once they are all older than the retention.
+func (m *Manager) partitionLegacyTable(ctx context.Context) error {
+	return pgx.BeginFunc(ctx, m.pool, func(tx pgx.Tx) error {
+		// Another instance may be converting the table
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+			return fmt.Errorf("postgres: cannot lock the query table: %w", err)
+		}
+
+		var legacy bool
+		err := tx.QueryRow(ctx, `
+			SELECT relkind = 'r' FROM pg_class WHERE oid = 'query'::regclass
+		`).Scan(&legacy)
+		if err != nil {
+			return fmt.Errorf("postgres: cannot check the query table: %w", err)
+		}
+		if !legacy {
+			return nil
+		}
+
+		var newest *time.Time
+		if err := tx.QueryRow(ctx, `SELECT MAX(timestamp) FROM "query"`).Scan(&newest); err != nil {
+			return fmt.Errorf("postgres: cannot fetch the newest query: %w", err)
+		}
+
+		until := startOfDay(time.Now()).AddDate(0, 0, 1)
+		if newest != nil && !localTime(*newest).Before(until) {
+			until = startOfDay(localTime(*newest)).AddDate(0, 0, 1)
+		}
+
+		queries := []string{
+			`ALTER TABLE "query" RENAME TO query_legacy;`,
+			`ALTER INDEX IF EXISTS query_timestamp_type_idx RENAME TO query_legacy_timestamp_type_idx;`,
+			// Range partitions cannot hold rows without timestamp
+			`DELETE FROM query_legacy WHERE timestamp IS NULL;`,
+			`CREATE TABLE "query" (LIKE query_legacy INCLUDING DEFAULTS) PARTITION BY RANGE (timestamp);`,
+			`CREATE INDEX query_timestamp_type_idx ON "query" (timestamp, type);`,
+			fmt.Sprintf(
+				`ALTER TABLE "query" ATTACH PARTITION query_legacy FOR VALUES FROM (MINVALUE) TO ('%s');`,
+				until.Format(timestampLayout),
+			),
+		}
+		for i, query := range queries {
+			if _, err := tx.Exec(ctx, query); err != nil {
+				return fmt.Errorf("postgres: cannot partition the query table (%d): %w", i, err)
+			}
+		}
+
+		slog.Info("Partitioned the query table", "legacy_until", until)
+		return nil
+	})
+}
+
+// queryPartitions returns the range partitions of the query table.
+func (m *Manager) queryPartitions(ctx context.Context) ([]partition, error) {
+	rows, err := m.pool.Query(ctx, `
+		SELECT c.relname, pg_get_expr(c.relpartbound, c.oid)
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'query'::regclass
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: cannot fetch the partitions: %w", err)
+	}
+	defer rows.Close()
+
+	var partitions []partition
+
+	for rows.Next() {
+		var name, bound string
+		if err := rows.Scan(&name, &bound); err != nil {
+			return nil, fmt.Errorf("postgres: cannot scan partition: %w", err)
+		}
+
+		match := partitionUpperBound.FindStringSubmatch(bound)
+		if match == nil {
+			continue
+		}
+		until, err := time.ParseInLocation(timestampLayout, match[1], time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("postgres: invalid bound of partition %s: %w", name, err)
+		}
+
+		partitions = append(partitions, partition{name: name, until: until})
+	}
+
+	return partitions, rows.Err()
+}
+
+// createPartitions creates the daily partitions of the query table, from the
+// last existing one or the current day, up to partitionLookahead days after now.
+func (m *Manager) createPartitions(ctx context.Context, now time.Time) error {
+	partitions, err := m.queryPartitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	from := startOfDay(now)
+	for _, p := range partitions {
+		if p.until.After(from) {
+			from = p.until
+		}
+	}
+
+	end := startOfDay(now).AddDate(0, 0, partitionLookahead+1)
+	for day := from; day.Before(end); day = day.AddDate(0, 0, 1) {
+		_, err := m.pool.Exec(ctx, fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS query_p%s PARTITION OF "query" FOR VALUES FROM ('%s') TO ('%s');`,
+			day.Format("20060102"),
+			day.Format(timestampLayout),
+			day.AddDate(0, 0, 1).Format(timestampLayout),
+		))
+		if err != nil {
+			return fmt.Errorf("postgres: cannot create partition of %s: %w", day.Format(time.DateOnly), err)
+		}
+	}
+
+	return nil
+}
+
+// dropPartitions drops the partitions of the query table whose queries are
+// all older than retention, and the rollup buckets older than retention.
+func (m *Manager) dropPartitions(ctx context.Context, now time.Time, retention time.Duration) error {
+	cutoff := now.Add(-retention)
+
+	partitions, err := m.queryPartitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range partitions {
+		if p.until.After(cutoff) {
+			continue
+		}
+		if _, err := m.pool.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s;`, p.name)); err != nil {
+			return fmt.Errorf("postgres: cannot drop partition %s: %w", p.name, err)
+		}
+		slog.Info("Dropped expired partition", "partition", p.name, "until", p.until)
+	}
+
+	for _, rollup := range database.Rollups {
+		_, err := m.pool.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE time < $1;`, rollup.Table), cutoff)
+		if err != nil {
+			return fmt.Errorf("postgres: cannot delete expired rows of %s: %w", rollup.Table, err)
+		}
+	}
+
+	return nil
+}
+
+// partitionJob creates the partitions of the upcoming days, and drops the
+// ones older than the retention, if any.
+type partitionJob struct {
+	mngr *Manager
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	l      *slog.Logger
+}
+
+func newPartitionJob(manager *Manager) *partitionJob {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &partitionJob{
+		mngr:   manager,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		l:      slog.With("component", "pg-partition"),
+	}
+}
+
+func (j *partitionJob) ID() string {
+	return "Postgres-partition"
+}
+
+func (j *partitionJob) Start() error {
+	defer close(j.done)
+
+	j.l.Info("Started Postgres partition job", "interval", partitionInterval, "retention", j.mngr.retention)
+
+	ticker := time.NewTicker(partitionInterval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+
+		if err := j.mngr.createPartitions(j.ctx, now); err != nil {
+			j.l.Error("Creating partitions", "error", err)
+		}
+		if j.mngr.retention > 0 {
+			if err := j.mngr.dropPartitions(j.ctx, now, j.mngr.retention); err != nil {
+				j.l.Error("Dropping expired partitions", "error", err)
+			}
+		}
+
+		select {
+		case <-j.ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *partitionJob) Stop() error {
+	j.l.Info("Stopping Postgres partition job")
+	j.cancel()
+	<-j.done
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"gohole/internal/database"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -11,6 +12,8 @@ import (
 type Manager struct {
 	cfg  *database.Config
 	pool *pgxpool.Pool
+	// retention is how long the queries are kept, 0 if forever.
+	retention time.Duration
 }
 
 func NewManager(cfg *database.Config) *Manager {
@@ -23,6 +26,32 @@ func (m *Manager) Repository() database.Repository {
 	return NewRepository(m)
 }
 
+func (m *Manager) SourceRepository() database.SourceRepository {
+	return NewSourceRepository(m)
+}
+
+func (m *Manager) Jobs() []database.Job {
+	return []database.Job{newRollupJob(m), newPartitionJob(m)}
+}
+
+func (m *Manager) MigrationStatus(ctx context.Context) ([]database.MigrationStatus, error) {
+	if m.pool == nil {
+		return nil, fmt.Errorf("postgres: connection is not initialized")
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := database.MigrationStatuses(ctx, newMigrationStore(m.pool), migrations)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+
+	return statuses, nil
+}
+
 func (m *Manager) Connect(ctx context.Context) error {
 	dsn := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable",
 		m.cfg.User,
@@ -50,25 +79,30 @@ func (m *Manager) Init(ctx context.Context) error {
 		return fmt.Errorf("postgres: connection is not initialized")
 	}
 
-	queries := []string{`
-		CREATE TABLE IF NOT EXISTS "query" (
-			name TEXT,
-			type SMALLINT,
-			blocked BOOLEAN,
-			host TEXT,
-			timestamp TIMESTAMP,
-			millis BIGINT
-		);`,
-
-		`CREATE INDEX IF NOT EXISTS query_timestamp_type_idx
-		ON "query" (timestamp, type);`,
+	retention, err := m.cfg.RetentionPeriod()
+	if err != nil {
+		return err
 	}
 
-	for i, query := range queries {
-		if _, err := m.pool.Exec(ctx, query); err != nil {
-			return fmt.Errorf("postgres: cannot create initial table (%d): %w", i, err)
-		}
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
 	}
+	if err := database.Migrate(ctx, newMigrationStore(m.pool), migrations); err != nil {
+		return fmt.Errorf("postgres: %w", err)
+	}
+
+	// Converting a query table created before the partitioning depends on the
+	// local time zone, in which the timestamps are stored, so it is not a
+	// migration
+	if err := m.partitionLegacyTable(ctx); err != nil {
+		return err
+	}
+	if err := m.createPartitions(ctx, time.Now()); err != nil {
+		return err
+	}
+
+	m.retention = retention
 
 	return nil
 }
@@ -26,8 +26,11 @@ func (r *repositoryImpl) Close() error {
 
 func (r *repositoryImpl) SaveQuery(ctx context.Context, q database.Query) error {
 	_, err := r.mngr.pool.Exec(ctx, `
-		INSERT INTO query (name, type, blocked, host, timestamp, millis)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO query (
+			name, type, blocked, host, timestamp, millis, match_list, match_rule, match_kind,
+			client_id, rcode, answer_count, response_size, upstream, cached, custom, protocol
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
 	`,
 		q.Name,
 		q.Type,
@@ -35,6 +38,17 @@ func (r *repositoryImpl) SaveQuery(ctx context.Context, q database.Query) error
 		q.Host,
 		time.Unix(q.Timestamp, 0),
 		q.Millis,
+		q.MatchList,
+		q.MatchRule,
+		q.MatchKind,
+		q.ClientID,
+		q.Rcode,
+		q.AnswerCount,
+		q.ResponseSize,
+		q.Upstream,
+		q.Cached,
+		q.Custom,
+		q.Protocol,
 	)
 
 	if err != nil {
@@ -44,17 +58,16 @@ func (r *repositoryImpl) SaveQuery(ctx context.Context, q database.Query) error
 	return nil
 }
 
-func (r *repositoryImpl) FindAll(ctx context.Context) ([]database.Query, error) {
-	return r.FindAllLimit(ctx, -1, "")
-}
-
 func (r *repositoryImpl) FindAllLimit(
 	ctx context.Context,
 	limit int,
 	name string,
 ) ([]database.Query, error) {
 	base := `
-		SELECT name, type, host, blocked, timestamp, millis
+		SELECT
+			name, type, host, blocked, EXTRACT(EPOCH FROM timestamp)::BIGINT AS timestamp, millis,
+			match_list, match_rule, match_kind, client_id, rcode, answer_count, response_size,
+			upstream, cached, custom, protocol
 		FROM query
 	`
 
@@ -88,22 +101,52 @@ func (r *repositoryImpl) FindAllLimit(
 	return res, nil
 }
 
-func (r *repositoryImpl) FindAllByInterval(
+func (r *repositoryImpl) FindQueryCounts(
 	ctx context.Context,
 	since time.Time,
-) ([]database.Query, error) {
+) (database.QueryCounts, error) {
+	q := `
+		SELECT COUNT(*) AS total, COUNT(*) FILTER (WHERE blocked) AS blocked
+		FROM query
+	`
+	args := []any{}
+
+	if !since.IsZero() {
+		q += " WHERE timestamp >= $1"
+		args = append(args, since)
+	}
+
+	var counts database.QueryCounts
+	err := r.mngr.pool.QueryRow(ctx, q, args...).Scan(&counts.Total, &counts.Blocked)
+
+	return counts, err
+}
+
+func (r *repositoryImpl) FindHistoryPoints(
+	ctx context.Context,
+	since time.Time,
+	granularity time.Duration,
+) ([]database.HistoryPoint, error) {
+	if granularity < time.Second {
+		return nil, fmt.Errorf("unsupported granularity")
+	}
+
 	rows, err := r.mngr.pool.Query(ctx, `
-		SELECT name, type, blocked, timestamp
+		SELECT
+			date_bin($1, timestamp, TIMESTAMP '1970-01-01') AS time,
+			COUNT(*) FILTER (WHERE blocked) AS blocked,
+			COUNT(*) FILTER (WHERE NOT blocked) AS allowed
 		FROM query
-		WHERE timestamp >= $1
-		ORDER BY timestamp DESC
-	`, since)
+		WHERE timestamp >= $2
+		GROUP BY 1
+		ORDER BY 1
+	`, granularity, since)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	res, err := pgx.CollectRows(rows, pgx.RowToStructByName[database.Query])
+	res, err := pgx.CollectRows(rows, pgx.RowToStructByName[database.HistoryPoint])
 	if err != nil {
 		return nil, err
 	}
@@ -111,21 +154,71 @@ func (r *repositoryImpl) FindAllByInterval(
 	return res, nil
 }
 
+// countsSince returns a "counts" common table expression of the number of
+// queries made after since, by client, domain and blocked flag, along with its
+// argument ($1). The counts are read from the coarsest rollup suiting the
+// period, if any, and from the query table until its first whole bucket and
+// after its last refresh.
+func countsSince(since time.Time) (string, any) {
+	rollup, ok := database.ChooseRollup(since, time.Now())
+	if !ok {
+		// Clients sharing an address are told apart by their ID
+		return `WITH counts AS (
+			SELECT
+				COALESCE(NULLIF(client_id, ''), host, '') AS client,
+				COALESCE(name, '') AS name,
+				COALESCE(blocked, FALSE) AS blocked,
+				1 AS queries
+			FROM query
+			WHERE timestamp >= $1
+		)`, since
+	}
+
+	// The buckets are binned like the refreshes do
+	return fmt.Sprintf(`WITH refreshed AS (
+		SELECT COALESCE(MAX(refreshed_until), '-infinity') AS until
+		FROM query_rollup_state
+		WHERE rollup = '%[1]s'
+	), bucket AS (
+		SELECT date_bin(INTERVAL '%[2]d seconds', $1, TIMESTAMP '1970-01-01') AS start
+	), edge AS (
+		SELECT CASE
+			WHEN bucket.start < $1 THEN bucket.start + INTERVAL '%[2]d seconds'
+			ELSE bucket.start
+		END AS at
+		FROM bucket
+	), counts AS (
+		SELECT r.client, r.name, r.blocked, r.queries
+		FROM %[1]s r, refreshed, edge
+		WHERE r.time >= edge.at AND r.time < refreshed.until
+		UNION ALL
+		SELECT
+			COALESCE(NULLIF(q.client_id, ''), q.host, ''),
+			COALESCE(q.name, ''),
+			COALESCE(q.blocked, FALSE),
+			1
+		FROM query q, refreshed, edge
+		WHERE q.timestamp >= $1
+			AND (q.timestamp < edge.at OR q.timestamp >= GREATEST(edge.at, refreshed.until))
+	)`, rollup.Table, int(rollup.Resolution.Seconds())), since
+}
+
 func (r *repositoryImpl) FindHostStats(
 	ctx context.Context,
 	since time.Time,
 ) ([]database.HostStat, error) {
-	rows, err := r.mngr.pool.Query(ctx, `
+	counts, arg := countsSince(since)
+
+	rows, err := r.mngr.pool.Query(ctx, counts+`
 		SELECT
-			host,
-			COUNT(*) AS query_count,
-			SUM(CASE WHEN blocked THEN 1 ELSE 0 END) AS blocked_count,
-			ROUND(100.0 * SUM(CASE WHEN blocked THEN 1 ELSE 0 END) / COUNT(*), 2) AS block_rate
-		FROM query
-		WHERE timestamp >= $1
-		GROUP BY host
+			client AS host,
+			SUM(queries)::BIGINT AS query_count,
+			COALESCE(SUM(queries) FILTER (WHERE blocked), 0)::BIGINT AS blocked_count,
+			ROUND(100.0 * COALESCE(SUM(queries) FILTER (WHERE blocked), 0) / SUM(queries), 2) AS block_rate
+		FROM counts
+		GROUP BY client
 		ORDER BY query_count DESC
-	`, since)
+	`, arg)
 	if err != nil {
 		return nil, err
 	}
@@ -145,15 +238,57 @@ func (r *repositoryImpl) FindDomainStats(
 ) (database.DomainStats, error) {
 	var stats database.DomainStats
 
-	err := r.mngr.pool.QueryRow(ctx, `
+	counts, arg := countsSince(since)
+
+	err := r.mngr.pool.QueryRow(ctx, counts+`
 		SELECT
-			COUNT(DISTINCT CASE WHEN blocked THEN name END) AS blocked_count,
+			COUNT(DISTINCT name) FILTER (WHERE blocked) AS blocked_count,
 			COUNT(DISTINCT name) AS total
+		FROM counts
+	`, arg).Scan(&stats.BlockedCount, &stats.Total)
+
+	return stats, err
+}
+
+func (r *repositoryImpl) FindTypeCounts(
+	ctx context.Context,
+	since time.Time,
+) ([]database.KeyCount, error) {
+	return r.findCountsBy(ctx, "type", since)
+}
+
+func (r *repositoryImpl) FindRcodeCounts(
+	ctx context.Context,
+	since time.Time,
+) ([]database.KeyCount, error) {
+	return r.findCountsBy(ctx, "rcode", since)
+}
+
+// findCountsBy counts the queries made after since by value of column, which
+// must not come from user input.
+func (r *repositoryImpl) findCountsBy(
+	ctx context.Context,
+	column string,
+	since time.Time,
+) ([]database.KeyCount, error) {
+	rows, err := r.mngr.pool.Query(ctx, fmt.Sprintf(`
+		SELECT %s AS key, COUNT(*) AS count
 		FROM query
 		WHERE timestamp >= $1
-	`, since).Scan(&stats.BlockedCount, &stats.Total)
+		GROUP BY key
+		ORDER BY count DESC
+	`, column), since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	return stats, err
+	res, err := pgx.CollectRows(rows, pgx.RowToStructByName[database.KeyCount])
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
 }
 
 func (r *repositoryImpl) FindTopDomains(
@@ -162,14 +297,16 @@ func (r *repositoryImpl) FindTopDomains(
 	since time.Time,
 	limit int,
 ) ([]database.TopDomain, error) {
-	rows, err := r.mngr.pool.Query(ctx, `
-		SELECT name, COUNT(*) AS cnt
-		FROM query
-		WHERE blocked = $1 AND timestamp >= $2
+	counts, arg := countsSince(since)
+
+	rows, err := r.mngr.pool.Query(ctx, counts+`
+		SELECT name AS domain, SUM(queries)::BIGINT AS count
+		FROM counts
+		WHERE blocked = $2
 		GROUP BY name
-		ORDER BY cnt DESC
+		ORDER BY count DESC
 		LIMIT $3
-	`, blocked, since, limit)
+	`, arg, blocked, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -183,6 +320,34 @@ func (r *repositoryImpl) FindTopDomains(
 	return res, nil
 }
 
+func (r *repositoryImpl) FindStorageStats(ctx context.Context) (database.StorageStats, error) {
+	stats := database.StorageStats{Retention: r.mngr.retention}
+
+	// The size of a partitioned table is the one of its partitions
+	size := `(
+		SELECT COALESCE(SUM(pg_total_relation_size(inhrelid)), 0)
+		FROM pg_inherits
+		WHERE inhparent = 'query'::regclass
+	)`
+	for _, rollup := range database.Rollups {
+		size += fmt.Sprintf(" + pg_total_relation_size('%s')", rollup.Table)
+	}
+
+	var oldest *time.Time
+	err := r.mngr.pool.QueryRow(ctx, fmt.Sprintf(`
+		SELECT (%s)::BIGINT, (SELECT MIN(timestamp) FROM query)
+	`, size)).Scan(&stats.Bytes, &oldest)
+	if err != nil {
+		return stats, err
+	}
+
+	if oldest != nil {
+		stats.Oldest = localTime(*oldest)
+	}
+
+	return stats, nil
+}
+
 func (r *repositoryImpl) FindDomainDetailsPoints(
 	ctx context.Context,
 	name string,
@@ -0,0 +1,136 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"gohole/internal/database"
+	"log/slog"
+	"time"
+)
+
+const (
+	// rollupInterval is how often the rollups are refreshed.
+	rollupInterval = time.Minute
+	// rollupDelay is how long the queries are left out of the rollups, so that
+	// the ones being saved are not missed.
+	rollupDelay = time.Minute
+	// rollupLockID is the advisory lock held while refreshing the rollups, so
+	// that instances sharing the database do not count the queries twice.
+	rollupLockID = 0x60401e
+)
+
+// rollupJob refreshes the rollup tables incrementally: each refresh counts
+// the queries made since the previous one.
+type rollupJob struct {
+	mngr *Manager
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	l      *slog.Logger
+}
+
+func newRollupJob(manager *Manager) *rollupJob {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &rollupJob{
+		mngr:   manager,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		l:      slog.With("component", "pg-rollup"),
+	}
+}
+
+func (j *rollupJob) ID() string {
+	return "Postgres-rollup"
+}
+
+func (j *rollupJob) Start() error {
+	defer close(j.done)
+
+	j.l.Info("Started Postgres rollup job", "interval", rollupInterval)
+
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, rollup := range database.Rollups {
+			if err := j.refresh(rollup); err != nil {
+				j.l.Error("Refreshing rollup", "rollup", rollup.Table, "error", err)
+			}
+		}
+
+		select {
+		case <-j.ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *rollupJob) Stop() error {
+	j.l.Info("Stopping Postgres rollup job")
+	j.cancel()
+	<-j.done
+	return nil
+}
+
+// refresh adds to rollup the queries made since its previous refresh, or
+// since the beginning on the first one, up to the start of the bucket
+// rollupDelay ago.
+func (j *rollupJob) refresh(rollup database.Rollup) error {
+	until := rollup.Start(time.Now().Add(-rollupDelay))
+
+	tx, err := j.mngr.pool.Begin(j.ctx)
+	if err != nil {
+		return fmt.Errorf("postgres: cannot begin rollup refresh: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(context.Background())
+	}()
+
+	if _, err := tx.Exec(j.ctx, "SELECT pg_advisory_xact_lock($1)", rollupLockID); err != nil {
+		return fmt.Errorf("postgres: cannot lock rollups: %w", err)
+	}
+
+	// Clients sharing an address are told apart by their ID. Buckets refreshed
+	// in several times, e.g. when until is not aligned in local time, add up.
+	tag, err := tx.Exec(j.ctx, fmt.Sprintf(`
+		INSERT INTO %[1]s (time, client, name, blocked, queries)
+		SELECT
+			date_bin($1, timestamp, TIMESTAMP '1970-01-01'),
+			COALESCE(NULLIF(client_id, ''), host, ''),
+			COALESCE(name, ''),
+			COALESCE(blocked, FALSE),
+			COUNT(*)
+		FROM query
+		WHERE timestamp < $2 AND timestamp >= COALESCE(
+			(SELECT refreshed_until FROM query_rollup_state WHERE rollup = $3),
+			'-infinity'
+		)
+		GROUP BY 1, 2, 3, 4
+		ON CONFLICT (time, client, name, blocked)
+			DO UPDATE SET queries = %[1]s.queries + EXCLUDED.queries
+	`, rollup.Table), rollup.Resolution, until, rollup.Table)
+	if err != nil {
+		return fmt.Errorf("postgres: cannot refresh rollup: %w", err)
+	}
+
+	_, err = tx.Exec(j.ctx, `
+		INSERT INTO query_rollup_state (rollup, refreshed_until)
+		VALUES ($1, $2)
+		ON CONFLICT (rollup) DO UPDATE
+			SET refreshed_until = GREATEST(query_rollup_state.refreshed_until, EXCLUDED.refreshed_until)
+	`, rollup.Table, until)
+	if err != nil {
+		return fmt.Errorf("postgres: cannot save rollup state: %w", err)
+	}
+
+	if err := tx.Commit(j.ctx); err != nil {
+		return fmt.Errorf("postgres: cannot commit rollup refresh: %w", err)
+	}
+
+	j.l.Debug("Refreshed rollup", "rollup", rollup.Table, "until", until, "rows", tag.RowsAffected())
+	return nil
+}
@@ -0,0 +1,73 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"gohole/internal/database"
+)
+
+type sourceRepositoryImpl struct {
+	mngr *Manager
+}
+
+func NewSourceRepository(manager *Manager) database.SourceRepository {
+	return &sourceRepositoryImpl{
+		mngr: manager,
+	}
+}
+
+func (r *sourceRepositoryImpl) FindAllSources(ctx context.Context) ([]database.BlocklistSource, error) {
+	rows, err := r.mngr.pool.Query(ctx, `
+		SELECT id, name, url, enabled, created_at
+		FROM blocklist_source
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("repository: cannot fetch sources: %w", err)
+	}
+	defer rows.Close()
+
+	var sources []database.BlocklistSource
+	for rows.Next() {
+		var s database.BlocklistSource
+		if err := rows.Scan(&s.ID, &s.Name, &s.URL, &s.Enabled, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("repository: cannot scan source: %w", err)
+		}
+		sources = append(sources, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository: cannot fetch sources: %w", err)
+	}
+
+	return sources, nil
+}
+
+func (r *sourceRepositoryImpl) SaveSource(ctx context.Context, s database.BlocklistSource) error {
+	_, err := r.mngr.pool.Exec(ctx, `
+		INSERT INTO blocklist_source (id, name, url, enabled, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE
+		SET name = EXCLUDED.name, url = EXCLUDED.url, enabled = EXCLUDED.enabled
+	`,
+		s.ID,
+		s.Name,
+		s.URL,
+		s.Enabled,
+		s.CreatedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("repository: save source failed: %w", err)
+	}
+
+	return nil
+}
+
+func (r *sourceRepositoryImpl) DeleteSource(ctx context.Context, id string) error {
+	if _, err := r.mngr.pool.Exec(ctx, `DELETE FROM blocklist_source WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("repository: delete source failed: %w", err)
+	}
+
+	return nil
+}
@@ -1,6 +1,6 @@
 package database
 
-//go:generate go tool go.uber.org/mock/mockgen -destination=../mock/database/repository.go -typed -package mockrepo gohole/internal/database Repository
+//go:generate go tool go.uber.org/mock/mockgen -destination=../mock/database/repository.go -typed -package mockrepo gohole/internal/database Repository,SourceRepository
 
 import (
 	"context"
@@ -9,16 +9,27 @@ import (
 
 type Repository interface {
 	SaveQuery(ctx context.Context, q Query) error
-	FindAll(ctx context.Context) ([]Query, error)
 	// FindAllLimit retrieves all queries from the database with an optional limit and name filter.
 	// If `limit` is greater than 0, it limits the number of results returned. If `name` is not empty,
 	// it filters the results to include only queries with the specified name.
 	FindAllLimit(ctx context.Context, limit int, name string) ([]Query, error)
-	// FindAllByInterval retrieves all queries from the database that were made
-	// after the specified `since`.
-	FindAllByInterval(ctx context.Context, since time.Time) ([]Query, error)
+	// FindQueryCounts counts the queries made after since, and the blocked ones.
+	// The queries of all time are counted if since is zero.
+	FindQueryCounts(ctx context.Context, since time.Time) (QueryCounts, error)
+	// FindHistoryPoints counts the blocked and allowed queries made after since,
+	// in buckets of the given granularity aligned on the Unix epoch. Buckets
+	// without queries are omitted.
+	FindHistoryPoints(
+		ctx context.Context,
+		since time.Time,
+		granularity time.Duration,
+	) ([]HistoryPoint, error)
 	FindHostStats(ctx context.Context, since time.Time) ([]HostStat, error)
 	FindDomainStats(ctx context.Context, since time.Time) (DomainStats, error)
+	// FindTypeCounts and FindRcodeCounts count the queries made after since by
+	// question type and by response code, the most frequent first.
+	FindTypeCounts(ctx context.Context, since time.Time) ([]KeyCount, error)
+	FindRcodeCounts(ctx context.Context, since time.Time) ([]KeyCount, error)
 	FindTopDomains(
 		ctx context.Context,
 		blocked bool,
@@ -31,7 +42,20 @@ type Repository interface {
 		since time.Time,
 		granularity time.Duration,
 	) ([]Point, error)
+	// FindStorageStats returns the disk space used by the queries and the time
+	// of the oldest one.
+	FindStorageStats(ctx context.Context) (StorageStats, error)
 	// Close flushes any buffered writes and stops the background batch worker.
 	// Call this on application shutdown.
 	Close() error
 }
+
+// SourceRepository stores the blocklist sources.
+type SourceRepository interface {
+	// FindAllSources retrieves all the sources, oldest first.
+	FindAllSources(ctx context.Context) ([]BlocklistSource, error)
+	// SaveSource inserts a source, or updates it if a source with the same ID exists.
+	SaveSource(ctx context.Context, s BlocklistSource) error
+	// DeleteSource deletes the source with the given ID, if any.
+	DeleteSource(ctx context.Context, id string) error
+}
@@ -0,0 +1,55 @@
+package database
+
+import "time"
+
+// minRollupBuckets is the number of buckets a period must span to be read from
+// a rollup. The queries of the first bucket, if the period starts in its
+// middle, are counted from the query table, which is worth it for long periods
+// only.
+const minRollupBuckets = 24
+
+// Rollup is a table of pre-aggregated query counts: the number of queries per
+// time bucket of the given resolution, by client, domain and blocked flag.
+type Rollup struct {
+	Table      string
+	Resolution time.Duration
+}
+
+var (
+	RollupMinute = Rollup{Table: "query_rollup_1m", Resolution: time.Minute}
+	RollupHour   = Rollup{Table: "query_rollup_1h", Resolution: time.Hour}
+
+	// Rollups are the rollups maintained by the backends, the finest first.
+	Rollups = []Rollup{RollupMinute, RollupHour}
+)
+
+// ChooseRollup returns the coarsest rollup in which the period from since to
+// now spans at least minRollupBuckets buckets. The boolean is false if the
+// period is too short for any rollup, and the queries must be counted one by one.
+func ChooseRollup(since, now time.Time) (Rollup, bool) {
+	period := now.Sub(since)
+
+	for i := len(Rollups) - 1; i >= 0; i-- {
+		if period >= minRollupBuckets*Rollups[i].Resolution {
+			return Rollups[i], true
+		}
+	}
+
+	return Rollup{}, false
+}
+
+// Start returns the start of the bucket of the rollup holding t.
+func (r Rollup) Start(t time.Time) time.Time {
+	return t.Truncate(r.Resolution)
+}
+
+// Ceil returns the start of the first bucket of the rollup starting at t or
+// after it. The queries made from t until then are not in a whole bucket.
+func (r Rollup) Ceil(t time.Time) time.Time {
+	start := r.Start(t)
+	if start.Before(t) {
+		return start.Add(r.Resolution)
+	}
+
+	return start
+}
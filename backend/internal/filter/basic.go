@@ -1,21 +1,29 @@
 package filter
 
-type BasicFilter map[string]struct{}
+// BasicFilter maps each domain to the index of its first occurrence in the
+// slice it was built from.
+type BasicFilter map[string]int32
 
 var _ Filter = (BasicFilter)(nil)
 
 func NewBasic(domains []string) Filter {
 	f := make(BasicFilter)
-	for _, d := range domains {
-		f[d] = struct{}{}
+	for i, d := range domains {
+		if _, ok := f[d]; !ok {
+			f[d] = int32(i)
+		}
 	}
 
 	return f
 }
 
-func (f BasicFilter) Filter(q string) (bool, error) {
-	_, ok := f[q]
-	return ok, nil
+func (f BasicFilter) Filter(r Request) (*Match, error) {
+	entry, ok := f[r.Name]
+	if !ok {
+		return nil, nil
+	}
+
+	return exactMatch(r.Name, int(entry)), nil
 }
 
 func (f BasicFilter) Size() int {
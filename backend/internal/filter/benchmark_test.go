@@ -32,7 +32,7 @@ func runBenchmark(b *testing.B, factory func([]string) filter.Filter, domains []
 	for b.Loop() {
 		f := factory(domains)
 		for _, d := range domains {
-			_, err := f.Filter(d)
+			_, err := f.Filter(filter.Request{Name: d})
 			if err != nil {
 				b.Fatalf("error filtering domain: %v", err)
 			}
@@ -54,4 +54,7 @@ func BenchmarkFilter(b *testing.B) {
 	b.Run("Trie2Filter", func(b *testing.B) {
 		runBenchmark(b, filter.NewTrie2, domains)
 	})
+	b.Run("SuffixFilter", func(b *testing.B) {
+		runBenchmark(b, filter.NewSuffix, domains)
+	})
 }
@@ -0,0 +1,116 @@
+package filter
+
+import "slices"
+
+// ScopedFilter is implemented by filters whose result may depend on the client
+// that sent the request.
+type ScopedFilter interface {
+	// ClientScoped returns true if a rule restricted to some clients matches the
+	// given name, whatever the client is.
+	ClientScoped(name string) bool
+}
+
+// IsClientScoped returns true if f is a ScopedFilter and its result for the given
+// name depends on the client.
+func IsClientScoped(f Filter, name string) bool {
+	sf, ok := f.(ScopedFilter)
+	return ok && sf.ClientScoped(name)
+}
+
+// CompositeFilter looks up literal domains in fast Filters, and only evaluates
+// the pattern rules when no literal lookup matches.
+type CompositeFilter struct {
+	literals []Filter
+	rules    []Rule
+	// overrides are rules that prevent the filter from matching, e.g. important
+	// block rules on the allow side.
+	overrides []Rule
+	// important holds the rules flagged as important, which match ahead of the
+	// overrides, e.g. important exceptions over important block rules.
+	important []Rule
+	// scoped holds the rules and overrides restricted to some clients.
+	scoped []Rule
+}
+
+var (
+	_ Filter       = (*CompositeFilter)(nil)
+	_ ScopedFilter = (*CompositeFilter)(nil)
+)
+
+func NewComposite(literals []Filter, rules []Rule, overrides []Rule) Filter {
+	if len(literals) == 1 && len(rules) == 0 && len(overrides) == 0 {
+		// Nothing to add on top of the literal filter
+		return literals[0]
+	}
+
+	f := &CompositeFilter{
+		literals:  literals,
+		rules:     rules,
+		overrides: overrides,
+	}
+
+	for _, r := range slices.Concat(rules, overrides) {
+		if r.ClientScoped() {
+			f.scoped = append(f.scoped, r)
+		}
+	}
+	for _, r := range rules {
+		if r.Modifiers.Important {
+			f.important = append(f.important, r)
+		}
+	}
+
+	return f
+}
+
+func (f *CompositeFilter) Filter(r Request) (*Match, error) {
+	for _, rule := range f.important {
+		if rule.Match(r) {
+			return rule.match(r), nil
+		}
+	}
+
+	for _, o := range f.overrides {
+		if o.Match(r) {
+			return nil, nil
+		}
+	}
+
+	for _, l := range f.literals {
+		m, err := l.Filter(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if m != nil {
+			return m, nil
+		}
+	}
+
+	for _, rule := range f.rules {
+		if rule.Match(r) {
+			return rule.match(r), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (f *CompositeFilter) ClientScoped(name string) bool {
+	for _, r := range f.scoped {
+		if r.matchName(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *CompositeFilter) Size() int {
+	size := len(f.rules)
+	for _, l := range f.literals {
+		size += l.Size()
+	}
+
+	return size
+}
@@ -10,12 +10,27 @@ const (
 	BasicStrategy Strategy = "basic"
 	TrieStrategy  Strategy = "trie"
 	Trie2Strategy Strategy = "trie2"
+	// SuffixStrategy matches a query if it or any of its parent domains is listed.
+	SuffixStrategy Strategy = "suffix"
 )
 
+// Request describes the DNS question being filtered.
+type Request struct {
+	// Name is the queried domain, without the trailing dot.
+	Name string
+	// Client is the address of the client that sent the question.
+	Client string
+	// ClientID is the ID the client identified itself with over DNS-over-TLS
+	// or DNS-over-HTTPS, if any.
+	ClientID string
+	// Type is the type of the question (e.g. dns.TypeA).
+	Type uint16
+}
+
 type Filter interface {
-	// Filter returns true if the filter contains the query, false otherwise.
-	// An error is returned if there was an issue checking the filter.
-	Filter(q string) (bool, error)
+	// Filter returns the entry matching the request, or nil if the filter does
+	// not contain it. An error is returned if there was an issue checking the filter.
+	Filter(r Request) (*Match, error)
 	// Size returns the number of entries in the filter
 	Size() int
 }
@@ -28,6 +43,8 @@ func NewFilter(strategy Strategy, domains []string) Filter {
 		return NewTrie(domains)
 	case Trie2Strategy:
 		return NewTrie2(domains)
+	case SuffixStrategy:
+		return NewSuffix(domains)
 	default:
 		slog.Warn("unknown filter strategy, defaulting to basic", "strategy", strategy)
 		return NewBasic(domains)
@@ -44,8 +61,8 @@ func NewTrie(domains []string) Filter {
 
 	addedDomains := 0
 
-	for _, d := range domains {
-		if err := root.Add(d); err != nil {
+	for i, d := range domains {
+		if err := root.add(d+"\x00", i); err != nil {
 			slog.Error("cannot add domain to trie", "domain", d, "error", err)
 		} else {
 			addedDomains++
@@ -58,13 +75,13 @@ func NewTrie(domains []string) Filter {
 	}
 }
 
-func (f *TrieFilter) Filter(q string) (bool, error) {
-	found, err := f.root.Contains(q)
-	if err != nil {
-		return false, err
+func (f *TrieFilter) Filter(r Request) (*Match, error) {
+	node := f.root.lookup(r.Name + "\x00")
+	if node == nil {
+		return nil, nil
 	}
 
-	return found, nil
+	return exactMatch(r.Name, node.entry), nil
 }
 
 func (f *TrieFilter) Size() int {
@@ -21,19 +21,130 @@ func TestFilters(t *testing.T) {
 	t.Run("trie2", func(t *testing.T) {
 		testFilter(t, filter.NewTrie2(testDomains))
 	})
+	t.Run("suffix", func(t *testing.T) {
+		testFilter(t, filter.NewSuffix(testDomains))
+	})
+}
+
+func TestSuffixFilter_MatchesSubdomains(t *testing.T) {
+	f := filter.NewSuffix(testDomains)
+
+	for _, domain := range []string{"ad.example.com", "a.b.example.com", "x.sub.domain.com"} {
+		blocked, err := f.Filter(filter.Request{Name: domain})
+		assert(t, err == nil, "unexpected error filtering domain: "+domain)
+		assert(t, blocked != nil, "subdomain should be blocked: "+domain)
+	}
+
+	// Parents and siblings of a listed domain must not match
+	for _, domain := range []string{"domain.com", "com", "other.domain.com", "notexample.com", ""} {
+		blocked, err := f.Filter(filter.Request{Name: domain})
+		assert(t, err == nil, "unexpected error filtering domain: "+domain)
+		assert(t, blocked == nil, "domain should be allowed: "+domain)
+	}
+}
+
+func TestSuffixFilter_SizeIgnoresDuplicates(t *testing.T) {
+	f := filter.NewSuffix([]string{"example.com", "example.com.", "ads.example.com"})
+	assert(t, f.Size() == 2, "unexpected filter size")
 }
 
 func testFilter(t *testing.T, f filter.Filter) {
 	assert(t, f.Size() == len(testDomains), "unexpected filter size")
 	for _, domain := range testDomains {
-		blocked, err := f.Filter(domain)
+		blocked, err := f.Filter(filter.Request{Name: domain})
 		assert(t, err == nil, "unexpected error filtering domain: "+domain)
-		assert(t, blocked, "domain should be blocked: "+domain)
+		assert(t, blocked != nil, "domain should be blocked: "+domain)
 	}
 
-	blocked, err := f.Filter("allowed.com")
+	blocked, err := f.Filter(filter.Request{Name: "allowed.com"})
 	assert(t, err == nil, "unexpected error filtering domain: allowed.com")
-	assert(t, !blocked, "domain should be allowed: allowed.com")
+	assert(t, blocked == nil, "domain should be allowed: allowed.com")
+}
+
+func TestCompositeFilter(t *testing.T) {
+	rule, err := filter.NewRegexRule("/^ads?[0-9]*\\./", `^ads?[0-9]*\.`)
+	assert(t, err == nil, "unexpected error compiling rule")
+
+	f := filter.NewComposite([]filter.Filter{filter.NewBasic(testDomains)}, []filter.Rule{rule}, nil)
+	assert(t, f.Size() == len(testDomains)+1, "unexpected filter size")
+
+	for _, domain := range []string{"example.com", "ad.tracker.net", "ads42.foo.org"} {
+		blocked, err := f.Filter(filter.Request{Name: domain})
+		assert(t, err == nil, "unexpected error filtering domain: "+domain)
+		assert(t, blocked != nil, "domain should be blocked: "+domain)
+	}
+
+	blocked, err := f.Filter(filter.Request{Name: "bads.com"})
+	assert(t, err == nil, "unexpected error filtering domain: bads.com")
+	assert(t, blocked == nil, "domain should be allowed: bads.com")
+}
+
+func TestCompositeFilter_NoRules(t *testing.T) {
+	f := filter.NewComposite([]filter.Filter{filter.NewBasic(testDomains)}, nil, nil)
+	_, isBasic := f.(filter.BasicFilter)
+	assert(t, isBasic, "expected the literal filter to be returned as is")
+}
+
+func TestMatch_Provenance(t *testing.T) {
+	var sources filter.Sources
+	sources.Add("list-a", 1)
+	sources.Add("list-b", 2)
+
+	rule, err := filter.NewRegexRule("/^ads?[0-9]*\\./", `^ads?[0-9]*\.`)
+	assert(t, err == nil, "unexpected error compiling rule")
+	rule.List = "list-c"
+
+	domainRule := filter.NewDomainRule("||tracker.net^$client=10.0.0.1", "tracker.net", true)
+	domainRule.Modifiers.Clients = []string{"10.0.0.1"}
+
+	f := filter.NewComposite(
+		[]filter.Filter{
+			filter.WithSources(filter.NewBasic(testDomains), &sources),
+			filter.NewSuffix([]string{"suffix.com"}),
+		},
+		[]filter.Rule{rule, domainRule},
+		nil,
+	)
+
+	cases := []struct {
+		name string
+		want filter.Match
+	}{
+		{"example.com", filter.Match{List: "list-a", Rule: "example.com", Kind: filter.MatchExact}},
+		{"sub.domain.com", filter.Match{List: "list-b", Rule: "sub.domain.com", Kind: filter.MatchExact}},
+		{"a.suffix.com", filter.Match{Rule: "suffix.com", Kind: filter.MatchSuffix}},
+		{"ads1.foo.org", filter.Match{List: "list-c", Rule: rule.Text, Kind: filter.MatchRegex}},
+		{"x.tracker.net", filter.Match{Rule: domainRule.Text, Kind: filter.MatchSuffix}},
+	}
+
+	for _, c := range cases {
+		m, err := f.Filter(filter.Request{Name: c.name, Client: "10.0.0.1"})
+		assert(t, err == nil, "unexpected error filtering domain: "+c.name)
+		assert(t, m != nil, "domain should be blocked: "+c.name)
+		got := filter.Match{List: m.List, Rule: m.Rule, Kind: m.Kind}
+		assert(t, got == c.want, "unexpected match for "+c.name)
+	}
+}
+
+func TestSources(t *testing.T) {
+	var a, b filter.Sources
+	a.Add("x", 2)
+	b.Add("y", 1)
+	b.Add("y", 1)
+
+	a.Append(&b, 3)
+	a.Append(&filter.Sources{}, 1)
+
+	for entry, want := range []string{"x", "x", "y", "y", "", ""} {
+		assert(t, a.ID(entry) == want, "unexpected list for entry")
+	}
+	assert(t, a.Len() == 6, "unexpected number of entries")
+	assert(t, a.ID(6) == "", "expected no list past the last entry")
+}
+
+func TestNewRegexRule_Invalid(t *testing.T) {
+	_, err := filter.NewRegexRule("/[a/", "[a")
+	assert(t, err != nil, "expected error for invalid regex")
 }
 
 func assert(t *testing.T, condition bool, message string) {
@@ -0,0 +1,126 @@
+package filter
+
+import "sort"
+
+// MatchKind tells how a request matched a filter entry.
+type MatchKind string
+
+const (
+	// MatchExact means the requested name is listed.
+	MatchExact MatchKind = "exact"
+	// MatchSuffix means a parent domain of the requested name is listed.
+	MatchSuffix MatchKind = "suffix"
+	// MatchRegex means the requested name matches a regex or wildcard rule.
+	MatchRegex MatchKind = "regex"
+)
+
+// Match describes the entry a request matched.
+type Match struct {
+	// List is the ID of the list the entry comes from (e.g. its URL), empty if unknown.
+	List string `json:"list"`
+	// Rule is the matched entry: the listed domain, or the rule as it was written.
+	Rule string    `json:"rule"`
+	Kind MatchKind `json:"kind"`
+
+	// entry is the index of a literal entry in the slice the filter was built from.
+	entry int
+}
+
+// Sources tells which list each entry of a slice of domains comes from. As
+// lists are appended one after the other, each list spans a range of entries.
+// The zero value attributes no entry.
+type Sources struct {
+	ids []string
+	// ends holds the exclusive end of the range of each list.
+	ends []int
+}
+
+// Len returns the number of attributed entries.
+func (s *Sources) Len() int {
+	if len(s.ends) == 0 {
+		return 0
+	}
+
+	return s.ends[len(s.ends)-1]
+}
+
+// Add attributes the next n entries to the list with the given ID.
+func (s *Sources) Add(id string, n int) {
+	if n <= 0 {
+		return
+	}
+
+	end := s.Len() + n
+	if len(s.ids) > 0 && s.ids[len(s.ids)-1] == id {
+		s.ends[len(s.ends)-1] = end
+		return
+	}
+
+	s.ids = append(s.ids, id)
+	s.ends = append(s.ends, end)
+}
+
+// Append attributes the next n entries like other does. Entries other does not
+// attribute are attributed to no list.
+func (s *Sources) Append(other *Sources, n int) {
+	start := 0
+	for i, end := range other.ends {
+		s.Add(other.ids[i], end-start)
+		start = end
+	}
+
+	s.Add("", n-start)
+}
+
+// ID returns the ID of the list the entry with the given index comes from.
+func (s *Sources) ID(entry int) string {
+	i := sort.SearchInts(s.ends, entry+1)
+	if entry < 0 || i == len(s.ends) {
+		return ""
+	}
+
+	return s.ids[i]
+}
+
+// SourcedFilter attributes the matches of a filter, built out of a slice of
+// domains, to the lists the domains come from.
+type SourcedFilter struct {
+	f       Filter
+	sources *Sources
+}
+
+var _ Filter = (*SourcedFilter)(nil)
+
+// WithSources returns f, with its matches attributed according to sources.
+func WithSources(f Filter, sources *Sources) Filter {
+	if sources == nil || sources.Len() == 0 {
+		return f
+	}
+
+	return &SourcedFilter{
+		f:       f,
+		sources: sources,
+	}
+}
+
+func (f *SourcedFilter) Filter(r Request) (*Match, error) {
+	m, err := f.f.Filter(r)
+	if m != nil {
+		m.List = f.sources.ID(m.entry)
+	}
+
+	return m, err
+}
+
+func (f *SourcedFilter) Size() int {
+	return f.f.Size()
+}
+
+// exactMatch returns the match of the literal entry with the given index.
+func exactMatch(domain string, entry int) *Match {
+	return &Match{
+		Rule:  domain,
+		Kind:  MatchExact,
+		entry: entry,
+	}
+}
@@ -0,0 +1,154 @@
+package filter
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Modifiers restrict the requests a rule applies to. The zero value applies the
+// rule to every request.
+type Modifiers struct {
+	// Important rules cannot be overridden by allow entries.
+	Important bool
+	// Clients restricts the rule to the given clients. Each entry is either an IP
+	// address, a CIDR prefix or a client name, matched against the client ID.
+	Clients []string
+	// ExcludedClients excludes the given clients from the rule.
+	ExcludedClients []string
+	// DNSTypes restricts the rule to the given question types.
+	DNSTypes []uint16
+	// ExcludedDNSTypes excludes the given question types from the rule.
+	ExcludedDNSTypes []uint16
+}
+
+// Rule is a list entry that cannot be matched with a literal lookup, such as a
+// regular expression, a wildcard or a domain restricted by modifiers.
+type Rule struct {
+	// Text is the rule as it was written in the list.
+	Text string
+	// List is the ID of the list the rule comes from, empty if unknown.
+	List      string
+	Modifiers Modifiers
+
+	re *regexp.Regexp
+	// domain is set for rules matching a domain name rather than a regex.
+	domain string
+	// subdomains is true if a domain rule matches the subdomains too.
+	subdomains bool
+}
+
+// NewRegexRule compiles expr into a rule. text is the original list entry, kept
+// for logging purposes.
+func NewRegexRule(text string, expr string) (Rule, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Rule{}, fmt.Errorf("filter: invalid rule '%s': %w", text, err)
+	}
+
+	return Rule{
+		Text: text,
+		re:   re,
+	}, nil
+}
+
+// NewDomainRule creates a rule matching the given domain and, if subdomains is
+// true, all of its subdomains.
+func NewDomainRule(text string, domain string, subdomains bool) Rule {
+	return Rule{
+		Text:       text,
+		domain:     strings.TrimSuffix(domain, "."),
+		subdomains: subdomains,
+	}
+}
+
+// Match returns true if the rule matches the given request.
+func (r Rule) Match(req Request) bool {
+	return r.matchName(req.Name) && r.matchClient(req) && r.matchType(req.Type)
+}
+
+// match returns the match of a request the rule matches.
+func (r Rule) match(req Request) *Match {
+	kind := MatchRegex
+	if r.re == nil {
+		kind = MatchExact
+		if strings.TrimSuffix(req.Name, ".") != r.domain {
+			kind = MatchSuffix
+		}
+	}
+
+	return &Match{
+		List: r.List,
+		Rule: r.Text,
+		Kind: kind,
+	}
+}
+
+// ClientScoped returns true if the rule applies only to some clients.
+func (r Rule) ClientScoped() bool {
+	return len(r.Modifiers.Clients) > 0 || len(r.Modifiers.ExcludedClients) > 0
+}
+
+func (r Rule) matchName(name string) bool {
+	if r.re != nil {
+		return r.re.MatchString(name)
+	}
+
+	name = strings.TrimSuffix(name, ".")
+	if name == r.domain {
+		return true
+	}
+
+	return r.subdomains && strings.HasSuffix(name, "."+r.domain)
+}
+
+func (r Rule) matchClient(req Request) bool {
+	if slices.ContainsFunc(r.Modifiers.ExcludedClients, func(c string) bool {
+		return clientMatches(c, req)
+	}) {
+		return false
+	}
+
+	if len(r.Modifiers.Clients) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(r.Modifiers.Clients, func(c string) bool {
+		return clientMatches(c, req)
+	})
+}
+
+func (r Rule) matchType(t uint16) bool {
+	if slices.Contains(r.Modifiers.ExcludedDNSTypes, t) {
+		return false
+	}
+
+	return len(r.Modifiers.DNSTypes) == 0 || slices.Contains(r.Modifiers.DNSTypes, t)
+}
+
+// clientMatches returns true if the client of req matches the pattern, which is
+// either a CIDR prefix or an IP address matched against its address, or a client
+// name matched against its ID.
+func clientMatches(pattern string, req Request) bool {
+	if strings.Contains(pattern, "/") {
+		prefix, err := netip.ParsePrefix(pattern)
+		if err != nil {
+			return false
+		}
+		addr, err := netip.ParseAddr(req.Client)
+		if err != nil {
+			return false
+		}
+		return prefix.Contains(addr.Unmap())
+	}
+
+	if want, err := netip.ParseAddr(pattern); err == nil {
+		addr, err := netip.ParseAddr(req.Client)
+		return err == nil && addr.Unmap() == want.Unmap()
+	}
+
+	// Client IDs are host labels, compared regardless of case
+	return req.ClientID != "" && strings.EqualFold(pattern, req.ClientID)
+}
@@ -0,0 +1,101 @@
+package filter
+
+import "strings"
+
+// labelNode is a node of a trie keyed by domain labels.
+type labelNode struct {
+	children map[string]*labelNode
+	// terminal is true if a listed domain ends at this node.
+	terminal bool
+	// entry is the index of the listed domain, for the terminal nodes.
+	entry int32
+}
+
+func newLabelNode() *labelNode {
+	return &labelNode{
+		children: make(map[string]*labelNode),
+	}
+}
+
+// SuffixFilter stores domains by reversed label (e.g. "ads.example.com" is stored
+// as com -> example -> ads), so that a query matches if it or any of its parent
+// domains is listed.
+type SuffixFilter struct {
+	root *labelNode
+	size int
+}
+
+var _ Filter = (*SuffixFilter)(nil)
+
+func NewSuffix(domains []string) Filter {
+	f := &SuffixFilter{
+		root: newLabelNode(),
+	}
+
+	for i, d := range domains {
+		f.add(d, i)
+	}
+
+	return f
+}
+
+func (f *SuffixFilter) add(domain string, entry int) {
+	domain = strings.TrimSuffix(domain, ".")
+	if domain == "" {
+		return
+	}
+
+	node := f.root
+	labels := strings.Split(domain, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		child, ok := node.children[labels[i]]
+		if !ok {
+			child = newLabelNode()
+			node.children[labels[i]] = child
+		}
+		node = child
+	}
+
+	if !node.terminal {
+		node.terminal = true
+		node.entry = int32(entry)
+		f.size++
+	}
+}
+
+// Filter matches if the requested name or any of its parent domains is in the filter.
+func (f *SuffixFilter) Filter(r Request) (*Match, error) {
+	return f.lookup(r.Name), nil
+}
+
+// lookup returns the match of the closest listed parent of q, q included.
+func (f *SuffixFilter) lookup(q string) *Match {
+	q = strings.TrimSuffix(q, ".")
+
+	node := f.root
+	// Walk the labels from the rightmost one, without allocating a slice.
+	for end := len(q); end > 0; {
+		start := strings.LastIndexByte(q[:end], '.') + 1
+
+		child, ok := node.children[q[start:end]]
+		if !ok {
+			return nil
+		}
+		if child.terminal {
+			m := exactMatch(q[start:], int(child.entry))
+			if start > 0 {
+				m.Kind = MatchSuffix
+			}
+			return m
+		}
+
+		node = child
+		end = start - 1
+	}
+
+	return nil
+}
+
+func (f *SuffixFilter) Size() int {
+	return f.size
+}
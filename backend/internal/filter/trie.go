@@ -2,6 +2,9 @@ package filter
 
 type TrieNode struct {
 	children map[rune]*TrieNode
+	// entry is the index of the first string ending at this node, for the
+	// terminal nodes.
+	entry int
 }
 
 func NewTrieNode() *TrieNode {
@@ -11,10 +14,10 @@ func NewTrieNode() *TrieNode {
 }
 
 func (n *TrieNode) Add(s string) error {
-	return n.add(s + "\x00") // Append null character to mark the end of the string.
+	return n.add(s+"\x00", 0) // Append null character to mark the end of the string.
 }
 
-func (n *TrieNode) add(s string) error {
+func (n *TrieNode) add(s string, entry int) error {
 	if s == "" {
 		// Finish adding the string
 		return nil
@@ -24,18 +27,33 @@ func (n *TrieNode) add(s string) error {
 	if !ok {
 		// Create a new child node if it doesn't exist
 		child := NewTrieNode()
+		child.entry = entry
 		n.children[rune(s[0])] = child
 	}
 
 	child := n.children[rune(s[0])]
 
-	return child.add(s[1:])
+	return child.add(s[1:], entry)
 }
 
 func (n *TrieNode) Contains(s string) (bool, error) {
 	return n.contains(s + "\x00")
 }
 
+// lookup returns the node where s ends, or nil if s was not added.
+func (n *TrieNode) lookup(s string) *TrieNode {
+	if s == "" {
+		return n
+	}
+
+	child, ok := n.children[rune(s[0])]
+	if !ok {
+		return nil
+	}
+
+	return child.lookup(s[1:])
+}
+
 func (n *TrieNode) contains(s string) (bool, error) {
 	if s == "" {
 		return true, nil
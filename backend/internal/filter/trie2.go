@@ -9,8 +9,10 @@ type Trie2Filter struct {
 
 func NewTrie2(domains []string) Filter {
 	t := trie.NewRuneTrie()
-	for _, d := range domains {
-		t.Put(d, struct{}{})
+	for i, d := range domains {
+		if t.Get(d) == nil {
+			t.Put(d, i)
+		}
 	}
 
 	return &Trie2Filter{
@@ -19,8 +21,13 @@ func NewTrie2(domains []string) Filter {
 	}
 }
 
-func (f *Trie2Filter) Filter(q string) (bool, error) {
-	return f.trie.Get(q) != nil, nil
+func (f *Trie2Filter) Filter(r Request) (*Match, error) {
+	entry, ok := f.trie.Get(r.Name).(int)
+	if !ok {
+		return nil, nil
+	}
+
+	return exactMatch(r.Name, entry), nil
 }
 
 func (f *Trie2Filter) Size() int {
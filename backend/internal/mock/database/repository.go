@@ -1,9 +1,9 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: gohole/internal/database (interfaces: Repository)
+// Source: gohole/internal/database (interfaces: Repository,SourceRepository)
 //
 // Generated by this command:
 //
-//	mockgen -destination=../mock/database/repository.go -typed -package mockrepo gohole/internal/database Repository
+//	mockgen -destination=../mock/database/repository.go -typed -package mockrepo gohole/internal/database Repository,SourceRepository
 //
 
 // Package mockrepo is a generated GoMock package.
@@ -80,236 +80,314 @@ func (c *MockRepositoryCloseCall) DoAndReturn(f func() error) *MockRepositoryClo
 	return c
 }
 
-// FindAll mocks base method.
-func (m *MockRepository) FindAll(ctx context.Context) ([]database.Query, error) {
+// FindAllLimit mocks base method.
+func (m *MockRepository) FindAllLimit(ctx context.Context, limit int, name string) ([]database.Query, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindAll", ctx)
+	ret := m.ctrl.Call(m, "FindAllLimit", ctx, limit, name)
 	ret0, _ := ret[0].([]database.Query)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// FindAll indicates an expected call of FindAll.
-func (mr *MockRepositoryMockRecorder) FindAll(ctx any) *MockRepositoryFindAllCall {
+// FindAllLimit indicates an expected call of FindAllLimit.
+func (mr *MockRepositoryMockRecorder) FindAllLimit(ctx, limit, name any) *MockRepositoryFindAllLimitCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindAll", reflect.TypeOf((*MockRepository)(nil).FindAll), ctx)
-	return &MockRepositoryFindAllCall{Call: call}
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindAllLimit", reflect.TypeOf((*MockRepository)(nil).FindAllLimit), ctx, limit, name)
+	return &MockRepositoryFindAllLimitCall{Call: call}
 }
 
-// MockRepositoryFindAllCall wrap *gomock.Call
-type MockRepositoryFindAllCall struct {
+// MockRepositoryFindAllLimitCall wrap *gomock.Call
+type MockRepositoryFindAllLimitCall struct {
 	*gomock.Call
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *MockRepositoryFindAllCall) Return(arg0 []database.Query, arg1 error) *MockRepositoryFindAllCall {
+func (c *MockRepositoryFindAllLimitCall) Return(arg0 []database.Query, arg1 error) *MockRepositoryFindAllLimitCall {
 	c.Call = c.Call.Return(arg0, arg1)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockRepositoryFindAllCall) Do(f func(context.Context) ([]database.Query, error)) *MockRepositoryFindAllCall {
+func (c *MockRepositoryFindAllLimitCall) Do(f func(context.Context, int, string) ([]database.Query, error)) *MockRepositoryFindAllLimitCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockRepositoryFindAllCall) DoAndReturn(f func(context.Context) ([]database.Query, error)) *MockRepositoryFindAllCall {
+func (c *MockRepositoryFindAllLimitCall) DoAndReturn(f func(context.Context, int, string) ([]database.Query, error)) *MockRepositoryFindAllLimitCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
 
-// FindAllByInterval mocks base method.
-func (m *MockRepository) FindAllByInterval(ctx context.Context, since time.Time) ([]database.Query, error) {
+// FindDomainDetailsPoints mocks base method.
+func (m *MockRepository) FindDomainDetailsPoints(ctx context.Context, name string, since time.Time, granularity time.Duration) ([]database.Point, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindAllByInterval", ctx, since)
-	ret0, _ := ret[0].([]database.Query)
+	ret := m.ctrl.Call(m, "FindDomainDetailsPoints", ctx, name, since, granularity)
+	ret0, _ := ret[0].([]database.Point)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// FindAllByInterval indicates an expected call of FindAllByInterval.
-func (mr *MockRepositoryMockRecorder) FindAllByInterval(ctx, since any) *MockRepositoryFindAllByIntervalCall {
+// FindDomainDetailsPoints indicates an expected call of FindDomainDetailsPoints.
+func (mr *MockRepositoryMockRecorder) FindDomainDetailsPoints(ctx, name, since, granularity any) *MockRepositoryFindDomainDetailsPointsCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindAllByInterval", reflect.TypeOf((*MockRepository)(nil).FindAllByInterval), ctx, since)
-	return &MockRepositoryFindAllByIntervalCall{Call: call}
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDomainDetailsPoints", reflect.TypeOf((*MockRepository)(nil).FindDomainDetailsPoints), ctx, name, since, granularity)
+	return &MockRepositoryFindDomainDetailsPointsCall{Call: call}
 }
 
-// MockRepositoryFindAllByIntervalCall wrap *gomock.Call
-type MockRepositoryFindAllByIntervalCall struct {
+// MockRepositoryFindDomainDetailsPointsCall wrap *gomock.Call
+type MockRepositoryFindDomainDetailsPointsCall struct {
 	*gomock.Call
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *MockRepositoryFindAllByIntervalCall) Return(arg0 []database.Query, arg1 error) *MockRepositoryFindAllByIntervalCall {
+func (c *MockRepositoryFindDomainDetailsPointsCall) Return(arg0 []database.Point, arg1 error) *MockRepositoryFindDomainDetailsPointsCall {
 	c.Call = c.Call.Return(arg0, arg1)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockRepositoryFindAllByIntervalCall) Do(f func(context.Context, time.Time) ([]database.Query, error)) *MockRepositoryFindAllByIntervalCall {
+func (c *MockRepositoryFindDomainDetailsPointsCall) Do(f func(context.Context, string, time.Time, time.Duration) ([]database.Point, error)) *MockRepositoryFindDomainDetailsPointsCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockRepositoryFindAllByIntervalCall) DoAndReturn(f func(context.Context, time.Time) ([]database.Query, error)) *MockRepositoryFindAllByIntervalCall {
+func (c *MockRepositoryFindDomainDetailsPointsCall) DoAndReturn(f func(context.Context, string, time.Time, time.Duration) ([]database.Point, error)) *MockRepositoryFindDomainDetailsPointsCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
 
-// FindAllLimit mocks base method.
-func (m *MockRepository) FindAllLimit(ctx context.Context, limit int, name string) ([]database.Query, error) {
+// FindDomainStats mocks base method.
+func (m *MockRepository) FindDomainStats(ctx context.Context, since time.Time) (database.DomainStats, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindAllLimit", ctx, limit, name)
-	ret0, _ := ret[0].([]database.Query)
+	ret := m.ctrl.Call(m, "FindDomainStats", ctx, since)
+	ret0, _ := ret[0].(database.DomainStats)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// FindAllLimit indicates an expected call of FindAllLimit.
-func (mr *MockRepositoryMockRecorder) FindAllLimit(ctx, limit, name any) *MockRepositoryFindAllLimitCall {
+// FindDomainStats indicates an expected call of FindDomainStats.
+func (mr *MockRepositoryMockRecorder) FindDomainStats(ctx, since any) *MockRepositoryFindDomainStatsCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindAllLimit", reflect.TypeOf((*MockRepository)(nil).FindAllLimit), ctx, limit, name)
-	return &MockRepositoryFindAllLimitCall{Call: call}
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDomainStats", reflect.TypeOf((*MockRepository)(nil).FindDomainStats), ctx, since)
+	return &MockRepositoryFindDomainStatsCall{Call: call}
 }
 
-// MockRepositoryFindAllLimitCall wrap *gomock.Call
-type MockRepositoryFindAllLimitCall struct {
+// MockRepositoryFindDomainStatsCall wrap *gomock.Call
+type MockRepositoryFindDomainStatsCall struct {
 	*gomock.Call
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *MockRepositoryFindAllLimitCall) Return(arg0 []database.Query, arg1 error) *MockRepositoryFindAllLimitCall {
+func (c *MockRepositoryFindDomainStatsCall) Return(arg0 database.DomainStats, arg1 error) *MockRepositoryFindDomainStatsCall {
 	c.Call = c.Call.Return(arg0, arg1)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockRepositoryFindAllLimitCall) Do(f func(context.Context, int, string) ([]database.Query, error)) *MockRepositoryFindAllLimitCall {
+func (c *MockRepositoryFindDomainStatsCall) Do(f func(context.Context, time.Time) (database.DomainStats, error)) *MockRepositoryFindDomainStatsCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockRepositoryFindAllLimitCall) DoAndReturn(f func(context.Context, int, string) ([]database.Query, error)) *MockRepositoryFindAllLimitCall {
+func (c *MockRepositoryFindDomainStatsCall) DoAndReturn(f func(context.Context, time.Time) (database.DomainStats, error)) *MockRepositoryFindDomainStatsCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
 
-// FindDomainDetailsPoints mocks base method.
-func (m *MockRepository) FindDomainDetailsPoints(ctx context.Context, name string, since time.Time, granularity time.Duration) ([]database.Point, error) {
+// FindHistoryPoints mocks base method.
+func (m *MockRepository) FindHistoryPoints(ctx context.Context, since time.Time, granularity time.Duration) ([]database.HistoryPoint, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindDomainDetailsPoints", ctx, name, since, granularity)
-	ret0, _ := ret[0].([]database.Point)
+	ret := m.ctrl.Call(m, "FindHistoryPoints", ctx, since, granularity)
+	ret0, _ := ret[0].([]database.HistoryPoint)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// FindDomainDetailsPoints indicates an expected call of FindDomainDetailsPoints.
-func (mr *MockRepositoryMockRecorder) FindDomainDetailsPoints(ctx, name, since, granularity any) *MockRepositoryFindDomainDetailsPointsCall {
+// FindHistoryPoints indicates an expected call of FindHistoryPoints.
+func (mr *MockRepositoryMockRecorder) FindHistoryPoints(ctx, since, granularity any) *MockRepositoryFindHistoryPointsCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDomainDetailsPoints", reflect.TypeOf((*MockRepository)(nil).FindDomainDetailsPoints), ctx, name, since, granularity)
-	return &MockRepositoryFindDomainDetailsPointsCall{Call: call}
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindHistoryPoints", reflect.TypeOf((*MockRepository)(nil).FindHistoryPoints), ctx, since, granularity)
+	return &MockRepositoryFindHistoryPointsCall{Call: call}
 }
 
-// MockRepositoryFindDomainDetailsPointsCall wrap *gomock.Call
-type MockRepositoryFindDomainDetailsPointsCall struct {
+// MockRepositoryFindHistoryPointsCall wrap *gomock.Call
+type MockRepositoryFindHistoryPointsCall struct {
 	*gomock.Call
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *MockRepositoryFindDomainDetailsPointsCall) Return(arg0 []database.Point, arg1 error) *MockRepositoryFindDomainDetailsPointsCall {
+func (c *MockRepositoryFindHistoryPointsCall) Return(arg0 []database.HistoryPoint, arg1 error) *MockRepositoryFindHistoryPointsCall {
 	c.Call = c.Call.Return(arg0, arg1)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockRepositoryFindDomainDetailsPointsCall) Do(f func(context.Context, string, time.Time, time.Duration) ([]database.Point, error)) *MockRepositoryFindDomainDetailsPointsCall {
+func (c *MockRepositoryFindHistoryPointsCall) Do(f func(context.Context, time.Time, time.Duration) ([]database.HistoryPoint, error)) *MockRepositoryFindHistoryPointsCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockRepositoryFindDomainDetailsPointsCall) DoAndReturn(f func(context.Context, string, time.Time, time.Duration) ([]database.Point, error)) *MockRepositoryFindDomainDetailsPointsCall {
+func (c *MockRepositoryFindHistoryPointsCall) DoAndReturn(f func(context.Context, time.Time, time.Duration) ([]database.HistoryPoint, error)) *MockRepositoryFindHistoryPointsCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
 
-// FindDomainStats mocks base method.
-func (m *MockRepository) FindDomainStats(ctx context.Context, since time.Time) (database.DomainStats, error) {
+// FindHostStats mocks base method.
+func (m *MockRepository) FindHostStats(ctx context.Context, since time.Time) ([]database.HostStat, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindDomainStats", ctx, since)
-	ret0, _ := ret[0].(database.DomainStats)
+	ret := m.ctrl.Call(m, "FindHostStats", ctx, since)
+	ret0, _ := ret[0].([]database.HostStat)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// FindDomainStats indicates an expected call of FindDomainStats.
-func (mr *MockRepositoryMockRecorder) FindDomainStats(ctx, since any) *MockRepositoryFindDomainStatsCall {
+// FindHostStats indicates an expected call of FindHostStats.
+func (mr *MockRepositoryMockRecorder) FindHostStats(ctx, since any) *MockRepositoryFindHostStatsCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDomainStats", reflect.TypeOf((*MockRepository)(nil).FindDomainStats), ctx, since)
-	return &MockRepositoryFindDomainStatsCall{Call: call}
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindHostStats", reflect.TypeOf((*MockRepository)(nil).FindHostStats), ctx, since)
+	return &MockRepositoryFindHostStatsCall{Call: call}
 }
 
-// MockRepositoryFindDomainStatsCall wrap *gomock.Call
-type MockRepositoryFindDomainStatsCall struct {
+// MockRepositoryFindHostStatsCall wrap *gomock.Call
+type MockRepositoryFindHostStatsCall struct {
 	*gomock.Call
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *MockRepositoryFindDomainStatsCall) Return(arg0 database.DomainStats, arg1 error) *MockRepositoryFindDomainStatsCall {
+func (c *MockRepositoryFindHostStatsCall) Return(arg0 []database.HostStat, arg1 error) *MockRepositoryFindHostStatsCall {
 	c.Call = c.Call.Return(arg0, arg1)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockRepositoryFindDomainStatsCall) Do(f func(context.Context, time.Time) (database.DomainStats, error)) *MockRepositoryFindDomainStatsCall {
+func (c *MockRepositoryFindHostStatsCall) Do(f func(context.Context, time.Time) ([]database.HostStat, error)) *MockRepositoryFindHostStatsCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockRepositoryFindDomainStatsCall) DoAndReturn(f func(context.Context, time.Time) (database.DomainStats, error)) *MockRepositoryFindDomainStatsCall {
+func (c *MockRepositoryFindHostStatsCall) DoAndReturn(f func(context.Context, time.Time) ([]database.HostStat, error)) *MockRepositoryFindHostStatsCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
 
-// FindHostStats mocks base method.
-func (m *MockRepository) FindHostStats(ctx context.Context, since time.Time) ([]database.HostStat, error) {
+// FindQueryCounts mocks base method.
+func (m *MockRepository) FindQueryCounts(ctx context.Context, since time.Time) (database.QueryCounts, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindHostStats", ctx, since)
-	ret0, _ := ret[0].([]database.HostStat)
+	ret := m.ctrl.Call(m, "FindQueryCounts", ctx, since)
+	ret0, _ := ret[0].(database.QueryCounts)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// FindHostStats indicates an expected call of FindHostStats.
-func (mr *MockRepositoryMockRecorder) FindHostStats(ctx, since any) *MockRepositoryFindHostStatsCall {
+// FindQueryCounts indicates an expected call of FindQueryCounts.
+func (mr *MockRepositoryMockRecorder) FindQueryCounts(ctx, since any) *MockRepositoryFindQueryCountsCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindHostStats", reflect.TypeOf((*MockRepository)(nil).FindHostStats), ctx, since)
-	return &MockRepositoryFindHostStatsCall{Call: call}
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindQueryCounts", reflect.TypeOf((*MockRepository)(nil).FindQueryCounts), ctx, since)
+	return &MockRepositoryFindQueryCountsCall{Call: call}
 }
 
-// MockRepositoryFindHostStatsCall wrap *gomock.Call
-type MockRepositoryFindHostStatsCall struct {
+// MockRepositoryFindQueryCountsCall wrap *gomock.Call
+type MockRepositoryFindQueryCountsCall struct {
 	*gomock.Call
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *MockRepositoryFindHostStatsCall) Return(arg0 []database.HostStat, arg1 error) *MockRepositoryFindHostStatsCall {
+func (c *MockRepositoryFindQueryCountsCall) Return(arg0 database.QueryCounts, arg1 error) *MockRepositoryFindQueryCountsCall {
 	c.Call = c.Call.Return(arg0, arg1)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockRepositoryFindHostStatsCall) Do(f func(context.Context, time.Time) ([]database.HostStat, error)) *MockRepositoryFindHostStatsCall {
+func (c *MockRepositoryFindQueryCountsCall) Do(f func(context.Context, time.Time) (database.QueryCounts, error)) *MockRepositoryFindQueryCountsCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockRepositoryFindHostStatsCall) DoAndReturn(f func(context.Context, time.Time) ([]database.HostStat, error)) *MockRepositoryFindHostStatsCall {
+func (c *MockRepositoryFindQueryCountsCall) DoAndReturn(f func(context.Context, time.Time) (database.QueryCounts, error)) *MockRepositoryFindQueryCountsCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// FindRcodeCounts mocks base method.
+func (m *MockRepository) FindRcodeCounts(ctx context.Context, since time.Time) ([]database.KeyCount, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindRcodeCounts", ctx, since)
+	ret0, _ := ret[0].([]database.KeyCount)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindRcodeCounts indicates an expected call of FindRcodeCounts.
+func (mr *MockRepositoryMockRecorder) FindRcodeCounts(ctx, since any) *MockRepositoryFindRcodeCountsCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindRcodeCounts", reflect.TypeOf((*MockRepository)(nil).FindRcodeCounts), ctx, since)
+	return &MockRepositoryFindRcodeCountsCall{Call: call}
+}
+
+// MockRepositoryFindRcodeCountsCall wrap *gomock.Call
+type MockRepositoryFindRcodeCountsCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockRepositoryFindRcodeCountsCall) Return(arg0 []database.KeyCount, arg1 error) *MockRepositoryFindRcodeCountsCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockRepositoryFindRcodeCountsCall) Do(f func(context.Context, time.Time) ([]database.KeyCount, error)) *MockRepositoryFindRcodeCountsCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockRepositoryFindRcodeCountsCall) DoAndReturn(f func(context.Context, time.Time) ([]database.KeyCount, error)) *MockRepositoryFindRcodeCountsCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// FindStorageStats mocks base method.
+func (m *MockRepository) FindStorageStats(ctx context.Context) (database.StorageStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindStorageStats", ctx)
+	ret0, _ := ret[0].(database.StorageStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindStorageStats indicates an expected call of FindStorageStats.
+func (mr *MockRepositoryMockRecorder) FindStorageStats(ctx any) *MockRepositoryFindStorageStatsCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindStorageStats", reflect.TypeOf((*MockRepository)(nil).FindStorageStats), ctx)
+	return &MockRepositoryFindStorageStatsCall{Call: call}
+}
+
+// MockRepositoryFindStorageStatsCall wrap *gomock.Call
+type MockRepositoryFindStorageStatsCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockRepositoryFindStorageStatsCall) Return(arg0 database.StorageStats, arg1 error) *MockRepositoryFindStorageStatsCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockRepositoryFindStorageStatsCall) Do(f func(context.Context) (database.StorageStats, error)) *MockRepositoryFindStorageStatsCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockRepositoryFindStorageStatsCall) DoAndReturn(f func(context.Context) (database.StorageStats, error)) *MockRepositoryFindStorageStatsCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
@@ -353,6 +431,45 @@ func (c *MockRepositoryFindTopDomainsCall) DoAndReturn(f func(context.Context, b
 	return c
 }
 
+// FindTypeCounts mocks base method.
+func (m *MockRepository) FindTypeCounts(ctx context.Context, since time.Time) ([]database.KeyCount, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindTypeCounts", ctx, since)
+	ret0, _ := ret[0].([]database.KeyCount)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindTypeCounts indicates an expected call of FindTypeCounts.
+func (mr *MockRepositoryMockRecorder) FindTypeCounts(ctx, since any) *MockRepositoryFindTypeCountsCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindTypeCounts", reflect.TypeOf((*MockRepository)(nil).FindTypeCounts), ctx, since)
+	return &MockRepositoryFindTypeCountsCall{Call: call}
+}
+
+// MockRepositoryFindTypeCountsCall wrap *gomock.Call
+type MockRepositoryFindTypeCountsCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockRepositoryFindTypeCountsCall) Return(arg0 []database.KeyCount, arg1 error) *MockRepositoryFindTypeCountsCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockRepositoryFindTypeCountsCall) Do(f func(context.Context, time.Time) ([]database.KeyCount, error)) *MockRepositoryFindTypeCountsCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockRepositoryFindTypeCountsCall) DoAndReturn(f func(context.Context, time.Time) ([]database.KeyCount, error)) *MockRepositoryFindTypeCountsCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // SaveQuery mocks base method.
 func (m *MockRepository) SaveQuery(ctx context.Context, q database.Query) error {
 	m.ctrl.T.Helper()
@@ -390,3 +507,142 @@ func (c *MockRepositorySaveQueryCall) DoAndReturn(f func(context.Context, databa
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
+
+// MockSourceRepository is a mock of SourceRepository interface.
+type MockSourceRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockSourceRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockSourceRepositoryMockRecorder is the mock recorder for MockSourceRepository.
+type MockSourceRepositoryMockRecorder struct {
+	mock *MockSourceRepository
+}
+
+// NewMockSourceRepository creates a new mock instance.
+func NewMockSourceRepository(ctrl *gomock.Controller) *MockSourceRepository {
+	mock := &MockSourceRepository{ctrl: ctrl}
+	mock.recorder = &MockSourceRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSourceRepository) EXPECT() *MockSourceRepositoryMockRecorder {
+	return m.recorder
+}
+
+// DeleteSource mocks base method.
+func (m *MockSourceRepository) DeleteSource(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSource", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSource indicates an expected call of DeleteSource.
+func (mr *MockSourceRepositoryMockRecorder) DeleteSource(ctx, id any) *MockSourceRepositoryDeleteSourceCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSource", reflect.TypeOf((*MockSourceRepository)(nil).DeleteSource), ctx, id)
+	return &MockSourceRepositoryDeleteSourceCall{Call: call}
+}
+
+// MockSourceRepositoryDeleteSourceCall wrap *gomock.Call
+type MockSourceRepositoryDeleteSourceCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockSourceRepositoryDeleteSourceCall) Return(arg0 error) *MockSourceRepositoryDeleteSourceCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockSourceRepositoryDeleteSourceCall) Do(f func(context.Context, string) error) *MockSourceRepositoryDeleteSourceCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockSourceRepositoryDeleteSourceCall) DoAndReturn(f func(context.Context, string) error) *MockSourceRepositoryDeleteSourceCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// FindAllSources mocks base method.
+func (m *MockSourceRepository) FindAllSources(ctx context.Context) ([]database.BlocklistSource, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindAllSources", ctx)
+	ret0, _ := ret[0].([]database.BlocklistSource)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindAllSources indicates an expected call of FindAllSources.
+func (mr *MockSourceRepositoryMockRecorder) FindAllSources(ctx any) *MockSourceRepositoryFindAllSourcesCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindAllSources", reflect.TypeOf((*MockSourceRepository)(nil).FindAllSources), ctx)
+	return &MockSourceRepositoryFindAllSourcesCall{Call: call}
+}
+
+// MockSourceRepositoryFindAllSourcesCall wrap *gomock.Call
+type MockSourceRepositoryFindAllSourcesCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockSourceRepositoryFindAllSourcesCall) Return(arg0 []database.BlocklistSource, arg1 error) *MockSourceRepositoryFindAllSourcesCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockSourceRepositoryFindAllSourcesCall) Do(f func(context.Context) ([]database.BlocklistSource, error)) *MockSourceRepositoryFindAllSourcesCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockSourceRepositoryFindAllSourcesCall) DoAndReturn(f func(context.Context) ([]database.BlocklistSource, error)) *MockSourceRepositoryFindAllSourcesCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// SaveSource mocks base method.
+func (m *MockSourceRepository) SaveSource(ctx context.Context, s database.BlocklistSource) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveSource", ctx, s)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveSource indicates an expected call of SaveSource.
+func (mr *MockSourceRepositoryMockRecorder) SaveSource(ctx, s any) *MockSourceRepositorySaveSourceCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveSource", reflect.TypeOf((*MockSourceRepository)(nil).SaveSource), ctx, s)
+	return &MockSourceRepositorySaveSourceCall{Call: call}
+}
+
+// MockSourceRepositorySaveSourceCall wrap *gomock.Call
+type MockSourceRepositorySaveSourceCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockSourceRepositorySaveSourceCall) Return(arg0 error) *MockSourceRepositorySaveSourceCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockSourceRepositorySaveSourceCall) Do(f func(context.Context, database.BlocklistSource) error) *MockSourceRepositorySaveSourceCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockSourceRepositorySaveSourceCall) DoAndReturn(f func(context.Context, database.BlocklistSource) error) *MockSourceRepositorySaveSourceCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
@@ -11,6 +11,7 @@ package mock_dns
 
 import (
 	dns0 "gohole/internal/controller/dns"
+	filter "gohole/internal/filter"
 	reflect "reflect"
 
 	dns "codeberg.org/miekg/dns"
@@ -41,14 +42,51 @@ func (m *MockCache) EXPECT() *MockCacheMockRecorder {
 	return m.recorder
 }
 
+// FlushFiltered mocks base method.
+func (m *MockCache) FlushFiltered() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FlushFiltered")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// FlushFiltered indicates an expected call of FlushFiltered.
+func (mr *MockCacheMockRecorder) FlushFiltered() *MockCacheFlushFilteredCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FlushFiltered", reflect.TypeOf((*MockCache)(nil).FlushFiltered))
+	return &MockCacheFlushFilteredCall{Call: call}
+}
+
+// MockCacheFlushFilteredCall wrap *gomock.Call
+type MockCacheFlushFilteredCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockCacheFlushFilteredCall) Return(arg0 int) *MockCacheFlushFilteredCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockCacheFlushFilteredCall) Do(f func() int) *MockCacheFlushFilteredCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockCacheFlushFilteredCall) DoAndReturn(f func() int) *MockCacheFlushFilteredCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // Get mocks base method.
-func (m *MockCache) Get(key dns0.CacheKey) (bool, []dns.RR, bool) {
+func (m *MockCache) Get(key dns0.CacheKey) (dns0.CacheEntry, bool) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Get", key)
-	ret0, _ := ret[0].(bool)
-	ret1, _ := ret[1].([]dns.RR)
-	ret2, _ := ret[2].(bool)
-	return ret0, ret1, ret2
+	ret0, _ := ret[0].(dns0.CacheEntry)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
 }
 
 // Get indicates an expected call of Get.
@@ -64,33 +102,187 @@ type MockCacheGetCall struct {
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *MockCacheGetCall) Return(arg0 bool, arg1 []dns.RR, arg2 bool) *MockCacheGetCall {
-	c.Call = c.Call.Return(arg0, arg1, arg2)
+func (c *MockCacheGetCall) Return(arg0 dns0.CacheEntry, arg1 bool) *MockCacheGetCall {
+	c.Call = c.Call.Return(arg0, arg1)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockCacheGetCall) Do(f func(dns0.CacheKey) (bool, []dns.RR, bool)) *MockCacheGetCall {
+func (c *MockCacheGetCall) Do(f func(dns0.CacheKey) (dns0.CacheEntry, bool)) *MockCacheGetCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockCacheGetCall) DoAndReturn(f func(dns0.CacheKey) (bool, []dns.RR, bool)) *MockCacheGetCall {
+func (c *MockCacheGetCall) DoAndReturn(f func(dns0.CacheKey) (dns0.CacheEntry, bool)) *MockCacheGetCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// GetStale mocks base method.
+func (m *MockCache) GetStale(key dns0.CacheKey) (dns0.CacheEntry, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStale", key)
+	ret0, _ := ret[0].(dns0.CacheEntry)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// GetStale indicates an expected call of GetStale.
+func (mr *MockCacheMockRecorder) GetStale(key any) *MockCacheGetStaleCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStale", reflect.TypeOf((*MockCache)(nil).GetStale), key)
+	return &MockCacheGetStaleCall{Call: call}
+}
+
+// MockCacheGetStaleCall wrap *gomock.Call
+type MockCacheGetStaleCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockCacheGetStaleCall) Return(arg0 dns0.CacheEntry, arg1 bool) *MockCacheGetStaleCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockCacheGetStaleCall) Do(f func(dns0.CacheKey) (dns0.CacheEntry, bool)) *MockCacheGetStaleCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockCacheGetStaleCall) DoAndReturn(f func(dns0.CacheKey) (dns0.CacheEntry, bool)) *MockCacheGetStaleCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Items mocks base method.
+func (m *MockCache) Items() []dns0.CacheItem {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Items")
+	ret0, _ := ret[0].([]dns0.CacheItem)
+	return ret0
+}
+
+// Items indicates an expected call of Items.
+func (mr *MockCacheMockRecorder) Items() *MockCacheItemsCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Items", reflect.TypeOf((*MockCache)(nil).Items))
+	return &MockCacheItemsCall{Call: call}
+}
+
+// MockCacheItemsCall wrap *gomock.Call
+type MockCacheItemsCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockCacheItemsCall) Return(arg0 []dns0.CacheItem) *MockCacheItemsCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockCacheItemsCall) Do(f func() []dns0.CacheItem) *MockCacheItemsCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockCacheItemsCall) DoAndReturn(f func() []dns0.CacheItem) *MockCacheItemsCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Peek mocks base method.
+func (m *MockCache) Peek(key dns0.CacheKey) (dns0.CacheEntry, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Peek", key)
+	ret0, _ := ret[0].(dns0.CacheEntry)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// Peek indicates an expected call of Peek.
+func (mr *MockCacheMockRecorder) Peek(key any) *MockCachePeekCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Peek", reflect.TypeOf((*MockCache)(nil).Peek), key)
+	return &MockCachePeekCall{Call: call}
+}
+
+// MockCachePeekCall wrap *gomock.Call
+type MockCachePeekCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockCachePeekCall) Return(arg0 dns0.CacheEntry, arg1 bool) *MockCachePeekCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockCachePeekCall) Do(f func(dns0.CacheKey) (dns0.CacheEntry, bool)) *MockCachePeekCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockCachePeekCall) DoAndReturn(f func(dns0.CacheKey) (dns0.CacheEntry, bool)) *MockCachePeekCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Restore mocks base method.
+func (m *MockCache) Restore(items []dns0.CacheItem) int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Restore", items)
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Restore indicates an expected call of Restore.
+func (mr *MockCacheMockRecorder) Restore(items any) *MockCacheRestoreCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restore", reflect.TypeOf((*MockCache)(nil).Restore), items)
+	return &MockCacheRestoreCall{Call: call}
+}
+
+// MockCacheRestoreCall wrap *gomock.Call
+type MockCacheRestoreCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockCacheRestoreCall) Return(arg0 int) *MockCacheRestoreCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockCacheRestoreCall) Do(f func([]dns0.CacheItem) int) *MockCacheRestoreCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockCacheRestoreCall) DoAndReturn(f func([]dns0.CacheItem) int) *MockCacheRestoreCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
 
 // Set mocks base method.
-func (m *MockCache) Set(key dns0.CacheKey, answer []dns.RR, ttl uint32) {
+func (m *MockCache) Set(key dns0.CacheKey, resp *dns.Msg, ttl uint32) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Set", key, answer, ttl)
+	m.ctrl.Call(m, "Set", key, resp, ttl)
 }
 
 // Set indicates an expected call of Set.
-func (mr *MockCacheMockRecorder) Set(key, answer, ttl any) *MockCacheSetCall {
+func (mr *MockCacheMockRecorder) Set(key, resp, ttl any) *MockCacheSetCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockCache)(nil).Set), key, answer, ttl)
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockCache)(nil).Set), key, resp, ttl)
 	return &MockCacheSetCall{Call: call}
 }
 
@@ -106,27 +298,27 @@ func (c *MockCacheSetCall) Return() *MockCacheSetCall {
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockCacheSetCall) Do(f func(dns0.CacheKey, []dns.RR, uint32)) *MockCacheSetCall {
+func (c *MockCacheSetCall) Do(f func(dns0.CacheKey, *dns.Msg, uint32)) *MockCacheSetCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockCacheSetCall) DoAndReturn(f func(dns0.CacheKey, []dns.RR, uint32)) *MockCacheSetCall {
+func (c *MockCacheSetCall) DoAndReturn(f func(dns0.CacheKey, *dns.Msg, uint32)) *MockCacheSetCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
 
 // SetBlocked mocks base method.
-func (m *MockCache) SetBlocked(key dns0.CacheKey) {
+func (m *MockCache) SetBlocked(key dns0.CacheKey, match *filter.Match) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "SetBlocked", key)
+	m.ctrl.Call(m, "SetBlocked", key, match)
 }
 
 // SetBlocked indicates an expected call of SetBlocked.
-func (mr *MockCacheMockRecorder) SetBlocked(key any) *MockCacheSetBlockedCall {
+func (mr *MockCacheMockRecorder) SetBlocked(key, match any) *MockCacheSetBlockedCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBlocked", reflect.TypeOf((*MockCache)(nil).SetBlocked), key)
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBlocked", reflect.TypeOf((*MockCache)(nil).SetBlocked), key, match)
 	return &MockCacheSetBlockedCall{Call: call}
 }
 
@@ -142,13 +334,89 @@ func (c *MockCacheSetBlockedCall) Return() *MockCacheSetBlockedCall {
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockCacheSetBlockedCall) Do(f func(dns0.CacheKey)) *MockCacheSetBlockedCall {
+func (c *MockCacheSetBlockedCall) Do(f func(dns0.CacheKey, *filter.Match)) *MockCacheSetBlockedCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockCacheSetBlockedCall) DoAndReturn(f func(dns0.CacheKey, *filter.Match)) *MockCacheSetBlockedCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Stats mocks base method.
+func (m *MockCache) Stats() dns0.CacheStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(dns0.CacheStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats.
+func (mr *MockCacheMockRecorder) Stats() *MockCacheStatsCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockCache)(nil).Stats))
+	return &MockCacheStatsCall{Call: call}
+}
+
+// MockCacheStatsCall wrap *gomock.Call
+type MockCacheStatsCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockCacheStatsCall) Return(arg0 dns0.CacheStats) *MockCacheStatsCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockCacheStatsCall) Do(f func() dns0.CacheStats) *MockCacheStatsCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockCacheStatsCall) DoAndReturn(f func() dns0.CacheStats) *MockCacheStatsCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Sweep mocks base method.
+func (m *MockCache) Sweep() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Sweep")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Sweep indicates an expected call of Sweep.
+func (mr *MockCacheMockRecorder) Sweep() *MockCacheSweepCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sweep", reflect.TypeOf((*MockCache)(nil).Sweep))
+	return &MockCacheSweepCall{Call: call}
+}
+
+// MockCacheSweepCall wrap *gomock.Call
+type MockCacheSweepCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockCacheSweepCall) Return(arg0 int) *MockCacheSweepCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockCacheSweepCall) Do(f func() int) *MockCacheSweepCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockCacheSetBlockedCall) DoAndReturn(f func(dns0.CacheKey)) *MockCacheSetBlockedCall {
+func (c *MockCacheSweepCall) DoAndReturn(f func() int) *MockCacheSweepCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
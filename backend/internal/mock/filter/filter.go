@@ -10,6 +10,7 @@
 package mockfilter
 
 import (
+	filter "gohole/internal/filter"
 	reflect "reflect"
 
 	gomock "go.uber.org/mock/gomock"
@@ -40,18 +41,18 @@ func (m *MockFilter) EXPECT() *MockFilterMockRecorder {
 }
 
 // Filter mocks base method.
-func (m *MockFilter) Filter(q string) (bool, error) {
+func (m *MockFilter) Filter(r filter.Request) (*filter.Match, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Filter", q)
-	ret0, _ := ret[0].(bool)
+	ret := m.ctrl.Call(m, "Filter", r)
+	ret0, _ := ret[0].(*filter.Match)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Filter indicates an expected call of Filter.
-func (mr *MockFilterMockRecorder) Filter(q any) *MockFilterFilterCall {
+func (mr *MockFilterMockRecorder) Filter(r any) *MockFilterFilterCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Filter", reflect.TypeOf((*MockFilter)(nil).Filter), q)
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Filter", reflect.TypeOf((*MockFilter)(nil).Filter), r)
 	return &MockFilterFilterCall{Call: call}
 }
 
@@ -61,19 +62,19 @@ type MockFilterFilterCall struct {
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *MockFilterFilterCall) Return(arg0 bool, arg1 error) *MockFilterFilterCall {
+func (c *MockFilterFilterCall) Return(arg0 *filter.Match, arg1 error) *MockFilterFilterCall {
 	c.Call = c.Call.Return(arg0, arg1)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockFilterFilterCall) Do(f func(string) (bool, error)) *MockFilterFilterCall {
+func (c *MockFilterFilterCall) Do(f func(filter.Request) (*filter.Match, error)) *MockFilterFilterCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockFilterFilterCall) DoAndReturn(f func(string) (bool, error)) *MockFilterFilterCall {
+func (c *MockFilterFilterCall) DoAndReturn(f func(filter.Request) (*filter.Match, error)) *MockFilterFilterCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
@@ -12,6 +12,7 @@ package mock_query
 import (
 	context "context"
 	database "gohole/internal/database"
+	filter "gohole/internal/filter"
 	query "gohole/internal/query"
 	reflect "reflect"
 
@@ -120,6 +121,45 @@ func (c *MockServiceGetBlockListStatsCall) DoAndReturn(f func() (*query.BlockLis
 	return c
 }
 
+// GetBreakdownStats mocks base method.
+func (m *MockService) GetBreakdownStats(ctx context.Context, interval query.Interval) (*query.BreakdownStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBreakdownStats", ctx, interval)
+	ret0, _ := ret[0].(*query.BreakdownStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBreakdownStats indicates an expected call of GetBreakdownStats.
+func (mr *MockServiceMockRecorder) GetBreakdownStats(ctx, interval any) *MockServiceGetBreakdownStatsCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBreakdownStats", reflect.TypeOf((*MockService)(nil).GetBreakdownStats), ctx, interval)
+	return &MockServiceGetBreakdownStatsCall{Call: call}
+}
+
+// MockServiceGetBreakdownStatsCall wrap *gomock.Call
+type MockServiceGetBreakdownStatsCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockServiceGetBreakdownStatsCall) Return(arg0 *query.BreakdownStats, arg1 error) *MockServiceGetBreakdownStatsCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockServiceGetBreakdownStatsCall) Do(f func(context.Context, query.Interval) (*query.BreakdownStats, error)) *MockServiceGetBreakdownStatsCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockServiceGetBreakdownStatsCall) DoAndReturn(f func(context.Context, query.Interval) (*query.BreakdownStats, error)) *MockServiceGetBreakdownStatsCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // GetDomainDetails mocks base method.
 func (m *MockService) GetDomainDetails(ctx context.Context, name string, interval query.Interval, granularity query.Granularity) (*query.DomainDetail, error) {
 	m.ctrl.T.Helper()
@@ -315,6 +355,123 @@ func (c *MockServiceGetStatsCall) DoAndReturn(f func(context.Context, query.Inte
 	return c
 }
 
+// GetStorageStats mocks base method.
+func (m *MockService) GetStorageStats(ctx context.Context) (*query.StorageStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStorageStats", ctx)
+	ret0, _ := ret[0].(*query.StorageStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStorageStats indicates an expected call of GetStorageStats.
+func (mr *MockServiceMockRecorder) GetStorageStats(ctx any) *MockServiceGetStorageStatsCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStorageStats", reflect.TypeOf((*MockService)(nil).GetStorageStats), ctx)
+	return &MockServiceGetStorageStatsCall{Call: call}
+}
+
+// MockServiceGetStorageStatsCall wrap *gomock.Call
+type MockServiceGetStorageStatsCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockServiceGetStorageStatsCall) Return(arg0 *query.StorageStats, arg1 error) *MockServiceGetStorageStatsCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockServiceGetStorageStatsCall) Do(f func(context.Context) (*query.StorageStats, error)) *MockServiceGetStorageStatsCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockServiceGetStorageStatsCall) DoAndReturn(f func(context.Context) (*query.StorageStats, error)) *MockServiceGetStorageStatsCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// GetTopAllowedDomains mocks base method.
+func (m *MockService) GetTopAllowedDomains(ctx context.Context, interval query.Interval, limit int) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTopAllowedDomains", ctx, interval, limit)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTopAllowedDomains indicates an expected call of GetTopAllowedDomains.
+func (mr *MockServiceMockRecorder) GetTopAllowedDomains(ctx, interval, limit any) *MockServiceGetTopAllowedDomainsCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopAllowedDomains", reflect.TypeOf((*MockService)(nil).GetTopAllowedDomains), ctx, interval, limit)
+	return &MockServiceGetTopAllowedDomainsCall{Call: call}
+}
+
+// MockServiceGetTopAllowedDomainsCall wrap *gomock.Call
+type MockServiceGetTopAllowedDomainsCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockServiceGetTopAllowedDomainsCall) Return(arg0 []string, arg1 error) *MockServiceGetTopAllowedDomainsCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockServiceGetTopAllowedDomainsCall) Do(f func(context.Context, query.Interval, int) ([]string, error)) *MockServiceGetTopAllowedDomainsCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockServiceGetTopAllowedDomainsCall) DoAndReturn(f func(context.Context, query.Interval, int) ([]string, error)) *MockServiceGetTopAllowedDomainsCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Matches mocks base method.
+func (m *MockService) Matches(r filter.Request) (query.Matches, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Matches", r)
+	ret0, _ := ret[0].(query.Matches)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Matches indicates an expected call of Matches.
+func (mr *MockServiceMockRecorder) Matches(r any) *MockServiceMatchesCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Matches", reflect.TypeOf((*MockService)(nil).Matches), r)
+	return &MockServiceMatchesCall{Call: call}
+}
+
+// MockServiceMatchesCall wrap *gomock.Call
+type MockServiceMatchesCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockServiceMatchesCall) Return(arg0 query.Matches, arg1 error) *MockServiceMatchesCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockServiceMatchesCall) Do(f func(filter.Request) (query.Matches, error)) *MockServiceMatchesCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockServiceMatchesCall) DoAndReturn(f func(filter.Request) (query.Matches, error)) *MockServiceMatchesCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // Save mocks base method.
 func (m *MockService) Save(ctx context.Context, q database.Query) error {
 	m.ctrl.T.Helper()
@@ -353,19 +510,55 @@ func (c *MockServiceSaveCall) DoAndReturn(f func(context.Context, database.Query
 	return c
 }
 
+// SetFilters mocks base method.
+func (m *MockService) SetFilters(blockFilter, allowFilter filter.Filter) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetFilters", blockFilter, allowFilter)
+}
+
+// SetFilters indicates an expected call of SetFilters.
+func (mr *MockServiceMockRecorder) SetFilters(blockFilter, allowFilter any) *MockServiceSetFiltersCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetFilters", reflect.TypeOf((*MockService)(nil).SetFilters), blockFilter, allowFilter)
+	return &MockServiceSetFiltersCall{Call: call}
+}
+
+// MockServiceSetFiltersCall wrap *gomock.Call
+type MockServiceSetFiltersCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockServiceSetFiltersCall) Return() *MockServiceSetFiltersCall {
+	c.Call = c.Call.Return()
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockServiceSetFiltersCall) Do(f func(filter.Filter, filter.Filter)) *MockServiceSetFiltersCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockServiceSetFiltersCall) DoAndReturn(f func(filter.Filter, filter.Filter)) *MockServiceSetFiltersCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // ShouldAllow mocks base method.
-func (m *MockService) ShouldAllow(name string) (bool, error) {
+func (m *MockService) ShouldAllow(r filter.Request) (query.Verdict, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ShouldAllow", name)
-	ret0, _ := ret[0].(bool)
+	ret := m.ctrl.Call(m, "ShouldAllow", r)
+	ret0, _ := ret[0].(query.Verdict)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // ShouldAllow indicates an expected call of ShouldAllow.
-func (mr *MockServiceMockRecorder) ShouldAllow(name any) *MockServiceShouldAllowCall {
+func (mr *MockServiceMockRecorder) ShouldAllow(r any) *MockServiceShouldAllowCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ShouldAllow", reflect.TypeOf((*MockService)(nil).ShouldAllow), name)
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ShouldAllow", reflect.TypeOf((*MockService)(nil).ShouldAllow), r)
 	return &MockServiceShouldAllowCall{Call: call}
 }
 
@@ -375,19 +568,19 @@ type MockServiceShouldAllowCall struct {
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *MockServiceShouldAllowCall) Return(arg0 bool, arg1 error) *MockServiceShouldAllowCall {
+func (c *MockServiceShouldAllowCall) Return(arg0 query.Verdict, arg1 error) *MockServiceShouldAllowCall {
 	c.Call = c.Call.Return(arg0, arg1)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockServiceShouldAllowCall) Do(f func(string) (bool, error)) *MockServiceShouldAllowCall {
+func (c *MockServiceShouldAllowCall) Do(f func(filter.Request) (query.Verdict, error)) *MockServiceShouldAllowCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockServiceShouldAllowCall) DoAndReturn(f func(string) (bool, error)) *MockServiceShouldAllowCall {
+func (c *MockServiceShouldAllowCall) DoAndReturn(f func(filter.Request) (query.Verdict, error)) *MockServiceShouldAllowCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
@@ -0,0 +1,300 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: sourceservice.go
+//
+// Generated by this command:
+//
+//	mockgen -destination=../mock/source/sourceservice.go -typed -source=sourceservice.go
+//
+
+// Package mock_source is a generated GoMock package.
+package mock_source
+
+import (
+	context "context"
+	blocklist "gohole/internal/blocklist"
+	source "gohole/internal/source"
+	reflect "reflect"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockService is a mock of Service interface.
+type MockService struct {
+	ctrl     *gomock.Controller
+	recorder *MockServiceMockRecorder
+	isgomock struct{}
+}
+
+// MockServiceMockRecorder is the mock recorder for MockService.
+type MockServiceMockRecorder struct {
+	mock *MockService
+}
+
+// NewMockService creates a new mock instance.
+func NewMockService(ctrl *gomock.Controller) *MockService {
+	mock := &MockService{ctrl: ctrl}
+	mock.recorder = &MockServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockService) EXPECT() *MockServiceMockRecorder {
+	return m.recorder
+}
+
+// Add mocks base method.
+func (m *MockService) Add(ctx context.Context, name, rawURL string) (*source.Source, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Add", ctx, name, rawURL)
+	ret0, _ := ret[0].(*source.Source)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Add indicates an expected call of Add.
+func (mr *MockServiceMockRecorder) Add(ctx, name, rawURL any) *MockServiceAddCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockService)(nil).Add), ctx, name, rawURL)
+	return &MockServiceAddCall{Call: call}
+}
+
+// MockServiceAddCall wrap *gomock.Call
+type MockServiceAddCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockServiceAddCall) Return(arg0 *source.Source, arg1 error) *MockServiceAddCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockServiceAddCall) Do(f func(context.Context, string, string) (*source.Source, error)) *MockServiceAddCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockServiceAddCall) DoAndReturn(f func(context.Context, string, string) (*source.Source, error)) *MockServiceAddCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// GetAll mocks base method.
+func (m *MockService) GetAll(ctx context.Context) ([]source.Source, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAll", ctx)
+	ret0, _ := ret[0].([]source.Source)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAll indicates an expected call of GetAll.
+func (mr *MockServiceMockRecorder) GetAll(ctx any) *MockServiceGetAllCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAll", reflect.TypeOf((*MockService)(nil).GetAll), ctx)
+	return &MockServiceGetAllCall{Call: call}
+}
+
+// MockServiceGetAllCall wrap *gomock.Call
+type MockServiceGetAllCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockServiceGetAllCall) Return(arg0 []source.Source, arg1 error) *MockServiceGetAllCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockServiceGetAllCall) Do(f func(context.Context) ([]source.Source, error)) *MockServiceGetAllCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockServiceGetAllCall) DoAndReturn(f func(context.Context) ([]source.Source, error)) *MockServiceGetAllCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Remove mocks base method.
+func (m *MockService) Remove(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Remove", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Remove indicates an expected call of Remove.
+func (mr *MockServiceMockRecorder) Remove(ctx, id any) *MockServiceRemoveCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockService)(nil).Remove), ctx, id)
+	return &MockServiceRemoveCall{Call: call}
+}
+
+// MockServiceRemoveCall wrap *gomock.Call
+type MockServiceRemoveCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockServiceRemoveCall) Return(arg0 error) *MockServiceRemoveCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockServiceRemoveCall) Do(f func(context.Context, string) error) *MockServiceRemoveCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockServiceRemoveCall) DoAndReturn(f func(context.Context, string) error) *MockServiceRemoveCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// SetEnabled mocks base method.
+func (m *MockService) SetEnabled(ctx context.Context, id string, enabled bool) (*source.Source, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetEnabled", ctx, id, enabled)
+	ret0, _ := ret[0].(*source.Source)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetEnabled indicates an expected call of SetEnabled.
+func (mr *MockServiceMockRecorder) SetEnabled(ctx, id, enabled any) *MockServiceSetEnabledCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetEnabled", reflect.TypeOf((*MockService)(nil).SetEnabled), ctx, id, enabled)
+	return &MockServiceSetEnabledCall{Call: call}
+}
+
+// MockServiceSetEnabledCall wrap *gomock.Call
+type MockServiceSetEnabledCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockServiceSetEnabledCall) Return(arg0 *source.Source, arg1 error) *MockServiceSetEnabledCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockServiceSetEnabledCall) Do(f func(context.Context, string, bool) (*source.Source, error)) *MockServiceSetEnabledCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockServiceSetEnabledCall) DoAndReturn(f func(context.Context, string, bool) (*source.Source, error)) *MockServiceSetEnabledCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// MockStatus is a mock of Status interface.
+type MockStatus struct {
+	ctrl     *gomock.Controller
+	recorder *MockStatusMockRecorder
+	isgomock struct{}
+}
+
+// MockStatusMockRecorder is the mock recorder for MockStatus.
+type MockStatusMockRecorder struct {
+	mock *MockStatus
+}
+
+// NewMockStatus creates a new mock instance.
+func NewMockStatus(ctrl *gomock.Controller) *MockStatus {
+	mock := &MockStatus{ctrl: ctrl}
+	mock.recorder = &MockStatusMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStatus) EXPECT() *MockStatusMockRecorder {
+	return m.recorder
+}
+
+// FileURLs mocks base method.
+func (m *MockStatus) FileURLs() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FileURLs")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FileURLs indicates an expected call of FileURLs.
+func (mr *MockStatusMockRecorder) FileURLs() *MockStatusFileURLsCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FileURLs", reflect.TypeOf((*MockStatus)(nil).FileURLs))
+	return &MockStatusFileURLsCall{Call: call}
+}
+
+// MockStatusFileURLsCall wrap *gomock.Call
+type MockStatusFileURLsCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockStatusFileURLsCall) Return(arg0 []string, arg1 error) *MockStatusFileURLsCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockStatusFileURLsCall) Do(f func() ([]string, error)) *MockStatusFileURLsCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockStatusFileURLsCall) DoAndReturn(f func() ([]string, error)) *MockStatusFileURLsCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Result mocks base method.
+func (m *MockStatus) Result(url string) (blocklist.Result, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Result", url)
+	ret0, _ := ret[0].(blocklist.Result)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// Result indicates an expected call of Result.
+func (mr *MockStatusMockRecorder) Result(url any) *MockStatusResultCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Result", reflect.TypeOf((*MockStatus)(nil).Result), url)
+	return &MockStatusResultCall{Call: call}
+}
+
+// MockStatusResultCall wrap *gomock.Call
+type MockStatusResultCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockStatusResultCall) Return(arg0 blocklist.Result, arg1 bool) *MockStatusResultCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockStatusResultCall) Do(f func(string) (blocklist.Result, bool)) *MockStatusResultCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockStatusResultCall) DoAndReturn(f func(string) (blocklist.Result, bool)) *MockStatusResultCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
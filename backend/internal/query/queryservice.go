@@ -6,7 +6,11 @@ import (
 	"gohole/internal/database"
 	"gohole/internal/filter"
 	"math"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"codeberg.org/miekg/dns/dnsutil"
 )
 
 //go:generate go tool go.uber.org/mock/mockgen -destination=../mock/query/queryservice.go -typed -source=queryservice.go
@@ -22,19 +26,56 @@ type Service interface {
 	GetBlockListStats() (*BlockListStats, error)
 	GetHostStats(ctx context.Context, interival Interval) ([]database.HostStat, error)
 	GetDomainStats(ctx context.Context, interval Interval) (DomainStats, error)
+	// GetBreakdownStats returns the number of queries by type and by response code.
+	GetBreakdownStats(ctx context.Context, interval Interval) (*BreakdownStats, error)
+	// GetStorageStats returns the disk space used by the query log, the time of
+	// the oldest query kept and how long they are kept.
+	GetStorageStats(ctx context.Context) (*StorageStats, error)
+	// GetTopAllowedDomains returns the names of the most queried allowed domains.
+	GetTopAllowedDomains(ctx context.Context, interval Interval, limit int) ([]string, error)
 	GetDomainDetails(
 		ctx context.Context,
 		name string,
 		interval Interval,
 		granularity Granularity,
 	) (*DomainDetail, error)
-	ShouldAllow(name string) (bool, error)
+	ShouldAllow(r filter.Request) (Verdict, error)
+	Matches(r filter.Request) (Matches, error)
+	SetFilters(blockFilter filter.Filter, allowFilter filter.Filter)
+}
+
+// Verdict is the outcome of filtering a request.
+type Verdict struct {
+	// Allowed is true if the request should be answered, false if it should be blocked.
+	Allowed bool
+	// ClientScoped is true if the verdict for the requested name depends on the
+	// client, hence it must not be shared with other clients (e.g. through a cache).
+	ClientScoped bool
+	// Match is the entry the verdict is based on: the allow entry if the request
+	// is allowed by the allow filter, the block entry if it is blocked, nil otherwise.
+	Match *filter.Match
+}
+
+// Matches holds the entries of both filters matching a request. Unlike a
+// Verdict, it is computed without short-circuiting the block filter.
+type Matches struct {
+	// Allow and Block are the matching entries, nil if there is none.
+	Allow *filter.Match
+	Block *filter.Match
+	// ClientScoped is true if the matches depend on the client.
+	ClientScoped bool
+}
+
+// filters holds a block filter together with the allow filter built along with it,
+// so that both are always swapped at once.
+type filters struct {
+	block filter.Filter
+	allow filter.Filter
 }
 
 type serviceImpl struct {
-	repo        database.Repository
-	blockFilter filter.Filter
-	allowFilter filter.Filter
+	repo    database.Repository
+	filters atomic.Pointer[filters]
 }
 
 func NewService(
@@ -42,11 +83,21 @@ func NewService(
 	allowFilter filter.Filter,
 	repo database.Repository,
 ) Service {
-	return &serviceImpl{
-		blockFilter: blockFilter,
-		allowFilter: allowFilter,
-		repo:        repo,
+	s := &serviceImpl{
+		repo: repo,
 	}
+	s.SetFilters(blockFilter, allowFilter)
+
+	return s
+}
+
+// SetFilters replaces the block and allow filters. Requests being filtered
+// keep using the previous filters until they are done.
+func (s *serviceImpl) SetFilters(blockFilter filter.Filter, allowFilter filter.Filter) {
+	s.filters.Store(&filters{
+		block: blockFilter,
+		allow: allowFilter,
+	})
 }
 
 func (s *serviceImpl) Save(ctx context.Context, q database.Query) error {
@@ -61,111 +112,120 @@ func (s *serviceImpl) GetAll(
 	return s.repo.FindAllLimit(ctx, limit, name)
 }
 
-// ShouldAllow checks if a query should be allowed or blocked based on the allow and block filters.
-// It returns true if the query should be allowed, false if it should be blocked.
-func (s *serviceImpl) ShouldAllow(name string) (bool, error) {
-	if name[len(name)-1] == '.' {
-		name = name[:len(name)-1]
+// ShouldAllow checks if a request should be allowed or blocked based on the allow and block filters.
+// The verdict is allowed if the request should be allowed, blocked otherwise.
+func (s *serviceImpl) ShouldAllow(r filter.Request) (Verdict, error) {
+	r.Name = strings.TrimSuffix(r.Name, ".")
+	f := s.filters.Load()
+
+	verdict := Verdict{
+		ClientScoped: filter.IsClientScoped(f.allow, r.Name) ||
+			filter.IsClientScoped(f.block, r.Name),
 	}
 
-	isAllowed, err := s.allowFilter.Filter(name)
+	allowMatch, err := f.allow.Filter(r)
 	if err != nil {
-		return false, fmt.Errorf("query service: error checking allow filter: %w", err)
+		return Verdict{}, fmt.Errorf("query service: error checking allow filter: %w", err)
 	}
 
-	if isAllowed {
-		return true, nil
+	if allowMatch != nil {
+		verdict.Allowed = true
+		verdict.Match = allowMatch
+		return verdict, nil
 	}
 
-	isBlocked, err := s.blockFilter.Filter(name)
+	blockMatch, err := f.block.Filter(r)
 	if err != nil {
-		return false, fmt.Errorf("query service: error checking block filter: %w", err)
+		return Verdict{}, fmt.Errorf("query service: error checking block filter: %w", err)
 	}
 
-	return !isBlocked, nil
+	verdict.Allowed = blockMatch == nil
+	verdict.Match = blockMatch
+	return verdict, nil
 }
 
-func (s *serviceImpl) GetStats(ctx context.Context, interval Interval) (*Stats, error) {
-	var err error
-	var queries []database.Query
+// Matches checks a request against both the allow and the block filters. It is
+// meant for explaining a verdict, ShouldAllow must be used for filtering.
+func (s *serviceImpl) Matches(r filter.Request) (Matches, error) {
+	r.Name = strings.TrimSuffix(r.Name, ".")
+	f := s.filters.Load()
 
-	if interval == "" {
-		queries, err = s.repo.FindAll(ctx)
-	} else {
-		queries, err = s.repo.FindAllByInterval(ctx, time.Now().UTC().Add(-interval.ToDuration()))
+	m := Matches{
+		ClientScoped: filter.IsClientScoped(f.allow, r.Name) ||
+			filter.IsClientScoped(f.block, r.Name),
 	}
 
-	if err != nil {
-		return nil, fmt.Errorf("query service: cannot fetch queries: %w", err)
+	var err error
+	if m.Allow, err = f.allow.Filter(r); err != nil {
+		return Matches{}, fmt.Errorf("query service: error checking allow filter: %w", err)
 	}
 
-	var blocked, allowed int
-	var blockRate float64
-	total := len(queries)
+	if m.Block, err = f.block.Filter(r); err != nil {
+		return Matches{}, fmt.Errorf("query service: error checking block filter: %w", err)
+	}
 
-	for _, q := range queries {
-		if q.Blocked {
-			blocked++
-		} else {
-			allowed++
-		}
+	return m, nil
+}
+
+func (s *serviceImpl) GetStats(ctx context.Context, interval Interval) (*Stats, error) {
+	// An empty interval counts the queries of all time
+	var since time.Time
+	if interval != "" {
+		since = time.Now().UTC().Add(-interval.ToDuration())
+	}
+
+	counts, err := s.repo.FindQueryCounts(ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("query service: cannot fetch query counts: %w", err)
 	}
 
+	total := int(counts.Total)
+	blocked := int(counts.Blocked)
+
 	// x : 100 = blocked : total
-	blockRate = math.Round(float64(100.0*blocked) / float64(total))
+	blockRate := math.Round(float64(100.0*blocked) / float64(total))
 
 	return &Stats{
 		TotalQueries:   total,
 		BlockedQueries: blocked,
-		AllowedQueries: allowed,
+		AllowedQueries: total - blocked,
 		BlockRate:      blockRate,
 	}, nil
 }
 
+// GetHistory returns the number of blocked and allowed queries in each of the
+// buckets of the interval, the last one being the current bucket. The buckets
+// are aligned on the granularity, in UTC.
 func (s *serviceImpl) GetHistory(
 	ctx context.Context,
 	interval Interval,
 	granularity Granularity,
 ) ([]QueryHistoryPoint, error) {
-	granularityStep := granularity.ToDuration().Seconds()
-	stepsNo := interval.ToDuration().Seconds() / granularityStep
-
-	history := make([]QueryHistoryPoint, int(math.Ceil(stepsNo)))
+	step := granularity.ToDuration()
+	stepsNo := int(math.Ceil(interval.ToDuration().Seconds() / step.Seconds()))
 
-	// FIXME: this does not handle the timezone properly. Fix it later.
-	startTs := time.Now().UTC().Add(-interval.ToDuration())
+	end := time.Now().UTC().Truncate(step)
+	start := end.Add(-time.Duration(stepsNo-1) * step)
 
-	// First, set all the timestamps
-	for i := range history {
-		ts := startTs.Add(granularity.ToDuration() * time.Duration(i))
-		history[i].Time = ts.Format(time.RFC3339)
-	}
-
-	// Fetch all the queries
-	queries, err := s.repo.FindAllByInterval(ctx, startTs)
+	points, err := s.repo.FindHistoryPoints(ctx, start, step)
 	if err != nil {
-		return nil, fmt.Errorf("query service: cannot fetch queries: %w", err)
+		return nil, fmt.Errorf("query service: cannot fetch history points: %w", err)
 	}
 
-	if len(queries) == 0 {
-		// early exit in case there's no data
-		return history, nil
+	byTime := make(map[int64]database.HistoryPoint, len(points))
+	for _, p := range points {
+		byTime[p.Time.Unix()] = p
 	}
 
-	// Then, update all the history points
-	for _, query := range queries {
-		// Index represents which history point this query belongs to
-		index := int((query.Timestamp - startTs.Unix()) / int64(granularity.ToDuration().Seconds()))
-
-		// Clamp to valid range
-		if index < 0 || index >= len(history) {
-			continue
-		}
+	history := make([]QueryHistoryPoint, stepsNo)
+	for i := range history {
+		ts := start.Add(step * time.Duration(i))
+		p := byTime[ts.Unix()]
 
-		if query.Blocked {
-			history[index].Blocked++
-		} else {
-			history[index].Allowed++
+		history[i] = QueryHistoryPoint{
+			Time:    ts.Format(time.RFC3339),
+			Blocked: int(p.Blocked),
+			Allowed: int(p.Allowed),
 		}
 	}
 
@@ -174,7 +234,7 @@ func (s *serviceImpl) GetHistory(
 
 func (s *serviceImpl) GetBlockListStats() (*BlockListStats, error) {
 	return &BlockListStats{
-		TotalEntries: s.blockFilter.Size(),
+		TotalEntries: s.filters.Load().block.Size(),
 	}, nil
 }
 
@@ -214,6 +274,76 @@ func (s *serviceImpl) GetDomainStats(ctx context.Context, interval Interval) (Do
 	return ret, nil
 }
 
+func (s *serviceImpl) GetBreakdownStats(
+	ctx context.Context,
+	interval Interval,
+) (*BreakdownStats, error) {
+	since := time.Now().UTC().Add(-interval.ToDuration())
+
+	types, err := s.repo.FindTypeCounts(ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("query service: cannot fetch counts by type: %w", err)
+	}
+
+	rcodes, err := s.repo.FindRcodeCounts(ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("query service: cannot fetch counts by rcode: %w", err)
+	}
+
+	stats := &BreakdownStats{
+		Types:  make([]NamedCount, 0, len(types)),
+		Rcodes: make([]NamedCount, 0, len(rcodes)),
+	}
+	for _, c := range types {
+		if c.Key == 0 {
+			// Queries logged before the type was recorded
+			continue
+		}
+		stats.Types = append(stats.Types, NamedCount{Name: dnsutil.TypeToString(c.Key), Count: c.Count})
+	}
+	for _, c := range rcodes {
+		stats.Rcodes = append(stats.Rcodes, NamedCount{Name: dnsutil.RcodeToString(c.Key), Count: c.Count})
+	}
+
+	return stats, nil
+}
+
+func (s *serviceImpl) GetStorageStats(ctx context.Context) (*StorageStats, error) {
+	ss, err := s.repo.FindStorageStats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("query service: cannot fetch storage stats: %w", err)
+	}
+
+	stats := &StorageStats{
+		Bytes:            ss.Bytes,
+		RetentionSeconds: int64(ss.Retention / time.Second),
+	}
+	if !ss.Oldest.IsZero() {
+		stats.Oldest = ss.Oldest.UTC().Format(time.RFC3339)
+	}
+
+	return stats, nil
+}
+
+func (s *serviceImpl) GetTopAllowedDomains(
+	ctx context.Context,
+	interval Interval,
+	limit int,
+) ([]string, error) {
+	since := time.Now().UTC().Add(-interval.ToDuration())
+	top, err := s.repo.FindTopDomains(ctx, false, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query service: cannot fetch top allowed domains: %w", err)
+	}
+
+	names := make([]string, 0, len(top))
+	for _, d := range top {
+		names = append(names, d.Domain)
+	}
+
+	return names, nil
+}
+
 func (s *serviceImpl) GetDomainDetails(
 	ctx context.Context,
 	name string,
@@ -242,14 +372,15 @@ func (s *serviceImpl) GetDomainDetails(
 		})
 	}
 
-	block, err := s.blockFilter.Filter(name)
+	match, err := s.filters.Load().block.Filter(filter.Request{Name: name})
 	if err != nil {
 		return nil, fmt.Errorf("query service: error checking block filter: %w", err)
 	}
 
 	return &DomainDetail{
 		Points:  jsonPoints,
-		Blocked: block,
+		Blocked: match != nil,
+		Match:   match,
 		Count:   len(points),
 	}, nil
 }
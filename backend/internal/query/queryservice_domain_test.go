@@ -9,6 +9,7 @@ import (
 	"go.uber.org/mock/gomock"
 
 	"gohole/internal/database"
+	"gohole/internal/filter"
 	"gohole/internal/query"
 )
 
@@ -84,6 +85,34 @@ func TestGetDomainStats_FindTopAllowedError(t *testing.T) {
 	}
 }
 
+// ---- GetTopAllowedDomains ----
+
+func TestGetTopAllowedDomains_OK(t *testing.T) {
+	svc, repo, _, _ := newService(t)
+	repo.EXPECT().
+		FindTopDomains(gomock.Any(), false, gomock.Any(), 2).
+		Return([]database.TopDomain{{Domain: "ok.com", Count: 80}, {Domain: "fine.org", Count: 10}}, nil)
+
+	names, err := svc.GetTopAllowedDomains(context.Background(), query.Interval7D, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(names) != 2 || names[0] != "ok.com" || names[1] != "fine.org" {
+		t.Errorf("unexpected names: %v", names)
+	}
+}
+
+func TestGetTopAllowedDomains_RepoError(t *testing.T) {
+	svc, repo, _, _ := newService(t)
+	repo.EXPECT().
+		FindTopDomains(gomock.Any(), false, gomock.Any(), 2).
+		Return(nil, errors.New("db error"))
+
+	if _, err := svc.GetTopAllowedDomains(context.Background(), query.Interval7D, 2); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
 // ---- GetDomainDetails ----
 
 func TestGetDomainDetails_OK(t *testing.T) {
@@ -96,7 +125,7 @@ func TestGetDomainDetails_OK(t *testing.T) {
 	repo.EXPECT().
 		FindDomainDetailsPoints(gomock.Any(), "example.com", gomock.Any(), step).
 		Return([]database.Point{point}, nil)
-	blockFilter.EXPECT().Filter("example.com").Return(false, nil)
+	blockFilter.EXPECT().Filter(filter.Request{Name: "example.com"}).Return(nil, nil)
 
 	detail, err := svc.GetDomainDetails(
 		context.Background(),
@@ -125,7 +154,7 @@ func TestGetDomainDetails_Blocked(t *testing.T) {
 	repo.EXPECT().
 		FindDomainDetailsPoints(gomock.Any(), "bad.com", gomock.Any(), step).
 		Return(nil, nil)
-	blockFilter.EXPECT().Filter("bad.com").Return(true, nil)
+	blockFilter.EXPECT().Filter(filter.Request{Name: "bad.com"}).Return(blockMatch, nil)
 
 	detail, err := svc.GetDomainDetails(
 		context.Background(),
@@ -139,6 +168,9 @@ func TestGetDomainDetails_Blocked(t *testing.T) {
 	if !detail.Blocked {
 		t.Error("expected Blocked=true")
 	}
+	if detail.Match != blockMatch {
+		t.Errorf("expected the block match, got %+v", detail.Match)
+	}
 }
 
 func TestGetDomainDetails_RepoError(t *testing.T) {
@@ -167,7 +199,7 @@ func TestGetDomainDetails_BlockFilterError(t *testing.T) {
 	repo.EXPECT().
 		FindDomainDetailsPoints(gomock.Any(), "example.com", gomock.Any(), step).
 		Return(nil, nil)
-	blockFilter.EXPECT().Filter("example.com").Return(false, errors.New("filter error"))
+	blockFilter.EXPECT().Filter(filter.Request{Name: "example.com"}).Return(nil, errors.New("filter error"))
 
 	_, err := svc.GetDomainDetails(
 		context.Background(),
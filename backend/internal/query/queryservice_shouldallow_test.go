@@ -4,47 +4,59 @@ import (
 	"errors"
 	"testing"
 
+	"gohole/internal/filter"
 	"gohole/internal/query"
 )
 
+var (
+	allowMatch = &filter.Match{List: "allow.txt", Rule: "example.com", Kind: filter.MatchExact}
+	blockMatch = &filter.Match{List: "https://lists.example.com/ads.txt", Rule: "bad.com", Kind: filter.MatchExact}
+)
+
 func TestShouldAllow_AllowFilterMatches(t *testing.T) {
 	svc, _, _, allowFilter := newService(t)
 	// domain is on the allow-list → should be allowed regardless of block filter
-	allowFilter.EXPECT().Filter("example.com").Return(true, nil)
+	allowFilter.EXPECT().Filter(filter.Request{Name: "example.com"}).Return(allowMatch, nil)
 
-	ok, err := svc.ShouldAllow("example.com")
+	ok, err := svc.ShouldAllow(filter.Request{Name: "example.com"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if !ok {
+	if !ok.Allowed {
 		t.Error("expected allowed=true")
 	}
+	if ok.Match != allowMatch {
+		t.Errorf("expected the allow match, got %+v", ok.Match)
+	}
 }
 
 func TestShouldAllow_BlockFilterMatches(t *testing.T) {
 	svc, _, blockFilter, allowFilter := newService(t)
-	allowFilter.EXPECT().Filter("bad.com").Return(false, nil)
-	blockFilter.EXPECT().Filter("bad.com").Return(true, nil)
+	allowFilter.EXPECT().Filter(filter.Request{Name: "bad.com"}).Return(nil, nil)
+	blockFilter.EXPECT().Filter(filter.Request{Name: "bad.com"}).Return(blockMatch, nil)
 
-	ok, err := svc.ShouldAllow("bad.com")
+	ok, err := svc.ShouldAllow(filter.Request{Name: "bad.com"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if ok {
+	if ok.Allowed {
 		t.Error("expected allowed=false for blocked domain")
 	}
+	if ok.Match != blockMatch {
+		t.Errorf("expected the block match, got %+v", ok.Match)
+	}
 }
 
 func TestShouldAllow_NeitherFilter(t *testing.T) {
 	svc, _, blockFilter, allowFilter := newService(t)
-	allowFilter.EXPECT().Filter("neutral.com").Return(false, nil)
-	blockFilter.EXPECT().Filter("neutral.com").Return(false, nil)
+	allowFilter.EXPECT().Filter(filter.Request{Name: "neutral.com"}).Return(nil, nil)
+	blockFilter.EXPECT().Filter(filter.Request{Name: "neutral.com"}).Return(nil, nil)
 
-	ok, err := svc.ShouldAllow("neutral.com")
+	ok, err := svc.ShouldAllow(filter.Request{Name: "neutral.com"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if !ok {
+	if !ok.Allowed {
 		t.Error("expected allowed=true for domain in neither filter")
 	}
 }
@@ -52,23 +64,23 @@ func TestShouldAllow_NeitherFilter(t *testing.T) {
 func TestShouldAllow_StripTrailingDot(t *testing.T) {
 	svc, _, blockFilter, allowFilter := newService(t)
 	// The service must strip the trailing dot before querying filters
-	allowFilter.EXPECT().Filter("example.com").Return(false, nil)
-	blockFilter.EXPECT().Filter("example.com").Return(false, nil)
+	allowFilter.EXPECT().Filter(filter.Request{Name: "example.com"}).Return(nil, nil)
+	blockFilter.EXPECT().Filter(filter.Request{Name: "example.com"}).Return(nil, nil)
 
-	ok, err := svc.ShouldAllow("example.com.")
+	ok, err := svc.ShouldAllow(filter.Request{Name: "example.com."})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if !ok {
+	if !ok.Allowed {
 		t.Error("expected allowed=true")
 	}
 }
 
 func TestShouldAllow_AllowFilterError(t *testing.T) {
 	svc, _, _, allowFilter := newService(t)
-	allowFilter.EXPECT().Filter("example.com").Return(false, errors.New("allow filter error"))
+	allowFilter.EXPECT().Filter(filter.Request{Name: "example.com"}).Return(nil, errors.New("allow filter error"))
 
-	_, err := svc.ShouldAllow("example.com")
+	_, err := svc.ShouldAllow(filter.Request{Name: "example.com"})
 	if err == nil {
 		t.Error("expected error from allow filter")
 	}
@@ -76,15 +88,69 @@ func TestShouldAllow_AllowFilterError(t *testing.T) {
 
 func TestShouldAllow_BlockFilterError(t *testing.T) {
 	svc, _, blockFilter, allowFilter := newService(t)
-	allowFilter.EXPECT().Filter("example.com").Return(false, nil)
-	blockFilter.EXPECT().Filter("example.com").Return(false, errors.New("block filter error"))
+	allowFilter.EXPECT().Filter(filter.Request{Name: "example.com"}).Return(nil, nil)
+	blockFilter.EXPECT().Filter(filter.Request{Name: "example.com"}).Return(nil, errors.New("block filter error"))
 
-	_, err := svc.ShouldAllow("example.com")
+	_, err := svc.ShouldAllow(filter.Request{Name: "example.com"})
 	if err == nil {
 		t.Error("expected error from block filter")
 	}
 }
 
+func TestShouldAllow_PatternRules(t *testing.T) {
+	blockRule, err := filter.NewRegexRule("/^ads?[0-9]*\\./", `^ads?[0-9]*\.`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	allowRule, err := filter.NewRegexRule("*.good.*", `^.*\.good\..*$`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	blockFilter := filter.NewComposite(
+		[]filter.Filter{filter.NewBasic([]string{"bad.com"})},
+		[]filter.Rule{blockRule},
+		nil,
+	)
+	allowFilter := filter.NewComposite([]filter.Filter{filter.NewBasic(nil)}, []filter.Rule{allowRule}, nil)
+	svc := query.NewService(blockFilter, allowFilter, nil)
+
+	cases := []struct {
+		name  string
+		allow bool
+	}{
+		{"bad.com.", false},
+		{"ads1.example.com.", false},
+		{"ads.good.com.", true},
+		{"example.com.", true},
+	}
+	for _, tc := range cases {
+		ok, err := svc.ShouldAllow(filter.Request{Name: tc.name})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ok.Allowed != tc.allow {
+			t.Errorf("%s: expected allowed=%v, got %v", tc.name, tc.allow, ok.Allowed)
+		}
+	}
+}
+
+func TestShouldAllow_SetFilters(t *testing.T) {
+	svc := query.NewService(filter.NewBasic([]string{"old.com"}), filter.NewBasic(nil), nil)
+
+	svc.SetFilters(filter.NewBasic([]string{"new.com"}), filter.NewBasic(nil))
+
+	for name, want := range map[string]bool{"old.com": true, "new.com": false} {
+		v, err := svc.ShouldAllow(filter.Request{Name: name})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if v.Allowed != want {
+			t.Errorf("%s: expected allowed=%v, got %v", name, want, v.Allowed)
+		}
+	}
+}
+
 // ---- GetBlockListStats ----
 
 func TestGetBlockListStats(t *testing.T) {
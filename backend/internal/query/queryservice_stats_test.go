@@ -3,6 +3,7 @@ package query_test
 import (
 	"context"
 	"errors"
+	"slices"
 	"testing"
 	"time"
 
@@ -16,12 +17,9 @@ import (
 
 func TestGetStats_AllInterval(t *testing.T) {
 	svc, repo, _, _ := newService(t)
-	queries := []database.Query{
-		{Blocked: true},
-		{Blocked: false},
-		{Blocked: false},
-	}
-	repo.EXPECT().FindAll(gomock.Any()).Return(queries, nil)
+	repo.EXPECT().
+		FindQueryCounts(gomock.Any(), time.Time{}).
+		Return(database.QueryCounts{Total: 3, Blocked: 1}, nil)
 
 	stats, err := svc.GetStats(context.Background(), "")
 	if err != nil {
@@ -40,11 +38,11 @@ func TestGetStats_AllInterval(t *testing.T) {
 
 func TestGetStats_WithInterval(t *testing.T) {
 	svc, repo, _, _ := newService(t)
-	queries := []database.Query{
-		{Blocked: true},
-		{Blocked: true},
-	}
-	repo.EXPECT().FindAllByInterval(gomock.Any(), gomock.Any()).Return(queries, nil)
+	repo.EXPECT().
+		FindQueryCounts(gomock.Any(), gomock.Cond(func(since time.Time) bool {
+			return time.Since(since).Round(time.Minute) == time.Hour
+		})).
+		Return(database.QueryCounts{Total: 2, Blocked: 2}, nil)
 
 	stats, err := svc.GetStats(context.Background(), query.Interval1H)
 	if err != nil {
@@ -56,11 +54,16 @@ func TestGetStats_WithInterval(t *testing.T) {
 	if stats.AllowedQueries != 0 {
 		t.Errorf("expected 0 allowed, got %d", stats.AllowedQueries)
 	}
+	if stats.BlockRate != 100 {
+		t.Errorf("expected a 100%% block rate, got %v", stats.BlockRate)
+	}
 }
 
 func TestGetStats_RepoError(t *testing.T) {
 	svc, repo, _, _ := newService(t)
-	repo.EXPECT().FindAll(gomock.Any()).Return(nil, errors.New("db error"))
+	repo.EXPECT().
+		FindQueryCounts(gomock.Any(), gomock.Any()).
+		Return(database.QueryCounts{}, errors.New("db error"))
 
 	_, err := svc.GetStats(context.Background(), "")
 	if err == nil {
@@ -72,7 +75,9 @@ func TestGetStats_RepoError(t *testing.T) {
 
 func TestGetHistory_EmptyQueries(t *testing.T) {
 	svc, repo, _, _ := newService(t)
-	repo.EXPECT().FindAllByInterval(gomock.Any(), gomock.Any()).Return(nil, nil)
+	repo.EXPECT().
+		FindHistoryPoints(gomock.Any(), gomock.Any(), 5*time.Minute).
+		Return(nil, nil)
 
 	points, err := svc.GetHistory(context.Background(), query.Interval1H, query.Granularity5M)
 	if err != nil {
@@ -92,30 +97,40 @@ func TestGetHistory_EmptyQueries(t *testing.T) {
 func TestGetHistory_WithQueries(t *testing.T) {
 	svc, repo, _, _ := newService(t)
 
-	// Place two queries 30 seconds into the 1h window (index 0 of 5m buckets)
-	startTs := time.Now().UTC().Add(-query.Interval1H.ToDuration())
-	q1 := database.Query{Timestamp: startTs.Unix() + 30, Blocked: true}
-	q2 := database.Query{Timestamp: startTs.Unix() + 30, Blocked: false}
+	// The buckets are aligned on the granularity, the last one being the current one
+	current := time.Now().UTC().Truncate(5 * time.Minute)
+	first := current.Add(-55 * time.Minute)
 
 	repo.EXPECT().
-		FindAllByInterval(gomock.Any(), gomock.Any()).
-		Return([]database.Query{q1, q2}, nil)
+		FindHistoryPoints(gomock.Any(), first, 5*time.Minute).
+		Return([]database.HistoryPoint{
+			{Time: first, Blocked: 1, Allowed: 1},
+			{Time: current.Local(), Blocked: 3},
+		}, nil)
 
 	points, err := svc.GetHistory(context.Background(), query.Interval1H, query.Granularity5M)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	if points[0].Time != first.Format(time.RFC3339) {
+		t.Errorf("expected bucket 0 to start at %s, got %s", first.Format(time.RFC3339), points[0].Time)
+	}
 	if points[0].Blocked != 1 {
 		t.Errorf("expected 1 blocked in bucket 0, got %d", points[0].Blocked)
 	}
 	if points[0].Allowed != 1 {
 		t.Errorf("expected 1 allowed in bucket 0, got %d", points[0].Allowed)
 	}
+	if points[11].Blocked != 3 {
+		t.Errorf("expected 3 blocked in the current bucket, got %d", points[11].Blocked)
+	}
 }
 
 func TestGetHistory_RepoError(t *testing.T) {
 	svc, repo, _, _ := newService(t)
-	repo.EXPECT().FindAllByInterval(gomock.Any(), gomock.Any()).Return(nil, errors.New("db error"))
+	repo.EXPECT().
+		FindHistoryPoints(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, errors.New("db error"))
 
 	_, err := svc.GetHistory(context.Background(), query.Interval1H, query.Granularity5M)
 	if err == nil {
@@ -148,3 +163,116 @@ func TestGetHostStats_Error(t *testing.T) {
 		t.Error("expected error, got nil")
 	}
 }
+
+// ---- GetBreakdownStats ----
+
+func TestGetBreakdownStats_OK(t *testing.T) {
+	svc, repo, _, _ := newService(t)
+	repo.EXPECT().FindTypeCounts(gomock.Any(), gomock.Any()).Return([]database.KeyCount{
+		{Key: 1, Count: 10},
+		{Key: 28, Count: 4},
+		{Key: 0, Count: 2},
+	}, nil)
+	repo.EXPECT().FindRcodeCounts(gomock.Any(), gomock.Any()).Return([]database.KeyCount{
+		{Key: 0, Count: 12},
+		{Key: 3, Count: 4},
+	}, nil)
+
+	got, err := svc.GetBreakdownStats(context.Background(), query.Interval1D)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedTypes := []query.NamedCount{{Name: "A", Count: 10}, {Name: "AAAA", Count: 4}}
+	if !slices.Equal(got.Types, expectedTypes) {
+		t.Errorf("expected types %v, got %v", expectedTypes, got.Types)
+	}
+	expectedRcodes := []query.NamedCount{{Name: "NOERROR", Count: 12}, {Name: "NXDOMAIN", Count: 4}}
+	if !slices.Equal(got.Rcodes, expectedRcodes) {
+		t.Errorf("expected rcodes %v, got %v", expectedRcodes, got.Rcodes)
+	}
+}
+
+func TestGetBreakdownStats_Error(t *testing.T) {
+	svc, repo, _, _ := newService(t)
+	repo.EXPECT().FindTypeCounts(gomock.Any(), gomock.Any()).Return(nil, errors.New("db error"))
+
+	_, err := svc.GetBreakdownStats(context.Background(), query.Interval1D)
+	if err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+// ---- GetStorageStats ----
+
+func TestGetStorageStats_OK(t *testing.T) {
+	svc, repo, _, _ := newService(t)
+	oldest := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	repo.EXPECT().FindStorageStats(gomock.Any()).Return(database.StorageStats{
+		Bytes:     4096,
+		Oldest:    oldest,
+		Retention: 90 * 24 * time.Hour,
+	}, nil)
+
+	got, err := svc.GetStorageStats(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := query.StorageStats{
+		Bytes:            4096,
+		Oldest:           "2024-01-02T03:04:05Z",
+		RetentionSeconds: 90 * 24 * 3600,
+	}
+	if *got != expected {
+		t.Errorf("expected %+v, got %+v", expected, *got)
+	}
+}
+
+func TestGetStorageStats_Empty(t *testing.T) {
+	svc, repo, _, _ := newService(t)
+	repo.EXPECT().FindStorageStats(gomock.Any()).Return(database.StorageStats{}, nil)
+
+	got, err := svc.GetStorageStats(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Oldest != "" || got.RetentionSeconds != 0 {
+		t.Errorf("expected no oldest query and no retention, got %+v", *got)
+	}
+}
+
+func TestGetStorageStats_Error(t *testing.T) {
+	svc, repo, _, _ := newService(t)
+	repo.EXPECT().FindStorageStats(gomock.Any()).Return(database.StorageStats{}, errors.New("db error"))
+
+	_, err := svc.GetStorageStats(context.Background())
+	if err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+// ---- QueryFromDB ----
+
+func TestQueryFromDB(t *testing.T) {
+	got := query.QueryFromDB(database.Query{
+		Name:         "example.com.",
+		Type:         28,
+		Rcode:        3,
+		AnswerCount:  0,
+		ResponseSize: 45,
+		Upstream:     "1.1.1.1:53",
+		Protocol:     "udp",
+	})
+
+	if got.Type != "AAAA" || got.Rcode != "NXDOMAIN" {
+		t.Errorf("expected the type and rcode names, got %q and %q", got.Type, got.Rcode)
+	}
+	if got.ResponseSize != 45 || got.Upstream != "1.1.1.1:53" || got.Protocol != "udp" {
+		t.Errorf("unexpected query: %+v", got)
+	}
+
+	if got := query.QueryFromDB(database.Query{Name: "old.com."}); got.Type != "" {
+		t.Errorf("expected no type for queries logged without one, got %q", got.Type)
+	}
+}
@@ -3,8 +3,11 @@ package query
 import (
 	"encoding/json"
 	"gohole/internal/database"
+	"gohole/internal/filter"
 	"math"
 	"time"
+
+	"codeberg.org/miekg/dns/dnsutil"
 )
 
 type Stats struct {
@@ -118,25 +121,85 @@ type BlockListStats struct {
 }
 
 type Query struct {
-	Name      string `json:"name"`
-	Type      uint16 `json:"type"`
+	Name string `json:"name"`
+	// Type is the type of the question, e.g. "A".
+	Type      string `json:"type"`
 	Blocked   bool   `json:"blocked"`
 	Host      string `json:"host"`
 	Timestamp string `json:"timestamp"`
 	Millis    int64  `json:"millis"`
+	// ClientID is the ID the client identified itself with, if any.
+	ClientID string `json:"clientId,omitempty"`
+	// Match is the list entry the query was blocked or allowed by, if any.
+	Match *filter.Match `json:"match,omitempty"`
+	// Rcode is the response code of the response, e.g. "NXDOMAIN".
+	Rcode        string `json:"rcode"`
+	AnswerCount  uint16 `json:"answerCount"`
+	ResponseSize uint32 `json:"responseSize"`
+	// Upstream is the upstream that answered, if the query was forwarded.
+	Upstream string `json:"upstream,omitempty"`
+	Cached   bool   `json:"cached"`
+	Custom   bool   `json:"custom"`
+	Protocol string `json:"protocol,omitempty"`
 }
 
 func QueryFromDB(q database.Query) Query {
+	var match *filter.Match
+	if q.MatchKind != "" {
+		match = &filter.Match{
+			List: q.MatchList,
+			Rule: q.MatchRule,
+			Kind: filter.MatchKind(q.MatchKind),
+		}
+	}
+
+	var qtype string
+	if q.Type != 0 {
+		// Queries logged before the type was recorded have none
+		qtype = dnsutil.TypeToString(q.Type)
+	}
+
 	return Query{
-		Name:      q.Name,
-		Type:      q.Type,
-		Blocked:   q.Blocked,
-		Host:      q.Host,
-		Timestamp: time.Unix(q.Timestamp, 0).UTC().Format(time.RFC3339),
-		Millis:    q.Millis,
+		Name:         q.Name,
+		Type:         qtype,
+		Blocked:      q.Blocked,
+		Host:         q.Host,
+		Timestamp:    time.Unix(q.Timestamp, 0).UTC().Format(time.RFC3339),
+		Millis:       q.Millis,
+		ClientID:     q.ClientID,
+		Match:        match,
+		Rcode:        dnsutil.RcodeToString(q.Rcode),
+		AnswerCount:  q.AnswerCount,
+		ResponseSize: q.ResponseSize,
+		Upstream:     q.Upstream,
+		Cached:       q.Cached,
+		Custom:       q.Custom,
+		Protocol:     q.Protocol,
 	}
 }
 
+// BreakdownStats splits the queries by question type and by response code.
+type BreakdownStats struct {
+	Types  []NamedCount `json:"types"`
+	Rcodes []NamedCount `json:"rcodes"`
+}
+
+// NamedCount is the number of queries with a given type or response code.
+type NamedCount struct {
+	Name  string `json:"name"`
+	Count uint64 `json:"count"`
+}
+
+// StorageStats is the disk space used by the query log, and how long the
+// queries are kept.
+type StorageStats struct {
+	Bytes uint64 `json:"bytes"`
+	// Oldest is the time of the oldest query kept, empty if there is none.
+	Oldest string `json:"oldest,omitempty"`
+	// RetentionSeconds is how long the queries are kept, 0 if they are kept forever.
+	RetentionSeconds int64 `json:"retentionSeconds"`
+}
+
 type DomainStats struct {
 	Total      uint64               `json:"total"`
 	Blocked    uint64               `json:"blocked"`
@@ -145,9 +208,11 @@ type DomainStats struct {
 }
 
 type DomainDetail struct {
-	Blocked bool                `json:"blocked"`
-	Count   int                 `json:"count"`
-	Points  []DomainDetailPoint `json:"points"`
+	Blocked bool `json:"blocked"`
+	// Match is the block list entry matching the domain, nil if it is not blocked.
+	Match  *filter.Match       `json:"match,omitempty"`
+	Count  int                 `json:"count"`
+	Points []DomainDetailPoint `json:"points"`
 }
 
 type DomainDetailPoint struct {
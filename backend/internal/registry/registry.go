@@ -36,7 +36,7 @@ func NewRegistry(
 
 	queryService := query.NewService(blockFilter, allowFilter, repo)
 
-	dnsCache := dns.NewCache()
+	dnsCache := dns.NewCache(dns.CacheOptions{})
 	dnsClient := &dns2.Client{}
 
 	tcpHandler, err := dns.NewHandler(queryService, dns.TCP, dnsCache, &cfg.DNS, dnsClient)
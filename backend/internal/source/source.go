@@ -0,0 +1,52 @@
+package source
+
+import (
+	"errors"
+	"gohole/internal/database"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no source has the given ID.
+	ErrNotFound = errors.New("source not found")
+	// ErrDuplicate is returned when adding a source whose URL is already loaded.
+	ErrDuplicate = errors.New("source already exists")
+	// ErrInvalidURL is returned when adding a source whose URL cannot be downloaded.
+	ErrInvalidURL = errors.New("invalid source URL")
+)
+
+type Origin string
+
+const (
+	// OriginFile is the origin of the sources listed in the blocklist file. They
+	// can only be changed by editing the file.
+	OriginFile Origin = "file"
+	// OriginAPI is the origin of the sources added through the API.
+	OriginAPI Origin = "api"
+)
+
+type Source struct {
+	// ID is empty for the sources listed in the blocklist file.
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Enabled bool   `json:"enabled"`
+	Origin  Origin `json:"origin"`
+	// Domains is the number of domains and rules of the list, zero if it was not
+	// loaded yet.
+	Domains int `json:"domains"`
+	// LastRefresh is the time the list in use was downloaded, nil if never.
+	LastRefresh *time.Time `json:"lastRefresh"`
+	// LastError is the error of the last download, empty if it succeeded.
+	LastError string `json:"lastError,omitempty"`
+}
+
+func sourceFromDB(s database.BlocklistSource) Source {
+	return Source{
+		ID:      s.ID,
+		Name:    s.Name,
+		URL:     s.URL,
+		Enabled: s.Enabled,
+		Origin:  OriginAPI,
+	}
+}
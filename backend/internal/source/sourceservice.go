@@ -0,0 +1,236 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"gohole/internal/blocklist"
+	"gohole/internal/database"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+//go:generate go tool go.uber.org/mock/mockgen -destination=../mock/source/sourceservice.go -typed -source=sourceservice.go
+type Service interface {
+	GetAll(ctx context.Context) ([]Source, error)
+	Add(ctx context.Context, name string, rawURL string) (*Source, error)
+	Remove(ctx context.Context, id string) error
+	SetEnabled(ctx context.Context, id string, enabled bool) (*Source, error)
+}
+
+// Status reports the state of the loaded lists.
+type Status interface {
+	// FileURLs returns the URLs listed in the blocklist file.
+	FileURLs() ([]string, error)
+	// Result returns how the list downloaded from url was last loaded.
+	Result(url string) (blocklist.Result, bool)
+}
+
+type serviceImpl struct {
+	repo   database.SourceRepository
+	status Status
+	// changed is called when the sources change, to reload the lists.
+	changed func()
+}
+
+func NewService(repo database.SourceRepository, status Status, changed func()) Service {
+	return &serviceImpl{
+		repo:    repo,
+		status:  status,
+		changed: changed,
+	}
+}
+
+// EnabledURLs returns a provider of the URLs of the enabled sources in repo.
+func EnabledURLs(repo database.SourceRepository) blocklist.SourceProvider {
+	return func(ctx context.Context) ([]string, error) {
+		sources, err := repo.FindAllSources(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("source: cannot fetch sources: %w", err)
+		}
+
+		var urls []string
+		for _, s := range sources {
+			if s.Enabled {
+				urls = append(urls, s.URL)
+			}
+		}
+
+		return urls, nil
+	}
+}
+
+// GetAll returns the sources listed in the blocklist file, followed by the ones
+// added through the API.
+func (s *serviceImpl) GetAll(ctx context.Context) ([]Source, error) {
+	fileURLs, err := s.status.FileURLs()
+	if err != nil {
+		return nil, fmt.Errorf("source: cannot read blocklist file: %w", err)
+	}
+
+	dbSources, err := s.repo.FindAllSources(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("source: cannot fetch sources: %w", err)
+	}
+
+	sources := make([]Source, 0, len(fileURLs)+len(dbSources))
+	for _, u := range fileURLs {
+		sources = append(sources, s.withStatus(Source{
+			Name:    nameFromURL(u),
+			URL:     u,
+			Enabled: true,
+			Origin:  OriginFile,
+		}))
+	}
+
+	for _, dbSource := range dbSources {
+		sources = append(sources, s.withStatus(sourceFromDB(dbSource)))
+	}
+
+	return sources, nil
+}
+
+func (s *serviceImpl) Add(ctx context.Context, name string, rawURL string) (*Source, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if err := validateURL(rawURL); err != nil {
+		return nil, err
+	}
+
+	sources, err := s.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.ContainsFunc(sources, func(o Source) bool { return o.URL == rawURL }) {
+		return nil, fmt.Errorf("source: %w: %s", ErrDuplicate, rawURL)
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, fmt.Errorf("source: cannot generate ID: %w", err)
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = nameFromURL(rawURL)
+	}
+
+	dbSource := database.BlocklistSource{
+		ID:        id.String(),
+		Name:      name,
+		URL:       rawURL,
+		Enabled:   true,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := s.repo.SaveSource(ctx, dbSource); err != nil {
+		return nil, fmt.Errorf("source: cannot save source: %w", err)
+	}
+
+	s.changed()
+
+	source := s.withStatus(sourceFromDB(dbSource))
+	return &source, nil
+}
+
+func (s *serviceImpl) Remove(ctx context.Context, id string) error {
+	if _, err := s.find(ctx, id); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteSource(ctx, id); err != nil {
+		return fmt.Errorf("source: cannot delete source: %w", err)
+	}
+
+	s.changed()
+
+	return nil
+}
+
+func (s *serviceImpl) SetEnabled(ctx context.Context, id string, enabled bool) (*Source, error) {
+	dbSource, err := s.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if dbSource.Enabled != enabled {
+		dbSource.Enabled = enabled
+		if err := s.repo.SaveSource(ctx, dbSource); err != nil {
+			return nil, fmt.Errorf("source: cannot save source: %w", err)
+		}
+
+		s.changed()
+	}
+
+	source := s.withStatus(sourceFromDB(dbSource))
+	return &source, nil
+}
+
+// find returns the source added through the API with the given ID.
+func (s *serviceImpl) find(ctx context.Context, id string) (database.BlocklistSource, error) {
+	sources, err := s.repo.FindAllSources(ctx)
+	if err != nil {
+		return database.BlocklistSource{}, fmt.Errorf("source: cannot fetch sources: %w", err)
+	}
+
+	i := slices.IndexFunc(sources, func(o database.BlocklistSource) bool { return o.ID == id })
+	if i < 0 {
+		return database.BlocklistSource{}, fmt.Errorf("source: %w: %s", ErrNotFound, id)
+	}
+
+	return sources[i], nil
+}
+
+// withStatus fills in how the list of an enabled source was last loaded.
+func (s *serviceImpl) withStatus(source Source) Source {
+	if !source.Enabled {
+		return source
+	}
+
+	res, ok := s.status.Result(source.URL)
+	if !ok {
+		return source
+	}
+
+	source.Domains = res.Domains + res.Rules
+	if !res.FetchedAt.IsZero() {
+		source.LastRefresh = &res.FetchedAt
+	}
+	if res.Err != nil {
+		source.LastError = res.Err.Error()
+	}
+
+	return source
+}
+
+// validateURL checks that rawURL is an absolute HTTP(S) URL.
+func validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("source: %w: %w", ErrInvalidURL, err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("source: %w: '%s' is not an HTTP(S) URL", ErrInvalidURL, rawURL)
+	}
+
+	return nil
+}
+
+// nameFromURL returns the name given to a source without one: the host and the
+// last path element of its URL.
+func nameFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	if i := strings.LastIndex(u.Path, "/"); i >= 0 && i < len(u.Path)-1 {
+		return u.Host + " " + u.Path[i+1:]
+	}
+
+	return u.Host
+}
@@ -0,0 +1,221 @@
+package source_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
+
+	"gohole/internal/blocklist"
+	"gohole/internal/database"
+	mockdb "gohole/internal/mock/database"
+	"gohole/internal/source"
+)
+
+// fakeStatus reports fixed blocklist file URLs and load results.
+type fakeStatus struct {
+	fileURLs []string
+	results  map[string]blocklist.Result
+}
+
+func (f *fakeStatus) FileURLs() ([]string, error) {
+	return f.fileURLs, nil
+}
+
+func (f *fakeStatus) Result(url string) (blocklist.Result, bool) {
+	res, ok := f.results[url]
+	return res, ok
+}
+
+func newService(t *testing.T) (source.Service, *mockdb.MockSourceRepository, *fakeStatus, *int) {
+	t.Helper()
+	ctrl := gomock.NewController(t)
+	repo := mockdb.NewMockSourceRepository(ctrl)
+	status := &fakeStatus{results: map[string]blocklist.Result{}}
+	changes := 0
+	svc := source.NewService(repo, status, func() { changes++ })
+	return svc, repo, status, &changes
+}
+
+// ---- GetAll ----
+
+func TestGetAll_OK(t *testing.T) {
+	svc, repo, status, _ := newService(t)
+
+	fetchedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	status.fileURLs = []string{"https://example.com/lists/ads.txt"}
+	status.results["https://example.com/lists/ads.txt"] = blocklist.Result{
+		Domains:   10,
+		Rules:     2,
+		FetchedAt: fetchedAt,
+	}
+	status.results["https://other.com/list"] = blocklist.Result{Err: errors.New("status code 404")}
+
+	repo.EXPECT().FindAllSources(gomock.Any()).Return([]database.BlocklistSource{
+		{ID: "a", Name: "Other", URL: "https://other.com/list", Enabled: true},
+		{ID: "b", Name: "Off", URL: "https://off.com/list", Enabled: false},
+	}, nil)
+
+	sources, err := svc.GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sources) != 3 {
+		t.Fatalf("expected 3 sources, got %d", len(sources))
+	}
+
+	file := sources[0]
+	if file.Origin != source.OriginFile || file.ID != "" || file.Name != "example.com ads.txt" {
+		t.Errorf("unexpected file source: %+v", file)
+	}
+	if file.Domains != 12 || file.LastRefresh == nil || !file.LastRefresh.Equal(fetchedAt) {
+		t.Errorf("unexpected file source status: %+v", file)
+	}
+
+	if sources[1].Origin != source.OriginAPI || sources[1].LastError != "status code 404" {
+		t.Errorf("unexpected API source: %+v", sources[1])
+	}
+	if sources[2].Enabled || sources[2].LastRefresh != nil {
+		t.Errorf("unexpected disabled source: %+v", sources[2])
+	}
+}
+
+func TestGetAll_Error(t *testing.T) {
+	svc, repo, _, _ := newService(t)
+	repo.EXPECT().FindAllSources(gomock.Any()).Return(nil, errors.New("db error"))
+
+	if _, err := svc.GetAll(context.Background()); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+// ---- Add ----
+
+func TestAdd_OK(t *testing.T) {
+	svc, repo, _, changes := newService(t)
+
+	repo.EXPECT().FindAllSources(gomock.Any()).Return(nil, nil)
+	repo.EXPECT().
+		SaveSource(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, s database.BlocklistSource) error {
+			if s.ID == "" || s.URL != "https://example.com/ads.txt" || !s.Enabled {
+				t.Errorf("unexpected saved source: %+v", s)
+			}
+			return nil
+		})
+
+	s, err := svc.Add(context.Background(), "", " https://example.com/ads.txt ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Name != "example.com ads.txt" || s.Origin != source.OriginAPI {
+		t.Errorf("unexpected source: %+v", s)
+	}
+	if *changes != 1 {
+		t.Errorf("expected a refresh to be triggered, got %d", *changes)
+	}
+}
+
+func TestAdd_InvalidURL(t *testing.T) {
+	svc, _, _, changes := newService(t)
+
+	for _, u := range []string{"", "example.com/list", "ftp://example.com/list", "https://"} {
+		if _, err := svc.Add(context.Background(), "x", u); !errors.Is(err, source.ErrInvalidURL) {
+			t.Errorf("expected ErrInvalidURL for '%s', got %v", u, err)
+		}
+	}
+	if *changes != 0 {
+		t.Errorf("expected no refresh, got %d", *changes)
+	}
+}
+
+func TestAdd_Duplicate(t *testing.T) {
+	svc, repo, status, _ := newService(t)
+	status.fileURLs = []string{"https://example.com/ads.txt"}
+	repo.EXPECT().FindAllSources(gomock.Any()).Return(nil, nil)
+
+	_, err := svc.Add(context.Background(), "x", "https://example.com/ads.txt")
+	if !errors.Is(err, source.ErrDuplicate) {
+		t.Errorf("expected ErrDuplicate, got %v", err)
+	}
+}
+
+// ---- Remove ----
+
+func TestRemove_OK(t *testing.T) {
+	svc, repo, _, changes := newService(t)
+	repo.EXPECT().
+		FindAllSources(gomock.Any()).
+		Return([]database.BlocklistSource{{ID: "a"}}, nil)
+	repo.EXPECT().DeleteSource(gomock.Any(), "a").Return(nil)
+
+	if err := svc.Remove(context.Background(), "a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *changes != 1 {
+		t.Errorf("expected a refresh to be triggered, got %d", *changes)
+	}
+}
+
+func TestRemove_NotFound(t *testing.T) {
+	svc, repo, _, _ := newService(t)
+	repo.EXPECT().FindAllSources(gomock.Any()).Return(nil, nil)
+
+	if err := svc.Remove(context.Background(), "a"); !errors.Is(err, source.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// ---- SetEnabled ----
+
+func TestSetEnabled_OK(t *testing.T) {
+	svc, repo, _, changes := newService(t)
+	repo.EXPECT().
+		FindAllSources(gomock.Any()).
+		Return([]database.BlocklistSource{{ID: "a", Enabled: true}}, nil)
+	repo.EXPECT().
+		SaveSource(gomock.Any(), database.BlocklistSource{ID: "a", Enabled: false}).
+		Return(nil)
+
+	s, err := svc.SetEnabled(context.Background(), "a", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Enabled || *changes != 1 {
+		t.Errorf("expected the source to be disabled, got %+v (%d changes)", s, *changes)
+	}
+}
+
+func TestSetEnabled_Unchanged(t *testing.T) {
+	svc, repo, _, changes := newService(t)
+	repo.EXPECT().
+		FindAllSources(gomock.Any()).
+		Return([]database.BlocklistSource{{ID: "a", Enabled: true}}, nil)
+
+	if _, err := svc.SetEnabled(context.Background(), "a", true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *changes != 0 {
+		t.Errorf("expected no refresh, got %d", *changes)
+	}
+}
+
+// ---- EnabledURLs ----
+
+func TestEnabledURLs(t *testing.T) {
+	_, repo, _, _ := newService(t)
+	repo.EXPECT().FindAllSources(gomock.Any()).Return([]database.BlocklistSource{
+		{ID: "a", URL: "https://a.com", Enabled: true},
+		{ID: "b", URL: "https://b.com", Enabled: false},
+	}, nil)
+
+	urls, err := source.EnabledURLs(repo)(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(urls) != 1 || urls[0] != "https://a.com" {
+		t.Errorf("unexpected URLs: %v", urls)
+	}
+}